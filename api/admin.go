@@ -0,0 +1,245 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/retention"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+type retentionOverrideRequest struct {
+	RetentionDays *int `json:"retention_days"`
+}
+
+// GetRetentionPoliciesHandler returns a handler listing each game's retention
+// @Summary      List score retention per game
+// @Description  Returns the effective retention period of every game and whether it comes from a per-game override or the global default
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}   retention.Policy
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /api/v1/admin/retention [get]
+func GetRetentionPoliciesHandler(job *retention.Job) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := job.Policies()
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, policies)
+	}
+}
+
+// RunRetentionHandler returns a handler that applies the retention policies
+// @Summary      Apply score retention
+// @Description  Deletes score rows older than each game's retention period. With dryRun=true nothing is deleted and the per-game row counts that would be removed are returned.
+// @Tags         admin
+// @Produce      json
+// @Param        dryRun  query     bool  false  "Only count the rows that would be deleted"
+// @Success      200     {array}   retention.Result
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/retention/run [post]
+func RunRetentionHandler(job *retention.Job) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := c.Query("dryRun") == "true"
+
+		results, err := job.Run(dryRun)
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// SetRetentionOverrideHandler returns a handler that sets a game's retention
+// @Summary      Set a game's score retention
+// @Description  Overrides the retention period for one game. A null retention_days removes the override and the game uses the global default again. 0 keeps scores forever.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Param        body    body      retentionOverrideRequest  true  "Retention in days"
+// @Success      204
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/retention/{gameId} [put]
+func SetRetentionOverrideHandler(job *retention.Job) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+
+		var request retentionOverrideRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid retention data", nil)
+			return
+		}
+		if request.RetentionDays != nil && *request.RetentionDays < 0 {
+			invalidParameter(c, "retention_days", "Invalid retention days")
+			return
+		}
+
+		if err := job.SetOverride(gameID, request.RetentionDays); err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// CompactStoreHandler returns a handler that compacts the in-memory store
+// @Summary      Compact the in-memory store
+// @Description  Removes expired window entries and empty games, optionally forces a GC that returns memory to the OS, and reports resident games, entries per window, estimated bytes and heap statistics before and after
+// @Tags         admin
+// @Produce      json
+// @Param        gc  query     bool  false  "Force a GC and release memory to the OS" default(true)
+// @Success      200  {object}  models.CompactionReport
+// @Router       /api/v1/admin/store/compact [post]
+func CompactStoreHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		releaseMemory := c.DefaultQuery("gc", "true") == "true"
+		c.JSON(http.StatusOK, store.Compact(releaseMemory))
+	}
+}
+
+// ResetGameHandler returns a handler that clears a game's leaderboard
+// @Summary      Reset a game's leaderboard
+// @Description  Clears every window of the game's board, on this instance and, through Kafka, on the others. Cached responses for the old board are never served again. With purgeDb=true the game's scores are also deleted from Postgres; otherwise they are kept there and come back if the board is rebuilt from Postgres without a snapshot.
+// @Tags         admin
+// @Produce      json
+// @Param        gameId   path      int   true   "Game ID"
+// @Param        purgeDb  query     bool  false  "Also delete the game's scores from Postgres"
+// @Success      200      {object}  models.ResetGameResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /api/v1/admin/leaderboard/{gameId} [delete]
+func ResetGameHandler(store *store.Store, producer *mq.KafkaProducer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+		purge := c.Query("purgeDb") == "true"
+
+		players, deleted, err := store.ResetGame(gameID, purge)
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Failed to reset game", "game", gameID, "error", err)
+			internalError(c, "Failed to reset game")
+			return
+		}
+
+		if producer != nil {
+			if err := producer.SendGameReset(c.Request.Context(), gameID); err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to publish game reset", "game", gameID, "error", err)
+				internalError(c, "Failed to publish game reset")
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, models.ResetGameResponse{
+			GameID:         gameID,
+			PlayersRemoved: players,
+			Purged:         purge,
+			RowsDeleted:    deleted,
+		})
+	}
+}
+
+// RunDoctorHandler returns a handler that checks a game's board for inconsistencies
+// @Summary      Diagnose a game's board
+// @Description  Runs every consistency check against the game: skiplist structure, window nesting, a sample of best scores against Postgres, consumer lag, cached top lists and board version. Each check passes, fails with a suggested remediation, or is skipped when its component is not configured. The response is 200 either way; healthy is false when any check failed.
+// @Tags         admin
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Success      200     {object}  doctor.Report
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/doctor/{gameId} [post]
+func RunDoctorHandler(doctor *doctor.Doctor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, doctor.Run(gameID))
+	}
+}
+
+// GetExcludedAccountsHandler returns a handler listing a game's excluded accounts
+// @Summary      List a game's excluded accounts
+// @Description  Returns the accounts, such as launch seed accounts, that are left out of the game's top lists, ranks, percentiles and player totals
+// @Tags         admin
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Success      200     {object}  models.ExcludedAccountsResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/games/{gameId}/excluded [get]
+func GetExcludedAccountsHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ExcludedAccountsResponse{
+			GameID:  gameID,
+			UserIDs: store.ExcludedAccounts(gameID),
+		})
+	}
+}
+
+// SetExcludedAccountHandler returns a handler that adds or removes an excluded account
+// @Summary      Exclude or re-include an account
+// @Description  PUT leaves the account out of the game's rankings; it keeps its scores and still sees its own rank. DELETE includes it again.
+// @Tags         admin
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Param        userId  path      int  true  "User ID"
+// @Success      204
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/games/{gameId}/excluded/{userId} [put]
+// @Router       /api/v1/admin/games/{gameId}/excluded/{userId} [delete]
+func SetExcludedAccountHandler(store *store.Store, excluded bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil || userID <= 0 {
+			invalidUserID(c)
+			return
+		}
+
+		if err := store.SetExcluded(gameID, userID, excluded); err != nil {
+			if isGameNotFound(err) {
+				gameNotFound(c, gameID)
+				return
+			}
+			internalError(c, err.Error())
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
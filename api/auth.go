@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the client's API key.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyIDKey is where the ID of the request's API key is kept, both in the
+// gin context and in the request's context.
+const apiKeyIDKey = "api_key_id"
+
+type apiKeyIDContextKey struct{}
+
+// APIKeyID returns the ID of the API key a request was authenticated with,
+// or "" when it was not.
+func APIKeyID(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyIDContextKey{}).(string)
+	return id
+}
+
+// APIKeyMiddleware rejects requests without a valid X-API-Key header with a
+// 401. It records the key's ID for logging, and lets requests already
+// authenticated by an earlier middleware through. Nil keys let every request
+// through.
+func APIKeyMiddleware(keys *auth.Keys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if keys == nil || c.GetString(apiKeyIDKey) != "" {
+			return
+		}
+
+		key := c.GetHeader(APIKeyHeader)
+		if key == "" {
+			abortWithError(c, http.StatusUnauthorized, CodeMissingAPIKey, "Missing API key")
+			return
+		}
+		id, ok := keys.Lookup(key)
+		if !ok {
+			abortWithError(c, http.StatusUnauthorized, CodeInvalidAPIKey, "Invalid API key")
+			return
+		}
+
+		c.Set(apiKeyIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), apiKeyIDContextKey{}, id))
+	}
+}
+
+// AccessLogFormatter formats access log lines like gin's default logger,
+// followed by the request ID and the ID of the request's API key when it had
+// one.
+func AccessLogFormatter(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	line := fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+	)
+	if id, ok := param.Keys[requestIDKey].(string); ok {
+		line += " | request=" + id
+	}
+	if id, ok := param.Keys[apiKeyIDKey].(string); ok {
+		line += " | key=" + id
+	}
+	if param.ErrorMessage != "" {
+		line += "\n" + param.ErrorMessage
+	}
+	return line + "\n"
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-contrib/cache/persistence"
+)
+
+// responseCacheTTL is only a backstop: cache keys include the board version,
+// so any write to a game makes its older entries unreachable immediately.
+const responseCacheTTL = 5 * time.Second
+
+func topLeadersKey(gameID int64, window models.TimeWindow, mode models.RankMode, limit, offset int, version uint64) string {
+	return fmt.Sprintf("top:%d:%s:%s:%d:%d:%d", gameID, window.Display, mode, limit, offset, version)
+}
+
+// cachedTopLeaders returns the shared part of a top leaders response, which is
+// identical for every caller and therefore safe to cache. Per-user fields such
+// as Me must be filled in on the returned copy by the caller.
+func cachedTopLeaders(store *store.Store, responseCacheStore *persistence.InMemoryStore, gameID int64, limit, offset int, window models.TimeWindow, mode models.RankMode) models.TopLeadersResponse {
+	key := topLeadersKey(gameID, window, mode, limit, offset, store.BoardVersion(gameID))
+
+	var response models.TopLeadersResponse
+	if err := responseCacheStore.Get(key, &response); err == nil {
+		return response
+	}
+
+	response = models.TopLeadersResponse{
+		GameID:       gameID,
+		Leaders:      store.GetRankedTopLeaders(gameID, limit, offset, window, mode),
+		Offset:       offset,
+		TotalPlayers: store.WindowPlayers(gameID, window),
+		Window:       window.Display,
+	}
+	responseCacheStore.Set(key, response, responseCacheTTL)
+
+	return response
+}
+
+// cachedPlayerRank returns the rank response for a player, with up to
+// neighbors players on each side, or false if the player has no score in the
+// window. Misses are not cached.
+func cachedPlayerRank(store *store.Store, responseCacheStore *persistence.InMemoryStore, gameID, userID int64, window models.TimeWindow, mode models.RankMode, neighbors int) (models.PlayerRankResponse, bool) {
+	key := fmt.Sprintf("rank:%d:%d:%s:%s:%d:%d", gameID, userID, window.Display, mode, neighbors, store.BoardVersion(gameID))
+
+	var response models.PlayerRankResponse
+	if err := responseCacheStore.Get(key, &response); err == nil {
+		return response, true
+	}
+
+	rank, above, below := store.GetRankedPlayerWithNeighbors(gameID, userID, neighbors, window, mode)
+	if !rank.Found {
+		return response, false
+	}
+
+	response = models.PlayerRankResponse{
+		GameID:       gameID,
+		UserID:       userID,
+		Score:        rank.Score,
+		Rank:         rank.Rank,
+		TiedWith:     rank.TiedWith,
+		Percentile:   rank.Percentile,
+		TotalPlayers: rank.Total,
+		Window:       window.Display,
+		Above:        above,
+		Below:        below,
+	}
+	responseCacheStore.Set(key, response, responseCacheTTL)
+
+	return response, true
+}
+
+// cachedAroundPlayer returns the player's neighborhood on the board, or false
+// if the player has no score in the window. Misses are not cached.
+func cachedAroundPlayer(store *store.Store, responseCacheStore *persistence.InMemoryStore, gameID, userID int64, count int, window models.TimeWindow) (models.AroundPlayerResponse, bool) {
+	key := fmt.Sprintf("around:%d:%d:%s:%d:%d", gameID, userID, window.Display, count, store.BoardVersion(gameID))
+
+	var response models.AroundPlayerResponse
+	if err := responseCacheStore.Get(key, &response); err == nil {
+		return response, true
+	}
+
+	entries, exists := store.GetPlayerNeighbors(gameID, userID, count, window)
+	if !exists {
+		return response, false
+	}
+
+	response = models.AroundPlayerResponse{
+		GameID:       gameID,
+		UserID:       userID,
+		Entries:      entries,
+		TotalPlayers: store.WindowPlayers(gameID, window),
+		Window:       window.Display,
+	}
+	responseCacheStore.Set(key, response, responseCacheTTL)
+
+	return response, true
+}
+
+func cachedScoreThreshold(store *store.Store, responseCacheStore *persistence.InMemoryStore, gameID int64, rank int, window models.TimeWindow) models.ScoreThresholdResponse {
+	key := fmt.Sprintf("threshold:%d:%s:%d:%d", gameID, window.Display, rank, store.BoardVersion(gameID))
+
+	var response models.ScoreThresholdResponse
+	if err := responseCacheStore.Get(key, &response); err == nil {
+		return response
+	}
+
+	threshold, ties, players, _ := store.GetScoreThreshold(gameID, rank, window)
+	response = models.ScoreThresholdResponse{
+		GameID:    gameID,
+		Rank:      rank,
+		Threshold: threshold,
+		Ties:      ties,
+		Players:   players,
+		Window:    window.Display,
+	}
+	responseCacheStore.Set(key, response, responseCacheTTL)
+
+	return response
+}
+
+// CacheCheck returns a doctor check comparing the cached first page of each
+// window's top list, at the board's current version, with the board itself.
+// Pages that are not cached are not checked.
+func CacheCheck(store *store.Store, responseCacheStore *persistence.InMemoryStore) doctor.Check {
+	const limit = 10
+
+	return doctor.Check{
+		Name:        "response_cache",
+		Remediation: "The board changed without its version being bumped. Cached responses expire within " + responseCacheTTL.String() + "; if this persists, rebuild the board.",
+		Run: func(gameID int64) (string, error) {
+			version := store.BoardVersion(gameID)
+
+			checked := 0
+			for _, window := range models.AllTimeWindows() {
+				var cached models.TopLeadersResponse
+				if err := responseCacheStore.Get(topLeadersKey(gameID, window, models.RankOrdinal, limit, 0, version), &cached); err != nil {
+					continue
+				}
+				leaders := store.GetTopLeaders(gameID, limit, 0, window)
+				if store.BoardVersion(gameID) != version {
+					// Changed while checking, the entry is simply out of date.
+					return "", doctor.Skip("board changed during the check")
+				}
+				if !reflect.DeepEqual(cached.Leaders, leaders) {
+					return "", fmt.Errorf("cached %s top %d at version %d differs from the board", window.Display, limit, version)
+				}
+				checked++
+			}
+
+			return fmt.Sprintf("%d cached top lists match the board", checked), nil
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/IWhitebird/go-leader-board/internal/auth"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureDebugRoutes serves the pprof profiles under /debug/pprof and the
+// store report on /debug/store. They are not cached, and need an API key when
+// keys are given.
+func ConfigureDebugRoutes(r *gin.Engine, store *store.Store, keys *auth.Keys) {
+	debug := r.Group("/debug", APIKeyMiddleware(keys))
+
+	debug.GET("/store", DebugStoreHandler(store))
+
+	profiles := debug.Group("/pprof")
+	profiles.GET("/", gin.WrapF(pprof.Index))
+	profiles.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	profiles.GET("/profile", gin.WrapF(pprof.Profile))
+	profiles.GET("/symbol", gin.WrapF(pprof.Symbol))
+	profiles.POST("/symbol", gin.WrapF(pprof.Symbol))
+	profiles.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		profiles.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
+
+// DebugStoreHandler returns a handler that reports what the store is holding
+// @Summary      Report the in-memory store's size
+// @Description  Counts the resident games and their entries per window with an estimate of their memory, totalled and per game with the largest first, along with the Go heap statistics. Only served when debug endpoints are enabled.
+// @Tags         debug
+// @Produce      json
+// @Success      200  {object}  models.DebugStoreReport
+// @Failure      401  {object}  models.ErrorResponse
+// @Router       /debug/store [get]
+func DebugStoreHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.DebugStoreReport{
+			Totals: store.Report(),
+			Games:  store.GameReports(),
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Error codes, stable for clients to branch on.
+const (
+	CodeInvalidGameID         = "INVALID_GAME_ID"
+	CodeInvalidUserID         = "INVALID_USER_ID"
+	CodeInvalidParameter      = "INVALID_PARAMETER" // details: parameter
+	CodeInvalidWindow         = "INVALID_WINDOW"
+	CodeInvalidBody           = "INVALID_BODY"
+	CodeInvalidScore          = "INVALID_SCORE" // details: fields
+	CodePlayerNotFound        = "PLAYER_NOT_FOUND"
+	CodeNoHistory             = "NO_HISTORY"      // details: nearest
+	CodeGameNotFound          = "GAME_NOT_FOUND"  // details: game_id
+	CodeScoringChanged        = "SCORING_CHANGED" // details: game_id
+	CodeNotCumulative         = "NOT_CUMULATIVE"  // details: game_id
+	CodeSeasonNotFound        = "SEASON_NOT_FOUND"
+	CodeSeasonOverlap         = "SEASON_OVERLAP"
+	CodeMissingAPIKey         = "MISSING_API_KEY"
+	CodeInvalidAPIKey         = "INVALID_API_KEY"
+	CodeRateLimited           = "RATE_LIMITED"
+	CodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeQueueFull             = "QUEUE_FULL"
+	CodeUnavailable           = "UNAVAILABLE"
+	CodeInternal              = "INTERNAL"
+)
+
+// RequestIDHeader carries the request's ID, taken from the client when it
+// sends one and generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+// newAPIError builds an error for the request, tagged with its ID.
+func newAPIError(c *gin.Context, code, message string, details any) models.ErrorResponse {
+	return models.ErrorResponse{Error: models.APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(requestIDKey),
+	}}
+}
+
+// respondError writes an error response. details may be nil.
+func respondError(c *gin.Context, status int, code, message string, details any) {
+	c.JSON(status, newAPIError(c, code, message, details))
+}
+
+// abortWithError writes an error response and stops the handler chain, for
+// middleware.
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, newAPIError(c, code, message, nil))
+}
+
+func invalidGameID(c *gin.Context) {
+	respondError(c, http.StatusBadRequest, CodeInvalidGameID, "Invalid game ID", nil)
+}
+
+func invalidUserID(c *gin.Context) {
+	respondError(c, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID", nil)
+}
+
+func invalidParameter(c *gin.Context, parameter, message string) {
+	respondError(c, http.StatusBadRequest, CodeInvalidParameter, message, gin.H{"parameter": parameter})
+}
+
+func invalidWindow(c *gin.Context, err error) {
+	respondError(c, http.StatusBadRequest, CodeInvalidWindow, err.Error(), gin.H{"parameter": "window"})
+}
+
+func playerNotFound(c *gin.Context, gameID, userID int64, window models.TimeWindow) {
+	respondError(c, http.StatusNotFound, CodePlayerNotFound, "Player not found", gin.H{
+		"game_id": gameID,
+		"user_id": userID,
+		"window":  window.Display,
+	})
+}
+
+func gameNotFound(c *gin.Context, gameID int64) {
+	respondError(c, http.StatusNotFound, CodeGameNotFound, "Game not found", gin.H{"game_id": gameID})
+}
+
+func seasonNotFound(c *gin.Context, gameID int64, season string) {
+	respondError(c, http.StatusNotFound, CodeSeasonNotFound, "Season not found", gin.H{
+		"game_id": gameID,
+		"season":  season,
+	})
+}
+
+func internalError(c *gin.Context, message string) {
+	respondError(c, http.StatusInternalServerError, CodeInternal, message, nil)
+}
+
+// invalidScore reports the fields of a submission that were invalid.
+func invalidScore(c *gin.Context, fields []models.FieldError) {
+	respondError(c, http.StatusBadRequest, CodeInvalidScore, "Invalid score data", gin.H{"fields": fields})
+}
+
+// scoreFieldErrors finds the fields of a submission that could not be
+// decoded, from the raw JSON body, form or query it arrived in. It returns
+// none when the body is not even well formed.
+func scoreFieldErrors(c *gin.Context, fromQuery bool) []models.FieldError {
+	values := make(map[string]string)
+	switch {
+	case fromQuery:
+		for _, field := range scoreFields {
+			if value, ok := c.GetQuery(field.name); ok {
+				values[field.name] = value
+			}
+		}
+	case c.ContentType() == binding.MIMEPOSTForm:
+		for _, field := range scoreFields {
+			if value, ok := c.GetPostForm(field.name); ok {
+				values[field.name] = value
+			}
+		}
+	default:
+		// The body was read by binding it with ShouldBindBodyWith
+		body, ok := c.Get(gin.BodyBytesKey)
+		if !ok {
+			return nil
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(body.([]byte), &raw); err != nil {
+			return nil
+		}
+		for _, field := range scoreFields {
+			value, ok := raw[field.name]
+			if !ok || string(value) == "null" {
+				continue
+			}
+			var s string
+			if json.Unmarshal(value, &s) == nil {
+				// Only the timestamp may be a JSON string
+				if field.name != "timestamp" {
+					s = "\x00"
+				}
+			} else {
+				s = string(value)
+			}
+			values[field.name] = s
+		}
+	}
+
+	var fields []models.FieldError
+	for _, field := range scoreFields {
+		if value, ok := values[field.name]; ok && !field.valid(value) {
+			fields = append(fields, models.FieldError{Field: field.name, Reason: field.reason})
+		}
+	}
+	return fields
+}
+
+var scoreFields = []struct {
+	name   string
+	reason string
+	valid  func(string) bool
+}{
+	{"game_id", "must be a positive integer", positiveInt},
+	{"user_id", "must be a positive integer", positiveInt},
+	{"score", "must be a non-negative integer", func(v string) bool {
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	}},
+	{"timestamp", "must be an RFC 3339 time", func(v string) bool {
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	}},
+}
+
+func positiveInt(v string) bool {
+	n, err := strconv.ParseInt(v, 10, 64)
+	return err == nil && n > 0
+}
+
+// RequestIDMiddleware keeps the client's X-Request-ID, or makes up a UUID,
+// and echoes it on the response. The ID also goes into the request's context,
+// so handlers log it with logging.InfoContext and logging.ErrorContext and
+// the Kafka producer stamps it on the scores it publishes.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+	}
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// RecoveryMiddleware responds to a panic in a handler with an INTERNAL error
+// carrying the request ID, so a failure reported by a client can be found in
+// the logs. It replaces gin.Recovery, after RequestIDMiddleware.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				logging.ErrorContext(c.Request.Context(), "Panic handling request", "path", c.Request.URL.Path, "panic", recovered, "stack", string(debug.Stack()))
+				if !c.Writer.Written() {
+					abortWithError(c, http.StatusInternalServerError, CodeInternal, "Internal error")
+				} else {
+					c.Abort()
+				}
+			}
+		}()
+		c.Next()
+	}
+}
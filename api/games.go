@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+const maxGameNameLength = 64
+
+type gameRequest struct {
+	GameID        int64   `json:"game_id" binding:"required"`
+	Name          string  `json:"name" binding:"required"`
+	SortOrder     string  `json:"sort_order"`
+	Scoring       string  `json:"scoring"`
+	MinScore      *uint64 `json:"min_score"`
+	MaxScore      *uint64 `json:"max_score"`
+	RetentionDays *int    `json:"retention_days"`
+}
+
+// RegisterGameHandler returns a handler that registers a game
+// @Summary      Register a game
+// @Description  Registers a game with its settings, or replaces the settings of a registered game. Scores outside min_score and max_score are rejected, and retention_days overrides the global retention period, null meaning the default. Only desc boards, highest score first, are supported. scoring is best, keeping each player's best submission, or cumulative, adding every submission to their total; it can only change while the game has no scores. With REQUIRE_REGISTERED_GAMES=true scores for unregistered games are rejected with GAME_NOT_FOUND.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        body  body      gameRequest  true  "Game settings"
+// @Success      200   {object}  models.Game  "Settings replaced"
+// @Success      201   {object}  models.Game  "Game registered"
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      409   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /api/v1/admin/games [post]
+func RegisterGameHandler(leaderboardStore *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request gameRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid game data", nil)
+			return
+		}
+		if request.GameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+		if utf8.RuneCountInString(request.Name) > maxGameNameLength {
+			invalidParameter(c, "name", "Name must be 1 to 64 characters")
+			return
+		}
+		if request.SortOrder == "" {
+			request.SortOrder = string(models.SortDescending)
+		}
+		if models.SortOrder(request.SortOrder) != models.SortDescending {
+			invalidParameter(c, "sort_order", "Only desc is supported, boards rank the highest score first")
+			return
+		}
+		if request.Scoring == "" {
+			request.Scoring = string(models.ScoringBest)
+		}
+		if scoring := models.ScoringMode(request.Scoring); scoring != models.ScoringBest && scoring != models.ScoringCumulative {
+			invalidParameter(c, "scoring", "Invalid scoring, expected best or cumulative")
+			return
+		}
+		for param, bound := range map[string]*uint64{"min_score": request.MinScore, "max_score": request.MaxScore} {
+			if bound != nil && *bound > math.MaxInt64 {
+				invalidParameter(c, param, "Score bounds must fit in a signed 64-bit integer")
+				return
+			}
+		}
+		if request.MinScore != nil && request.MaxScore != nil && *request.MinScore > *request.MaxScore {
+			invalidParameter(c, "max_score", "max_score must be at least min_score")
+			return
+		}
+		if request.RetentionDays != nil && *request.RetentionDays < 0 {
+			invalidParameter(c, "retention_days", "Invalid retention days")
+			return
+		}
+
+		game, created, err := leaderboardStore.RegisterGame(models.Game{
+			GameID:        request.GameID,
+			Name:          request.Name,
+			SortOrder:     models.SortOrder(request.SortOrder),
+			Scoring:       models.ScoringMode(request.Scoring),
+			MinScore:      request.MinScore,
+			MaxScore:      request.MaxScore,
+			RetentionDays: request.RetentionDays,
+		})
+		if errors.Is(err, store.ErrScoringChanged) {
+			respondError(c, http.StatusConflict, CodeScoringChanged, "The game already has scores, so its scoring cannot change", gin.H{"game_id": request.GameID})
+			return
+		}
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		c.JSON(status, game)
+	}
+}
+
+// GetRegisteredGamesHandler returns a handler listing the registered games
+// @Summary      List registered games
+// @Description  Returns the registered games and their settings, ordered by game ID
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}  models.Game
+// @Router       /api/v1/admin/games [get]
+func GetRegisteredGamesHandler(leaderboardStore *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, leaderboardStore.RegisteredGames())
+	}
+}
+
+func isGameNotFound(err error) bool {
+	return errors.Is(err, store.ErrGameNotFound)
+}
+
+// checkGameFailed builds the response to a score turned away by
+// store.CheckGame.
+func checkGameFailed(c *gin.Context, gameID int64, err error) (int, any) {
+	switch {
+	case errors.Is(err, store.ErrGameNotFound):
+		return http.StatusNotFound, newAPIError(c, CodeGameNotFound, "Game not found", gin.H{"game_id": gameID})
+	case errors.Is(err, store.ErrScoreOutOfRange):
+		fields := []models.FieldError{{Field: "score", Reason: "must be within the game's score range"}}
+		return http.StatusBadRequest, newAPIError(c, CodeInvalidScore, "Invalid score data", gin.H{"fields": fields})
+	default:
+		return http.StatusInternalServerError, newAPIError(c, CodeInternal, "Failed to check game", nil)
+	}
+}
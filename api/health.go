@@ -15,7 +15,7 @@ import (
 // @Accept       json
 // @Produce      json
 // @Success      200  {object}  models.HealthResponse
-// @Router       /api/health [get]
+// @Router       /api/v1/health [get]
 func HealthHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		response := models.HealthResponse{
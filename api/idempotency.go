@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/idempotency"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/receipt"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a submission.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the keys kept in memory and in Postgres.
+const maxIdempotencyKeyLength = 255
+
+// submitScoreOnce submits a score at most once per idempotency key and
+// player. A retry with the key gets the first response back, and one arriving
+// while the first is still being handled waits for it.
+func submitScoreOnce(c *gin.Context, dedupe *idempotency.Store, clientKey string, store *store.Store, receipts *receipt.Signer, score models.Score, producer *mq.KafkaProducer, scoreTimes *scoretime.Policy) {
+	if len(clientKey) > maxIdempotencyKeyLength {
+		respondError(c, http.StatusBadRequest, CodeInvalidIdempotencyKey, "Invalid idempotency key", nil)
+		return
+	}
+
+	key := idempotency.Key(score.GameID, score.UserID, clientKey)
+	fingerprint := fmt.Sprintf("%d@%s", score.Score, score.Timestamp.UTC().Format(time.RFC3339Nano))
+
+	previous, err := dedupe.Begin(c.Request.Context(), key)
+	if err != nil {
+		// The client went away while an earlier request was running.
+		respondError(c, http.StatusServiceUnavailable, CodeUnavailable, "Gave up waiting for an earlier request with the idempotency key", nil)
+		return
+	}
+	if previous != nil {
+		if previous.Fingerprint != fingerprint {
+			respondError(c, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "Idempotency key was already used for a different score", nil)
+			return
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		if len(previous.Body) == 0 {
+			c.Status(previous.Status)
+			return
+		}
+		c.Data(previous.Status, "application/json; charset=utf-8", previous.Body)
+		return
+	}
+
+	status, response := processScore(c, store, receipts, score, producer, scoreTimes)
+
+	var body []byte
+	if response != nil {
+		body, err = json.Marshal(response)
+	}
+	if err != nil || status >= http.StatusInternalServerError {
+		dedupe.Abort(key)
+	} else {
+		dedupe.Finish(key, models.IdempotentResponse{Fingerprint: fingerprint, Status: status, Body: body})
+	}
+
+	if response == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// IncrementScoreHandler returns a handler that adds to a player's total
+// @Summary      Increment a player's total
+// @Description  Adds delta to the player's total in a cumulative game and returns their new total and all-time rank. The increment is saved and applied before responding, and published to Kafka so the other instances apply it too. Games keeping best scores answer 409 with NOT_CUMULATIVE.
+// @Tags         leaderboard
+// @Accept       json
+// @Produce      json
+// @Param        body  body      models.IncrementScoreRequest  true  "Game, player and amount to add"
+// @Success      200   {object}  models.IncrementScoreResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      404   {object}  models.ErrorResponse
+// @Failure      409   {object}  models.ErrorResponse
+// @Failure      429   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/score/increment [post]
+func IncrementScoreHandler(leaderboardStore *store.Store, producer *mq.KafkaProducer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.IncrementScoreRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid increment data", nil)
+			return
+		}
+
+		var fields []models.FieldError
+		if request.GameID <= 0 {
+			fields = append(fields, models.FieldError{Field: "game_id", Reason: "must be a positive integer"})
+		}
+		if request.UserID <= 0 {
+			fields = append(fields, models.FieldError{Field: "user_id", Reason: "must be a positive integer"})
+		}
+		if request.Delta == 0 {
+			fields = append(fields, models.FieldError{Field: "delta", Reason: "must be a positive integer"})
+		}
+		if len(fields) > 0 {
+			invalidScore(c, fields)
+			return
+		}
+
+		now := time.Now().UTC()
+		score := models.Score{GameID: request.GameID, UserID: request.UserID, Score: request.Delta, Timestamp: now, ReceivedAt: now}
+		rank, err := leaderboardStore.IncrementScore(score)
+		switch {
+		case errors.Is(err, store.ErrNotCumulative):
+			respondError(c, http.StatusConflict, CodeNotCumulative, "The game keeps best scores, so its scores cannot be incremented", gin.H{"game_id": request.GameID})
+			return
+		case errors.Is(err, store.ErrGameNotFound), errors.Is(err, store.ErrScoreOutOfRange):
+			status, body := checkGameFailed(c, request.GameID, err)
+			c.JSON(status, body)
+			return
+		case err != nil:
+			logging.ErrorContext(c.Request.Context(), "Failed to increment score", "game", request.GameID, "user", request.UserID, "error", err)
+			internalError(c, "Failed to increment score")
+			return
+		}
+
+		// The increment is already saved and applied here; failing the request
+		// would only have the client add it a second time.
+		if producer != nil {
+			if err := producer.SendIncrement(c.Request.Context(), score); err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to publish score increment", "game", request.GameID, "user", request.UserID, "error", err)
+			}
+		}
+
+		c.JSON(http.StatusOK, models.IncrementScoreResponse{
+			GameID:       request.GameID,
+			UserID:       request.UserID,
+			Score:        rank.Score,
+			Rank:         rank.Rank,
+			Percentile:   rank.Percentile,
+			TotalPlayers: rank.Total,
+		})
+	}
+}
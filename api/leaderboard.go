@@ -1,68 +1,386 @@
 package api
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/internal/db"
+	"github.com/IWhitebird/go-leader-board/internal/idempotency"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
 	"github.com/IWhitebird/go-leader-board/internal/models"
 	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/receipt"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
 	"github.com/IWhitebird/go-leader-board/internal/store"
-	responseCache "github.com/gin-contrib/cache"
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// maxGamesLimit bounds the page size of the games endpoint.
+const maxGamesLimit = 1000
+
+// GetGamesHandler returns a handler for listing the known games
+// @Summary      List the known games
+// @Description  Returns the games loaded into memory together with, when Postgres is configured, the games that only have scores there. Player counts are only given for loaded games.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        limit   query     int  false  "Number of games to return" default(100)
+// @Param        offset  query     int  false  "Number of games to skip, for paging" default(0)
+// @Success      200     {object}  models.GamesResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/games [get]
+func GetGamesHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limitStr := c.DefaultQuery("limit", "100")
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxGamesLimit {
+			invalidParameter(c, "limit", "Invalid limit")
+			return
+		}
+
+		offsetStr := c.DefaultQuery("offset", "0")
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			invalidParameter(c, "offset", "Invalid offset")
+			return
+		}
+
+		games := store.Games()
+		if pgRepo != nil {
+			stored, err := pgRepo.GetAllGames()
+			if err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to list games", "error", err)
+				internalError(c, "Failed to list games")
+				return
+			}
+			games = mergeGames(games, stored, store.IsHidden)
+		}
+
+		page := games[min(offset, len(games)):min(offset+limit, len(games))]
+		c.JSON(http.StatusOK, models.GamesResponse{
+			Games:  page,
+			Offset: offset,
+			Total:  len(games),
+		})
+	}
+}
+
+// mergeGames adds the stored games that are neither loaded nor hidden to the
+// loaded ones, keeping the result ordered by game ID.
+func mergeGames(loaded []models.GameInfo, stored []int64, hidden func(gameID int64) bool) []models.GameInfo {
+	known := make(map[int64]bool, len(loaded))
+	for _, game := range loaded {
+		known[game.GameID] = true
+	}
+
+	games := loaded
+	for _, gameID := range stored {
+		if !known[gameID] && !hidden(gameID) {
+			games = append(games, models.GameInfo{GameID: gameID})
+		}
+	}
+	slices.SortFunc(games, func(a, b models.GameInfo) int { return cmp.Compare(a.GameID, b.GameID) })
+
+	return games
+}
+
+// TopLimits is the page size of the top leaders endpoint: Default when no
+// limit is given, and at most Max. Zero fields take the built-in defaults.
+type TopLimits struct {
+	Default int
+	Max     int
+}
+
+func (l TopLimits) withDefaults() TopLimits {
+	if l.Max <= 0 {
+		l.Max = 1000
+	}
+	if l.Default <= 0 {
+		l.Default = 10
+	}
+	l.Default = min(l.Default, l.Max)
+	return l
+}
+
 // GetTopLeadersHandler returns a handler for getting top leaders
 // @Summary      Get top leaders for a game
-// @Description  Returns the top scoring players for a specific game
+// @Description  Returns the top scoring players for a specific game. When userId is given the response also carries that player's own entry in "me".
 // @Tags         leaderboard
 // @Accept       json
 // @Produce      json
 // @Param        gameId  path      int  true  "Game ID"
-// @Param        limit   query     int  false  "Number of leaders to return" default(10)
-// @Param        window  query     string  false  "Time window (empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days)" Enums(24h,3d,7d)
+// @Param        limit   query     int  false  "Number of leaders to return, at most TOP_MAX_LIMIT (1000 unless configured)" default(10)
+// @Param        offset  query     int  false  "Number of leaders to skip, for paging" default(0)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Param        userId  query     int  false  "Viewing player to include as me"
+// @Param        submitted_before  query  string  false  "RFC 3339 time; rank only scores the server received before it, read from Postgres"
+// @Param        include  query    string  false  "profile to join each player's display name and avatar into their entry" Enums(profile)
+// @Param        season   query    string  false  "Season ID, or current for the game's current season"
+// @Param        rankMode  query   string  false  "How tied players are ranked: ordinal (1, 2, 3, earlier score first), competition (1, 1, 3) or dense (1, 1, 2)" Enums(ordinal,competition,dense)
 // @Success      200     {object}  models.TopLeadersResponse
-// @Failure      400     {object}  map[string]string
-// @Router       /api/leaderboard/top/{gameId} [get]
-func GetTopLeadersHandler(store *store.Store, responseCacheStore *persistence.InMemoryStore) gin.HandlerFunc {
-	return responseCache.CachePage(responseCacheStore, time.Second*5, func(c *gin.Context) {
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Failure      503     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/top/{gameId} [get]
+func GetTopLeadersHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface, responseCacheStore *persistence.InMemoryStore, limits TopLimits) gin.HandlerFunc {
+	limits = limits.withDefaults()
+
+	return func(c *gin.Context) {
 		gameIDStr := c.Param("gameId")
 		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game ID"})
+			invalidGameID(c)
 			return
 		}
 
-		limitStr := c.DefaultQuery("limit", "10")
+		// Every read path, in memory or from Postgres, is held to the same
+		// page size.
+		limitStr := c.DefaultQuery("limit", strconv.Itoa(limits.Default))
 		limit, err := strconv.Atoi(limitStr)
 		if err != nil || limit <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			invalidParameter(c, "limit", "Invalid limit")
+			return
+		}
+		if limit > limits.Max {
+			invalidParameter(c, "limit", fmt.Sprintf("limit must be at most %d, page through larger boards with offset", limits.Max))
+			return
+		}
+
+		offsetStr := c.DefaultQuery("offset", "0")
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			invalidParameter(c, "offset", "Invalid offset")
 			return
 		}
 
 		windowStr := c.DefaultQuery("window", "")
 		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		mode, ok := rankModeParam(c)
+		if !ok {
+			return
+		}
+
+		var viewerID int64
+		if viewerIDStr := c.Query("userId"); viewerIDStr != "" {
+			viewerID, err = strconv.ParseInt(viewerIDStr, 10, 64)
+			if err != nil {
+				invalidUserID(c)
+				return
+			}
+		}
+
+		profiles, ok := includeProfile(c)
+		if !ok {
+			return
+		}
+
+		seasonID, seasonBoard, ok := seasonParam(c, store, pgRepo, gameID, window)
+		if !ok {
+			return
+		}
+		if seasonID != 0 {
+			response, err := seasonTopLeaders(pgRepo, seasonBoard, gameID, seasonID, viewerID, limit, offset, window, mode)
+			if err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to read season top leaders", "game", gameID, "season", seasonID, "error", err)
+				internalError(c, "Failed to read leaderboard")
+				return
+			}
+			if profiles {
+				response = withProfiles(store, response)
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		before, ok := submittedBefore(c, pgRepo)
+		if !ok {
+			return
+		}
+		if before != nil {
+			response, err := frozenTopLeaders(pgRepo, gameID, viewerID, limit, offset, window, *before, mode)
+			if err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to read frozen top leaders", "game", gameID, "error", err)
+				internalError(c, "Failed to read leaderboard")
+				return
+			}
+			if profiles {
+				response = withProfiles(store, response)
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		// The leaders and totals come from the shared cache; the viewer's own
+		// entry is looked up per request so it never leaks between users.
+		response := cachedTopLeaders(store, responseCacheStore, gameID, limit, offset, window, mode)
+		if viewerID != 0 {
+			if rank := store.GetRankedPlayer(gameID, viewerID, window, mode); rank.Found {
+				response.Me = &models.LeaderboardEntry{
+					UserID:   viewerID,
+					Score:    rank.Score,
+					Rank:     rank.Rank,
+					TiedWith: rank.TiedWith,
+				}
+			}
+		}
+		if profiles {
+			response = withProfiles(store, response)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// maxMultiTopGames bounds the number of games in one multi-game top lookup.
+const maxMultiTopGames = 50
+
+// GetMultiTopLeadersHandler returns a handler for getting several games' top leaders at once
+// @Summary      Get top leaders for several games
+// @Description  Returns the top scoring players of each requested game, keyed by game ID, for hub screens that show many games at once. Each game is read on its own, so the games are not read at the same instant. Unknown games get an empty leaders array.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameIds   query     string  true   "Comma-separated game IDs, at most 50"
+// @Param        limit     query     int     false  "Number of leaders to return per game, at most TOP_MAX_LIMIT (1000 unless configured)" default(10)
+// @Param        window    query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Param        rankMode  query     string  false  "How tied players are ranked: ordinal (1, 2, 3, earlier score first), competition (1, 1, 3) or dense (1, 1, 2)" Enums(ordinal,competition,dense)
+// @Success      200       {object}  map[string]models.TopLeadersResponse
+// @Failure      400       {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/top [get]
+func GetMultiTopLeadersHandler(store *store.Store, responseCacheStore *persistence.InMemoryStore, limits TopLimits) gin.HandlerFunc {
+	limits = limits.withDefaults()
+
+	return func(c *gin.Context) {
+		var gameIDs []int64
+		for _, gameIDStr := range strings.Split(c.Query("gameIds"), ",") {
+			gameID, err := strconv.ParseInt(strings.TrimSpace(gameIDStr), 10, 64)
+			if err != nil {
+				invalidGameID(c)
+				return
+			}
+			gameIDs = append(gameIDs, gameID)
+		}
+		if len(gameIDs) > maxMultiTopGames {
+			invalidParameter(c, "gameIds", fmt.Sprintf("At most %d game IDs can be requested at once", maxMultiTopGames))
+			return
+		}
 
+		limitStr := c.DefaultQuery("limit", strconv.Itoa(limits.Default))
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			invalidParameter(c, "limit", "Invalid limit")
+			return
+		}
+		if limit > limits.Max {
+			invalidParameter(c, "limit", fmt.Sprintf("limit must be at most %d", limits.Max))
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window"})
+			invalidWindow(c, err)
 			return
 		}
 
-		leaders := store.GetTopLeaders(gameID, limit, window)
-		totalPlayers := store.TotalPlayers(gameID)
+		mode, ok := rankModeParam(c)
+		if !ok {
+			return
+		}
 
-		c.JSON(http.StatusOK, models.TopLeadersResponse{
-			GameID:       gameID,
-			Leaders:      leaders,
-			TotalPlayers: totalPlayers,
-			Window:       window.Display,
-		})
-	})
+		// Each game is read, and locked, separately, through the same cache
+		// as the single-game endpoint.
+		response := make(map[int64]models.TopLeadersResponse, len(gameIDs))
+		for _, gameID := range gameIDs {
+			response[gameID] = cachedTopLeaders(store, responseCacheStore, gameID, limit, 0, window, mode)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
 }
 
+// submittedBefore parses the optional submitted_before parameter, which
+// freezes a board at the scores the server had received by then. Receipt
+// times only live in Postgres, so frozen boards are read from there. ok is
+// false when an error response has been written.
+func submittedBefore(c *gin.Context, pgRepo db.PostgresRepositoryInterface) (*time.Time, bool) {
+	beforeStr := c.Query("submitted_before")
+	if beforeStr == "" {
+		return nil, true
+	}
+
+	before, err := time.Parse(time.RFC3339Nano, beforeStr)
+	if err != nil {
+		invalidParameter(c, "submitted_before", "Invalid submitted_before, expected an RFC 3339 time")
+		return nil, false
+	}
+	if pgRepo == nil {
+		respondError(c, http.StatusServiceUnavailable, CodeUnavailable, "submitted_before needs PostgreSQL", nil)
+		return nil, false
+	}
+
+	before = before.UTC()
+	return &before, true
+}
+
+// rankModeParam parses the optional rankMode parameter. ok is false when an
+// error response has been written.
+func rankModeParam(c *gin.Context) (models.RankMode, bool) {
+	mode, err := models.ParseRankMode(c.Query("rankMode"))
+	if err != nil {
+		invalidParameter(c, "rankMode", "Invalid rankMode, expected ordinal, competition or dense")
+		return mode, false
+	}
+	return mode, true
+}
+
+// frozenTopLeaders builds a top leaders response, including the viewer's own
+// entry, from the board as of the scores received before the given instant.
+// Frozen responses never change, but they are read from Postgres every time
+// rather than cached.
+func frozenTopLeaders(pgRepo db.PostgresRepositoryInterface, gameID, viewerID int64, limit, offset int, window models.TimeWindow, before time.Time, mode models.RankMode) (models.TopLeadersResponse, error) {
+	leaders, total, err := pgRepo.GetTopLeadersSubmittedBefore(gameID, limit, offset, window, before, mode)
+	if err != nil {
+		return models.TopLeadersResponse{}, err
+	}
+
+	response := models.TopLeadersResponse{
+		GameID:          gameID,
+		Leaders:         leaders,
+		Offset:          offset,
+		TotalPlayers:    total,
+		Window:          window.Display,
+		SubmittedBefore: &before,
+	}
+
+	if viewerID != 0 {
+		me, _, _, found, err := pgRepo.GetPlayerRankSubmittedBefore(gameID, viewerID, window, before, mode)
+		if err != nil {
+			return models.TopLeadersResponse{}, err
+		}
+		if found {
+			response.Me = &me
+		}
+	}
+
+	return response, nil
+}
+
+// maxRankNeighbors bounds the neighbors on each side of a rank response.
+const maxRankNeighbors = 25
+
 // GetPlayerRankHandler returns a handler for getting a player's rank
 // @Summary      Get a player's rank
 // @Description  Returns the rank and percentile for a specific player in a game
@@ -71,86 +389,804 @@ func GetTopLeadersHandler(store *store.Store, responseCacheStore *persistence.In
 // @Produce      json
 // @Param        gameId  path      int  true  "Game ID"
 // @Param        userId  path      int  true  "User ID"
-// @Param        window  query     string  false  "Time window (empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days)" Enums(24h,3d,7d)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Param        submitted_before  query  string  false  "RFC 3339 time; rank only scores the server received before it, read from Postgres"
+// @Param        include  query    string  false  "profile to join the player's display name and avatar into the response" Enums(profile)
+// @Param        season   query    string  false  "Season ID, or current for the game's current season"
+// @Param        rankMode  query   string  false  "How tied players are ranked: ordinal (1, 2, 3, earlier score first), competition (1, 1, 3) or dense (1, 1, 2)" Enums(ordinal,competition,dense)
+// @Param        neighbors  query  int     false  "Players ranked directly above and below to include as above and below, at most 25" default(0)
 // @Success      200     {object}  models.PlayerRankResponse
-// @Failure      400     {object}  map[string]string
-// @Failure      404     {object}  map[string]string
-// @Router       /api/leaderboard/rank/{gameId}/{userId} [get]
-func GetPlayerRankHandler(store *store.Store, responseCacheStore *persistence.InMemoryStore) gin.HandlerFunc {
-	return responseCache.CachePage(responseCacheStore, time.Second*5, func(c *gin.Context) {
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Failure      503     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/rank/{gameId}/{userId} [get]
+func GetPlayerRankHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface, responseCacheStore *persistence.InMemoryStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
 		gameIDStr := c.Param("gameId")
 		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game ID"})
+			invalidGameID(c)
 			return
 		}
 
 		userIDStr := c.Param("userId")
 		userID, err := strconv.ParseInt(userIDStr, 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			invalidUserID(c)
 			return
 		}
 
 		windowStr := c.DefaultQuery("window", "")
 		window, err := models.FromQueryParam(windowStr)
-
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window"})
+			invalidWindow(c, err)
+			return
+		}
+
+		mode, ok := rankModeParam(c)
+		if !ok {
+			return
+		}
+
+		neighborsStr := c.DefaultQuery("neighbors", "0")
+		neighbors, err := strconv.Atoi(neighborsStr)
+		if err != nil || neighbors < 0 || neighbors > maxRankNeighbors {
+			invalidParameter(c, "neighbors", "Invalid neighbors, expected 0 to 25")
+			return
+		}
+
+		profiles, ok := includeProfile(c)
+		if !ok {
+			return
+		}
+
+		seasonID, seasonBoard, ok := seasonParam(c, store, pgRepo, gameID, window)
+		if !ok {
+			return
+		}
+		if seasonID != 0 {
+			if seasonBoard == nil && neighbors > 0 {
+				invalidParameter(c, "neighbors", "Past seasons do not support neighbors")
+				return
+			}
+			response, found, err := seasonPlayerRank(pgRepo, seasonBoard, gameID, seasonID, userID, window, mode, neighbors)
+			if err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to read season player rank", "game", gameID, "season", seasonID, "user", userID, "error", err)
+				internalError(c, "Failed to read player rank")
+				return
+			}
+			if !found {
+				playerNotFound(c, gameID, userID, window)
+				return
+			}
+			if profiles {
+				response = withRankProfiles(store, response)
+			}
+			c.JSON(http.StatusOK, response)
 			return
 		}
 
-		rank, percentile, score, total, exists := store.GetPlayerRank(gameID, userID, window)
+		before, ok := submittedBefore(c, pgRepo)
+		if !ok {
+			return
+		}
+		if before != nil {
+			if neighbors > 0 {
+				invalidParameter(c, "neighbors", "neighbors cannot be combined with submitted_before")
+				return
+			}
+			entry, percentile, total, found, err := pgRepo.GetPlayerRankSubmittedBefore(gameID, userID, window, *before, mode)
+			if err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to read frozen player rank", "game", gameID, "user", userID, "error", err)
+				internalError(c, "Failed to read player rank")
+				return
+			}
+			if !found {
+				playerNotFound(c, gameID, userID, window)
+				return
+			}
+			response := models.PlayerRankResponse{
+				GameID:          gameID,
+				UserID:          userID,
+				Score:           entry.Score,
+				Rank:            entry.Rank,
+				TiedWith:        entry.TiedWith,
+				Percentile:      percentile,
+				TotalPlayers:    total,
+				Window:          window.Display,
+				SubmittedBefore: before,
+			}
+			if profiles {
+				response = withRankProfiles(store, response)
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		// Misses are never cached, so a player is found as soon as their
+		// first score lands.
+		response, exists := cachedPlayerRank(store, responseCacheStore, gameID, userID, window, mode, neighbors)
 		if !exists {
-			c.JSON(http.StatusOK, gin.H{"error": "Player not found"})
+			playerNotFound(c, gameID, userID, window)
 			return
 		}
+		if profiles {
+			response = withRankProfiles(store, response)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
 
-		c.JSON(http.StatusOK, models.PlayerRankResponse{
-			GameID:       gameID,
-			UserID:       userID,
-			Score:        score,
-			Rank:         rank,
-			Percentile:   percentile,
-			TotalPlayers: total,
-			Window:       window.Display,
+// GetUserRanksHandler returns a handler for a player's rank in every game
+// @Summary      Get a player's rank in every game
+// @Description  Returns the player's rank, score and percentile in every game where they have a score in the window, ordered by game ID. Only games currently loaded into the in-memory store are included.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        userId  path      int     true   "User ID"
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Success      200     {object}  models.UserRanksResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/user/{userId} [get]
+func GetUserRanksHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil {
+			invalidUserID(c)
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, models.UserRanksResponse{
+			UserID: userID,
+			Games:  store.GetUserRanks(userID, window),
+			Window: window.Display,
 		})
-	})
+	}
+}
+
+// EraseUserHandler returns a handler that erases a player's data
+// @Summary      Erase a player's data
+// @Description  Deletes every score the player has in every game from Postgres and from the in-memory boards, and tells the other instances to do the same. Erasing a player who is already gone succeeds with no games affected.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        userId  path      int  true  "User ID"
+// @Success      200     {object}  models.EraseUserResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/user/{userId} [delete]
+func EraseUserHandler(store *store.Store, producer *mq.KafkaProducer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil || userID <= 0 {
+			invalidUserID(c)
+			return
+		}
+
+		games, err := store.EraseUser(userID)
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Failed to erase user", "user", userID, "error", err)
+			internalError(c, "Failed to erase user")
+			return
+		}
+
+		// The other instances drop the user from their boards when the
+		// tombstone reaches their consumer.
+		if producer != nil {
+			if err := producer.SendErasure(c.Request.Context(), userID); err != nil {
+				logging.ErrorContext(c.Request.Context(), "Failed to publish user erasure", "user", userID, "error", err)
+				internalError(c, "Failed to publish user erasure")
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, models.EraseUserResponse{
+			UserID:        userID,
+			GamesAffected: len(games),
+			GameIDs:       games,
+		})
+	}
+}
+
+// maxBulkRankUsers bounds the number of players in one bulk rank lookup.
+const maxBulkRankUsers = 100
+
+// GetPlayerRanksHandler returns a handler for looking up several players' ranks at once
+// @Summary      Get several players' ranks
+// @Description  Returns the rank of each requested player, in request order, all read from the same state of the board. Players without a score in the window are returned with found set to false. The players can be given as a comma-separated userIds query parameter with GET, or as a JSON body with POST.
+// @Tags         leaderboard
+// @Accept       json
+// @Produce      json
+// @Param        gameId   path      int     true   "Game ID"
+// @Param        userIds  query     string  false  "Comma-separated user IDs (GET)"
+// @Param        window   query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Param        body     body      models.BulkRankRequest  false  "User IDs and window (POST)"
+// @Success      200      {array}   models.PlayerRankLookup
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/ranks/{gameId} [get]
+// @Router       /api/v1/leaderboard/ranks/{gameId} [post]
+func GetPlayerRanksHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		var request models.BulkRankRequest
+		if c.Request.Method == http.MethodPost {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid rank request", nil)
+				return
+			}
+		} else {
+			request.Window = c.DefaultQuery("window", "")
+			for _, userIDStr := range strings.Split(c.Query("userIds"), ",") {
+				userID, err := strconv.ParseInt(strings.TrimSpace(userIDStr), 10, 64)
+				if err != nil {
+					invalidUserID(c)
+					return
+				}
+				request.UserIDs = append(request.UserIDs, userID)
+			}
+		}
+
+		if len(request.UserIDs) == 0 || len(request.UserIDs) > maxBulkRankUsers {
+			invalidParameter(c, "user_ids", fmt.Sprintf("Between 1 and %d user IDs are required", maxBulkRankUsers))
+			return
+		}
+
+		window, err := models.FromQueryParam(request.Window)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		ranks := store.GetPlayerRanks(gameID, request.UserIDs, window)
+		response := make([]models.PlayerRankLookup, len(ranks))
+		for i, rank := range ranks {
+			response[i] = models.PlayerRankLookup{
+				PlayerRankResponse: models.PlayerRankResponse{
+					GameID:       gameID,
+					UserID:       rank.UserID,
+					Score:        rank.Score,
+					Rank:         rank.Rank,
+					Percentile:   rank.Percentile,
+					TotalPlayers: rank.Total,
+					Window:       window.Display,
+				},
+				Found: rank.Found,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// maxAroundCount bounds the number of neighbors on each side returned by the
+// around endpoint.
+const maxAroundCount = 100
+
+// GetAroundPlayerHandler returns a handler for a player's neighborhood on the board
+// @Summary      Get the players ranked around a player
+// @Description  Returns the player's entry together with up to count players ranked directly above and below them, in rank order
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Param        userId  path      int  true  "User ID"
+// @Param        count   query     int  false  "Players to include on each side" default(5)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Success      200     {object}  models.AroundPlayerResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/around/{gameId}/{userId} [get]
+func GetAroundPlayerHandler(store *store.Store, responseCacheStore *persistence.InMemoryStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil {
+			invalidUserID(c)
+			return
+		}
+
+		countStr := c.DefaultQuery("count", "5")
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 0 || count > maxAroundCount {
+			invalidParameter(c, "count", "Invalid count")
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		response, exists := cachedAroundPlayer(store, responseCacheStore, gameID, userID, count, window)
+		if !exists {
+			playerNotFound(c, gameID, userID, window)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// maxHistoryLimit bounds the page size of the history endpoint.
+const maxHistoryLimit = 500
+
+// GetScoreHistoryHandler returns a handler for a player's past submissions
+// @Summary      Get a player's submissions in a game
+// @Description  Returns every score the player submitted in the game, newest first, read from Postgres rather than the in-memory store. Pass next_before from a page as before to get the next one.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameId  path      int     true   "Game ID"
+// @Param        userId  path      int     true   "User ID"
+// @Param        limit   query     int     false  "Number of submissions to return" default(50)
+// @Param        before  query     string  false  "Only return submissions older than this RFC 3339 time"
+// @Success      200     {object}  models.ScoreHistoryResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/history/{gameId}/{userId} [get]
+func GetScoreHistoryHandler(pgRepo db.PostgresRepositoryInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil {
+			invalidUserID(c)
+			return
+		}
+
+		limitStr := c.DefaultQuery("limit", "50")
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			invalidParameter(c, "limit", "Invalid limit")
+			return
+		}
+
+		var before time.Time
+		if beforeStr := c.Query("before"); beforeStr != "" {
+			before, err = time.Parse(time.RFC3339Nano, beforeStr)
+			if err != nil {
+				invalidParameter(c, "before", "Invalid before, expected an RFC 3339 time")
+				return
+			}
+		}
+
+		scores, err := pgRepo.GetScoresForUser(gameID, userID, limit, before)
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Failed to load score history", "game", gameID, "user", userID, "error", err)
+			internalError(c, "Failed to load score history")
+			return
+		}
+
+		// An empty first page means the player never submitted; an empty later
+		// page is just the end of their history.
+		if len(scores) == 0 && before.IsZero() {
+			playerNotFound(c, gameID, userID, models.AllTime)
+			return
+		}
+
+		response := models.ScoreHistoryResponse{
+			GameID: gameID,
+			UserID: userID,
+			Scores: scores,
+		}
+		if len(scores) == limit {
+			next := scores[len(scores)-1].Timestamp
+			response.NextBefore = &next
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetHistoricalPercentileHandler returns a handler for a score's percentile on a past board
+// @Summary      Get a score's percentile on a past board
+// @Description  Returns the percentile the score would have had on the game's board as of the given time, computed from the score distribution stored with the latest snapshot taken at or before it. Percentiles from large boards are accurate to within 0.05 percentage points.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameId  path      int     true   "Game ID"
+// @Param        score   query     int     true   "Score"
+// @Param        as_of   query     string  true   "RFC 3339 time"
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days)" Enums(all,24h,3d,7d)
+// @Success      200     {object}  models.HistoricalPercentileResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/percentile/{gameId} [get]
+func GetHistoricalPercentileHandler(leaderboardStore *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		score, err := strconv.ParseUint(c.Query("score"), 10, 64)
+		if err != nil {
+			invalidParameter(c, "score", "Invalid score")
+			return
+		}
+
+		asOf, err := time.Parse(time.RFC3339, c.Query("as_of"))
+		if err != nil {
+			invalidParameter(c, "as_of", "Invalid as_of, expected an RFC 3339 time")
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err == nil && !window.IsStandard() {
+			err = fmt.Errorf("snapshots only keep the %s windows", models.SupportedWindows())
+		}
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		response, err := leaderboardStore.HistoricalPercentile(gameID, score, asOf, window)
+		var noHistory *store.NoHistoryError
+		if errors.As(err, &noHistory) {
+			respondError(c, http.StatusNotFound, CodeNoHistory, err.Error(), gin.H{"nearest": noHistory.Nearest})
+			return
+		}
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// maxSketchQuantiles bounds the quantiles accepted by the sketch endpoint.
+const maxSketchQuantiles = 100
+
+// GetScoreSketchHandler returns a handler for approximate score quantiles
+// @Summary      Get approximate score quantiles
+// @Description  Returns approximate scores at the requested quantiles of the game's board, read from a quantile sketch kept up to date as scores are accepted. Each score is within relative_error (1%) of the exact score at its quantile. Quantile 0 is the lowest score and 1 the highest. Excluded accounts are counted.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameId  path      int     true   "Game ID"
+// @Param        q       query     string  false  "Comma-separated quantiles between 0 and 1" default(0.5,0.9,0.99)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Success      200     {object}  models.SketchResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/sketch/{gameId} [get]
+func GetScoreSketchHandler(leaderboardStore *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		qs, err := parseQuantiles(c.DefaultQuery("q", "0.5,0.9,0.99"))
+		if err != nil {
+			invalidParameter(c, "q", err.Error())
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		response := models.SketchResponse{
+			GameID:        gameID,
+			RelativeError: store.SketchRelativeError,
+			Quantiles:     []models.QuantileEstimate{},
+			Window:        window.Display,
+		}
+
+		scores, count, found := leaderboardStore.ScoreQuantiles(gameID, qs, window)
+		if found {
+			response.Count = count
+			for i, q := range qs {
+				response.Quantiles = append(response.Quantiles, models.QuantileEstimate{Q: q, Score: scores[i]})
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func parseQuantiles(value string) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) > maxSketchQuantiles {
+		return nil, fmt.Errorf("at most %d quantiles can be requested", maxSketchQuantiles)
+	}
+
+	qs := make([]float64, len(parts))
+	for i, part := range parts {
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("invalid quantile %q, expected a number between 0 and 1", part)
+		}
+		qs[i] = q
+	}
+	return qs, nil
+}
+
+// maxThresholdRank bounds the rank accepted by the threshold endpoint.
+const maxThresholdRank = 1000000
+
+// GetScoreThresholdHandler returns a handler for the score needed to enter the top N
+// @Summary      Get the score needed to enter the top N
+// @Description  Returns the score held by the player at the given rank and how many players share it. When the board has fewer players than rank, threshold is 0 and any score qualifies.
+// @Tags         leaderboard
+// @Accept       json
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Param        rank    query     int  false  "Rank to enter" default(100)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Success      200     {object}  models.ScoreThresholdResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/threshold/{gameId} [get]
+func GetScoreThresholdHandler(store *store.Store, responseCacheStore *persistence.InMemoryStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		rankStr := c.DefaultQuery("rank", "100")
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil || rank <= 0 || rank > maxThresholdRank {
+			invalidParameter(c, "rank", "Invalid rank")
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, cachedScoreThreshold(store, responseCacheStore, gameID, rank, window))
+	}
 }
 
 // SubmitScoreHandler returns a handler for submitting a score
 // @Summary      Submit a player's score
-// @Description  Records a new score for a player in a game
+// @Description  Records a new score for a player in a game. The score can be sent as JSON or as a URL-encoded form with the same field names; timestamp is RFC 3339 and defaults to now. With receipt=true and receipts configured, the response carries a signed receipt. With includeRank=true it carries the player's all-time rank straight after the submission, computed on this instance, which applies the score to its boards ahead of Kafka.
 // @Tags         leaderboard
-// @Accept       json
+// @Accept       json,x-www-form-urlencoded
 // @Produce      json
-// @Param        score   body      models.Score  true  "Score data"
-// @Success      200
-// @Failure      400     {object}  map[string]string
-// @Router       /api/leaderboard/score [post]
-func SubmitScoreHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface, producer *mq.KafkaProducer) gin.HandlerFunc {
+// @Param        score            body      models.Score  true   "Score data"
+// @Param        receipt          query     bool          false  "Return a signed receipt"
+// @Param        includeRank      query     bool          false  "Return the player's rank after the submission"
+// @Param        Idempotency-Key  header    string        false  "Key identifying the submission, so retries with it get the first response"
+// @Success      200      {object}  models.SubmitScoreResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      422     {object}  models.ErrorResponse
+// @Failure      429     {object}  models.ErrorResponse
+// @Failure      503     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/score [post]
+func SubmitScoreHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface, producer *mq.KafkaProducer, receipts *receipt.Signer, dedupe *idempotency.Store, scoreTimes *scoretime.Policy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var score models.Score
-		if err := c.ShouldBindJSON(&score); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid score data"})
+		var err error
+		if c.ContentType() == binding.MIMEPOSTForm {
+			err = c.ShouldBindWith(&score, binding.FormPost)
+		} else {
+			err = c.ShouldBindBodyWith(&score, binding.JSON)
+		}
+		if err != nil {
+			bindScoreFailed(c, false)
 			return
 		}
 
-		if score.Timestamp.IsZero() {
-			score.Timestamp = time.Now().UTC()
+		if key := c.GetHeader(IdempotencyKeyHeader); key != "" && dedupe != nil {
+			submitScoreOnce(c, dedupe, key, store, receipts, score, producer, scoreTimes)
+			return
 		}
+		submitScore(c, store, receipts, score, producer, scoreTimes)
+	}
+}
 
-		if score.GameID <= 0 || score.UserID <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game ID or user ID"})
+// SubmitScoreQueryHandler returns a handler for submitting a score with a GET
+// request, for clients that cannot send a request body. It is only routed when
+// enabled in the configuration.
+// @Summary      Submit a player's score from query parameters
+// @Description  Records a new score for a player in a game from query parameters. Only available when SCORE_SUBMIT_GET is enabled.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        game_id      query     int     true   "Game ID"
+// @Param        user_id      query     int     true   "User ID"
+// @Param        score        query     int     true   "Score"
+// @Param        timestamp    query     string  false  "RFC 3339 timestamp, defaults to now"
+// @Param        receipt      query     bool    false  "Return a signed receipt"
+// @Param        includeRank  query     bool    false  "Return the player's rank after the submission"
+// @Success      200          {object}  models.SubmitScoreResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      429     {object}  models.ErrorResponse
+// @Failure      503     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/score/submit [get]
+func SubmitScoreQueryHandler(store *store.Store, pgRepo db.PostgresRepositoryInterface, producer *mq.KafkaProducer, receipts *receipt.Signer, scoreTimes *scoretime.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var score models.Score
+		if err := c.ShouldBindQuery(&score); err != nil {
+			bindScoreFailed(c, true)
 			return
 		}
 
-		if producer != nil {
-			if err := producer.SendScore(c.Request.Context(), score); err != nil {
-				logging.Error("Error sending score to Kafka:", err)
+		submitScore(c, store, receipts, score, producer, scoreTimes)
+	}
+}
+
+// bindScoreFailed reports a submission that could not be decoded, naming the
+// fields at fault when the body itself was well formed.
+func bindScoreFailed(c *gin.Context, fromQuery bool) {
+	if fields := scoreFieldErrors(c, fromQuery); len(fields) > 0 {
+		invalidScore(c, fields)
+		return
+	}
+	respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid score data", nil)
+}
+
+// submitScore validates a decoded score and hands it to Kafka, whatever
+// encoding it arrived in.
+func submitScore(c *gin.Context, store *store.Store, receipts *receipt.Signer, score models.Score, producer *mq.KafkaProducer, scoreTimes *scoretime.Policy) {
+	status, response := processScore(c, store, receipts, score, producer, scoreTimes)
+	if response == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, response)
+}
+
+// processScore does the work of submitScore, returning the status and the
+// body to respond with, nil for none.
+func processScore(c *gin.Context, store *store.Store, receipts *receipt.Signer, score models.Score, producer *mq.KafkaProducer, scoreTimes *scoretime.Policy) (int, any) {
+	score.ReceivedAt = time.Now().UTC()
+	if score.Timestamp.IsZero() {
+		score.Timestamp = score.ReceivedAt
+	}
+
+	var fields []models.FieldError
+	if score.GameID <= 0 {
+		fields = append(fields, models.FieldError{Field: "game_id", Reason: "must be a positive integer"})
+	}
+	if score.UserID <= 0 {
+		fields = append(fields, models.FieldError{Field: "user_id", Reason: "must be a positive integer"})
+	}
+	timestamp, err := scoreTimes.Check(score.Timestamp, score.ReceivedAt)
+	var timeErr *scoretime.Error
+	if errors.As(err, &timeErr) {
+		fields = append(fields, models.FieldError{Field: "timestamp", Reason: timeErr.Reason()})
+	}
+	score.Timestamp = timestamp
+	if len(fields) > 0 {
+		return http.StatusBadRequest, newAPIError(c, CodeInvalidScore, "Invalid score data", gin.H{"fields": fields})
+	}
+	if err := store.CheckGame(score); err != nil {
+		return checkGameFailed(c, score.GameID, err)
+	}
+
+	if producer != nil {
+		if err := producer.SendScore(c.Request.Context(), score); err != nil {
+			logging.ErrorContext(c.Request.Context(), "Error sending score to Kafka", "error", err)
+			if errors.Is(err, mq.ErrQueueFull) {
+				c.Header("Retry-After", "1")
+				return http.StatusServiceUnavailable, newAPIError(c, CodeQueueFull, "Too many scores are waiting to be written, retry shortly", nil)
+			}
+			return http.StatusServiceUnavailable, newAPIError(c, CodeUnavailable, "Scores cannot be accepted right now", nil)
+		}
+	}
+
+	var response models.SubmitScoreResponse
+	if c.Query("includeRank") == "true" {
+		// The consumer applies the score later, and the score may not reach
+		// it before the client asks, so the rank comes from applying it here.
+		result, err := store.ApplySubmission(score)
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Error applying score for its rank", "error", err)
+		} else {
+			response.Rank = &models.SubmissionRank{
+				Rank:         result.Rank,
+				Score:        result.Score,
+				Percentile:   result.Percentile,
+				TotalPlayers: result.Total,
+				Improved:     result.Improved,
 			}
 		}
+	}
+
+	if receipts != nil && c.Query("receipt") == "true" {
+		token, err := receipts.Sign(models.ReceiptClaims{
+			GameID:    score.GameID,
+			UserID:    score.UserID,
+			Score:     score.Score,
+			Timestamp: score.Timestamp,
+			Rank:      store.RankForScore(score.GameID, score.Score),
+		})
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Error signing score receipt", "error", err)
+		} else {
+			response.Receipt = token
+		}
+	}
 
-		c.Status(http.StatusOK)
+	if response == (models.SubmitScoreResponse{}) {
+		return http.StatusOK, nil
+	}
+	return http.StatusOK, response
+}
+
+// VerifyReceiptHandler returns a handler that verifies a submission receipt
+// @Summary      Verify a score submission receipt
+// @Description  Checks the receipt's signature and reports whether its score still stands as the player's best, has been superseded by a better score, or is no longer on the board
+// @Tags         leaderboard
+// @Produce      json
+// @Param        receipt  query     string  true  "Receipt returned on submission"
+// @Success      200      {object}  models.ReceiptVerificationResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/verify [get]
+func VerifyReceiptHandler(store *store.Store, receipts *receipt.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("receipt")
+		if token == "" {
+			invalidParameter(c, "receipt", "Missing receipt")
+			return
+		}
+
+		claims, err := receipts.Verify(token)
+		if err != nil {
+			c.JSON(http.StatusOK, models.ReceiptVerificationResponse{Valid: false, Error: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ReceiptVerificationResponse{
+			Valid:  true,
+			Status: store.ReceiptStatus(claims),
+			Claims: &claims,
+		})
+	}
+}
+
+// ReceiptKeysHandler returns a handler serving the receipt public keys
+// @Summary      Get the receipt signing keys
+// @Description  Returns the public keys receipts are signed with as a JSON Web Key Set, so third parties can verify receipts offline
+// @Tags         leaderboard
+// @Produce      json
+// @Success      200  {object}  receipt.JWKS
+// @Router       /.well-known/jwks.json [get]
+func ReceiptKeysHandler(receipts *receipt.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, receipts.JWKS())
 	}
 }
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// maxLiveLimit bounds the size of a live top list, which is read again after
+// every change to the game.
+const maxLiveLimit = 100
+
+// liveWriteTimeout is how long a frame may take to reach a client before the
+// connection is dropped.
+const liveWriteTimeout = 10 * time.Second
+
+// LiveTopLeadersHandler returns a handler streaming a game's top players over a WebSocket
+// @Summary      Stream a game's top players
+// @Description  Upgrades to a WebSocket and sends the game's top list as a JSON frame shaped like the top leaders response, first on connecting and then whenever its players, order or scores change. A client that reads slowly skips to the latest list instead of receiving every intermediate one. Messages from the client are ignored.
+// @Tags         leaderboard
+// @Param        gameId  path      int  true  "Game ID"
+// @Param        limit   query     int  false  "Number of leaders to send, at most 100" default(10)
+// @Param        window  query     string  false  "Time window (all or empty for all-time, 24h for last 24 hours, 3d for 3 days, 7d for 7 days, or a custom number of hours or days such as 48h or 30d)"
+// @Success      101
+// @Failure      400     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/live/{gameId} [get]
+func LiveTopLeadersHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		limitStr := c.DefaultQuery("limit", "10")
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxLiveLimit {
+			invalidParameter(c, "limit", "Invalid limit")
+			return
+		}
+
+		windowStr := c.DefaultQuery("window", "")
+		window, err := models.FromQueryParam(windowStr)
+		if err != nil {
+			invalidWindow(c, err)
+			return
+		}
+
+		server := websocket.Server{
+			// The board is public, so spectator pages on any origin may
+			// connect.
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				streamTopLeaders(ws, store, gameID, limit, window)
+			},
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func streamTopLeaders(ws *websocket.Conn, store *store.Store, gameID int64, limit int, window models.TimeWindow) {
+	updates, cancel := store.Subscribe(gameID, limit, window)
+	defer cancel()
+
+	// Reading is only how a closed connection is noticed.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case leaders := <-updates:
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			err := websocket.JSON.Send(ws, models.TopLeadersResponse{
+				GameID:       gameID,
+				Leaders:      leaders,
+				TotalPlayers: store.WindowPlayers(gameID, window),
+				Window:       window.Display,
+			})
+			if err != nil {
+				logging.InfoContext(ws.Request().Context(), "Closing live leaderboard stream", "game", gameID, "error", err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureMetrics serves the registry on /metrics and counts and times every
+// request. It must be called before the other routes are added so that the
+// middleware covers them.
+func ConfigureMetrics(r *gin.Engine, registry *metrics.Registry) {
+	r.Use(MetricsMiddleware())
+	r.GET("/metrics", gin.WrapH(registry.Handler()))
+}
+
+// MetricsMiddleware records each request's count and latency by its route
+// template, such as /api/v1/leaderboard/top/:gameId, so that IDs in paths do
+// not create a series each. Requests matching no route share one series.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+
+		metrics.HTTPRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
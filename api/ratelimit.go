@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/IWhitebird/go-leader-board/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// RateLimitMiddleware limits score submissions per player, keyed by the
+// user_id being submitted for, or by client IP when the request carries none.
+// Submissions over the limit get a 429 with a Retry-After header. A nil
+// limiter lets every request through.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			return
+		}
+
+		allowed, wait := limiter.Allow(submitterKey(c))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, CodeRateLimited, "Too many score submissions")
+		}
+	}
+}
+
+// submitterKey reads the user_id of a submission from its query, form or
+// JSON body, leaving the body for the handler to bind.
+func submitterKey(c *gin.Context) string {
+	userID := c.Query("user_id")
+	if userID == "" && c.Request.Body != nil {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if c.ContentType() == binding.MIMEPOSTForm {
+			if values, err := url.ParseQuery(string(body)); err == nil {
+				userID = values.Get("user_id")
+			}
+		} else {
+			var submission struct {
+				UserID json.Number `json:"user_id"`
+			}
+			if json.Unmarshal(body, &submission) == nil {
+				userID = submission.UserID.String()
+			}
+		}
+	}
+
+	if _, err := strconv.ParseInt(userID, 10, 64); err == nil {
+		return "user:" + userID
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -1,8 +1,16 @@
 package api
 
 import (
+	"github.com/IWhitebird/go-leader-board/internal/auth"
 	"github.com/IWhitebird/go-leader-board/internal/db"
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+	"github.com/IWhitebird/go-leader-board/internal/idempotency"
 	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/ratelimit"
+	"github.com/IWhitebird/go-leader-board/internal/receipt"
+	"github.com/IWhitebird/go-leader-board/internal/retention"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
+	"github.com/IWhitebird/go-leader-board/internal/season"
 	"github.com/IWhitebird/go-leader-board/internal/store"
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
@@ -13,23 +21,179 @@ func ConfigureRoutes(
 	store *store.Store,
 	pgRepo db.PostgresRepositoryInterface,
 	producer *mq.KafkaProducer,
-	responseCache *persistence.InMemoryStore) {
-	// API group
-	api := r.Group("/api")
+	responseCache *persistence.InMemoryStore,
+	receipts *receipt.Signer,
+	limiter *ratelimit.Limiter,
+	keys *auth.Keys,
+	dedupe *idempotency.Store,
+	scoreTimes *scoretime.Policy,
+	topLimits TopLimits) {
+	for _, api := range versionedGroups(r) {
+		configureLeaderboardRoutes(api, store, pgRepo, producer, responseCache, receipts, limiter, keys, dedupe, scoreTimes, topLimits)
+	}
+
+	// Public keys for verifying receipts
+	if receipts != nil {
+		r.GET("/.well-known/jwks.json", ReceiptKeysHandler(receipts))
+	}
+}
 
+func configureLeaderboardRoutes(
+	api *gin.RouterGroup,
+	store *store.Store,
+	pgRepo db.PostgresRepositoryInterface,
+	producer *mq.KafkaProducer,
+	responseCache *persistence.InMemoryStore,
+	receipts *receipt.Signer,
+	limiter *ratelimit.Limiter,
+	keys *auth.Keys,
+	dedupe *idempotency.Store,
+	scoreTimes *scoretime.Policy,
+	topLimits TopLimits) {
 	// Health endpoint
 	api.GET("/health", HealthHandler())
 
+	// Writes always need an API key when keys are configured, reads only
+	// when they are locked
+	requireKey := APIKeyMiddleware(keys)
+
 	// Leaderboard endpoints
 	leaderboard := api.Group("/leaderboard")
+	if keys != nil && keys.ReadsLocked() {
+		leaderboard.Use(requireKey)
+	}
 	{
+		// List the known games
+		leaderboard.GET("/games", GetGamesHandler(store, pgRepo))
+
 		// Get top leaders for a game
-		leaderboard.GET("/top/:gameId", GetTopLeadersHandler(store, responseCache))
+		leaderboard.GET("/top/:gameId", GetTopLeadersHandler(store, pgRepo, responseCache, topLimits))
+
+		// Get top leaders for several games at once
+		leaderboard.GET("/top", GetMultiTopLeadersHandler(store, responseCache, topLimits))
+
+		// Stream a game's top list as it changes
+		leaderboard.GET("/live/:gameId", LiveTopLeadersHandler(store))
 
 		// Get a player's rank for a game
-		leaderboard.GET("/rank/:gameId/:userId", GetPlayerRankHandler(store, responseCache))
+		leaderboard.GET("/rank/:gameId/:userId", GetPlayerRankHandler(store, pgRepo, responseCache))
+
+		// Get a player's rank in every game
+		leaderboard.GET("/user/:userId", GetUserRanksHandler(store))
+
+		// Erase every score of a player
+		leaderboard.DELETE("/user/:userId", requireKey, EraseUserHandler(store, producer))
+
+		// Get several players' ranks at once
+		leaderboard.GET("/ranks/:gameId", GetPlayerRanksHandler(store))
+		leaderboard.POST("/ranks/:gameId", GetPlayerRanksHandler(store))
+
+		// Get the players ranked around a player
+		leaderboard.GET("/around/:gameId/:userId", GetAroundPlayerHandler(store, responseCache))
+
+		// Get a player's past submissions, read from Postgres
+		if pgRepo != nil {
+			leaderboard.GET("/history/:gameId/:userId", GetScoreHistoryHandler(pgRepo))
+		}
+
+		// List a game's seasons, read from Postgres
+		if pgRepo != nil {
+			leaderboard.GET("/seasons/:gameId", GetSeasonsHandler(pgRepo))
+		}
+
+		// Get a score's percentile on a past board
+		leaderboard.GET("/percentile/:gameId", GetHistoricalPercentileHandler(store))
+
+		// Get approximate score quantiles
+		leaderboard.GET("/sketch/:gameId", GetScoreSketchHandler(store))
+
+		// Get the score needed to enter the top N
+		leaderboard.GET("/threshold/:gameId", GetScoreThresholdHandler(store, responseCache))
 
 		// Submit a score
-		leaderboard.POST("/score", SubmitScoreHandler(store, pgRepo, producer))
+		leaderboard.POST("/score", requireKey, RateLimitMiddleware(limiter), SubmitScoreHandler(store, pgRepo, producer, receipts, dedupe, scoreTimes))
+
+		// Add to a player's total in a cumulative game
+		leaderboard.POST("/score/increment", requireKey, RateLimitMiddleware(limiter), IncrementScoreHandler(store, producer))
+
+		// Verify a submission receipt
+		if receipts != nil {
+			leaderboard.GET("/verify", VerifyReceiptHandler(store, receipts))
+		}
+	}
+
+	// Player display names and avatars
+	api.PUT("/users/:userId", requireKey, SetProfileHandler(store))
+}
+
+func ConfigureAdminRoutes(
+	r *gin.Engine,
+	store *store.Store,
+	producer *mq.KafkaProducer,
+	retentionJob *retention.Job,
+	seasonJob *season.Job,
+	doctor *doctor.Doctor,
+	keys *auth.Keys) {
+	for _, api := range versionedGroups(r) {
+		configureAdminRoutes(api.Group("/admin", APIKeyMiddleware(keys)), store, producer, retentionJob, seasonJob, doctor)
+	}
+}
+
+func configureAdminRoutes(
+	admin *gin.RouterGroup,
+	store *store.Store,
+	producer *mq.KafkaProducer,
+	retentionJob *retention.Job,
+	seasonJob *season.Job,
+	doctor *doctor.Doctor) {
+
+	// Registered games and their settings
+	admin.GET("/games", GetRegisteredGamesHandler(store))
+	admin.POST("/games", RegisterGameHandler(store))
+
+	// In-memory store maintenance
+	admin.POST("/store/compact", CompactStoreHandler(store))
+
+	// Clear a game's board between tournament rounds
+	admin.DELETE("/leaderboard/:gameId", ResetGameHandler(store, producer))
+
+	// Accounts left out of a game's rankings
+	admin.GET("/games/:gameId/excluded", GetExcludedAccountsHandler(store))
+	admin.PUT("/games/:gameId/excluded/:userId", SetExcludedAccountHandler(store, true))
+	admin.DELETE("/games/:gameId/excluded/:userId", SetExcludedAccountHandler(store, false))
+
+	// Consistency checks for on-call
+	if doctor != nil {
+		admin.POST("/doctor/:gameId", RunDoctorHandler(doctor))
+	}
+
+	// Score retention
+	if retentionJob != nil {
+		admin.GET("/retention", GetRetentionPoliciesHandler(retentionJob))
+		admin.POST("/retention/run", RunRetentionHandler(retentionJob))
+		admin.PUT("/retention/:gameId", SetRetentionOverrideHandler(retentionJob))
+	}
+
+	// Seasons
+	if seasonJob != nil {
+		admin.POST("/games/:gameId/seasons", CreateSeasonHandler(seasonJob))
+		admin.POST("/seasons/rollover", RunSeasonRolloverHandler(seasonJob))
+	}
+}
+
+// ConfigureQuerySubmitRoutes routes score submission over GET for clients that
+// cannot send a request body. It is opt-in because such URLs end up in logs
+// and browser history.
+func ConfigureQuerySubmitRoutes(
+	r *gin.Engine,
+	store *store.Store,
+	pgRepo db.PostgresRepositoryInterface,
+	producer *mq.KafkaProducer,
+	receipts *receipt.Signer,
+	limiter *ratelimit.Limiter,
+	keys *auth.Keys,
+	scoreTimes *scoretime.Policy) {
+	for _, api := range versionedGroups(r) {
+		api.GET("/leaderboard/score/submit", APIKeyMiddleware(keys), RateLimitMiddleware(limiter), SubmitScoreQueryHandler(store, pgRepo, producer, receipts, scoreTimes))
 	}
 }
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/db"
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/season"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+type seasonRequest struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+}
+
+// seasonParam resolves the optional season parameter, "current" or a season
+// ID, to a season of the game. board is the season's board while it is open,
+// and nil for a frozen season, which is read from Postgres and only has an
+// all-time board. seasonID is 0 when no season was asked for, and ok is false
+// when an error response has been written.
+func seasonParam(c *gin.Context, leaderboardStore *store.Store, pgRepo db.PostgresRepositoryInterface, gameID int64, window models.TimeWindow) (seasonID int64, board *store.GameLeaderboard, ok bool) {
+	value := c.Query("season")
+	if value == "" {
+		return 0, nil, true
+	}
+	if c.Query("submitted_before") != "" {
+		invalidParameter(c, "season", "season cannot be combined with submitted_before")
+		return 0, nil, false
+	}
+
+	if value == "current" {
+		current, found := leaderboardStore.ActiveSeason(gameID)
+		if found {
+			board = leaderboardStore.SeasonLeaderboard(gameID, current.SeasonID)
+		}
+		if board == nil {
+			seasonNotFound(c, gameID, value)
+			return 0, nil, false
+		}
+		return current.SeasonID, board, true
+	}
+
+	seasonID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seasonID <= 0 {
+		invalidParameter(c, "season", "Invalid season, expected a season ID or current")
+		return 0, nil, false
+	}
+	if board := leaderboardStore.SeasonLeaderboard(gameID, seasonID); board != nil {
+		return seasonID, board, true
+	}
+
+	if pgRepo == nil {
+		seasonNotFound(c, gameID, value)
+		return 0, nil, false
+	}
+	past, err := pgRepo.GetSeason(seasonID)
+	if err != nil {
+		logging.ErrorContext(c.Request.Context(), "Failed to read season", "game", gameID, "season", seasonID, "error", err)
+		internalError(c, "Failed to read season")
+		return 0, nil, false
+	}
+	if past == nil || past.GameID != gameID {
+		seasonNotFound(c, gameID, value)
+		return 0, nil, false
+	}
+	if window.Hours != models.AllTime.Hours {
+		invalidParameter(c, "window", "Past seasons only have an all-time board")
+		return 0, nil, false
+	}
+	return seasonID, nil, true
+}
+
+// seasonTopLeaders builds a top leaders response, including the viewer's own
+// entry, from a season's board, or from Postgres when board is nil. Season
+// responses are not cached.
+func seasonTopLeaders(pgRepo db.PostgresRepositoryInterface, board *store.GameLeaderboard, gameID, seasonID, viewerID int64, limit, offset int, window models.TimeWindow, mode models.RankMode) (models.TopLeadersResponse, error) {
+	response := models.TopLeadersResponse{
+		GameID:   gameID,
+		Offset:   offset,
+		Window:   window.Display,
+		SeasonID: seasonID,
+	}
+
+	if board != nil {
+		response.Leaders = board.GetRankedTopK(limit, offset, window, mode)
+		response.TotalPlayers = board.TotalPlayers(window)
+		if viewerID != 0 {
+			if rank := board.GetPlayerRank(viewerID, window, mode); rank.Found {
+				response.Me = &models.LeaderboardEntry{UserID: viewerID, Score: rank.Score, Rank: rank.Rank, TiedWith: rank.TiedWith}
+			}
+		}
+		return response, nil
+	}
+
+	leaders, total, err := pgRepo.GetSeasonTopLeaders(gameID, seasonID, limit, offset, mode)
+	if err != nil {
+		return models.TopLeadersResponse{}, err
+	}
+	response.Leaders = leaders
+	response.TotalPlayers = total
+
+	if viewerID != 0 {
+		me, _, _, found, err := pgRepo.GetSeasonPlayerRank(gameID, seasonID, viewerID, mode)
+		if err != nil {
+			return models.TopLeadersResponse{}, err
+		}
+		if found {
+			response.Me = &me
+		}
+	}
+
+	return response, nil
+}
+
+// seasonPlayerRank ranks a player on a season's board, or in Postgres when
+// board is nil. Neighbors are only listed from a board. found is false when
+// the player has no score in the season.
+func seasonPlayerRank(pgRepo db.PostgresRepositoryInterface, board *store.GameLeaderboard, gameID, seasonID, userID int64, window models.TimeWindow, mode models.RankMode, neighbors int) (models.PlayerRankResponse, bool, error) {
+	var (
+		entry        models.LeaderboardEntry
+		above, below []models.LeaderboardEntry
+		total        uint64
+		percentile   float64
+		found        bool
+		err          error
+	)
+	if board != nil {
+		var rank store.PlayerRank
+		rank, above, below = board.GetPlayerRankWithNeighbors(userID, neighbors, window, mode)
+		entry = models.LeaderboardEntry{UserID: userID, Score: rank.Score, Rank: rank.Rank, TiedWith: rank.TiedWith}
+		percentile, total, found = rank.Percentile, rank.Total, rank.Found
+	} else {
+		entry, percentile, total, found, err = pgRepo.GetSeasonPlayerRank(gameID, seasonID, userID, mode)
+	}
+	if err != nil || !found {
+		return models.PlayerRankResponse{}, false, err
+	}
+
+	return models.PlayerRankResponse{
+		GameID:       gameID,
+		UserID:       userID,
+		Score:        entry.Score,
+		Rank:         entry.Rank,
+		TiedWith:     entry.TiedWith,
+		Percentile:   percentile,
+		TotalPlayers: total,
+		Window:       window.Display,
+		SeasonID:     seasonID,
+		Above:        above,
+		Below:        below,
+	}, true, nil
+}
+
+// GetSeasonsHandler returns a handler that lists a game's seasons
+// @Summary      List a game's seasons
+// @Description  Returns the game's seasons, oldest first. Frozen seasons have ended and can still be read with season=<id> on the top and rank endpoints.
+// @Tags         leaderboard
+// @Produce      json
+// @Param        gameId  path      int  true  "Game ID"
+// @Success      200     {array}   models.Season
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/leaderboard/seasons/{gameId} [get]
+func GetSeasonsHandler(pgRepo db.PostgresRepositoryInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			invalidGameID(c)
+			return
+		}
+
+		seasons, err := pgRepo.GetSeasons(gameID)
+		if err != nil {
+			logging.ErrorContext(c.Request.Context(), "Failed to read seasons", "game", gameID, "error", err)
+			internalError(c, "Failed to read seasons")
+			return
+		}
+		c.JSON(http.StatusOK, seasons)
+	}
+}
+
+// CreateSeasonHandler returns a handler that adds a season to a game
+// @Summary      Create a season
+// @Description  Adds a season to the game. Scores received between starts_at and ends_at count towards its board. When it ends it is frozen and a season of the same length, or the same number of calendar months, is started after it.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        gameId  path      int            true  "Game ID"
+// @Param        body    body      seasonRequest  true  "Season start and end"
+// @Success      201     {object}  models.Season
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      409     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/admin/games/{gameId}/seasons [post]
+func CreateSeasonHandler(job *season.Job) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		gameIDStr := c.Param("gameId")
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil || gameID <= 0 {
+			invalidGameID(c)
+			return
+		}
+
+		var request seasonRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid season data", nil)
+			return
+		}
+		if !request.EndsAt.After(request.StartsAt) {
+			invalidParameter(c, "ends_at", "Season must end after it starts")
+			return
+		}
+
+		created, err := job.Create(gameID, request.StartsAt, request.EndsAt)
+		if errors.Is(err, season.ErrOverlap) {
+			respondError(c, http.StatusConflict, CodeSeasonOverlap, err.Error(), nil)
+			return
+		}
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+// RunSeasonRolloverHandler returns a handler that rolls over ended seasons
+// @Summary      Roll over ended seasons
+// @Description  Freezes the seasons that have ended and starts the next ones now rather than at the next scheduled run
+// @Tags         admin
+// @Produce      json
+// @Success      200  {array}   season.Rollover
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /api/v1/admin/seasons/rollover [post]
+func RunSeasonRolloverHandler(job *season.Job) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rollovers, err := job.Run()
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		if rollovers == nil {
+			rollovers = []season.Rollover{}
+		}
+		c.JSON(http.StatusOK, rollovers)
+	}
+}
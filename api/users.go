@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxDisplayNameLength = 64
+	maxAvatarURLLength   = 2048
+)
+
+type profileRequest struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// SetProfileHandler returns a handler that creates or replaces a player's profile
+// @Summary      Set a player's profile
+// @Description  Creates or replaces the display name and avatar shown next to the player's entries with include=profile. A missing or null field clears it.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        userId  path      int             true  "User ID"
+// @Param        body    body      profileRequest  true  "Profile data"
+// @Success      200     {object}  models.Profile
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /api/v1/users/{userId} [put]
+func SetProfileHandler(store *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDStr := c.Param("userId")
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil || userID <= 0 {
+			invalidUserID(c)
+			return
+		}
+
+		var request profileRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidBody, "Invalid profile data", nil)
+			return
+		}
+		if name := request.DisplayName; name != nil {
+			if *name == "" || utf8.RuneCountInString(*name) > maxDisplayNameLength {
+				invalidParameter(c, "display_name", "Display name must be 1 to 64 characters")
+				return
+			}
+		}
+		if avatar := request.AvatarURL; avatar != nil && !validAvatarURL(*avatar) {
+			invalidParameter(c, "avatar_url", "Avatar URL must be an absolute http or https URL")
+			return
+		}
+
+		profile, err := store.SetProfile(userID, request.DisplayName, request.AvatarURL)
+		if err != nil {
+			internalError(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+func validAvatarURL(avatar string) bool {
+	if len(avatar) > maxAvatarURLLength {
+		return false
+	}
+	u, err := url.Parse(avatar)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// includeProfile parses the include parameter, whose only option is profile.
+// ok is false when an error response has been written.
+func includeProfile(c *gin.Context) (include, ok bool) {
+	value := c.Query("include")
+	if value == "" {
+		return false, true
+	}
+	for _, option := range strings.Split(value, ",") {
+		if strings.TrimSpace(option) != "profile" {
+			invalidParameter(c, "include", "Invalid include, expected profile")
+			return false, false
+		}
+	}
+	return true, true
+}
+
+func entryProfile(profiles map[int64]models.Profile, userID int64) *models.EntryProfile {
+	profile := profiles[userID]
+	return &models.EntryProfile{DisplayName: profile.DisplayName, AvatarURL: profile.AvatarURL}
+}
+
+// withProfiles joins the players' profiles into a top leaders response. The
+// leaders are copied, as the response may share them with the cache.
+func withProfiles(store *store.Store, response models.TopLeadersResponse) models.TopLeadersResponse {
+	userIDs := make([]int64, 0, len(response.Leaders)+1)
+	for _, entry := range response.Leaders {
+		userIDs = append(userIDs, entry.UserID)
+	}
+	if response.Me != nil {
+		userIDs = append(userIDs, response.Me.UserID)
+	}
+	profiles := store.Profiles(userIDs)
+
+	leaders := make([]models.LeaderboardEntry, len(response.Leaders))
+	for i, entry := range response.Leaders {
+		entry.Profile = entryProfile(profiles, entry.UserID)
+		leaders[i] = entry
+	}
+	response.Leaders = leaders
+	if response.Me != nil {
+		me := *response.Me
+		me.Profile = entryProfile(profiles, me.UserID)
+		response.Me = &me
+	}
+	return response
+}
+
+// withRankProfiles joins the profiles of the player and their neighbors into
+// a rank response, copying the neighbors like withProfiles.
+func withRankProfiles(store *store.Store, response models.PlayerRankResponse) models.PlayerRankResponse {
+	userIDs := []int64{response.UserID}
+	for _, entry := range slices.Concat(response.Above, response.Below) {
+		userIDs = append(userIDs, entry.UserID)
+	}
+	profiles := store.Profiles(userIDs)
+
+	response.Profile = entryProfile(profiles, response.UserID)
+	joined := func(entries []models.LeaderboardEntry) []models.LeaderboardEntry {
+		if entries == nil {
+			return nil
+		}
+		copied := make([]models.LeaderboardEntry, len(entries))
+		for i, entry := range entries {
+			entry.Profile = entryProfile(profiles, entry.UserID)
+			copied[i] = entry
+		}
+		return copied
+	}
+	response.Above = joined(response.Above)
+	response.Below = joined(response.Below)
+	return response
+}
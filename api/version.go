@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentPrefix is where the current version of the API is served. A breaking
+// change gets a new prefix with its own handlers, next to this one.
+const CurrentPrefix = "/api/v1"
+
+// legacyPrefix is the unversioned path the API was served under before
+// versioning. It stays an alias of the v1 routes for existing clients.
+const legacyPrefix = "/api"
+
+// versionedGroups returns a group for the current version and one for its
+// unversioned alias. Routes must be registered on both.
+func versionedGroups(r *gin.Engine) []*gin.RouterGroup {
+	return []*gin.RouterGroup{
+		r.Group(CurrentPrefix),
+		r.Group(legacyPrefix, deprecatedAlias(legacyPrefix, CurrentPrefix)),
+	}
+}
+
+// deprecatedAlias marks responses served under an alias as deprecated and
+// links to the same resource under its successor prefix.
+func deprecatedAlias(prefix, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := successor + strings.TrimPrefix(c.Request.URL.Path, prefix)
+		if c.Request.URL.RawQuery != "" {
+			path += "?" + c.Request.URL.RawQuery
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", path))
+		c.Next()
+	}
+}
@@ -0,0 +1,115 @@
+// Command lbctl runs operator tasks against a leaderboard instance through its
+// admin API.
+//
+//	lbctl doctor --game 42 [--addr http://127.0.0.1:8080] [--key KEY]
+//
+// The API key defaults to $LEADERBOARD_API_KEY.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "doctor":
+		os.Exit(runDoctor(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: lbctl doctor --game ID [--addr URL] [--key KEY]")
+	os.Exit(2)
+}
+
+// runDoctor prints the doctor's report for a game. It exits with 1 when any
+// check failed, so it can gate scripts.
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	gameID := flags.Int64("game", 0, "game to check")
+	addr := flags.String("addr", "http://127.0.0.1:8080", "base URL of the instance")
+	asJSON := flags.Bool("json", false, "print the raw report")
+	apiKey := flags.String("key", os.Getenv("LEADERBOARD_API_KEY"), "API key, when the instance requires one")
+	flags.Parse(args)
+
+	if *gameID <= 0 {
+		usage()
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	url := fmt.Sprintf("%s/api/v1/admin/doctor/%d", strings.TrimRight(*addr, "/"), *gameID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lbctl: %v\n", err)
+		return 2
+	}
+	if *apiKey != "" {
+		req.Header.Set("X-API-Key", *apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lbctl: %v\n", err)
+		return 2
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lbctl: %v\n", err)
+		return 2
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "lbctl: %s: %s\n", resp.Status, body)
+		return 2
+	}
+
+	var report doctor.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "lbctl: invalid report: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		os.Stdout.Write(body)
+		fmt.Println()
+	} else {
+		printReport(report)
+	}
+
+	if !report.Healthy {
+		return 1
+	}
+	return 0
+}
+
+func printReport(report doctor.Report) {
+	fmt.Printf("game %d, checked at %s\n\n", report.GameID, report.Started.Format(time.RFC3339))
+	for _, check := range report.Checks {
+		fmt.Printf("%-4s  %-15s %s\n", strings.ToUpper(check.Status), check.Name, check.Detail)
+		if check.Remediation != "" {
+			fmt.Printf("      %-15s -> %s\n", "", check.Remediation)
+		}
+	}
+
+	if report.Healthy {
+		fmt.Println("\nhealthy")
+	} else {
+		fmt.Println("\nunhealthy")
+	}
+}
@@ -10,13 +10,27 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // CALENDAR_TIMEZONE must load even where the image has no zoneinfo
 
 	"github.com/IWhitebird/go-leader-board/api"
 	"github.com/IWhitebird/go-leader-board/config"
+	"github.com/IWhitebird/go-leader-board/internal/auth"
+	"github.com/IWhitebird/go-leader-board/internal/canary"
 	"github.com/IWhitebird/go-leader-board/internal/db"
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+	"github.com/IWhitebird/go-leader-board/internal/idempotency"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/IWhitebird/go-leader-board/internal/models"
 	"github.com/IWhitebird/go-leader-board/internal/mq"
+	"github.com/IWhitebird/go-leader-board/internal/pubsub"
+	"github.com/IWhitebird/go-leader-board/internal/ratelimit"
+	"github.com/IWhitebird/go-leader-board/internal/receipt"
+	"github.com/IWhitebird/go-leader-board/internal/retention"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
+	"github.com/IWhitebird/go-leader-board/internal/season"
 	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/IWhitebird/go-leader-board/internal/webhook"
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
 
@@ -46,15 +60,43 @@ func main() {
 	store := setupStore(pgRepo, cfg)
 	defer store.Close()
 
+	//Initialize seasons, before scores arrive so they are tagged
+	seasonJob := setupSeasons(cfg, pgRepo, store)
+
 	//Initialize kafka
 	producer, consumer := setupKafka(cfg, store, ctx)
 	defer producer.Close()
 	defer consumer.Close()
 
+	//Initialize metrics
+	setupMetrics(store, producer)
+
+	//Initialize redis top N publishing
+	if publisher := setupPublisher(cfg, store); publisher != nil {
+		defer publisher.Close()
+	}
+
+	//Initialize leaderboard change webhooks
+	if webhooks := setupWebhooks(cfg, store); webhooks != nil {
+		defer webhooks.Close()
+	}
+
+	//Initialize retention
+	retentionJob := setupRetention(cfg, pgRepo)
+
+	//Initialize API keys
+	keys := setupAuth(ctx, cfg, pgRepo)
+
+	//Initialize idempotent submissions
+	dedupe := setupIdempotency(ctx, cfg, pgRepo)
+
 	//Initialize router
-	router := setupRouter(store, pgRepo, producer)
+	router := setupRouter(cfg, store, pgRepo, producer, consumer, retentionJob, seasonJob, keys, dedupe)
 	server := setupServer(cfg, router)
 
+	//Initialize pipeline canary
+	setupCanary(ctx, cfg, store, pgRepo)
+
 	//Start server
 	handleGracefulShutdown(server, cancel)
 	startServer(cfg, server)
@@ -62,7 +104,28 @@ func main() {
 
 func setupStore(db *db.PostgresRepository, cfg *config.AppConfig) *store.Store {
 	log.Println("Initializing in-memory store")
+	location, err := time.LoadLocation(cfg.Store.CalendarTimezone)
+	if err != nil {
+		log.Fatalf("Invalid CALENDAR_TIMEZONE %q: %v", cfg.Store.CalendarTimezone, err)
+	}
+	models.CalendarLocation = location
+
+	snapshots := setupSnapshots(cfg)
 	store := store.NewStore(db)
+	setupGameShards(cfg, store)
+	store.RequireRegisteredGames(cfg.Store.RequireRegisteredGames)
+	store.StartIngestWorkers(cfg.Store.IngestWorkers)
+	store.EnableActivityTracking(cfg.Store.ActivityPlayers, cfg.Store.ActivityDepth)
+	store.StartCalendarResets()
+
+	if cfg.Store.CompactionInterval > 0 {
+		store.StartPeriodicCompaction(time.Duration(cfg.Store.CompactionInterval) * time.Second)
+	}
+
+	if snapshots != nil {
+		store.SetSnapshotStore(snapshots)
+		store.StartPeriodicSnapshots(time.Duration(cfg.Snapshot.Interval) * time.Second)
+	}
 
 	// Initialize the store from PostgreSQL database
 	log.Println("Loading existing data from PostgreSQL...")
@@ -74,6 +137,34 @@ func setupStore(db *db.PostgresRepository, cfg *config.AppConfig) *store.Store {
 	return store
 }
 
+func setupGameShards(cfg *config.AppConfig, leaderboard *store.Store) {
+	if cfg.Store.GameShards == "" {
+		return
+	}
+
+	shards, err := store.ParseGameShards(cfg.Store.GameShards)
+	if err != nil {
+		log.Fatalf("Failed to parse game shards: %v", err)
+	}
+	leaderboard.SetGameShards(shards)
+	log.Printf("Sharding %d game boards by player", len(shards))
+}
+
+func setupSnapshots(cfg *config.AppConfig) *store.SnapshotStore {
+	if cfg.Snapshot.Dir == "" {
+		return nil
+	}
+
+	snapshots, err := store.NewSnapshotStore(cfg.Snapshot.Dir)
+	if err != nil {
+		log.Fatalf("Failed to initialize snapshot store: %v", err)
+	}
+	snapshots.SetHistoryRetention(time.Duration(cfg.Snapshot.HistoryDays) * 24 * time.Hour)
+	log.Printf("Store snapshots enabled in %s", cfg.Snapshot.Dir)
+
+	return snapshots
+}
+
 func setupPostgres(cfg *config.AppConfig) (*sql.DB, *db.PostgresRepository) {
 	log.Println("Initializing PostgreSQL connection")
 	pgPool, err := db.CreatePool(cfg)
@@ -134,11 +225,175 @@ func setupKafka(cfg *config.AppConfig, store *store.Store, ctx context.Context)
 	return producer, consumer
 }
 
-func setupRouter(store *store.Store, pgRepo *db.PostgresRepository, producer *mq.KafkaProducer) *gin.Engine {
-	router := gin.Default()
+// setupMetrics refreshes the gauges that are read on demand before each scrape.
+func setupMetrics(store *store.Store, producer *mq.KafkaProducer) {
+	metrics.Default.OnScrape(store.RecordMetrics)
+	metrics.Default.OnScrape(func() {
+		metrics.ProducerQueueDepth.Set(float64(producer.QueueDepth()))
+	})
+}
+
+func setupRetention(cfg *config.AppConfig, pgRepo *db.PostgresRepository) *retention.Job {
+	job := retention.NewJob(pgRepo, cfg.Retention.DefaultDays)
+	if cfg.Retention.Interval > 0 {
+		job.Start(time.Duration(cfg.Retention.Interval) * time.Second)
+		log.Printf("Retention job started, default retention %d days", cfg.Retention.DefaultDays)
+	}
+	return job
+}
+
+func setupSeasons(cfg *config.AppConfig, pgRepo *db.PostgresRepository, store *store.Store) *season.Job {
+	interval := time.Duration(cfg.Seasons.Interval) * time.Second
+	job := season.NewJob(pgRepo, store, interval)
+	if err := job.Refresh(); err != nil {
+		log.Fatalf("Failed to load seasons: %v", err)
+	}
+	if cfg.Seasons.Interval > 0 {
+		job.Start(interval)
+		log.Printf("Season rollover started, checking every %s", interval)
+	}
+	return job
+}
+
+func setupPublisher(cfg *config.AppConfig, store *store.Store) *pubsub.TopNPublisher {
+	if cfg.Redis.Addr == "" {
+		return nil
+	}
+
+	publisher := pubsub.NewTopNPublisher(store, cfg.Redis.Addr, cfg.Redis.ChannelPrefix, cfg.Redis.TopN, time.Duration(cfg.Redis.DebounceMs)*time.Millisecond)
+	publisher.Start()
+	log.Printf("Publishing top %d changes to redis at %s", cfg.Redis.TopN, cfg.Redis.Addr)
+
+	return publisher
+}
+
+func setupWebhooks(cfg *config.AppConfig, store *store.Store) *webhook.Dispatcher {
+	if cfg.Webhooks.File == "" {
+		return nil
+	}
+
+	targets, err := webhook.LoadTargets(cfg.Webhooks.File)
+	if err != nil {
+		log.Fatalf("Failed to load webhooks: %v", err)
+	}
+
+	webhooks := webhook.New(targets, cfg.Webhooks.QueueSize, cfg.Webhooks.MaxAttempts, time.Duration(cfg.Webhooks.Timeout)*time.Second)
+	webhooks.Watch(store)
+	webhooks.Start()
+	log.Printf("Posting leaderboard changes to %d webhooks", len(targets))
+
+	return webhooks
+}
+
+func setupCanary(ctx context.Context, cfg *config.AppConfig, store *store.Store, pgRepo *db.PostgresRepository) {
+	if cfg.Canary.Interval <= 0 {
+		return
+	}
+
+	baseURL := cfg.Canary.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://127.0.0.1:%d", cfg.Server.Port)
+	}
+
+	store.HideGame(cfg.Canary.GameID)
+	check := canary.New(baseURL, cfg.Canary.GameID, time.Duration(cfg.Canary.DelayMs)*time.Millisecond, cfg.Canary.Webhook, pgRepo)
+	check.SetAPIKey(cfg.Canary.APIKey)
+	check.Start(ctx, time.Duration(cfg.Canary.Interval)*time.Second)
+	log.Printf("Canary started on game %d every %ds", cfg.Canary.GameID, cfg.Canary.Interval)
+}
+
+func setupAuth(ctx context.Context, cfg *config.AppConfig, pgRepo *db.PostgresRepository) *auth.Keys {
+	if cfg.Auth.APIKeys == "" && !cfg.Auth.FromDB {
+		return nil
+	}
+
+	keys, err := auth.NewKeys(cfg.Auth.APIKeys)
+	if err != nil {
+		log.Fatalf("Failed to initialize API keys: %v", err)
+	}
+	keys.SetReadsLocked(cfg.Auth.LockReads)
+
+	if cfg.Auth.FromDB {
+		keys.SetRepository(pgRepo)
+		if err := keys.Refresh(); err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		keys.Start(ctx, time.Duration(cfg.Auth.Refresh)*time.Second)
+	}
+	log.Printf("API keys required for writes, and for reads: %t", cfg.Auth.LockReads)
+
+	return keys
+}
+
+func setupIdempotency(ctx context.Context, cfg *config.AppConfig, pgRepo *db.PostgresRepository) *idempotency.Store {
+	if cfg.Idempotency.TTL <= 0 {
+		return nil
+	}
+
+	ttl := time.Duration(cfg.Idempotency.TTL) * time.Second
+	dedupe := idempotency.NewStore(ttl)
+	if cfg.Idempotency.FromDB {
+		dedupe.SetRepository(pgRepo)
+		dedupe.Start(ctx, time.Hour)
+	}
+	log.Printf("Idempotency keys on score submissions kept for %s", ttl)
+
+	return dedupe
+}
+
+func setupReceipts(cfg *config.AppConfig) *receipt.Signer {
+	if cfg.Server.ReceiptKeys == "" {
+		return nil
+	}
+
+	receipts, err := receipt.NewSigner(cfg.Server.ReceiptKeys)
+	if err != nil {
+		log.Fatalf("Failed to initialize receipt signer: %v", err)
+	}
+	log.Println("Score submission receipts enabled")
+
+	return receipts
+}
+
+func setupRateLimit(cfg *config.AppConfig) *ratelimit.Limiter {
+	if cfg.RateLimit.Rate <= 0 {
+		return nil
+	}
+
+	log.Printf("Score submissions limited to %d per second per player", cfg.RateLimit.Rate)
+	return ratelimit.New(float64(cfg.RateLimit.Rate), cfg.RateLimit.Burst, cfg.RateLimit.MaxClients)
+}
+
+func setupDoctor(cfg *config.AppConfig, store *store.Store, pgRepo *db.PostgresRepository, consumer *mq.KafkaConsumer, responseCache *persistence.InMemoryStore) *doctor.Doctor {
+	check := doctor.New(store)
+	check.SetDatabase(pgRepo, cfg.Doctor.SampleSize)
+	check.SetConsumer(consumer, int64(cfg.Doctor.MaxLag))
+	check.AddCheck(api.CacheCheck(store, responseCache))
+	return check
+}
+
+func setupRouter(cfg *config.AppConfig, store *store.Store, pgRepo *db.PostgresRepository, producer *mq.KafkaProducer, consumer *mq.KafkaConsumer, retentionJob *retention.Job, seasonJob *season.Job, keys *auth.Keys, dedupe *idempotency.Store) *gin.Engine {
+	router := gin.New()
+	router.Use(api.RequestIDMiddleware(), gin.LoggerWithFormatter(api.AccessLogFormatter), api.RecoveryMiddleware())
+	api.ConfigureMetrics(router, metrics.Default)
 	responseCache := persistence.NewInMemoryStore(time.Second)
-	api.ConfigureRoutes(router, store, pgRepo, producer, responseCache)
+	receipts := setupReceipts(cfg)
+	limiter := setupRateLimit(cfg)
+	scoreTimes := scoretime.FromConfig(cfg.ScoreTime)
+	topLimits := api.TopLimits{Default: cfg.Server.TopLimit, Max: cfg.Server.TopMaxLimit}
+	api.ConfigureRoutes(router, store, pgRepo, producer, responseCache, receipts, limiter, keys, dedupe, scoreTimes, topLimits)
+	api.ConfigureAdminRoutes(router, store, producer, retentionJob, seasonJob, setupDoctor(cfg, store, pgRepo, consumer, responseCache), keys)
+	if cfg.Server.AllowGetSubmit {
+		api.ConfigureQuerySubmitRoutes(router, store, pgRepo, producer, receipts, limiter, keys, scoreTimes)
+	}
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	if cfg.Server.DebugEndpoints {
+		debugKeys := keys
+		if cfg.Server.DebugOpen {
+			debugKeys = nil
+		}
+		api.ConfigureDebugRoutes(router, store, debugKeys)
+	}
 	return router
 }
 
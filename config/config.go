@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -13,8 +14,43 @@ import (
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
-	Host string
-	Port int
+	Host           string
+	Port           int
+	AllowGetSubmit bool   // Accept score submissions as GET query parameters
+	ReceiptKeys    string // kid:seed pairs for signing receipts, active key first; disabled when empty
+	TopLimit       int    // Leaders returned by the top endpoint when no limit is given
+	TopMaxLimit    int    // Largest limit the top endpoint accepts
+	DebugEndpoints bool   // Serve pprof and the store report under /debug
+	DebugOpen      bool   // Serve /debug without an API key even when keys are configured
+}
+
+// AuthConfig holds the API key configuration. Keys are required on writes
+// when any are configured.
+type AuthConfig struct {
+	APIKeys   string // id:key pairs
+	FromDB    bool   // Also accept the keys in the api_keys table
+	Refresh   int    // in seconds, how often the api_keys table is read
+	LockReads bool   // Require a key on read endpoints too
+}
+
+// IdempotencyConfig holds the score submission idempotency key configuration
+type IdempotencyConfig struct {
+	TTL    int  // in seconds, how long a key's response is replayed, disabled when 0
+	FromDB bool // Also keep responses in Postgres, so they survive restarts
+}
+
+// ScoreTimeConfig bounds the timestamps score submissions may carry
+type ScoreTimeConfig struct {
+	MaxSkew  int  // in seconds, how far in the future a timestamp may be
+	MaxAge   int  // in seconds, how old a timestamp may be, unbounded when 0
+	ClampOld bool // Move older timestamps up to MaxAge instead of rejecting them
+}
+
+// RateLimitConfig holds the per-player score submission limit
+type RateLimitConfig struct {
+	Rate       int // Submissions per second per player, disabled when 0
+	Burst      int // Submissions a player may make at once
+	MaxClients int // Players tracked at once, bounding the limiter's memory
 }
 
 // DatabaseConfig holds the database configuration
@@ -37,11 +73,84 @@ type KafkaConfig struct {
 	ServiceID         string // Unique identifier for this service instance
 }
 
+// StoreConfig holds the in-memory store configuration
+type StoreConfig struct {
+	IngestWorkers          int    // Number of goroutines applying score batches, by game
+	CompactionInterval     int    // in seconds, disabled when 0
+	ActivityPlayers        int    // Players tracked for recent activity, disabled when 0
+	ActivityDepth          int    // Submissions remembered per player
+	GameShards             string // gameID:shards pairs for games whose boards are split by player
+	RequireRegisteredGames bool   // Reject scores for games not registered through the admin API
+	CalendarTimezone       string // IANA time zone whose midnight starts the today and thisweek windows
+}
+
+// SnapshotConfig holds the store snapshot configuration
+type SnapshotConfig struct {
+	Dir         string // Snapshots are disabled when empty
+	Interval    int    // in seconds
+	HistoryDays int    // Days of score history kept for past percentiles, forever when 0
+}
+
+// RetentionConfig holds the score history retention configuration
+type RetentionConfig struct {
+	DefaultDays int // Keep scores forever when 0, games can override it
+	Interval    int // in seconds, the job is disabled when 0
+}
+
+// SeasonConfig holds the season rollover configuration
+type SeasonConfig struct {
+	Interval int // in seconds, rollover is disabled when 0
+}
+
+// RedisConfig holds the Redis top N publisher configuration
+type RedisConfig struct {
+	Addr          string // Publishing is disabled when empty
+	ChannelPrefix string // Each game publishes on ChannelPrefix + game ID
+	TopN          int
+	DebounceMs    int // Minimum time between diffs for one game
+}
+
+// WebhookConfig holds the leaderboard change webhook configuration
+type WebhookConfig struct {
+	File        string // JSON list of targets, webhooks are disabled when empty
+	QueueSize   int    // Deliveries waiting to be sent; more are dropped
+	MaxAttempts int    // Tries per delivery before it is given up
+	Timeout     int    // in seconds, per attempt
+}
+
+// CanaryConfig holds the pipeline canary configuration
+type CanaryConfig struct {
+	Interval int    // in seconds, the canary is disabled when 0
+	GameID   int64  // Reserved game the canary submits to
+	DelayMs  int    // Time between submitting and checking a score
+	BaseURL  string // Where the canary reaches the public API, this server when empty
+	Webhook  string // Receives a POST for every failed check, optional
+	APIKey   string // Sent with the canary's submissions when API keys are required
+}
+
+// DoctorConfig holds the consistency doctor configuration
+type DoctorConfig struct {
+	SampleSize int // Players compared against Postgres per run
+	MaxLag     int // Consumer lag, in messages, above which the lag check fails
+}
+
 // AppConfig holds the application configuration
 type AppConfig struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Kafka    KafkaConfig
+	Server      ServerConfig
+	Auth        AuthConfig
+	RateLimit   RateLimitConfig
+	ScoreTime   ScoreTimeConfig
+	Idempotency IdempotencyConfig
+	Database    DatabaseConfig
+	Kafka       KafkaConfig
+	Store       StoreConfig
+	Snapshot    SnapshotConfig
+	Retention   RetentionConfig
+	Seasons     SeasonConfig
+	Redis       RedisConfig
+	Webhooks    WebhookConfig
+	Canary      CanaryConfig
+	Doctor      DoctorConfig
 }
 
 // NewAppConfig creates a new AppConfig from environment variables
@@ -52,8 +161,34 @@ func NewAppConfig() *AppConfig {
 	}
 	return &AppConfig{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "127.0.0.1"),
-			Port: getEnvAsInt("SERVER_PORT", 8080),
+			Host:           getEnv("SERVER_HOST", "127.0.0.1"),
+			Port:           getEnvAsInt("SERVER_PORT", 8080),
+			AllowGetSubmit: getEnvAsBool("SCORE_SUBMIT_GET", false),
+			ReceiptKeys:    getEnv("RECEIPT_KEYS", ""),
+			TopLimit:       getEnvAsInt("TOP_DEFAULT_LIMIT", 10),
+			TopMaxLimit:    getEnvAsInt("TOP_MAX_LIMIT", 1000),
+			DebugEndpoints: getEnvAsBool("DEBUG_ENDPOINTS", false),
+			DebugOpen:      getEnvAsBool("DEBUG_ENDPOINTS_OPEN", false),
+		},
+		Auth: AuthConfig{
+			APIKeys:   getEnv("API_KEYS", ""),
+			FromDB:    getEnvAsBool("API_KEYS_FROM_DB", false),
+			Refresh:   getEnvAsInt("API_KEYS_REFRESH", 60),
+			LockReads: getEnvAsBool("API_KEYS_LOCK_READS", false),
+		},
+		RateLimit: RateLimitConfig{
+			Rate:       getEnvAsInt("SCORE_RATE_LIMIT", 10),
+			Burst:      getEnvAsInt("SCORE_RATE_BURST", 20),
+			MaxClients: getEnvAsInt("SCORE_RATE_MAX_CLIENTS", 100000),
+		},
+		ScoreTime: ScoreTimeConfig{
+			MaxSkew:  getEnvAsInt("SCORE_MAX_SKEW", 5*60),
+			MaxAge:   getEnvAsInt("SCORE_MAX_AGE", 30*24*60*60),
+			ClampOld: getEnvAsBool("SCORE_CLAMP_OLD", false),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:    getEnvAsInt("IDEMPOTENCY_TTL", 24*60*60),
+			FromDB: getEnvAsBool("IDEMPOTENCY_DB", false),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -71,6 +206,51 @@ func NewAppConfig() *AppConfig {
 			BatchTimeout:      getEnvAsInt("KAFKA_BATCH_TIMEOUT", 5),
 			ServiceID:         generateServiceID(),
 		},
+		Store: StoreConfig{
+			IngestWorkers:          getEnvAsInt("STORE_INGEST_WORKERS", runtime.NumCPU()),
+			CompactionInterval:     getEnvAsInt("STORE_COMPACTION_INTERVAL", 24*60*60),
+			ActivityPlayers:        getEnvAsInt("STORE_ACTIVITY_PLAYERS", 0),
+			ActivityDepth:          getEnvAsInt("STORE_ACTIVITY_DEPTH", 16),
+			GameShards:             getEnv("STORE_GAME_SHARDS", ""),
+			CalendarTimezone:       getEnv("CALENDAR_TIMEZONE", "UTC"),
+			RequireRegisteredGames: getEnvAsBool("REQUIRE_REGISTERED_GAMES", false),
+		},
+		Snapshot: SnapshotConfig{
+			Dir:         getEnv("SNAPSHOT_DIR", ""),
+			Interval:    getEnvAsInt("SNAPSHOT_INTERVAL", 300),
+			HistoryDays: getEnvAsInt("SNAPSHOT_HISTORY_DAYS", 30),
+		},
+		Retention: RetentionConfig{
+			DefaultDays: getEnvAsInt("RETENTION_DAYS", 0),
+			Interval:    getEnvAsInt("RETENTION_INTERVAL", 3600),
+		},
+		Seasons: SeasonConfig{
+			Interval: getEnvAsInt("SEASON_ROLLOVER_INTERVAL", 60),
+		},
+		Redis: RedisConfig{
+			Addr:          getEnv("REDIS_ADDR", ""),
+			ChannelPrefix: getEnv("REDIS_CHANNEL_PREFIX", "leaderboard:top:"),
+			TopN:          getEnvAsInt("REDIS_TOP_N", 10),
+			DebounceMs:    getEnvAsInt("REDIS_DEBOUNCE_MS", 500),
+		},
+		Webhooks: WebhookConfig{
+			File:        getEnv("WEBHOOKS_FILE", ""),
+			QueueSize:   getEnvAsInt("WEBHOOK_QUEUE_SIZE", 1000),
+			MaxAttempts: getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 5),
+			Timeout:     getEnvAsInt("WEBHOOK_TIMEOUT", 5),
+		},
+		Canary: CanaryConfig{
+			Interval: getEnvAsInt("CANARY_INTERVAL", 0),
+			GameID:   int64(getEnvAsInt("CANARY_GAME_ID", 999999999)),
+			DelayMs:  getEnvAsInt("CANARY_DELAY_MS", 10000),
+			BaseURL:  getEnv("CANARY_BASE_URL", ""),
+			Webhook:  getEnv("CANARY_WEBHOOK_URL", ""),
+			APIKey:   getEnv("CANARY_API_KEY", ""),
+		},
+		Doctor: DoctorConfig{
+			SampleSize: getEnvAsInt("DOCTOR_SAMPLE_SIZE", 100),
+			MaxLag:     getEnvAsInt("DOCTOR_MAX_LAG", 10000),
+		},
 	}
 }
 
@@ -92,6 +272,16 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+		log.Printf("Warning: Environment variable %s is not a valid boolean, using default", key)
+	}
+	return defaultValue
+}
+
 // generateServiceID creates a unique service ID for this instance
 func generateServiceID() string {
 	// First try to get from environment (for Docker containers)
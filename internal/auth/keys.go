@@ -0,0 +1,124 @@
+// Package auth holds the API keys clients authenticate with.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+)
+
+// Repository is the subset of the Postgres repository holding rotatable keys.
+type Repository interface {
+	// GetAPIKeys returns the IDs of the keys that are not revoked, by the
+	// hex SHA-256 of the key.
+	GetAPIKeys() (map[string]string, error)
+}
+
+// Keys maps API keys to their IDs. Keys from the configuration are fixed;
+// keys from the repository are read again on every Refresh, so they can be
+// added and revoked without a redeploy. Only hashes of the keys are held.
+type Keys struct {
+	configured  map[string]string
+	repo        Repository
+	readsLocked bool
+
+	mu     sync.RWMutex
+	stored map[string]string
+}
+
+// NewKeys parses comma-separated id:key pairs. The spec may be empty when
+// the keys come from a repository.
+func NewKeys(spec string) (*Keys, error) {
+	k := &Keys{configured: make(map[string]string)}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key %q, expected id:key", pair)
+		}
+		k.configured[Hash(key)] = id
+	}
+
+	return k, nil
+}
+
+// Hash returns the hex SHA-256 of a key, as stored in the repository.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetRepository adds the keys stored in repo. Call Refresh to load them.
+func (k *Keys) SetRepository(repo Repository) {
+	k.repo = repo
+}
+
+// SetReadsLocked makes read endpoints require a key as well as writes.
+func (k *Keys) SetReadsLocked(locked bool) {
+	k.readsLocked = locked
+}
+
+func (k *Keys) ReadsLocked() bool {
+	return k.readsLocked
+}
+
+// Lookup returns the ID of key, and whether it is valid.
+func (k *Keys) Lookup(key string) (string, bool) {
+	hash := Hash(key)
+	if id, ok := k.configured[hash]; ok {
+		return id, true
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	id, ok := k.stored[hash]
+	return id, ok
+}
+
+// Refresh reloads the repository's keys. On error the previous keys stay in
+// use.
+func (k *Keys) Refresh() error {
+	if k.repo == nil {
+		return nil
+	}
+
+	stored, err := k.repo.GetAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.stored = stored
+	k.mu.Unlock()
+	return nil
+}
+
+// Start refreshes the repository's keys every interval until ctx is done.
+func (k *Keys) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.Refresh(); err != nil {
+					logging.Error("Failed to refresh API keys", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
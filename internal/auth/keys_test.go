@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepo struct {
+	keys map[string]string
+	err  error
+}
+
+func (r *fakeRepo) GetAPIKeys() (map[string]string, error) {
+	return r.keys, r.err
+}
+
+func TestKeys_Configured(t *testing.T) {
+	keys, err := NewKeys("ingest:s3cret, admin:0ther")
+	assert.NoError(t, err)
+
+	id, ok := keys.Lookup("s3cret")
+	assert.True(t, ok)
+	assert.Equal(t, "ingest", id)
+	id, ok = keys.Lookup("0ther")
+	assert.True(t, ok)
+	assert.Equal(t, "admin", id)
+	_, ok = keys.Lookup("ingest")
+	assert.False(t, ok)
+
+	for _, spec := range []string{"nokey", ":key", "id:"} {
+		_, err := NewKeys(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestKeys_Repository(t *testing.T) {
+	repo := &fakeRepo{keys: map[string]string{Hash("rotated"): "partner"}}
+	keys, err := NewKeys("ingest:s3cret")
+	assert.NoError(t, err)
+	keys.SetRepository(repo)
+
+	_, ok := keys.Lookup("rotated")
+	assert.False(t, ok, "stored keys are only read on refresh")
+
+	assert.NoError(t, keys.Refresh())
+	id, ok := keys.Lookup("rotated")
+	assert.True(t, ok)
+	assert.Equal(t, "partner", id)
+
+	// A failed refresh keeps the keys already loaded
+	repo.err = errors.New("connection refused")
+	assert.Error(t, keys.Refresh())
+	_, ok = keys.Lookup("rotated")
+	assert.True(t, ok)
+
+	// Revoked keys drop out on the next refresh, configured keys stay
+	repo.keys, repo.err = map[string]string{}, nil
+	assert.NoError(t, keys.Refresh())
+	_, ok = keys.Lookup("rotated")
+	assert.False(t, ok)
+	_, ok = keys.Lookup("s3cret")
+	assert.True(t, ok)
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
@@ -82,6 +83,31 @@ func (sl *SkipList[K, V]) InsertOrUpdate(key K, value V) bool {
 	return sl.insertNode(key, value)
 }
 
+// Upsert sets the key's value to update(current, exists), whether or not the
+// new value compares better, moving the node to its new position, and returns
+// the new value. update runs under the list's lock, so concurrent upserts of
+// the same key each see the other's result.
+func (sl *SkipList[K, V]) Upsert(key K, update func(current V, exists bool) V) V {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	existingNode, nodeExists := sl.mapIndex[key]
+	var current V
+	if nodeExists {
+		current = existingNode.Value
+	}
+
+	value := update(current, nodeExists)
+	if nodeExists {
+		if value == current {
+			return value
+		}
+		sl.deleteNode(existingNode.Key, existingNode.Value)
+	}
+	sl.insertNode(key, value)
+	return value
+}
+
 // insertNode is the internal method to insert a node
 func (sl *SkipList[K, V]) insertNode(key K, value V) bool {
 	update := make([]*SkipListNode[K, V], MaxLevel)
@@ -218,18 +244,82 @@ func (sl *SkipList[K, V]) GetRank(key K) (int, bool) {
 	return rank + 1, true
 }
 
+// GetByRank returns the entry at the given 1-based rank. It follows the span
+// counts down the levels instead of walking the bottom level from the head.
+func (sl *SkipList[K, V]) GetByRank(rank int) (Entry[K, V], bool) {
+	node := sl.nodeByRank(rank)
+	if node == nil {
+		return Entry[K, V]{}, false
+	}
+	return Entry[K, V]{Key: node.Key, Value: node.Value, Rank: rank}, true
+}
+
+func (sl *SkipList[K, V]) nodeByRank(rank int) *SkipListNode[K, V] {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+
+	traversed := 0
+	x := sl.header
+
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.Forward[i] != nil && traversed+x.Span[i] <= rank {
+			traversed += x.Span[i]
+			x = x.Forward[i]
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// CountWhile returns how many leading entries satisfy pred. pred must hold for
+// a prefix of the list and not after it, e.g. "score is greater than X".
+func (sl *SkipList[K, V]) CountWhile(pred func(V) bool) int {
+	count := 0
+	x := sl.header
+
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.Forward[i] != nil && pred(x.Forward[i].Value) {
+			count += x.Span[i]
+			x = x.Forward[i]
+		}
+	}
+
+	return count
+}
+
+// CountGreater returns how many entries rank strictly ahead of value, that is
+// compare as less than it.
+func (sl *SkipList[K, V]) CountGreater(value V) int {
+	return sl.CountWhile(func(v V) bool { return sl.compare(v, value) < 0 })
+}
+
 func (sl *SkipList[K, V]) GetTopK(k int) []Entry[K, V] {
+	return sl.GetRange(0, k)
+}
+
+// GetRange returns up to k entries starting after the first offset entries.
+// The first entry is found through the spans, so deep pages cost O(log n + k)
+// rather than O(offset + k).
+func (sl *SkipList[K, V]) GetRange(offset, k int) []Entry[K, V] {
 	// sl.mu.RLock()
 	// defer sl.mu.RUnlock()
 
-	result := make([]Entry[K, V], 0, k)
-	x := sl.header.Forward[0]
+	if offset < 0 || k <= 0 || offset >= sl.length {
+		return []Entry[K, V]{}
+	}
+
+	result := make([]Entry[K, V], 0, min(k, sl.length-offset))
+	x := sl.nodeByRank(offset + 1)
 
 	for i := 0; i < k && x != nil; i++ {
 		result = append(result, Entry[K, V]{
 			Key:   x.Key,
 			Value: x.Value,
-			Rank:  i + 1,
+			Rank:  offset + i + 1,
 		})
 		x = x.Forward[0]
 	}
@@ -237,6 +327,27 @@ func (sl *SkipList[K, V]) GetTopK(k int) []Entry[K, V] {
 	return result
 }
 
+// GetNeighbors returns the entry for key together with up to before entries
+// ranked above it and up to after entries ranked below it, in rank order.
+func (sl *SkipList[K, V]) GetNeighbors(key K, before, after int) ([]Entry[K, V], bool) {
+	rank, exists := sl.GetRank(key)
+	if !exists {
+		return nil, false
+	}
+
+	start := max(rank-before, 1)
+	return sl.GetRange(start-1, rank-start+1+after), true
+}
+
+// Ascend calls fn for every entry in order until fn returns false.
+func (sl *SkipList[K, V]) Ascend(fn func(key K, value V) bool) {
+	for x := sl.header.Forward[0]; x != nil; x = x.Forward[0] {
+		if !fn(x.Key, x.Value) {
+			return
+		}
+	}
+}
+
 func (sl *SkipList[K, V]) GetAll() []Entry[K, V] {
 	// sl.mu.RLock()
 	// defer sl.mu.RUnlock()
@@ -282,6 +393,55 @@ func (sl *SkipList[K, V]) GetAllExpiredEntries(isExpired func(K) bool) []Entry[K
 	return result
 }
 
+// Validate checks the list's structure: the bottom level is in order and
+// matches the length and key index, and every forward pointer's span is the
+// distance it skips. It reports the first problem found. Like the other
+// readers it does not lock, so the caller must keep writers out.
+func (sl *SkipList[K, V]) Validate() error {
+	ranks := make(map[*SkipListNode[K, V]]int, sl.length)
+	rank := 0
+	var prev *SkipListNode[K, V]
+
+	for x := sl.header.Forward[0]; x != nil; x = x.Forward[0] {
+		rank++
+		if rank > sl.length {
+			return fmt.Errorf("bottom level has more than the %d entries recorded", sl.length)
+		}
+		if prev != nil && sl.compare(prev.Value, x.Value) > 0 {
+			return fmt.Errorf("entry %v at rank %d is out of order", x.Key, rank)
+		}
+		if sl.mapIndex[x.Key] != x {
+			return fmt.Errorf("entry %v at rank %d is not the indexed node for its key", x.Key, rank)
+		}
+		ranks[x] = rank
+		prev = x
+	}
+
+	if rank != sl.length {
+		return fmt.Errorf("bottom level has %d entries, %d recorded", rank, sl.length)
+	}
+	if len(sl.mapIndex) != sl.length {
+		return fmt.Errorf("key index has %d entries, %d recorded", len(sl.mapIndex), sl.length)
+	}
+
+	for i := 1; i < sl.level; i++ {
+		x := sl.header
+		for x.Forward[i] != nil {
+			next := x.Forward[i]
+			nextRank, linked := ranks[next]
+			if !linked {
+				return fmt.Errorf("level %d links entry %v, which is missing from the bottom level", i, next.Key)
+			}
+			if x.Span[i] != nextRank-ranks[x] {
+				return fmt.Errorf("level %d span before entry %v is %d, expected %d", i, next.Key, x.Span[i], nextRank-ranks[x])
+			}
+			x = next
+		}
+	}
+
+	return nil
+}
+
 func (sl *SkipList[K, V]) GetLength() int {
 	// sl.mu.RLock()
 	// defer sl.mu.RUnlock()
@@ -104,6 +104,32 @@ func TestSkipList_Delete(t *testing.T) {
 	assert.Equal(t, 2, sl.GetLength())
 }
 
+func TestSkipList_Upsert(t *testing.T) {
+	sl := NewSkipList[string](reverseIntCompare)
+	add := func(delta int) func(int, bool) int {
+		return func(current int, _ bool) int { return current + delta }
+	}
+
+	assert.Equal(t, 100, sl.Upsert("user1", add(100)))
+	assert.Equal(t, 200, sl.Upsert("user2", add(200)))
+
+	// A worse value replaces the current one and moves the node down.
+	assert.Equal(t, 50, sl.Upsert("user2", add(-150)))
+	rank, _ := sl.GetRank("user2")
+	assert.Equal(t, 2, rank)
+
+	assert.Equal(t, 150, sl.Upsert("user2", add(100)))
+	rank, _ = sl.GetRank("user2")
+	assert.Equal(t, 1, rank)
+
+	sl.Upsert("user1", func(current int, exists bool) int {
+		assert.True(t, exists)
+		return current
+	})
+	assert.Equal(t, 2, sl.GetLength())
+	assert.NoError(t, sl.Validate())
+}
+
 func TestSkipList_GetTopK(t *testing.T) {
 	sl := NewSkipList[string](intCompare)
 
@@ -125,6 +151,27 @@ func TestSkipList_GetTopK(t *testing.T) {
 	assert.Equal(t, 4, len(topAll))
 }
 
+func TestSkipList_GetRange(t *testing.T) {
+	sl := NewSkipList[int](intCompare)
+	for i := 1; i <= 500; i++ {
+		sl.InsertOrUpdate(i, i*10)
+	}
+
+	page := sl.GetRange(120, 5)
+	assert.Equal(t, 5, len(page))
+	for i, entry := range page {
+		assert.Equal(t, 121+i, entry.Rank)
+		assert.Equal(t, 121+i, entry.Key)
+	}
+
+	tail := sl.GetRange(498, 10)
+	assert.Equal(t, 2, len(tail))
+	assert.Equal(t, 500, tail[1].Rank)
+
+	assert.Equal(t, 0, len(sl.GetRange(500, 10)))
+	assert.NotNil(t, sl.GetRange(1000, 10))
+}
+
 func TestSkipList_ReverseOrder(t *testing.T) {
 	sl := NewSkipList[string](reverseIntCompare)
 
@@ -257,3 +304,119 @@ func TestSkipList_GetRank(t *testing.T) {
 	assert.False(t, found)
 	assert.Equal(t, 0, rank)
 }
+
+func TestSkipList_GetByRank(t *testing.T) {
+	sl := NewSkipList[int](reverseIntCompare)
+
+	for i := range 1000 {
+		sl.InsertOrUpdate(i, i)
+	}
+	// Deletes must keep the spans consistent.
+	for i := 0; i < 1000; i += 3 {
+		sl.Delete(i)
+	}
+
+	all := sl.GetAll()
+	for _, expected := range all {
+		entry, found := sl.GetByRank(expected.Rank)
+		assert.True(t, found)
+		assert.Equal(t, expected, entry)
+	}
+
+	_, found := sl.GetByRank(0)
+	assert.False(t, found)
+	_, found = sl.GetByRank(len(all) + 1)
+	assert.False(t, found)
+}
+
+func TestSkipList_CountWhile(t *testing.T) {
+	sl := NewSkipList[string](reverseIntCompare)
+
+	sl.InsertOrUpdate("user1", 300)
+	sl.InsertOrUpdate("user2", 200)
+	sl.InsertOrUpdate("user3", 200)
+	sl.InsertOrUpdate("user4", 100)
+
+	assert.Equal(t, 0, sl.CountWhile(func(v int) bool { return v > 300 }))
+	assert.Equal(t, 1, sl.CountWhile(func(v int) bool { return v > 200 }))
+	assert.Equal(t, 3, sl.CountWhile(func(v int) bool { return v >= 200 }))
+	assert.Equal(t, 4, sl.CountWhile(func(v int) bool { return v > 0 }))
+}
+
+func TestSkipList_CountGreater(t *testing.T) {
+	sl := NewSkipList[string](reverseIntCompare)
+
+	sl.InsertOrUpdate("user1", 300)
+	sl.InsertOrUpdate("user2", 200)
+	sl.InsertOrUpdate("user3", 200)
+	sl.InsertOrUpdate("user4", 100)
+
+	assert.Equal(t, 0, sl.CountGreater(400))
+	assert.Equal(t, 1, sl.CountGreater(200))
+	assert.Equal(t, 3, sl.CountGreater(150))
+	assert.Equal(t, 3, sl.CountGreater(100))
+}
+
+func TestSkipList_GetNeighbors(t *testing.T) {
+	sl := NewSkipList[int](intCompare)
+	for i := 1; i <= 20; i++ {
+		sl.InsertOrUpdate(i, i*10)
+	}
+
+	around, ok := sl.GetNeighbors(10, 2, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 6, len(around))
+	assert.Equal(t, 8, around[0].Rank)
+	assert.Equal(t, 10, around[2].Key)
+	assert.Equal(t, 13, around[5].Rank)
+
+	// Fewer neighbors exist above the first and below the last entry.
+	first, _ := sl.GetNeighbors(1, 3, 1)
+	assert.Equal(t, []int{1, 2}, []int{first[0].Key, first[1].Key})
+	last, _ := sl.GetNeighbors(20, 1, 3)
+	assert.Equal(t, []int{19, 20}, []int{last[0].Key, last[1].Key})
+
+	_, ok = sl.GetNeighbors(99, 1, 1)
+	assert.False(t, ok)
+}
+
+func TestSkipList_Validate(t *testing.T) {
+	build := func() *SkipList[int, int] {
+		sl := NewSkipList[int](intCompare)
+		for i := 1; i <= 1000; i++ {
+			sl.InsertOrUpdate(i, (i*7919)%1000)
+		}
+		for i := 1; i <= 1000; i += 3 {
+			sl.Delete(i)
+		}
+		for i := 2; i <= 1000; i += 5 {
+			sl.InsertOrUpdate(i, -i)
+		}
+		return sl
+	}
+
+	assert.NoError(t, build().Validate())
+	assert.NoError(t, NewSkipList[int](intCompare).Validate())
+
+	// An entry whose value changed without being moved.
+	sl := build()
+	sl.header.Forward[0].Value = 1 << 30
+	assert.ErrorContains(t, sl.Validate(), "out of order")
+
+	// A span that no longer matches the distance it skips.
+	sl = build()
+	assert.Greater(t, sl.level, 1)
+	sl.header.Span[1]++
+	assert.ErrorContains(t, sl.Validate(), "span")
+
+	// A length out of step with the entries.
+	sl = build()
+	sl.length--
+	assert.Error(t, sl.Validate())
+
+	// A key index pointing at a node that was unlinked.
+	sl = build()
+	node := sl.header.Forward[0]
+	sl.mapIndex[node.Key] = &SkipListNode[int, int]{Key: node.Key, Value: node.Value}
+	assert.ErrorContains(t, sl.Validate(), "indexed node")
+}
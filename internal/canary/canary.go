@@ -0,0 +1,264 @@
+package canary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// UserID is the only player of the canary game.
+const UserID int64 = 1
+
+// retention is how long canary scores are kept in Postgres.
+const retention = time.Hour
+
+// Repository is the subset of the Postgres repository the canary needs.
+type Repository interface {
+	GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, error)
+	DeleteScoresBefore(gameID int64, cutoff time.Time) (int64, error)
+}
+
+// Stats summarizes the canary's runs since it started.
+type Stats struct {
+	Runs        uint64        `json:"runs"`
+	Failures    uint64        `json:"failures"`
+	LastLatency time.Duration `json:"last_latency_ns"`
+	LastSuccess time.Time     `json:"last_success,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+// Canary continuously checks the whole score pipeline. Each run submits a
+// score for a reserved game through the public HTTP API, waits, and checks
+// that the score shows up in the top list, in the player's rank and, when a
+// repository is given, in Postgres.
+type Canary struct {
+	baseURL string
+	gameID  int64
+	delay   time.Duration
+	webhook string
+	apiKey  string
+	repo    Repository
+	client  *http.Client
+	now     func() time.Time
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(baseURL string, gameID int64, delay time.Duration, webhook string, repo Repository) *Canary {
+	return &Canary{
+		baseURL: baseURL,
+		gameID:  gameID,
+		delay:   delay,
+		webhook: webhook,
+		repo:    repo,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetAPIKey sets the key sent with the canary's submissions, for instances
+// that require one.
+func (c *Canary) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+func (c *Canary) GameID() int64 {
+	return c.gameID
+}
+
+// Run performs one check. The score submitted is the current unix time in
+// milliseconds, so every run beats the previous one and becomes the top entry.
+func (c *Canary) Run(ctx context.Context) error {
+	start := c.now()
+	score := models.Score{
+		GameID:    c.gameID,
+		UserID:    UserID,
+		Score:     uint64(start.UnixMilli()),
+		Timestamp: start,
+	}
+
+	err := c.check(ctx, score)
+
+	c.mu.Lock()
+	c.stats.Runs++
+	if err != nil {
+		c.stats.Failures++
+		c.stats.LastError = err.Error()
+	} else {
+		c.stats.LastLatency = c.now().Sub(start)
+		c.stats.LastSuccess = start
+		c.stats.LastError = ""
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.alarm(ctx, err)
+	}
+	return err
+}
+
+func (c *Canary) check(ctx context.Context, score models.Score) error {
+	if err := c.submit(ctx, score); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var top models.TopLeadersResponse
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/leaderboard/top/%d?limit=1", c.gameID), &top); err != nil {
+		return err
+	}
+	if len(top.Leaders) == 0 || top.Leaders[0].UserID != UserID || top.Leaders[0].Score != score.Score {
+		return fmt.Errorf("canary score %d is not the top entry: %v", score.Score, top.Leaders)
+	}
+
+	var rank models.PlayerRankResponse
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/leaderboard/rank/%d/%d", c.gameID, UserID), &rank); err != nil {
+		return err
+	}
+	if rank.Rank != 1 || rank.Score != score.Score {
+		return fmt.Errorf("canary rank lookup returned rank %d with score %d, want rank 1 with score %d", rank.Rank, rank.Score, score.Score)
+	}
+
+	if c.repo == nil {
+		return nil
+	}
+	_, _, stored, _, err := c.repo.GetPlayerRank(c.gameID, UserID, models.AllTime)
+	if err != nil {
+		return fmt.Errorf("failed to read canary score from postgres: %w", err)
+	}
+	if stored != score.Score {
+		return fmt.Errorf("postgres holds canary score %d, want %d", stored, score.Score)
+	}
+	return nil
+}
+
+func (c *Canary) submit(ctx context.Context, score models.Score) error {
+	body, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/leaderboard/score", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to submit canary score: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("canary score submission returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *Canary) get(ctx context.Context, path string, response any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// alarm logs the failure and, when a webhook is configured, posts it there.
+func (c *Canary) alarm(ctx context.Context, failure error) {
+	logging.Error("Canary check failed", "game", c.gameID, "error", failure)
+	if c.webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"game_id": c.gameID,
+		"error":   failure.Error(),
+		"at":      c.now(),
+	})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.webhook, bytes.NewReader(body))
+	if err != nil {
+		logging.Error("Failed to build canary alarm", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		logging.Error("Failed to send canary alarm", "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// Cleanup removes canary scores older than an hour from Postgres.
+func (c *Canary) Cleanup() error {
+	if c.repo == nil {
+		return nil
+	}
+	_, err := c.repo.DeleteScoresBefore(c.gameID, c.now().Add(-retention))
+	return err
+}
+
+func (c *Canary) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Start runs the check and the cleanup every interval until ctx is done.
+func (c *Canary) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Run(ctx); err == nil {
+					logging.Info("Canary check passed", "game", c.gameID, "latency", c.Stats().LastLatency)
+				}
+				if err := c.Cleanup(); err != nil {
+					logging.Error("Canary cleanup failed", "game", c.gameID, "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
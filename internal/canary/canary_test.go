@@ -0,0 +1,123 @@
+package canary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/api"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gin-contrib/cache/persistence"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRepository stands in for Postgres by reading the in-memory store, unless
+// lost is set, in which case it has never seen any score.
+type fakeRepository struct {
+	store   *store.Store
+	lost    bool
+	cutoffs []time.Time
+}
+
+func (f *fakeRepository) GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, error) {
+	if f.lost {
+		return 0, 0, 0, 0, nil
+	}
+	rank, percentile, score, total, _ := f.store.GetPlayerRank(gameID, userID, window)
+	return rank, percentile, score, total, nil
+}
+
+func (f *fakeRepository) DeleteScoresBefore(gameID int64, cutoff time.Time) (int64, error) {
+	f.cutoffs = append(f.cutoffs, cutoff)
+	return 0, nil
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *store.Store) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	leaderboard := store.NewStore(nil)
+
+	// Without Kafka, submissions are applied to the store directly, standing
+	// in for the producer and consumer.
+	router.Use(func(c *gin.Context) {
+		if c.Request.Method == http.MethodPost {
+			body, _ := io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			var score models.Score
+			if json.Unmarshal(body, &score) == nil {
+				leaderboard.AddScore(score)
+			}
+		}
+		c.Next()
+	})
+	api.ConfigureRoutes(router, leaderboard, nil, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, leaderboard
+}
+
+func TestCanary_PassesThroughThePipeline(t *testing.T) {
+	server, leaderboard := newTestServer(t)
+	repo := &fakeRepository{store: leaderboard}
+	canary := New(server.URL, 777, time.Millisecond, "", repo)
+
+	assert.NoError(t, canary.Run(context.Background()))
+	assert.NoError(t, canary.Run(context.Background()))
+
+	stats := canary.Stats()
+	assert.Equal(t, uint64(2), stats.Runs)
+	assert.Equal(t, uint64(0), stats.Failures)
+	assert.False(t, stats.LastSuccess.IsZero())
+	assert.Empty(t, stats.LastError)
+
+	// Only the canary player is on the board, holding the latest score.
+	assert.Equal(t, uint64(1), leaderboard.TotalPlayers(777))
+
+	assert.NoError(t, canary.Cleanup())
+	assert.Equal(t, 1, len(repo.cutoffs))
+	assert.WithinDuration(t, time.Now().Add(-retention), repo.cutoffs[0], time.Minute)
+}
+
+func TestCanary_AlarmsWhenAStageFails(t *testing.T) {
+	server, leaderboard := newTestServer(t)
+
+	var mu sync.Mutex
+	var alarms []map[string]any
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alarm map[string]any
+		json.NewDecoder(r.Body).Decode(&alarm)
+		mu.Lock()
+		alarms = append(alarms, alarm)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	// The score never reaches Postgres.
+	canary := New(server.URL, 777, time.Millisecond, webhook.URL, &fakeRepository{store: leaderboard, lost: true})
+	err := canary.Run(context.Background())
+	assert.ErrorContains(t, err, "postgres")
+
+	// The public API is down.
+	server.Close()
+	err = canary.Run(context.Background())
+	assert.ErrorContains(t, err, "failed to submit canary score")
+
+	stats := canary.Stats()
+	assert.Equal(t, uint64(2), stats.Runs)
+	assert.Equal(t, uint64(2), stats.Failures)
+	assert.Equal(t, err.Error(), stats.LastError)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, len(alarms))
+	assert.Equal(t, float64(777), alarms[0]["game_id"])
+}
@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/config"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
 	"github.com/IWhitebird/go-leader-board/internal/models"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 //go:embed sql/init.sql
@@ -21,11 +23,20 @@ type PostgresRepository struct {
 
 type PostgresRepositoryInterface interface {
 	SaveScore(score models.Score) error
-	GetTopLeaders(gameID int64, limit int, window models.TimeWindow) ([]models.LeaderboardEntry, error)
+	GetTopLeaders(gameID int64, limit, offset int, window models.TimeWindow) ([]models.LeaderboardEntry, error)
 	GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, error)
 	SaveScoreBatch(scores []models.Score) error
 	GetAllScores() ([]models.Score, error)
 	GetAllScoresForGame(gameID int64) ([]models.Score, error)
+	GetScoresForGameSince(gameID int64, since time.Time) ([]models.Score, error)
+	GetAllGames() ([]int64, error)
+	GetScoresForUser(gameID, userID int64, limit int, before time.Time) ([]models.Score, error)
+	GetTopLeadersSubmittedBefore(gameID int64, limit, offset int, window models.TimeWindow, before time.Time, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error)
+	GetPlayerRankSubmittedBefore(gameID, userID int64, window models.TimeWindow, before time.Time, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error)
+	GetSeasons(gameID int64) ([]models.Season, error)
+	GetSeason(seasonID int64) (*models.Season, error)
+	GetSeasonTopLeaders(gameID, seasonID int64, limit, offset int, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error)
+	GetSeasonPlayerRank(gameID, seasonID, userID int64, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error)
 }
 
 func CreatePool(cfg *config.AppConfig) (*sql.DB, error) {
@@ -72,50 +83,53 @@ func initTables(db *sql.DB) error {
 }
 
 func (r *PostgresRepository) SaveScore(score models.Score) error {
+	defer timeQuery("save_score")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	_, err := r.db.ExecContext(ctx, `
-INSERT INTO scores (game_id, user_id, score, timestamp)
-VALUES ($1, $2, $3, $4)
-`, score.GameID, score.UserID, score.Score, score.Timestamp)
+INSERT INTO scores (game_id, user_id, score, timestamp, received_at, season_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+`, score.GameID, score.UserID, score.Score, score.Timestamp, receivedAt(score), seasonID(score))
 
 	return err
 }
 
-func (r *PostgresRepository) GetTopLeaders(gameID int64, limit int, window models.TimeWindow) ([]models.LeaderboardEntry, error) {
+func (r *PostgresRepository) GetTopLeaders(gameID int64, limit, offset int, window models.TimeWindow) ([]models.LeaderboardEntry, error) {
+	defer timeQuery("get_top_leaders")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	query := `
-SELECT user_id, score, rank
-FROM (
-    SELECT
-        user_id,
-        score,
-        RANK() OVER (ORDER BY score DESC) as rank
-    FROM (
-        SELECT DISTINCT ON (user_id) user_id, score
-        FROM scores
-        WHERE game_id = $1
-    `
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
 
+	where := "game_id = $1"
 	args := []any{gameID}
 	argIndex := 2
 
 	if start, end := window.GetTimeRange(); start != nil {
-		query += fmt.Sprintf(" AND timestamp BETWEEN $%d AND $%d ", argIndex, argIndex+1)
+		where += fmt.Sprintf(" AND timestamp BETWEEN $%d AND $%d", argIndex, argIndex+1)
 		args = append(args, *start, end)
 		argIndex += 2
 	}
 
-	query += `
-        ORDER BY user_id, score DESC
-    ) AS best_scores
+	query := `
+SELECT user_id, score, rank
+FROM (
+    SELECT
+        user_id,
+        score,
+        RANK() OVER (ORDER BY score DESC) as rank
+    FROM (` + boardScores(scoring, where) + `    ) AS best_scores
 ) ranked_scores
-WHERE rank <= $` + fmt.Sprintf("%d", argIndex)
+ORDER BY rank, user_id
+LIMIT $` + fmt.Sprintf("%d OFFSET $%d", argIndex, argIndex+1)
 
-	args = append(args, limit)
+	args = append(args, limit, offset)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -140,25 +154,29 @@ WHERE rank <= $` + fmt.Sprintf("%d", argIndex)
 }
 
 func (r *PostgresRepository) GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, error) {
+	defer timeQuery("get_player_rank")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var score uint64
-	scoreQuery := `
-SELECT MAX(score) as score
-FROM scores
-WHERE game_id = $1 AND user_id = $2
-`
-	args := []any{gameID, userID}
-	argIndex := 3
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	where := "game_id = $1"
+	args := []any{gameID}
 
 	if start, end := window.GetTimeRange(); start != nil {
-		scoreQuery += fmt.Sprintf(" AND timestamp BETWEEN $%d AND $%d ", argIndex, argIndex+1)
+		where += " AND timestamp BETWEEN $2 AND $3"
 		args = append(args, *start, end)
-		argIndex += 2
 	}
 
-	err := r.db.QueryRowContext(ctx, scoreQuery, args...).Scan(&score)
+	var score uint64
+	scoreQuery := `SELECT score FROM (` + boardScores(scoring, where+fmt.Sprintf(" AND user_id = $%d", len(args)+1)) + `) AS player_score`
+	scoreArgs := append(slices.Clone(args), userID)
+
+	err = r.db.QueryRowContext(ctx, scoreQuery, scoreArgs...).Scan(&score)
 	if err == sql.ErrNoRows {
 		return 0, 0, 0, 0, fmt.Errorf("player not found")
 	}
@@ -167,29 +185,13 @@ WHERE game_id = $1 AND user_id = $2
 	}
 
 	rankQuery := `
-WITH player_scores AS (
-    SELECT DISTINCT ON (user_id) user_id, score
-    FROM scores
-    WHERE game_id = $1
-`
-	rankArgs := []any{gameID}
-	rankArgIndex := 2
-
-	if start, end := window.GetTimeRange(); start != nil {
-		rankQuery += fmt.Sprintf(" AND timestamp BETWEEN $%d AND $%d ", rankArgIndex, rankArgIndex+1)
-		rankArgs = append(rankArgs, *start, end)
-		rankArgIndex += 2
-	}
-
-	rankQuery += `
-    ORDER BY user_id, score DESC
-)
+WITH player_scores AS (` + boardScores(scoring, where) + `)
 SELECT
-    (SELECT COUNT(*) FROM player_scores WHERE score > $` + fmt.Sprintf("%d", rankArgIndex) + `) + 1 AS rank,
+    (SELECT COUNT(*) FROM player_scores WHERE score > $` + fmt.Sprintf("%d", len(args)+1) + `) + 1 AS rank,
     (SELECT COUNT(*) FROM player_scores) AS total
 `
 
-	rankArgs = append(rankArgs, score)
+	rankArgs := append(args, score)
 
 	var rank, total uint64
 	err = r.db.QueryRowContext(ctx, rankQuery, rankArgs...).Scan(&rank, &total)
@@ -205,7 +207,225 @@ SELECT
 	return rank, percentile, score, total, nil
 }
 
+// boardScores selects each player's score on the board from the scores
+// matching where, with the timestamp that breaks ties like the in-memory
+// boards: the best score and when it was first reached, or for cumulative
+// games the sum of the submissions, capped at the largest uint64, and the
+// latest of them.
+func boardScores(scoring models.ScoringMode, where string) string {
+	if scoring == models.ScoringCumulative {
+		return `
+    SELECT user_id, LEAST(SUM(score), 18446744073709551615) AS score, MAX(timestamp) AS timestamp
+    FROM scores
+    WHERE ` + where + `
+    GROUP BY user_id
+`
+	}
+	return `
+    SELECT DISTINCT ON (user_id) user_id, score, timestamp
+    FROM scores
+    WHERE ` + where + `
+    ORDER BY user_id, score DESC, timestamp ASC
+`
+}
+
+// scoring returns the game's scoring mode. Games that are not registered keep
+// their best score.
+func (r *PostgresRepository) scoring(ctx context.Context, gameID int64) (models.ScoringMode, error) {
+	var scoring models.ScoringMode
+	err := r.db.QueryRowContext(ctx, `
+SELECT scoring FROM games WHERE game_id = $1 AND registered_at IS NOT NULL
+`, gameID).Scan(&scoring)
+	if err == sql.ErrNoRows {
+		return models.ScoringBest, nil
+	}
+	return scoring, err
+}
+
+// receivedAt is the server receipt time to store for a score, defaulting to
+// now for callers that did not record one.
+// timeQuery records how long a repository method takes, used as
+// defer timeQuery("name")().
+func timeQuery(name string) func() {
+	start := time.Now()
+	return func() {
+		metrics.PostgresQueryDuration.Observe(time.Since(start).Seconds(), name)
+	}
+}
+
+func receivedAt(score models.Score) time.Time {
+	if score.ReceivedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return score.ReceivedAt
+}
+
+// seasonID is the season_id to store for a score, NULL outside of seasons.
+func seasonID(score models.Score) sql.NullInt64 {
+	return sql.NullInt64{Int64: score.SeasonID, Valid: score.SeasonID != 0}
+}
+
+// submittedBeforeScores is a best_scores CTE holding each player's score on
+// the board, as described by boardScores, among the scores the server received
+// before $2, ordered like the in-memory boards: higher score first, then the
+// earlier timestamp. Rows written before receipt times were recorded count as
+// received at their timestamp. Excluded accounts are left out, except $3 when
+// it is set so a player can always see their own rank. Window bounds, when
+// the window has them, are $4 and $5.
+func submittedBeforeScores(scoring models.ScoringMode, window models.TimeWindow) string {
+	where := `game_id = $1
+        AND COALESCE(received_at, timestamp) < $2
+        AND (user_id = $3 OR user_id NOT IN (SELECT user_id FROM excluded_accounts WHERE game_id = $1))`
+	if start, _ := window.GetTimeRange(); start != nil {
+		where += "\n        AND timestamp BETWEEN $4 AND $5"
+	}
+	return "\nWITH best_scores AS (" + boardScores(scoring, where) + ")\n"
+}
+
+func submittedBeforeArgs(gameID, userID int64, window models.TimeWindow, before time.Time) []any {
+	args := []any{gameID, before, userID}
+	if start, end := window.GetTimeRange(); start != nil {
+		args = append(args, *start, end)
+	}
+	return args
+}
+
+// rankedScores lists best_scores in the in-memory boards' order, numbered
+// under the rank mode and with how many other players hold each score.
+func rankedScores(mode models.RankMode) string {
+	rank := "ROW_NUMBER() OVER (ORDER BY score DESC, timestamp ASC, user_id)"
+	switch mode {
+	case models.RankCompetition:
+		rank = "RANK() OVER (ORDER BY score DESC)"
+	case models.RankDense:
+		rank = "DENSE_RANK() OVER (ORDER BY score DESC)"
+	}
+	return `
+SELECT user_id, score, ` + rank + ` AS rank, COUNT(*) OVER (PARTITION BY score) - 1 AS tied_with
+FROM best_scores
+ORDER BY score DESC, timestamp ASC, user_id
+`
+}
+
+// playerStanding selects the standing of player $%d on best_scores: ahead
+// counts the players ordered before them, above those with a strictly higher
+// score and distinct_above the distinct higher scores.
+const playerStanding = `
+SELECT
+    p.score,
+    (SELECT COUNT(*) FROM best_scores b
+        WHERE b.score > p.score OR (b.score = p.score AND b.timestamp < p.timestamp)) AS ahead,
+    (SELECT COUNT(*) FROM best_scores b WHERE b.score > p.score) AS above,
+    (SELECT COUNT(DISTINCT b.score) FROM best_scores b WHERE b.score > p.score) AS distinct_above,
+    (SELECT COUNT(*) FROM best_scores b WHERE b.score = p.score) - 1 AS tied_with,
+    (SELECT COUNT(*) FROM best_scores) AS total
+FROM best_scores p
+WHERE p.user_id = $%d
+`
+
+// scanStanding reads a playerStanding row and ranks the player under the
+// mode, matching the in-memory boards. found is false when there is no row.
+func scanStanding(row *sql.Row, userID int64, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	var score, ahead, above, distinctAbove, tiedWith, total uint64
+	err := row.Scan(&score, &ahead, &above, &distinctAbove, &tiedWith, &total)
+	if err == sql.ErrNoRows {
+		return models.LeaderboardEntry{}, 0, 0, false, nil
+	}
+	if err != nil {
+		return models.LeaderboardEntry{}, 0, 0, false, err
+	}
+
+	entry := models.LeaderboardEntry{UserID: userID, Score: score, Rank: ahead + 1, TiedWith: tiedWith}
+	percentile := 100.0 * float64(total-above) / float64(total)
+	switch mode {
+	case models.RankCompetition:
+		entry.Rank = above + 1
+	case models.RankDense:
+		entry.Rank = distinctAbove + 1
+	default:
+		percentile = 100.0 * float64(total-ahead) / float64(total)
+	}
+	return entry, percentile, total, true, nil
+}
+
+func scanRankedScores(rows *sql.Rows, limit int) ([]models.LeaderboardEntry, error) {
+	defer rows.Close()
+
+	entries := make([]models.LeaderboardEntry, 0, limit)
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		if err := rows.Scan(&entry.UserID, &entry.Score, &entry.Rank, &entry.TiedWith); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetTopLeadersSubmittedBefore returns the top players as they stood when the
+// server had received only the scores before the given instant, together with
+// the number of players on that board. Unlike the in-memory boards it does
+// not change when back-dated scores arrive later.
+func (r *PostgresRepository) GetTopLeadersSubmittedBefore(gameID int64, limit, offset int, window models.TimeWindow, before time.Time, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error) {
+	defer timeQuery("get_top_leaders_submitted_before")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cte := submittedBeforeScores(scoring, window)
+	args := submittedBeforeArgs(gameID, 0, window, before)
+
+	var total uint64
+	if err := r.db.QueryRowContext(ctx, cte+"SELECT COUNT(*) FROM best_scores", args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := cte + rankedScores(mode) + fmt.Sprintf("LIMIT $%d OFFSET $%d\n", len(args)+1, len(args)+2)
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := scanRankedScores(rows, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// GetPlayerRankSubmittedBefore ranks the player on the board described by
+// GetTopLeadersSubmittedBefore. found is false when the player had no score
+// received before the instant.
+func (r *PostgresRepository) GetPlayerRankSubmittedBefore(gameID, userID int64, window models.TimeWindow, before time.Time, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	defer timeQuery("get_player_rank_submitted_before")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return models.LeaderboardEntry{}, 0, 0, false, err
+	}
+
+	query := submittedBeforeScores(scoring, window) + fmt.Sprintf(playerStanding, 3)
+	row := r.db.QueryRowContext(ctx, query, submittedBeforeArgs(gameID, userID, window, before)...)
+	return scanStanding(row, userID, mode)
+}
+
 func (r *PostgresRepository) SaveScoreBatch(scores []models.Score) error {
+	defer timeQuery("save_score_batch")()
+
 	if len(scores) == 0 {
 		return nil
 	}
@@ -224,8 +444,8 @@ func (r *PostgresRepository) SaveScoreBatch(scores []models.Score) error {
 	}()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO scores (game_id, user_id, score, timestamp)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO scores (game_id, user_id, score, timestamp, received_at, season_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`)
 	if err != nil {
 		return err
@@ -233,7 +453,7 @@ func (r *PostgresRepository) SaveScoreBatch(scores []models.Score) error {
 	defer stmt.Close()
 
 	for _, score := range scores {
-		_, err = stmt.ExecContext(ctx, score.GameID, score.UserID, score.Score, score.Timestamp)
+		_, err = stmt.ExecContext(ctx, score.GameID, score.UserID, score.Score, score.Timestamp, receivedAt(score), seasonID(score))
 		if err != nil {
 			return err
 		}
@@ -243,6 +463,8 @@ func (r *PostgresRepository) SaveScoreBatch(scores []models.Score) error {
 }
 
 func (r *PostgresRepository) GetAllGames() ([]int64, error) {
+	defer timeQuery("get_all_games")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -275,6 +497,8 @@ ORDER BY game_id
 }
 
 func (r *PostgresRepository) GetAllScores() ([]models.Score, error) {
+	defer timeQuery("get_all_scores")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -307,6 +531,8 @@ ORDER BY game_id, timestamp DESC
 }
 
 func (r *PostgresRepository) GetAllScoresForGame(gameID int64) ([]models.Score, error) {
+	defer timeQuery("get_all_scores_for_game")()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -338,3 +564,816 @@ ORDER BY timestamp DESC
 
 	return scores, nil
 }
+
+// GetScoresForGameSince returns the scores for a game with a timestamp at or
+// after since. It is used to replay the delta on top of a snapshot.
+func (r *PostgresRepository) GetScoresForGameSince(gameID int64, since time.Time) ([]models.Score, error) {
+	defer timeQuery("get_scores_for_game_since")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	query := `
+SELECT game_id, user_id, score, timestamp
+FROM scores
+WHERE game_id = $1 AND timestamp >= $2
+ORDER BY timestamp DESC
+`
+
+	rows, err := r.db.QueryContext(ctx, query, gameID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []models.Score
+	for rows.Next() {
+		var score models.Score
+		if err := rows.Scan(&score.GameID, &score.UserID, &score.Score, &score.Timestamp); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+// GetScoresForUser returns up to limit of the player's submissions in a game,
+// newest first. When before is set only submissions older than it are
+// returned, so the timestamp of the last row fetches the next page.
+func (r *PostgresRepository) GetScoresForUser(gameID, userID int64, limit int, before time.Time) ([]models.Score, error) {
+	defer timeQuery("get_scores_for_user")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+SELECT game_id, user_id, score, timestamp, received_at
+FROM scores
+WHERE game_id = $1 AND user_id = $2 AND ($3::timestamptz IS NULL OR timestamp < $3)
+ORDER BY timestamp DESC, id DESC
+LIMIT $4
+`
+
+	rows, err := r.db.QueryContext(ctx, query, gameID, userID, sql.NullTime{Time: before, Valid: !before.IsZero()}, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make([]models.Score, 0, limit)
+	for rows.Next() {
+		var score models.Score
+		var received sql.NullTime
+		if err := rows.Scan(&score.GameID, &score.UserID, &score.Score, &score.Timestamp, &received); err != nil {
+			return nil, err
+		}
+		score.ReceivedAt = received.Time
+		scores = append(scores, score)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+// GetRetentionOverrides returns the games with their own retention period, in
+// days. Games without an override use the global default.
+func (r *PostgresRepository) GetRetentionOverrides() (map[int64]int, error) {
+	defer timeQuery("get_retention_overrides")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT game_id, retention_days
+FROM games
+WHERE retention_days IS NOT NULL
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make(map[int64]int)
+	for rows.Next() {
+		var gameID int64
+		var days int
+		if err := rows.Scan(&gameID, &days); err != nil {
+			return nil, err
+		}
+		overrides[gameID] = days
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// SetGameRetention sets a game's retention override. A nil days removes the
+// override so the game falls back to the global default.
+func (r *PostgresRepository) SetGameRetention(gameID int64, days *int) error {
+	defer timeQuery("set_game_retention")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO games (game_id, retention_days)
+VALUES ($1, $2)
+ON CONFLICT (game_id) DO UPDATE SET retention_days = EXCLUDED.retention_days
+`, gameID, days)
+
+	return err
+}
+
+const gameColumns = `game_id, name, sort_order, scoring, min_score, max_score, retention_days, registered_at`
+
+func scanGame(row interface{ Scan(dest ...any) error }) (models.Game, error) {
+	var game models.Game
+	var minScore, maxScore sql.NullInt64
+	var retentionDays sql.NullInt32
+	err := row.Scan(&game.GameID, &game.Name, &game.SortOrder, &game.Scoring, &minScore, &maxScore, &retentionDays, &game.RegisteredAt)
+	if minScore.Valid {
+		value := uint64(minScore.Int64)
+		game.MinScore = &value
+	}
+	if maxScore.Valid {
+		value := uint64(maxScore.Int64)
+		game.MaxScore = &value
+	}
+	if retentionDays.Valid {
+		days := int(retentionDays.Int32)
+		game.RetentionDays = &days
+	}
+	return game, err
+}
+
+// GetRegisteredGames returns every registered game, ordered by game ID.
+func (r *PostgresRepository) GetRegisteredGames() ([]models.Game, error) {
+	defer timeQuery("get_registered_games")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT `+gameColumns+`
+FROM games
+WHERE registered_at IS NOT NULL
+ORDER BY game_id
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []models.Game
+	for rows.Next() {
+		game, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+// GetRegisteredGame returns a registered game, or nil when the game is not
+// registered.
+func (r *PostgresRepository) GetRegisteredGame(gameID int64) (*models.Game, error) {
+	defer timeQuery("get_registered_game")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	game, err := scanGame(r.db.QueryRowContext(ctx, `
+SELECT `+gameColumns+`
+FROM games
+WHERE game_id = $1 AND registered_at IS NOT NULL
+`, gameID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &game, nil
+}
+
+// RegisterGame registers a game, or replaces the settings of one already
+// registered, and returns it as stored. created is false when it was already
+// registered, in which case it keeps its first registration time.
+func (r *PostgresRepository) RegisterGame(game models.Game) (models.Game, bool, error) {
+	defer timeQuery("register_game")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var existed bool
+	err := r.db.QueryRowContext(ctx, `
+SELECT EXISTS (SELECT 1 FROM games WHERE game_id = $1 AND registered_at IS NOT NULL)
+`, game.GameID).Scan(&existed)
+	if err != nil {
+		return game, false, err
+	}
+
+	stored, err := scanGame(r.db.QueryRowContext(ctx, `
+INSERT INTO games (game_id, name, sort_order, scoring, min_score, max_score, retention_days, registered_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (game_id) DO UPDATE SET
+    name = EXCLUDED.name,
+    sort_order = EXCLUDED.sort_order,
+    scoring = EXCLUDED.scoring,
+    min_score = EXCLUDED.min_score,
+    max_score = EXCLUDED.max_score,
+    retention_days = EXCLUDED.retention_days,
+    registered_at = COALESCE(games.registered_at, EXCLUDED.registered_at)
+RETURNING `+gameColumns+`
+`, game.GameID, game.Name, game.SortOrder, game.Scoring, game.MinScore, game.MaxScore, game.RetentionDays, game.RegisteredAt))
+	if err != nil {
+		return game, false, err
+	}
+
+	return stored, !existed, nil
+}
+
+func (r *PostgresRepository) CountScoresBefore(gameID int64, cutoff time.Time) (int64, error) {
+	defer timeQuery("count_scores_before")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM scores
+WHERE game_id = $1 AND timestamp < $2
+`, gameID, cutoff).Scan(&count)
+
+	return count, err
+}
+
+func (r *PostgresRepository) DeleteScoresBefore(gameID int64, cutoff time.Time) (int64, error) {
+	defer timeQuery("delete_scores_before")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+DELETE FROM scores
+WHERE game_id = $1 AND timestamp < $2
+`, gameID, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetBestScores returns each of the players' score on the game's all-time
+// board: their best, or their total in cumulative games. Players without a
+// score are left out.
+func (r *PostgresRepository) GetBestScores(gameID int64, userIDs []int64) (map[int64]uint64, error) {
+	defer timeQuery("get_best_scores")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT user_id, score FROM (`+boardScores(scoring, "game_id = $1 AND user_id = ANY($2)")+`) AS best_scores
+`, gameID, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	best := make(map[int64]uint64, len(userIDs))
+	for rows.Next() {
+		var userID int64
+		var score uint64
+		if err := rows.Scan(&userID, &score); err != nil {
+			return nil, err
+		}
+		best[userID] = score
+	}
+
+	return best, rows.Err()
+}
+
+// DeleteGameScores removes every score of the game. Its settings and excluded
+// accounts are kept.
+func (r *PostgresRepository) DeleteGameScores(gameID int64) (int64, error) {
+	defer timeQuery("delete_game_scores")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+DELETE FROM scores
+WHERE game_id = $1
+`, gameID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteUser removes every score and exclusion of the player, in one
+// transaction, and returns the games they were removed from.
+func (r *PostgresRepository) DeleteUser(userID int64) ([]int64, error) {
+	defer timeQuery("delete_user")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+WITH deleted_scores AS (
+    DELETE FROM scores WHERE user_id = $1 RETURNING game_id
+), deleted_exclusions AS (
+    DELETE FROM excluded_accounts WHERE user_id = $1 RETURNING game_id
+)
+SELECT game_id FROM deleted_scores
+UNION
+SELECT game_id FROM deleted_exclusions
+ORDER BY game_id
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []int64
+	for rows.Next() {
+		var gameID int64
+		if err := rows.Scan(&gameID); err != nil {
+			return nil, err
+		}
+		games = append(games, gameID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, tx.Commit()
+}
+
+// GetExcludedAccounts returns the excluded accounts of every game.
+func (r *PostgresRepository) GetExcludedAccounts() (map[int64][]int64, error) {
+	defer timeQuery("get_excluded_accounts")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT game_id, user_id
+FROM excluded_accounts
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	excluded := make(map[int64][]int64)
+	for rows.Next() {
+		var gameID, userID int64
+		if err := rows.Scan(&gameID, &userID); err != nil {
+			return nil, err
+		}
+		excluded[gameID] = append(excluded[gameID], userID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return excluded, nil
+}
+
+func (r *PostgresRepository) AddExcludedAccount(gameID, userID int64) error {
+	defer timeQuery("add_excluded_account")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO excluded_accounts (game_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`, gameID, userID)
+
+	return err
+}
+
+func (r *PostgresRepository) RemoveExcludedAccount(gameID, userID int64) error {
+	defer timeQuery("remove_excluded_account")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+DELETE FROM excluded_accounts
+WHERE game_id = $1 AND user_id = $2
+`, gameID, userID)
+
+	return err
+}
+
+// GetAPIKeys returns the IDs of the API keys that are not revoked, by key hash.
+func (r *PostgresRepository) GetAPIKeys() (map[string]string, error) {
+	defer timeQuery("get_api_keys")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT key_hash, id
+FROM api_keys
+WHERE revoked_at IS NULL OR revoked_at > NOW()
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]string)
+	for rows.Next() {
+		var hash, id string
+		if err := rows.Scan(&hash, &id); err != nil {
+			return nil, err
+		}
+		keys[hash] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetIdempotentResponse returns the response stored for an idempotency key
+// since the given time, or nil when there is none.
+func (r *PostgresRepository) GetIdempotentResponse(key string, since time.Time) (*models.IdempotentResponse, error) {
+	defer timeQuery("get_idempotent_response")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response := models.IdempotentResponse{Key: key}
+	err := r.db.QueryRowContext(ctx, `
+SELECT fingerprint, status, body, created_at
+FROM idempotency_keys
+WHERE key = $1 AND created_at >= $2
+`, key, since).Scan(&response.Fingerprint, &response.Status, &response.Body, &response.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SaveIdempotentResponse stores the response for an idempotency key,
+// replacing an expired one.
+func (r *PostgresRepository) SaveIdempotentResponse(response models.IdempotentResponse) error {
+	defer timeQuery("save_idempotent_response")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO idempotency_keys (key, fingerprint, status, body, created_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE SET
+    fingerprint = EXCLUDED.fingerprint,
+    status = EXCLUDED.status,
+    body = EXCLUDED.body,
+    created_at = EXCLUDED.created_at
+`, response.Key, response.Fingerprint, response.Status, response.Body, response.CreatedAt)
+
+	return err
+}
+
+// DeleteIdempotentResponsesBefore deletes the responses stored before cutoff.
+func (r *PostgresRepository) DeleteIdempotentResponsesBefore(cutoff time.Time) (int64, error) {
+	defer timeQuery("delete_idempotent_responses_before")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+DELETE FROM idempotency_keys
+WHERE created_at < $1
+`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetProfiles returns the profiles of the given users that have one, by user
+// ID.
+func (r *PostgresRepository) GetProfiles(userIDs []int64) (map[int64]models.Profile, error) {
+	defer timeQuery("get_profiles")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT user_id, display_name, avatar_url, updated_at
+FROM users
+WHERE user_id = ANY($1)
+`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make(map[int64]models.Profile, len(userIDs))
+	for rows.Next() {
+		var profile models.Profile
+		if err := rows.Scan(&profile.UserID, &profile.DisplayName, &profile.AvatarURL, &profile.UpdatedAt); err != nil {
+			return nil, err
+		}
+		profiles[profile.UserID] = profile
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// SaveProfile creates or replaces a user's profile.
+func (r *PostgresRepository) SaveProfile(profile models.Profile) error {
+	defer timeQuery("save_profile")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO users (user_id, display_name, avatar_url, updated_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    display_name = EXCLUDED.display_name,
+    avatar_url = EXCLUDED.avatar_url,
+    updated_at = EXCLUDED.updated_at
+`, profile.UserID, profile.DisplayName, profile.AvatarURL, profile.UpdatedAt)
+
+	return err
+}
+
+func scanSeasons(rows *sql.Rows) ([]models.Season, error) {
+	seasons := make([]models.Season, 0)
+	for rows.Next() {
+		var season models.Season
+		if err := rows.Scan(&season.SeasonID, &season.GameID, &season.StartsAt, &season.EndsAt, &season.FrozenAt); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return seasons, nil
+}
+
+// GetSeasons returns a game's seasons, oldest first.
+func (r *PostgresRepository) GetSeasons(gameID int64) ([]models.Season, error) {
+	defer timeQuery("get_seasons")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT season_id, game_id, starts_at, ends_at, frozen_at
+FROM seasons
+WHERE game_id = $1
+ORDER BY starts_at
+`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSeasons(rows)
+}
+
+// GetOpenSeasons returns the seasons of every game that are not frozen yet.
+func (r *PostgresRepository) GetOpenSeasons() ([]models.Season, error) {
+	defer timeQuery("get_open_seasons")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT season_id, game_id, starts_at, ends_at, frozen_at
+FROM seasons
+WHERE frozen_at IS NULL
+ORDER BY game_id, starts_at
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSeasons(rows)
+}
+
+// GetSeason returns a season, or nil when there is none with the ID.
+func (r *PostgresRepository) GetSeason(seasonID int64) (*models.Season, error) {
+	defer timeQuery("get_season")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var season models.Season
+	err := r.db.QueryRowContext(ctx, `
+SELECT season_id, game_id, starts_at, ends_at, frozen_at
+FROM seasons
+WHERE season_id = $1
+`, seasonID).Scan(&season.SeasonID, &season.GameID, &season.StartsAt, &season.EndsAt, &season.FrozenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &season, nil
+}
+
+// CreateSeason adds a season and returns it with its ID. created is false,
+// and nothing is added, when it would overlap another season of the game.
+func (r *PostgresRepository) CreateSeason(season models.Season) (models.Season, bool, error) {
+	defer timeQuery("create_season")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, `
+INSERT INTO seasons (game_id, starts_at, ends_at)
+SELECT $1, $2, $3
+WHERE NOT EXISTS (
+    SELECT 1 FROM seasons
+    WHERE game_id = $1 AND starts_at < $3 AND ends_at > $2
+)
+ON CONFLICT (game_id, starts_at) DO NOTHING
+RETURNING season_id
+`, season.GameID, season.StartsAt, season.EndsAt).Scan(&season.SeasonID)
+	if err == sql.ErrNoRows {
+		return season, false, nil
+	}
+	if err != nil {
+		return season, false, err
+	}
+
+	return season, true, nil
+}
+
+// FreezeSeason marks a season frozen. frozen is false when it already was, so
+// only one instance acts on each rollover.
+func (r *PostgresRepository) FreezeSeason(seasonID int64, at time.Time) (bool, error) {
+	defer timeQuery("freeze_season")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+UPDATE seasons
+SET frozen_at = $2
+WHERE season_id = $1 AND frozen_at IS NULL
+`, seasonID, at)
+	if err != nil {
+		return false, err
+	}
+
+	frozen, err := result.RowsAffected()
+	return frozen > 0, err
+}
+
+// GetScoresForSeason returns every score received in a season.
+func (r *PostgresRepository) GetScoresForSeason(seasonID int64) ([]models.Score, error) {
+	defer timeQuery("get_scores_for_season")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT game_id, user_id, score, timestamp, season_id
+FROM scores
+WHERE season_id = $1
+`, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []models.Score
+	for rows.Next() {
+		var score models.Score
+		if err := rows.Scan(&score.GameID, &score.UserID, &score.Score, &score.Timestamp, &score.SeasonID); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+// seasonScores is a best_scores CTE holding each player's score on the board,
+// as described by boardScores, in season $1 of game $3, ordered like the
+// in-memory boards. Excluded accounts are left out, except $2 when it is set
+// so a player can always see their own rank.
+func seasonScores(scoring models.ScoringMode) string {
+	where := `season_id = $1
+        AND (user_id = $2 OR user_id NOT IN (SELECT user_id FROM excluded_accounts WHERE game_id = $3))`
+	return "\nWITH best_scores AS (" + boardScores(scoring, where) + ")\n"
+}
+
+// GetSeasonTopLeaders returns a season's top players from Postgres, with the
+// number of players on its board.
+func (r *PostgresRepository) GetSeasonTopLeaders(gameID, seasonID int64, limit, offset int, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error) {
+	defer timeQuery("get_season_top_leaders")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cte := seasonScores(scoring)
+	args := []any{seasonID, 0, gameID}
+
+	var total uint64
+	if err := r.db.QueryRowContext(ctx, cte+"SELECT COUNT(*) FROM best_scores", args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, cte+rankedScores(mode)+"LIMIT $4 OFFSET $5\n", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := scanRankedScores(rows, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// GetSeasonPlayerRank ranks the player on a season's board in Postgres.
+// found is false when the player has no score in the season.
+func (r *PostgresRepository) GetSeasonPlayerRank(gameID, seasonID, userID int64, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	defer timeQuery("get_season_player_rank")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	scoring, err := r.scoring(ctx, gameID)
+	if err != nil {
+		return models.LeaderboardEntry{}, 0, 0, false, err
+	}
+
+	row := r.db.QueryRowContext(ctx, seasonScores(scoring)+fmt.Sprintf(playerStanding, 2), seasonID, userID, gameID)
+	return scanStanding(row, userID, mode)
+}
@@ -6,7 +6,85 @@ CREATE TABLE IF NOT EXISTS scores (
     timestamp TIMESTAMP WITH TIME ZONE NOT NULL
 );
 
+-- When the server received the score, as opposed to the client's timestamp.
+-- Rows written before it was recorded are NULL.
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS received_at TIMESTAMP WITH TIME ZONE;
+
 -- Indexes for common queries
 CREATE INDEX IF NOT EXISTS idx_scores_game_user ON scores (game_id, user_id);
 CREATE INDEX IF NOT EXISTS idx_scores_game_score ON scores (game_id, score DESC);
-CREATE INDEX IF NOT EXISTS idx_scores_timestamp ON scores (timestamp); 
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_scores_timestamp ON scores (timestamp);
+CREATE INDEX IF NOT EXISTS idx_scores_game_timestamp ON scores (game_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_scores_game_user_timestamp ON scores (game_id, user_id, timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_scores_user ON scores (user_id);
+CREATE INDEX IF NOT EXISTS idx_scores_game_received ON scores (game_id, (COALESCE(received_at, timestamp)));
+
+-- Per-game settings
+CREATE TABLE IF NOT EXISTS games (
+    game_id BIGINT PRIMARY KEY,
+    retention_days INT
+);
+
+-- Registered games. Rows holding only a retention override are not
+-- registered, and have a NULL registered_at.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS name TEXT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS sort_order TEXT NOT NULL DEFAULT 'desc';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS min_score BIGINT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS max_score BIGINT;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS registered_at TIMESTAMP WITH TIME ZONE;
+
+-- How submissions make up a player's score: their best one, or the sum of all
+ALTER TABLE games ADD COLUMN IF NOT EXISTS scoring TEXT NOT NULL DEFAULT 'best';
+
+-- Accounts kept out of a game's public rankings, e.g. launch seed accounts
+CREATE TABLE IF NOT EXISTS excluded_accounts (
+    game_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    PRIMARY KEY (game_id, user_id)
+);
+
+-- API keys that can be rotated without a redeploy. Only the hex SHA-256 of
+-- each key is stored; set revoked_at to stop accepting one.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Responses to score submissions made with an Idempotency-Key, so retries
+-- after a restart still get the first response. Rows past the TTL are
+-- deleted by the service.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status INT NOT NULL,
+    body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys (created_at);
+
+-- Display metadata shown next to a player's scores, shared by every game
+CREATE TABLE IF NOT EXISTS users (
+    user_id BIGINT PRIMARY KEY,
+    display_name TEXT,
+    avatar_url TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Seasons of a game, each with its own board. A season is frozen once it has
+-- ended and the next one has been started.
+CREATE TABLE IF NOT EXISTS seasons (
+    season_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    frozen_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (game_id, starts_at)
+);
+
+-- The season a score was received in, NULL outside of seasons
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS season_id BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_scores_season ON scores (season_id, user_id) WHERE season_id IS NOT NULL;
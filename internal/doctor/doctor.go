@@ -0,0 +1,276 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/store"
+)
+
+// Check outcomes.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Repository is the subset of the Postgres repository the doctor needs.
+type Repository interface {
+	GetBestScores(gameID int64, userIDs []int64) (map[int64]uint64, error)
+}
+
+// LagReporter reports how far the Kafka consumer is behind, see
+// mq.KafkaConsumer.
+type LagReporter interface {
+	Lag() int64
+}
+
+// Check is one diagnostic. Run returns a short description of what it found,
+// or an error describing the problem. Remediation is suggested when it fails.
+type Check struct {
+	Name        string
+	Remediation string
+	Run         func(gameID int64) (string, error)
+}
+
+type skipped string
+
+func (s skipped) Error() string { return string(s) }
+
+// Skip returns the error a check's Run returns when it cannot run, for
+// example because a component is not configured.
+func Skip(reason string) error {
+	return skipped(reason)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of every check for a game. Healthy is false when any
+// check failed; skipped checks do not count.
+type Report struct {
+	GameID  int64     `json:"game_id"`
+	Healthy bool      `json:"healthy"`
+	Started time.Time `json:"started"`
+	Checks  []Result  `json:"checks"`
+}
+
+// Doctor checks one game's board for the inconsistencies that lead to wrong
+// ranks: corrupt skiplists, windows that disagree, drift from Postgres, a
+// lagging consumer, stale cached responses and board versions going
+// backwards. A failing check is run a second time after a short delay, so
+// that writes racing with the check are not reported.
+type Doctor struct {
+	store        *store.Store
+	repo         Repository
+	sampleSize   int
+	consumer     LagReporter
+	maxLag       int64
+	extra        []Check
+	recheckDelay time.Duration
+
+	mu       sync.Mutex
+	versions map[int64]uint64 // highest board version seen per game
+}
+
+func New(store *store.Store) *Doctor {
+	return &Doctor{
+		store:        store,
+		recheckDelay: time.Second,
+		versions:     make(map[int64]uint64),
+	}
+}
+
+// SetDatabase enables comparing a sample of sampleSize players against their
+// best scores in Postgres.
+func (d *Doctor) SetDatabase(repo Repository, sampleSize int) {
+	d.repo = repo
+	d.sampleSize = sampleSize
+}
+
+// SetConsumer enables the consumer lag check, which fails above maxLag
+// messages.
+func (d *Doctor) SetConsumer(consumer LagReporter, maxLag int64) {
+	d.consumer = consumer
+	d.maxLag = maxLag
+}
+
+// AddCheck adds a check run after the built-in ones.
+func (d *Doctor) AddCheck(check Check) {
+	d.extra = append(d.extra, check)
+}
+
+func (d *Doctor) checks() []Check {
+	checks := []Check{
+		{
+			Name:        "skiplist",
+			Remediation: "Rebuild the board: delete the game's snapshot, if any, and restart the instance so it reloads from Postgres.",
+			Run:         d.checkSkiplists,
+		},
+		{
+			Name:        "windows",
+			Remediation: "Rebuild the board: delete the game's snapshot, if any, and restart the instance so it reloads from Postgres.",
+			Run:         d.checkWindows,
+		},
+		{
+			Name:        "postgres",
+			Remediation: "Check the consumer's logs for save errors and the consumer lag. Scores deleted by retention also show up here, as board scores missing from Postgres.",
+			Run:         d.checkDatabase,
+		},
+		{
+			Name:        "consumer_lag",
+			Remediation: "Check the consumer's logs and the Kafka brokers. The board is missing every score still in the topic.",
+			Run:         d.checkLag,
+		},
+		{
+			Name:        "board_version",
+			Remediation: "The board was replaced since the last run, for example pruned by compaction and recreated. Cached responses under the reused versions can be served until they expire.",
+			Run:         d.checkVersion,
+		},
+	}
+	return append(checks, d.extra...)
+}
+
+// Run runs every check against the game.
+func (d *Doctor) Run(gameID int64) Report {
+	report := Report{GameID: gameID, Healthy: true, Started: time.Now().UTC()}
+
+	for _, check := range d.checks() {
+		result := d.run(check, gameID)
+		if result.Status == StatusFail && d.recheckDelay > 0 {
+			time.Sleep(d.recheckDelay)
+			result = d.run(check, gameID)
+		}
+		if result.Status == StatusFail {
+			report.Healthy = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+func (d *Doctor) run(check Check, gameID int64) Result {
+	start := time.Now()
+	detail, err := check.Run(gameID)
+
+	result := Result{Name: check.Name, Status: StatusPass, Detail: detail, DurationMs: time.Since(start).Milliseconds()}
+	var skip skipped
+	switch {
+	case errors.As(err, &skip):
+		result.Status = StatusSkip
+		result.Detail = skip.Error()
+	case err != nil:
+		result.Status = StatusFail
+		result.Detail = err.Error()
+		result.Remediation = check.Remediation
+	}
+	return result
+}
+
+func (d *Doctor) board(gameID int64) (*store.GameLeaderboard, error) {
+	leaderboard := d.store.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return nil, Skip("game is not loaded on this instance")
+	}
+	return leaderboard, nil
+}
+
+func (d *Doctor) checkSkiplists(gameID int64) (string, error) {
+	leaderboard, err := d.board(gameID)
+	if err != nil {
+		return "", err
+	}
+	if err := leaderboard.Validate(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d shards per window are well formed", leaderboard.Shards()), nil
+}
+
+func (d *Doctor) checkWindows(gameID int64) (string, error) {
+	leaderboard, err := d.board(gameID)
+	if err != nil {
+		return "", err
+	}
+	if err := leaderboard.CheckWindows(); err != nil {
+		return "", err
+	}
+	return "every window is contained in the longer ones", nil
+}
+
+func (d *Doctor) checkDatabase(gameID int64) (string, error) {
+	if d.repo == nil {
+		return "", Skip("Postgres is not configured")
+	}
+
+	sample := d.store.SampleScores(gameID, d.sampleSize)
+	if len(sample) == 0 {
+		return "", Skip("no players to sample")
+	}
+
+	userIDs := make([]int64, len(sample))
+	for i, score := range sample {
+		userIDs[i] = score.UserID
+	}
+	best, err := d.repo.GetBestScores(gameID, userIDs)
+	if err != nil {
+		return "", fmt.Errorf("failed to read best scores from Postgres: %w", err)
+	}
+
+	var diffs []string
+	for _, score := range sample {
+		stored, ok := best[score.UserID]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("user %d: board %d, none in Postgres", score.UserID, score.Score))
+		case stored != score.Score:
+			diffs = append(diffs, fmt.Sprintf("user %d: board %d, Postgres %d", score.UserID, score.Score, stored))
+		}
+	}
+
+	if len(diffs) > 0 {
+		return "", fmt.Errorf("%d of %d sampled players differ: %s", len(diffs), len(sample), strings.Join(diffs[:min(len(diffs), 5)], "; "))
+	}
+	return fmt.Sprintf("%d sampled players match Postgres", len(sample)), nil
+}
+
+func (d *Doctor) checkLag(int64) (string, error) {
+	if d.consumer == nil {
+		return "", Skip("Kafka consumer is not configured")
+	}
+
+	lag := d.consumer.Lag()
+	if lag > d.maxLag {
+		return "", fmt.Errorf("consumer is %d messages behind, more than %d", lag, d.maxLag)
+	}
+	return fmt.Sprintf("consumer is %d messages behind", lag), nil
+}
+
+// checkVersion fails when the game's board version is lower than on an
+// earlier run. Versions key the response cache, so they must never repeat. It
+// keeps failing until the board passes the highest version seen.
+func (d *Doctor) checkVersion(gameID int64) (string, error) {
+	if _, err := d.board(gameID); err != nil {
+		return "", err
+	}
+	version := d.store.BoardVersion(gameID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen := d.versions[gameID]
+	d.versions[gameID] = max(seen, version)
+	if version < seen {
+		return "", fmt.Errorf("board version %d is lower than %d seen on an earlier run", version, seen)
+	}
+	return fmt.Sprintf("board version %d", version), nil
+}
@@ -0,0 +1,159 @@
+package doctor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRepository answers best scores from a map, standing in for Postgres.
+type fakeRepository struct {
+	best map[int64]uint64
+}
+
+func (f *fakeRepository) GetBestScores(gameID int64, userIDs []int64) (map[int64]uint64, error) {
+	best := make(map[int64]uint64)
+	for _, userID := range userIDs {
+		if score, ok := f.best[userID]; ok {
+			best[userID] = score
+		}
+	}
+	return best, nil
+}
+
+type fakeLag int64
+
+func (f fakeLag) Lag() int64 { return int64(f) }
+
+// newDoctor returns a doctor over a game with players 1 to 50, and a
+// repository agreeing with the board.
+func newDoctor() (*Doctor, *store.Store, *fakeRepository) {
+	leaderboard := store.NewStore(nil)
+	repo := &fakeRepository{best: make(map[int64]uint64)}
+	now := time.Now().UTC()
+	for i := int64(1); i <= 50; i++ {
+		leaderboard.AddScore(models.Score{GameID: 1, UserID: i, Score: uint64(i * 10), Timestamp: now})
+		repo.best[i] = uint64(i * 10)
+	}
+
+	d := New(leaderboard)
+	d.recheckDelay = 0
+	d.SetDatabase(repo, 20)
+	d.SetConsumer(fakeLag(5), 100)
+	return d, leaderboard, repo
+}
+
+func statuses(report Report) map[string]string {
+	byName := make(map[string]string)
+	for _, result := range report.Checks {
+		byName[result.Name] = result.Status
+	}
+	return byName
+}
+
+func TestDoctor_Healthy(t *testing.T) {
+	d, _, _ := newDoctor()
+
+	report := d.Run(1)
+	assert.True(t, report.Healthy)
+	assert.Equal(t, map[string]string{
+		"skiplist":      StatusPass,
+		"windows":       StatusPass,
+		"postgres":      StatusPass,
+		"consumer_lag":  StatusPass,
+		"board_version": StatusPass,
+	}, statuses(report))
+	for _, result := range report.Checks {
+		assert.Empty(t, result.Remediation)
+	}
+}
+
+func TestDoctor_SkipsWhatIsNotConfigured(t *testing.T) {
+	d := New(store.NewStore(nil))
+
+	report := d.Run(1)
+	assert.True(t, report.Healthy)
+	for _, result := range report.Checks {
+		assert.Equal(t, StatusSkip, result.Status, result.Name)
+	}
+}
+
+func TestDoctor_PostgresDrift(t *testing.T) {
+	d, _, repo := newDoctor()
+	repo.best[50] = 9999
+	delete(repo.best, 48)
+
+	report := d.Run(1)
+	assert.False(t, report.Healthy)
+	result := report.Checks[2]
+	assert.Equal(t, "postgres", result.Name)
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Contains(t, result.Detail, "2 of 20 sampled players differ")
+	assert.Contains(t, result.Detail, "user 50: board 500, Postgres 9999")
+	assert.Contains(t, result.Detail, "user 48: board 480, none in Postgres")
+	assert.NotEmpty(t, result.Remediation)
+}
+
+func TestDoctor_ConsumerLag(t *testing.T) {
+	d, _, _ := newDoctor()
+	d.SetConsumer(fakeLag(500), 100)
+
+	report := d.Run(1)
+	assert.False(t, report.Healthy)
+	assert.Equal(t, StatusFail, statuses(report)["consumer_lag"])
+}
+
+func TestDoctor_WindowsDisagree(t *testing.T) {
+	d, leaderboard, _ := newDoctor()
+
+	// A snapshot holding a 24h entry better than the player's all-time one.
+	var snap store.GameSnapshot
+	snap.Windows[models.Last24Hours.GetLeaderboardIndex()] = []models.Score{
+		{UserID: 7, Score: 100_000, Timestamp: time.Now().UTC()},
+	}
+	leaderboard.GetLeaderboard(1).Restore(&snap)
+
+	report := d.Run(1)
+	assert.False(t, report.Healthy)
+	assert.Equal(t, StatusFail, statuses(report)["windows"])
+	assert.Equal(t, StatusPass, statuses(report)["skiplist"])
+	assert.Contains(t, report.Checks[1].Detail, "user 7")
+}
+
+func TestDoctor_VersionGoesBackwards(t *testing.T) {
+	d, leaderboard, _ := newDoctor()
+	assert.True(t, d.Run(1).Healthy)
+
+	// Compaction drops the emptied board, and the next score creates a new
+	// one whose versions start over.
+	leaderboard.ResetGame(1, false)
+	leaderboard.Compact(false)
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 10, Timestamp: time.Now().UTC()})
+
+	report := d.Run(1)
+	assert.Equal(t, StatusFail, statuses(report)["board_version"])
+	assert.Contains(t, report.Checks[4].Detail, "lower than")
+}
+
+func TestDoctor_RechecksFailures(t *testing.T) {
+	d, _, _ := newDoctor()
+
+	// A check that only fails once, like one racing with a write.
+	runs := 0
+	d.AddCheck(Check{Name: "flaky", Run: func(int64) (string, error) {
+		runs++
+		if runs == 1 {
+			return "", assert.AnError
+		}
+		return "ok", nil
+	}})
+
+	d.recheckDelay = time.Millisecond
+	report := d.Run(1)
+	assert.True(t, report.Healthy)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, StatusPass, statuses(report)["flaky"])
+}
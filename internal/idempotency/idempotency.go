@@ -0,0 +1,197 @@
+// Package idempotency remembers the results of requests made with an
+// idempotency key, so that a client retrying after a timeout gets the first
+// result back instead of the request being carried out again.
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// sweepInterval bounds how often expired responses are looked for.
+const sweepInterval = time.Minute
+
+// Repository is the subset of the Postgres repository that keeps responses
+// across restarts.
+type Repository interface {
+	// GetIdempotentResponse returns the response stored for key since the
+	// given time, or nil when there is none.
+	GetIdempotentResponse(key string, since time.Time) (*models.IdempotentResponse, error)
+	SaveIdempotentResponse(response models.IdempotentResponse) error
+	DeleteIdempotentResponsesBefore(cutoff time.Time) (int64, error)
+}
+
+// Store holds responses by key for the TTL. A key is claimed by Begin and
+// then either finished with its response or released with Abort.
+type Store struct {
+	ttl  time.Duration
+	repo Repository
+	now  func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	done     chan struct{} // Closed when the request holding the key ends
+	response *models.IdempotentResponse
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:     ttl,
+		now:     func() time.Time { return time.Now().UTC() },
+		entries: make(map[string]*entry),
+	}
+}
+
+// SetRepository makes responses outlive the process by also saving them in
+// repo.
+func (s *Store) SetRepository(repo Repository) {
+	s.repo = repo
+}
+
+// Key scopes a client's idempotency key to the game and player it submits
+// for, so that two players' keys never collide.
+func Key(gameID, userID int64, clientKey string) string {
+	return fmt.Sprintf("%d:%d:%s", gameID, userID, clientKey)
+}
+
+// Begin claims key. When a request with the key has already finished within
+// the TTL, its response is returned and the key is not claimed. When one is
+// still running, Begin waits for it to end. On a nil response the caller
+// holds the key and must call Finish or Abort.
+func (s *Store) Begin(ctx context.Context, key string) (*models.IdempotentResponse, error) {
+	for {
+		s.mu.Lock()
+		now := s.now()
+		if now.Sub(s.lastSweep) >= min(s.ttl, sweepInterval) {
+			s.sweep(now)
+		}
+
+		e, ok := s.entries[key]
+		if ok && e.response != nil && !s.expired(e.response, now) {
+			s.mu.Unlock()
+			return e.response, nil
+		}
+		if ok && e.response == nil {
+			s.mu.Unlock()
+			select {
+			case <-e.done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		e = &entry{done: make(chan struct{})}
+		s.entries[key] = e
+		s.mu.Unlock()
+
+		if s.repo == nil {
+			return nil, nil
+		}
+		stored, err := s.repo.GetIdempotentResponse(key, now.Add(-s.ttl))
+		if err != nil {
+			logging.Error("Failed to read idempotent response", "key", key, "error", err)
+			return nil, nil
+		}
+		if stored != nil {
+			s.complete(key, e, stored)
+		}
+		return stored, nil
+	}
+}
+
+// Finish records the response of the request holding key.
+func (s *Store) Finish(key string, response models.IdempotentResponse) {
+	response.Key = key
+	response.CreatedAt = s.now()
+
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	s.mu.Unlock()
+	if !ok || e.response != nil {
+		return
+	}
+	s.complete(key, e, &response)
+
+	if s.repo != nil {
+		if err := s.repo.SaveIdempotentResponse(response); err != nil {
+			logging.Error("Failed to save idempotent response", "key", key, "error", err)
+		}
+	}
+}
+
+// Abort releases key without a response, so that the next request with it is
+// carried out.
+func (s *Store) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.response != nil {
+		return
+	}
+	delete(s.entries, key)
+	close(e.done)
+}
+
+func (s *Store) complete(key string, e *entry, response *models.IdempotentResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.response = response
+	close(e.done)
+}
+
+func (s *Store) expired(response *models.IdempotentResponse, now time.Time) bool {
+	return now.Sub(response.CreatedAt) >= s.ttl
+}
+
+// sweep drops expired responses. Callers hold mu.
+func (s *Store) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if e.response != nil && s.expired(e.response, now) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Len returns the number of keys held in memory.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Start deletes the repository's expired responses every interval until ctx
+// is done.
+func (s *Store) Start(ctx context.Context, interval time.Duration) {
+	if s.repo == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.repo.DeleteIdempotentResponsesBefore(s.now().Add(-s.ttl)); err != nil {
+					logging.Error("Failed to delete expired idempotent responses", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepo struct {
+	mu        sync.Mutex
+	responses map[string]models.IdempotentResponse
+}
+
+func (r *fakeRepo) GetIdempotentResponse(key string, since time.Time) (*models.IdempotentResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	response, ok := r.responses[key]
+	if !ok || response.CreatedAt.Before(since) {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+func (r *fakeRepo) SaveIdempotentResponse(response models.IdempotentResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[response.Key] = response
+	return nil
+}
+
+func (r *fakeRepo) DeleteIdempotentResponsesBefore(cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newTestStore(ttl time.Duration) (*Store, *time.Time) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	s := NewStore(ttl)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestStore_ReplaysUntilExpired(t *testing.T) {
+	s, now := newTestStore(time.Hour)
+	ctx := context.Background()
+
+	previous, err := s.Begin(ctx, "1:2:abc")
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+	s.Finish("1:2:abc", models.IdempotentResponse{Fingerprint: "f", Status: http.StatusOK, Body: []byte(`{}`)})
+
+	previous, err = s.Begin(ctx, "1:2:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, previous.Status)
+	assert.Equal(t, "f", previous.Fingerprint)
+
+	// Keys are independent
+	previous, _ = s.Begin(ctx, "1:3:abc")
+	assert.Nil(t, previous)
+	s.Abort("1:3:abc")
+
+	*now = now.Add(time.Hour)
+	previous, _ = s.Begin(ctx, "1:2:abc")
+	assert.Nil(t, previous, "expired responses are not replayed")
+	s.Abort("1:2:abc")
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestStore_AbortLetsTheNextRequestThrough(t *testing.T) {
+	s, _ := newTestStore(time.Hour)
+	ctx := context.Background()
+
+	s.Begin(ctx, "k")
+	s.Abort("k")
+
+	previous, err := s.Begin(ctx, "k")
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+}
+
+func TestStore_ConcurrentRequestsRunOnce(t *testing.T) {
+	s := NewStore(time.Hour)
+
+	var ran, replayed atomic.Int64
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			previous, err := s.Begin(context.Background(), "k")
+			assert.NoError(t, err)
+			if previous != nil {
+				replayed.Add(1)
+				return
+			}
+			ran.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			s.Finish("k", models.IdempotentResponse{Status: http.StatusOK})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), ran.Load())
+	assert.Equal(t, int64(31), replayed.Load())
+}
+
+func TestStore_WaitingGivesUpWithTheContext(t *testing.T) {
+	s := NewStore(time.Hour)
+	s.Begin(context.Background(), "k")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.Begin(ctx, "k")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStore_Repository(t *testing.T) {
+	repo := &fakeRepo{responses: make(map[string]models.IdempotentResponse)}
+	first, _ := newTestStore(time.Hour)
+	first.SetRepository(repo)
+
+	first.Begin(context.Background(), "k")
+	first.Finish("k", models.IdempotentResponse{Fingerprint: "f", Status: http.StatusOK})
+	assert.Contains(t, repo.responses, "k")
+
+	// A restarted instance finds the response in the repository
+	restarted, _ := newTestStore(time.Hour)
+	restarted.SetRepository(repo)
+	previous, err := restarted.Begin(context.Background(), "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "f", previous.Fingerprint)
+
+	// and keeps it in memory from then on
+	repo.responses = map[string]models.IdempotentResponse{}
+	previous, _ = restarted.Begin(context.Background(), "k")
+	assert.NotNil(t, previous)
+}
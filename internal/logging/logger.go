@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"context"
 	"log"
 	"os"
 )
@@ -26,3 +27,34 @@ func Error(v ...any) {
 		ErrorLogger.Println(v...)
 	}
 }
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it belongs
+// to, which InfoContext and ErrorContext add to every line.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" when it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// InfoContext is Info followed by the request ID carried by ctx, if any.
+func InfoContext(ctx context.Context, v ...any) {
+	Info(withRequestID(ctx, v)...)
+}
+
+// ErrorContext is Error followed by the request ID carried by ctx, if any.
+func ErrorContext(ctx context.Context, v ...any) {
+	Error(withRequestID(ctx, v)...)
+}
+
+func withRequestID(ctx context.Context, v []any) []any {
+	if id := RequestID(ctx); id != "" {
+		return append(v, "request", id)
+	}
+	return v
+}
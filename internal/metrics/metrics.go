@@ -0,0 +1,55 @@
+// Package metrics holds the service's Prometheus metrics. They are registered
+// on Default, a registry of their own, which /metrics serves and tests read.
+package metrics
+
+var Default = NewRegistry()
+
+// HTTP
+var (
+	HTTPRequests = Default.NewCounter("leaderboard_http_requests_total",
+		"HTTP requests handled, by route template and status code.", "method", "route", "status")
+	HTTPRequestDuration = Default.NewHistogram("leaderboard_http_request_duration_seconds",
+		"Time spent handling HTTP requests, by route template.", DefaultBuckets, "method", "route")
+)
+
+// Store
+var (
+	ScoresApplied = Default.NewCounter("leaderboard_store_scores_applied_total",
+		"Scores applied to the in-memory store.")
+	ScoresRejected = Default.NewCounter("leaderboard_store_scores_rejected_total",
+		"Scores the store refused, because they were invalid or could not be saved to Postgres.")
+	GamesLoaded = Default.NewGauge("leaderboard_store_games_loaded",
+		"Games resident in the in-memory store.")
+	BoardEntries = Default.NewGauge("leaderboard_store_entries",
+		"Entries held by the in-memory store, by window.", "window")
+)
+
+// Kafka
+var (
+	ProducerQueueDepth = Default.NewGauge("leaderboard_kafka_producer_queue_depth",
+		"Scores waiting to be batched for Kafka.")
+	ProducerDropped = Default.NewCounter("leaderboard_kafka_producer_dropped_total",
+		"Scores refused because the producer queue was full.")
+	ProducerFlushFailures = Default.NewCounter("leaderboard_kafka_producer_flush_failures_total",
+		"Batches of messages Kafka did not accept.")
+	ConsumerBatchSize = Default.NewHistogram("leaderboard_kafka_consumer_batch_size",
+		"Scores in each batch the consumer saves.", []float64{1, 10, 50, 100, 500, 1000, 2500, 5000, 10000})
+	ConsumerSaveDuration = Default.NewHistogram("leaderboard_kafka_consumer_save_duration_seconds",
+		"Time spent saving each consumed batch to Postgres and the store.", DefaultBuckets)
+)
+
+// Webhooks
+var (
+	WebhookDelivered = Default.NewCounter("leaderboard_webhook_delivered_total",
+		"Webhook events delivered, by event.", "event")
+	WebhookFailed = Default.NewCounter("leaderboard_webhook_failed_total",
+		"Webhook events given up on after every attempt failed, by event.", "event")
+	WebhookDropped = Default.NewCounter("leaderboard_webhook_dropped_total",
+		"Webhook events dropped because the delivery queue was full, by event.", "event")
+)
+
+// Postgres
+var (
+	PostgresQueryDuration = Default.NewHistogram("leaderboard_postgres_query_duration_seconds",
+		"Time spent on Postgres queries, by repository method.", DefaultBuckets, "query")
+)
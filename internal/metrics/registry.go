@@ -0,0 +1,317 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A minimal implementation of the Prometheus data model: counters, gauges and
+// histograms with labels, written out in the text exposition format. Each
+// metric keeps one series per combination of label values, created on first
+// use.
+
+// DefaultBuckets suit latencies from a millisecond to ten seconds, in seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// Registry holds a set of metrics and writes them out for scraping.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	names    map[string]struct{}
+	onScrape []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// OnScrape registers fn to be called before every scrape, for example to set
+// gauges that are cheaper to read on demand than to keep up to date.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, fn)
+}
+
+func (r *Registry) register(f *family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.names[f.name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", f.name))
+	}
+	r.names[f.name] = struct{}{}
+	r.families = append(r.families, f)
+}
+
+// family is one metric with all its series.
+type family struct {
+	name    string
+	help    string
+	kind    metricType
+	labels  []string
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+// series is one combination of label values. Counters and gauges use value;
+// histograms use counts, one per bucket plus +Inf, and sum.
+type series struct {
+	labelValues []string
+	value       atomic.Uint64 // float64 bits
+	counts      []atomic.Uint64
+	sum         atomic.Uint64 // float64 bits
+}
+
+func (r *Registry) newFamily(name, help string, kind metricType, buckets []float64, labels []string) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.register(f)
+	return f
+}
+
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: slices.Clone(labelValues)}
+	if f.kind == histogramType {
+		s.counts = make([]atomic.Uint64, len(f.buckets)+1)
+	}
+	f.series[key] = s
+	return s
+}
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Counter is a value that only goes up.
+type Counter struct{ f *family }
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.newFamily(name, help, counterType, nil, labels)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter decreased")
+	}
+	addFloat(&c.f.get(labelValues).value, delta)
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+	return math.Float64frombits(c.f.get(labelValues).value.Load())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ f *family }
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.newFamily(name, help, gaugeType, nil, labels)}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.get(labelValues).value.Store(math.Float64bits(value))
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	addFloat(&g.f.get(labelValues).value, delta)
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return math.Float64frombits(g.f.get(labelValues).value.Load())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct{ f *family }
+
+// NewHistogram creates a histogram with the given upper bucket bounds, in
+// increasing order. A +Inf bucket is always added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: %s buckets are not sorted", name))
+	}
+	return &Histogram{r.newFamily(name, help, histogramType, buckets, labels)}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	s := h.f.get(labelValues)
+	i, _ := slices.BinarySearch(h.f.buckets, value)
+	s.counts[i].Add(1)
+	addFloat(&s.sum, value)
+}
+
+// Count returns how many values have been observed.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	s := h.f.get(labelValues)
+	var count uint64
+	for i := range s.counts {
+		count += s.counts[i].Load()
+	}
+	return count
+}
+
+func (h *Histogram) Sum(labelValues ...string) float64 {
+	return math.Float64frombits(h.f.get(labelValues).sum.Load())
+}
+
+// WriteTo writes every metric in the Prometheus text format, after running
+// the OnScrape hooks.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	hooks := slices.Clone(r.onScrape)
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+
+	counter := &countingWriter{w: w}
+	out := bufio.NewWriter(counter)
+	for _, f := range families {
+		f.write(out)
+	}
+	err := out.Flush()
+	return counter.n, err
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+	slices.SortFunc(all, func(a, b *series) int { return slices.Compare(a.labelValues, b.labelValues) })
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	for _, s := range all {
+		labels := formatLabels(f.labels, s.labelValues)
+		if f.kind != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, wrap(labels), formatFloat(math.Float64frombits(s.value.Load())))
+			continue
+		}
+
+		var cumulative uint64
+		for i := range s.counts {
+			cumulative += s.counts[i].Load()
+			le := "+Inf"
+			if i < len(f.buckets) {
+				le = formatFloat(f.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, wrap(join(labels, `le="`+le+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, wrap(labels), formatFloat(math.Float64frombits(s.sum.Load())))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, wrap(labels), cumulative)
+	}
+}
+
+// Handler serves the registry's metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func join(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrap(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
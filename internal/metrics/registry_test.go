@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_TextFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests.\nBy route.", "route", "status")
+	depth := registry.NewGauge("queue_depth", "Queue depth.")
+	latency := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/"quoted"`, "500")
+	depth.Set(7)
+	depth.Add(-2)
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(3, "/a")
+
+	scraped := 0
+	registry.OnScrape(func() { scraped++ })
+
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, scraped)
+	assert.Equal(t, `# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/\"quoted\"",status="500"} 1
+requests_total{route="/a",status="200"} 2
+requests_total{route="/b",status="200"} 1
+# HELP queue_depth Queue depth.
+# TYPE queue_depth gauge
+queue_depth 5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.15
+latency_seconds_count{route="/a"} 3
+`, out.String())
+
+	assert.Equal(t, 2.0, requests.Value("/a", "200"))
+	assert.Equal(t, 5.0, depth.Value())
+	assert.Equal(t, uint64(3), latency.Count("/a"))
+	assert.InDelta(t, 3.15, latency.Sum("/a"), 1e-9)
+
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, w.Body.String(), "queue_depth 5\n")
+}
+
+func TestRegistry_ConcurrentUpdates(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("ops_total", "Operations.", "worker")
+	histogram := registry.NewHistogram("sizes", "Sizes.", []float64{10})
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				counter.Inc(string(rune('a' + w%2)))
+				histogram.Observe(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 4000.0, counter.Value("a"))
+	assert.Equal(t, 4000.0, counter.Value("b"))
+	assert.Equal(t, uint64(8000), histogram.Count())
+	assert.Equal(t, 8000.0, histogram.Sum())
+}
+
+func TestRegistry_Misuse(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("ops_total", "Operations.", "worker")
+
+	assert.Panics(t, func() { registry.NewGauge("ops_total", "Again.") })
+	assert.Panics(t, func() { counter.Inc() })
+	assert.Panics(t, func() { counter.Add(-1, "a") })
+	assert.Panics(t, func() { registry.NewHistogram("bad", "Unsorted.", []float64{2, 1}) })
+}
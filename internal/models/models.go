@@ -1,9 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/IWhitebird/go-leader-board/internal/logging"
 )
 
 type HealthResponse struct {
@@ -13,10 +14,30 @@ type HealthResponse struct {
 }
 
 type Score struct {
-	GameID    int64     `json:"game_id"`
-	UserID    int64     `json:"user_id"`
-	Score     uint64    `json:"score"`
-	Timestamp time.Time `json:"timestamp"`
+	GameID    int64     `json:"game_id" form:"game_id"`
+	UserID    int64     `json:"user_id" form:"user_id"`
+	Score     uint64    `json:"score" form:"score"`
+	Timestamp time.Time `json:"timestamp" form:"timestamp"`
+	// ReceivedAt is when the server accepted the score. It is always set by
+	// the server, never taken from the client, and is not kept in memory.
+	ReceivedAt time.Time `json:"received_at,omitzero" form:"-"`
+	// SeasonID is the game's season the score was received in, 0 when it
+	// has none. The store sets it when the score is saved.
+	SeasonID int64 `json:"-" form:"-"`
+}
+
+// Validate reports why a score cannot be recorded, or nil if it is valid.
+func (s Score) Validate() error {
+	if s.GameID <= 0 {
+		return fmt.Errorf("invalid game ID %d", s.GameID)
+	}
+	if s.UserID <= 0 {
+		return fmt.Errorf("invalid user ID %d", s.UserID)
+	}
+	if s.Timestamp.IsZero() {
+		return fmt.Errorf("missing timestamp")
+	}
+	return nil
 }
 
 func ScoreCompare(a, b Score) int {
@@ -36,31 +57,416 @@ func ScoreCompare(a, b Score) int {
 }
 
 type LeaderboardEntry struct {
-	UserID int64  `json:"user_id"`
-	Score  uint64 `json:"score"`
-	Rank   uint64 `json:"rank"`
+	UserID   int64         `json:"user_id"`
+	Score    uint64        `json:"score"`
+	Rank     uint64        `json:"rank"`
+	TiedWith uint64        `json:"tied_with"`         // Other players with the same score
+	Profile  *EntryProfile `json:"profile,omitempty"` // Only with include=profile
+}
+
+// Profile is a player's display metadata, shared by every game.
+type Profile struct {
+	UserID      int64     `json:"user_id"`
+	DisplayName *string   `json:"display_name"`
+	AvatarURL   *string   `json:"avatar_url"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// EntryProfile is the profile joined into a leaderboard entry. Both fields
+// are null for players without a profile.
+type EntryProfile struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
 }
 
 type TopLeadersResponse struct {
+	GameID          int64              `json:"game_id"`
+	Leaders         []LeaderboardEntry `json:"leaders"`
+	Offset          int                `json:"offset"`
+	TotalPlayers    uint64             `json:"total_players"`
+	Window          string             `json:"window,omitempty"`
+	Me              *LeaderboardEntry  `json:"me,omitempty"`
+	SubmittedBefore *time.Time         `json:"submitted_before,omitempty"`
+	SeasonID        int64              `json:"season_id,omitempty"`
+}
+
+type PlayerRankResponse struct {
+	GameID          int64              `json:"game_id"`
+	UserID          int64              `json:"user_id"`
+	Score           uint64             `json:"score"`
+	Rank            uint64             `json:"rank"`
+	TiedWith        uint64             `json:"tied_with"` // Other players with the same score
+	Percentile      float64            `json:"percentile"`
+	TotalPlayers    uint64             `json:"total_players"`
+	Window          string             `json:"window,omitempty"`
+	SubmittedBefore *time.Time         `json:"submitted_before,omitempty"`
+	SeasonID        int64              `json:"season_id,omitempty"`
+	Profile         *EntryProfile      `json:"profile,omitempty"` // Only with include=profile
+	Above           []LeaderboardEntry `json:"above,omitempty"`   // Only with neighbors, nearest last
+	Below           []LeaderboardEntry `json:"below,omitempty"`   // Only with neighbors, nearest first
+}
+
+// Season is a period of a game with its own board. Scores received between
+// StartsAt and EndsAt count towards it. A season is frozen once it has ended
+// and been rolled over; its board is then only read from Postgres.
+type Season struct {
+	SeasonID int64      `json:"season_id"`
+	GameID   int64      `json:"game_id"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at"`
+	FrozenAt *time.Time `json:"frozen_at,omitempty"`
+}
+
+// Contains reports whether a score received at t counts towards the season.
+func (s Season) Contains(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// PlayerRankLookup is one player's result in a bulk rank lookup. Players
+// without a score in the window have Found set to false.
+type PlayerRankLookup struct {
+	PlayerRankResponse
+	Found bool `json:"found"`
+}
+
+// UserGameRank is a player's standing in one game.
+type UserGameRank struct {
+	GameID       int64   `json:"game_id"`
+	Rank         uint64  `json:"rank"`
+	Score        uint64  `json:"score"`
+	Percentile   float64 `json:"percentile"`
+	TotalPlayers uint64  `json:"total_players"`
+}
+
+// UserRanksResponse lists a player's standing in every game where they have a
+// score in the window, ordered by game ID.
+type UserRanksResponse struct {
+	UserID int64          `json:"user_id"`
+	Games  []UserGameRank `json:"games"`
+	Window string         `json:"window,omitempty"`
+}
+
+// Game is a registered game and its settings. MinScore and MaxScore bound the
+// scores it accepts when set, and RetentionDays overrides the global
+// retention period when set.
+type Game struct {
+	GameID        int64       `json:"game_id"`
+	Name          string      `json:"name"`
+	SortOrder     SortOrder   `json:"sort_order"`
+	Scoring       ScoringMode `json:"scoring"`
+	MinScore      *uint64     `json:"min_score,omitempty"`
+	MaxScore      *uint64     `json:"max_score,omitempty"`
+	RetentionDays *int        `json:"retention_days,omitempty"`
+	RegisteredAt  time.Time   `json:"registered_at"`
+}
+
+// SortOrder is the direction a game's board is ranked in.
+type SortOrder string
+
+// SortDescending ranks the highest score first. It is the only order the
+// boards support for now.
+const SortDescending SortOrder = "desc"
+
+// ScoringMode is how a game's submissions make up a player's score.
+type ScoringMode string
+
+const (
+	// ScoringBest keeps the player's best submission.
+	ScoringBest ScoringMode = "best"
+	// ScoringCumulative adds every submission to the player's total, which
+	// stops at the largest uint64 rather than wrapping.
+	ScoringCumulative ScoringMode = "cumulative"
+)
+
+// Accepts reports whether the score falls within the game's score range.
+func (g Game) Accepts(score uint64) bool {
+	return (g.MinScore == nil || score >= *g.MinScore) && (g.MaxScore == nil || score <= *g.MaxScore)
+}
+
+// GameInfo describes one game the service knows about. TotalPlayers is only
+// counted for games loaded into memory and is 0 otherwise.
+type GameInfo struct {
+	GameID       int64  `json:"game_id"`
+	TotalPlayers uint64 `json:"total_players"`
+	Loaded       bool   `json:"loaded"`
+}
+
+// GamesResponse is one page of the known games, ordered by game ID. Total is
+// the number of games across all pages.
+type GamesResponse struct {
+	Games  []GameInfo `json:"games"`
+	Offset int        `json:"offset"`
+	Total  int        `json:"total"`
+}
+
+// ScoreHistoryResponse is one page of a player's submissions in a game,
+// newest first. NextBefore is set when there may be more, and is passed as
+// before to fetch the next page.
+type ScoreHistoryResponse struct {
+	GameID     int64      `json:"game_id"`
+	UserID     int64      `json:"user_id"`
+	Scores     []Score    `json:"scores"`
+	NextBefore *time.Time `json:"next_before,omitempty"`
+}
+
+// EraseUserResponse reports the games a user was erased from. Erasing a user
+// who is already gone succeeds with no games.
+type EraseUserResponse struct {
+	UserID        int64   `json:"user_id"`
+	GamesAffected int     `json:"games_affected"`
+	GameIDs       []int64 `json:"game_ids"`
+}
+
+// ResetGameResponse reports how a game's board was cleared. RowsDeleted is
+// only set when the Postgres scores were purged too.
+type ResetGameResponse struct {
+	GameID         int64  `json:"game_id"`
+	PlayersRemoved uint64 `json:"players_removed"`
+	Purged         bool   `json:"purged"`
+	RowsDeleted    int64  `json:"rows_deleted"`
+}
+
+// ErrorResponse is returned with every 4xx and 5xx status.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError says why a request failed. Code is stable for clients to branch
+// on, Message is meant for people, and Details carries what the code needs,
+// such as the invalid fields of a submission.
+type APIError struct {
+	Code      string `json:"code" example:"INVALID_GAME_ID"`
+	Message   string `json:"message" example:"Invalid game ID"`
+	Details   any    `json:"details,omitempty" swaggertype:"object"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// FieldError is one invalid field of a request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+type BulkRankRequest struct {
+	UserIDs []int64 `json:"user_ids"`
+	Window  string  `json:"window"`
+}
+
+// AroundPlayerResponse shows a player in the context of the players ranked
+// just above and below them.
+type AroundPlayerResponse struct {
 	GameID       int64              `json:"game_id"`
-	Leaders      []LeaderboardEntry `json:"leaders"`
+	UserID       int64              `json:"user_id"`
+	Entries      []LeaderboardEntry `json:"entries"`
 	TotalPlayers uint64             `json:"total_players"`
 	Window       string             `json:"window,omitempty"`
 }
 
-type PlayerRankResponse struct {
+// HistoricalPercentileResponse is the percentile a score would have had on a
+// past board, taken from the snapshot at SnapshotAt.
+type HistoricalPercentileResponse struct {
+	GameID       int64     `json:"game_id"`
+	Score        uint64    `json:"score"`
+	Percentile   float64   `json:"percentile"`
+	TotalPlayers uint64    `json:"total_players"`
+	AsOf         time.Time `json:"as_of"`
+	SnapshotAt   time.Time `json:"snapshot_at"`
+	Window       string    `json:"window,omitempty"`
+}
+
+// QuantileEstimate is the approximate score at quantile Q, where 0 is the
+// lowest score on the board and 1 the highest.
+type QuantileEstimate struct {
+	Q     float64 `json:"q"`
+	Score uint64  `json:"score"`
+}
+
+// SketchResponse holds approximate quantiles of a board's scores. Each score
+// is within RelativeError of the exact score at its quantile. Count is the
+// number of scores on the board, excluded accounts included.
+type SketchResponse struct {
+	GameID        int64              `json:"game_id"`
+	Count         uint64             `json:"count"`
+	RelativeError float64            `json:"relative_error"`
+	Quantiles     []QuantileEstimate `json:"quantiles"`
+	Window        string             `json:"window,omitempty"`
+}
+
+// ScoreThresholdResponse describes the score needed to enter the top Rank.
+// Threshold is 0 when the board has fewer than Rank players, meaning any score
+// qualifies. Ties is the number of players holding exactly the threshold score.
+type ScoreThresholdResponse struct {
+	GameID    int64  `json:"game_id"`
+	Rank      int    `json:"rank"`
+	Threshold uint64 `json:"threshold"`
+	Ties      uint64 `json:"ties"`
+	Players   uint64 `json:"players"`
+	Window    string `json:"window,omitempty"`
+}
+
+// ExcludedAccountsResponse lists the accounts left out of a game's rankings.
+type ExcludedAccountsResponse struct {
+	GameID  int64   `json:"game_id"`
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// ReceiptClaims is what a submission receipt attests: the score as accepted,
+// the rank it would take on the all-time board at that moment, and the
+// server time in unix seconds.
+type ReceiptClaims struct {
+	GameID    int64     `json:"game_id"`
+	UserID    int64     `json:"user_id"`
+	Score     uint64    `json:"score"`
+	Timestamp time.Time `json:"timestamp"`
+	Rank      uint64    `json:"rank"`
+	IssuedAt  int64     `json:"iat"`
+}
+
+type SubmitScoreResponse struct {
+	Receipt string          `json:"receipt,omitempty"`
+	Rank    *SubmissionRank `json:"rank,omitempty"`
+}
+
+// SubmissionRank is the player's standing on the all-time board right after
+// their submission. Improved is whether it raised their best score, or their
+// total in a cumulative game.
+type SubmissionRank struct {
+	Rank         uint64  `json:"rank"`
+	Score        uint64  `json:"score"`
+	Percentile   float64 `json:"percentile"`
+	TotalPlayers uint64  `json:"total_players"`
+	Improved     bool    `json:"improved"`
+}
+
+// IncrementScoreRequest adds Delta to a player's total in a cumulative game.
+type IncrementScoreRequest struct {
+	GameID int64  `json:"game_id"`
+	UserID int64  `json:"user_id"`
+	Delta  uint64 `json:"delta"`
+}
+
+// IncrementScoreResponse is the player's standing on the all-time board
+// straight after their increment.
+type IncrementScoreResponse struct {
 	GameID       int64   `json:"game_id"`
 	UserID       int64   `json:"user_id"`
-	Score        uint64  `json:"score"`
+	Score        uint64  `json:"score"` // The new total
 	Rank         uint64  `json:"rank"`
 	Percentile   float64 `json:"percentile"`
 	TotalPlayers uint64  `json:"total_players"`
-	Window       string  `json:"window,omitempty"`
+}
+
+// IdempotentResponse is the result of a submission made with an idempotency
+// key, kept so that retries with the key get the same answer.
+type IdempotentResponse struct {
+	Key         string // The client's key, scoped to the game and player
+	Fingerprint string // What was submitted, to spot a key reused for another score
+	Status      int
+	Body        []byte // JSON, empty when the response had none
+	CreatedAt   time.Time
+}
+
+// Receipt statuses reported by verification.
+const (
+	ReceiptStanding   = "standing"   // the score is the player's current best
+	ReceiptSuperseded = "superseded" // the player has since posted a better score
+	ReceiptRemoved    = "removed"    // the score is no longer on the board
+)
+
+type ReceiptVerificationResponse struct {
+	Valid  bool           `json:"valid"`
+	Status string         `json:"status,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Claims *ReceiptClaims `json:"claims,omitempty"`
+}
+
+// TopNDiff describes how a game's top N changed. Left holds the entries as
+// they were before they dropped out.
+type TopNDiff struct {
+	GameID  int64              `json:"game_id"`
+	Entered []LeaderboardEntry `json:"entered,omitempty"`
+	Left    []LeaderboardEntry `json:"left,omitempty"`
+	Moved   []TopNMove         `json:"moved,omitempty"`
+}
+
+func (d TopNDiff) Empty() bool {
+	return len(d.Entered) == 0 && len(d.Left) == 0 && len(d.Moved) == 0
+}
+
+type TopNMove struct {
+	UserID       int64  `json:"user_id"`
+	Score        uint64 `json:"score"`
+	Rank         uint64 `json:"rank"`
+	PreviousRank uint64 `json:"previous_rank"`
+}
+
+// WebhookEvent is posted to webhook targets when a game's top list changes.
+// OldRank is left out when the player was not among the watched places.
+type WebhookEvent struct {
+	Event          string    `json:"event"`
+	GameID         int64     `json:"game_id"`
+	Window         string    `json:"window"`
+	UserID         int64     `json:"user_id"`
+	Score          uint64    `json:"score"`
+	OldRank        uint64    `json:"old_rank,omitempty"`
+	NewRank        uint64    `json:"new_rank"`
+	PreviousUserID int64     `json:"previous_user_id,omitempty"` // Who held first place, for new_top_player
+	PreviousScore  uint64    `json:"previous_score,omitempty"`   // The record beaten, for score_record
+	OccurredAt     time.Time `json:"occurred_at"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+// StoreReport summarizes what the in-memory store is holding.
+type StoreReport struct {
+	Games          int               `json:"games"`
+	Entries        map[string]uint64 `json:"entries"` // keyed by window
+	EstimatedBytes uint64            `json:"estimated_bytes"`
+	Heap           HeapStats         `json:"heap"`
+	Activity       *ActivityStats    `json:"activity,omitempty"` // nil when activity tracking is off
+}
+
+// ActivityStats describes the occupancy of the per-user activity tracker.
+type ActivityStats struct {
+	Players   int    `json:"players"`
+	Capacity  int    `json:"capacity"`
+	Depth     int    `json:"depth"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// GameStoreReport counts the entries of one game's boards.
+type GameStoreReport struct {
+	GameID         int64             `json:"game_id"`
+	Entries        map[string]uint64 `json:"entries"` // keyed by window
+	EstimatedBytes uint64            `json:"estimated_bytes"`
+}
+
+// DebugStoreReport is the store summary broken down by game, largest first.
+type DebugStoreReport struct {
+	Totals StoreReport       `json:"totals"`
+	Games  []GameStoreReport `json:"games"`
+}
+
+type HeapStats struct {
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapIdle     uint64 `json:"heap_idle"`
+	HeapReleased uint64 `json:"heap_released"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	NumGC        uint32 `json:"num_gc"`
+}
+
+type CompactionReport struct {
+	Before         StoreReport `json:"before"`
+	After          StoreReport `json:"after"`
+	RemovedEntries uint64      `json:"removed_entries"`
+	PrunedGames    int         `json:"pruned_games"`
+	DurationMs     int64       `json:"duration_ms"`
 }
 
 type TimeWindow struct {
-	Hours   int
-	Display string
+	Hours    int
+	Display  string
+	Calendar CalendarPeriod // set for the calendar windows, which do not roll
 }
 
 func (w TimeWindow) GetLeaderboardIndex() int {
@@ -96,48 +502,182 @@ func AllTimeWindows() [LeaderboardIndexCount]TimeWindow {
 	}
 }
 
+// CalendarPeriod is the stretch of the calendar a calendar window covers.
+type CalendarPeriod string
+
+const (
+	CalendarDay  CalendarPeriod = "day"
+	CalendarWeek CalendarPeriod = "week"
+)
+
+const CalendarWindowCount = 2
+
+// The calendar windows hold the scores since midnight, or since the midnight
+// starting Monday, in CalendarLocation, and start over empty when the day or
+// week ends.
+var (
+	Today    = TimeWindow{Display: "today", Calendar: CalendarDay}
+	ThisWeek = TimeWindow{Display: "thisweek", Calendar: CalendarWeek}
+)
+
+// CalendarLocation is the time zone the calendar windows follow. It is set
+// once at startup.
+var CalendarLocation = time.UTC
+
+func CalendarWindows() [CalendarWindowCount]TimeWindow {
+	return [CalendarWindowCount]TimeWindow{Today, ThisWeek}
+}
+
+// IsCalendar reports whether the window is one of the calendar windows.
+func (w TimeWindow) IsCalendar() bool {
+	return w.Calendar != ""
+}
+
+// CalendarIndex is the calendar window's position in CalendarWindows.
+func (w TimeWindow) CalendarIndex() int {
+	if w.Calendar == CalendarWeek {
+		return 1
+	}
+	return 0
+}
+
+// Period returns the start and end of the calendar window's day or week
+// containing t, in UTC.
+func (w TimeWindow) Period(t time.Time) (start, end time.Time) {
+	local := t.In(CalendarLocation)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, CalendarLocation)
+	if w.Calendar == CalendarWeek {
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return monday.UTC(), monday.AddDate(0, 0, 7).UTC()
+	}
+	return day.UTC(), day.AddDate(0, 0, 1).UTC()
+}
+
+// MaxWindowHours bounds custom windows at a year.
+const MaxWindowHours = 365 * 24
+
+// FromQueryParam parses a window query parameter. Equivalent spellings map to
+// the same window, whose Display is the canonical name echoed in responses and
+// used in cache keys. Besides the standard windows it takes any whole number
+// of hours or days, such as 48h or 30d, as a custom window.
 func FromQueryParam(window string) (TimeWindow, error) {
-	switch window {
-	case "":
+	normalized := strings.ToLower(strings.TrimSpace(window))
+	switch normalized {
+	case "", "all", "alltime":
 		return AllTime, nil
-	case "24h":
-		return Last24Hours, nil
-	case "3d":
-		return Last3Days, nil
-	case "7d":
-		return Last7Days, nil
+	case "today":
+		return Today, nil
+	case "thisweek":
+		return ThisWeek, nil
+	}
+
+	hours, ok := parseWindowHours(normalized)
+	if !ok {
+		return AllTime, fmt.Errorf("unsupported window %q, supported values are %s, today, thisweek, or a number of hours or days such as 48h or 30d", window, SupportedWindows())
+	}
+	if hours > MaxWindowHours {
+		return AllTime, fmt.Errorf("window %q is longer than %dd", window, MaxWindowHours/24)
+	}
+	return WindowOfHours(hours), nil
+}
+
+// parseWindowHours parses a positive number of hours or days, like 12h or 30d.
+func parseWindowHours(window string) (int, bool) {
+	if len(window) < 2 {
+		return 0, false
+	}
+	unit := 1
+	switch window[len(window)-1] {
+	case 'h':
+	case 'd':
+		unit = 24
 	default:
-		logging.Error("invalid window", "window", window)
-		return AllTime, nil
+		return 0, false
+	}
+
+	digits := window[:len(window)-1]
+	if strings.TrimLeft(digits, "0123456789") != "" || len(digits) > 6 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 {
+		return 0, false
 	}
+	return n * unit, true
+}
 
-	// // Handle day-based windows
-	// if strings.HasSuffix(window, "d") {
-	// 	days, err := strconv.Atoi(window[:len(window)-1])
-	// 	if err == nil && days > 0 {
-	// 		return TimeWindow{
-	// 			Hours:   days * 24,
-	// 			Display: window,
-	// 		}
-	// 	}
-	// }
+// WindowOfHours returns the window covering the given number of hours, one of
+// the standard windows when it has that length.
+func WindowOfHours(hours int) TimeWindow {
+	for _, window := range AllTimeWindows() {
+		if window.Hours == hours {
+			return window
+		}
+	}
+	if hours%24 == 0 {
+		return TimeWindow{Hours: hours, Display: fmt.Sprintf("%dd", hours/24)}
+	}
+	return TimeWindow{Hours: hours, Display: fmt.Sprintf("%dh", hours)}
+}
 
-	// // Handle hour-based windows
-	// if strings.HasSuffix(window, "h") {
-	// 	hours, err := strconv.Atoi(window[:len(window)-1])
-	// 	if err == nil && hours > 0 {
-	// 		return TimeWindow{
-	// 			Hours:   hours,
-	// 			Display: window,
-	// 		}
-	// 	}
-	// }
+// IsStandard reports whether the window is one of the rolling windows the
+// boards keep, rather than a custom or calendar one.
+func (w TimeWindow) IsStandard() bool {
+	if w.IsCalendar() {
+		return false
+	}
+	for _, window := range AllTimeWindows() {
+		if window.Hours == w.Hours {
+			return true
+		}
+	}
+	return false
+}
 
-	// return AllTime
+// RankMode is how players with equal scores are ranked.
+type RankMode string
+
+const (
+	// RankOrdinal gives every player a rank of their own, ties going to
+	// whoever reached the score first: 1, 2, 3.
+	RankOrdinal RankMode = "ordinal"
+	// RankCompetition gives tied players the same rank and skips the ranks
+	// they use up: 1, 1, 3.
+	RankCompetition RankMode = "competition"
+	// RankDense gives tied players the same rank without skipping: 1, 1, 2.
+	RankDense RankMode = "dense"
+)
+
+// ParseRankMode parses a rankMode query parameter. Empty means ordinal, the
+// ranking the boards have always used.
+func ParseRankMode(mode string) (RankMode, error) {
+	switch RankMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", RankOrdinal:
+		return RankOrdinal, nil
+	case RankCompetition:
+		return RankCompetition, nil
+	case RankDense:
+		return RankDense, nil
+	default:
+		return RankOrdinal, fmt.Errorf("unsupported rank mode %q, supported values are ordinal, competition, dense", mode)
+	}
+}
+
+// SupportedWindows lists the canonical window names.
+func SupportedWindows() string {
+	names := make([]string, 0, LeaderboardIndexCount)
+	for _, window := range AllTimeWindows() {
+		names = append(names, window.Display)
+	}
+	return strings.Join(names, ", ")
 }
 
 // GetCutoffTime returns the cutoff time for filtering scores based on the time window
 func (w TimeWindow) GetCutoffTime() *time.Time {
+	if w.IsCalendar() {
+		start, _ := w.Period(time.Now().UTC())
+		return &start
+	}
 	if w.Hours <= 0 {
 		return nil
 	}
@@ -150,6 +690,10 @@ func (w TimeWindow) GetCutoffTime() *time.Time {
 func (w TimeWindow) GetTimeRange() (start *time.Time, end time.Time) {
 	end = time.Now().UTC()
 
+	if w.IsCalendar() {
+		startTime, _ := w.Period(end)
+		return &startTime, end
+	}
 	if w.Hours <= 0 {
 		return nil, end
 	}
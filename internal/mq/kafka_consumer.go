@@ -3,24 +3,49 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/config"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
 	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
 	"github.com/IWhitebird/go-leader-board/internal/store"
 	"github.com/segmentio/kafka-go"
 )
 
+// MessageReader is the part of *kafka.Reader the consumer uses, so the batch
+// loop can be driven by a fake in tests.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+	Stats() kafka.ReaderStats
+}
+
+// ScoreBatchSaver persists and applies a batch of scores, erases users and
+// resets games, see store.Store.
+type ScoreBatchSaver interface {
+	SaveScoreBatch(scores []models.Score) error
+	EraseUser(userID int64) ([]int64, error)
+	ResetGame(gameID int64, purgeDB bool) (uint64, int64, error)
+	ApplyIncrement(score models.Score) error
+}
+
+var _ MessageReader = (*kafka.Reader)(nil)
+
 type KafkaConsumer struct {
-	reader        *kafka.Reader
-	store         *store.Store
+	reader        MessageReader
+	store         ScoreBatchSaver
 	batchSize     int
 	timeout       time.Duration
+	scoreTimes    *scoretime.Policy // Scores may come from other producers, so are checked again
 	brokers       []string
 	topic         string
 	consumerGroup string
+	serviceID     string
 }
 
 func NewKafkaConsumer(cfg *config.AppConfig, store *store.Store) (*KafkaConsumer, error) {
@@ -28,9 +53,11 @@ func NewKafkaConsumer(cfg *config.AppConfig, store *store.Store) (*KafkaConsumer
 		store:         store,
 		batchSize:     cfg.Kafka.BatchSize,
 		timeout:       time.Duration(cfg.Kafka.BatchTimeout) * time.Second,
+		scoreTimes:    scoretime.FromConfig(cfg.ScoreTime),
 		brokers:       cfg.Kafka.Brokers,
 		topic:         cfg.Kafka.ScoresTopicPrefix,
 		consumerGroup: fmt.Sprintf("%s-%s", cfg.Kafka.ConsumerGroup, cfg.Kafka.ServiceID),
+		serviceID:     cfg.Kafka.ServiceID,
 	}
 
 	// Retry connecting to Kafka
@@ -118,6 +145,7 @@ func (c *KafkaConsumer) StartConsumer(ctx context.Context) {
 
 func (c *KafkaConsumer) processBatch(ctx context.Context) error {
 	batch := make([]models.Score, 0, c.batchSize)
+	var requests map[scoreRef]string // who submitted each score, when known
 	timer := time.NewTimer(c.timeout)
 	defer timer.Stop()
 
@@ -128,12 +156,12 @@ func (c *KafkaConsumer) processBatch(ctx context.Context) error {
 		select {
 		case <-timer.C:
 			if len(batch) > 0 {
-				return c.saveBatch(batch)
+				return c.saveBatch(batch, requests)
 			}
 			return nil
 		case <-ctx.Done():
 			if len(batch) > 0 {
-				return c.saveBatch(batch)
+				return c.saveBatch(batch, requests)
 			}
 			return ctx.Err()
 		default:
@@ -142,15 +170,58 @@ func (c *KafkaConsumer) processBatch(ctx context.Context) error {
 			fetchCancel()
 
 			if err != nil {
-				if err == context.DeadlineExceeded {
+				if ctx.Err() != nil {
+					// Shutting down: keep what has already been collected.
+					if len(batch) > 0 {
+						return c.saveBatch(batch, requests)
+					}
+					return ctx.Err()
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
 					continue
 				}
 				return fmt.Errorf("error fetching message from Kafka: %v", err)
 			}
 
+			if messageType(message) == incrementType {
+				// Increments add up in any order, so unlike the other control
+				// messages they are applied without ending the batch.
+				c.applyIncrement(messageContext(ctx, message), message)
+				if err := c.reader.CommitMessages(ctx, message); err != nil {
+					return fmt.Errorf("error committing message: %v", err)
+				}
+				continue
+			}
+
+			if kind := messageType(message); kind != "" {
+				// Scores fetched before a control message are saved first, so
+				// none of them brings an erased user or a reset board back.
+				if len(batch) > 0 {
+					if err := c.saveBatch(batch, requests); err != nil {
+						return err
+					}
+				}
+				return c.handleControl(messageContext(ctx, message), kind, message)
+			}
+
 			var score models.Score
 			if err := json.Unmarshal(message.Value, &score); err != nil {
-				logging.Error("Error unmarshaling score", "error", err)
+				logging.ErrorContext(messageContext(ctx, message), "Error unmarshaling score", "error", err)
+				if commitErr := c.reader.CommitMessages(ctx, message); commitErr != nil {
+					logging.Error("Error committing invalid message", "error", commitErr)
+				}
+				continue
+			}
+
+			// Scores from producers that predate receipt times count as
+			// received when Kafka appended them.
+			if score.ReceivedAt.IsZero() {
+				score.ReceivedAt = message.Time.UTC()
+			}
+
+			if score.Timestamp, err = c.scoreTimes.Check(score.Timestamp, score.ReceivedAt); err != nil {
+				logging.ErrorContext(messageContext(ctx, message), "Skipping score with invalid timestamp", "game", score.GameID, "user", score.UserID, "error", err)
+				metrics.ScoresRejected.Inc()
 				if commitErr := c.reader.CommitMessages(ctx, message); commitErr != nil {
 					logging.Error("Error committing invalid message", "error", commitErr)
 				}
@@ -158,6 +229,12 @@ func (c *KafkaConsumer) processBatch(ctx context.Context) error {
 			}
 
 			batch = append(batch, score)
+			if id := header(message, requestIDHeader); id != "" {
+				if requests == nil {
+					requests = make(map[scoreRef]string)
+				}
+				requests[refOf(score)] = id
+			}
 
 			if err := c.reader.CommitMessages(ctx, message); err != nil {
 				return fmt.Errorf("error committing message: %v", err)
@@ -166,20 +243,38 @@ func (c *KafkaConsumer) processBatch(ctx context.Context) error {
 	}
 
 	if len(batch) > 0 {
-		return c.saveBatch(batch)
+		return c.saveBatch(batch, requests)
 	}
 
 	return nil
 }
 
-func (c *KafkaConsumer) saveBatch(batch []models.Score) error {
+// saveBatch saves the batch, logging each rejected score with the request
+// that submitted it, looked up in requests.
+func (c *KafkaConsumer) saveBatch(batch []models.Score, requests map[scoreRef]string) error {
 	logging.Info("Saving batch of scores", "count", len(batch))
 
 	if len(batch) == 0 {
 		return nil
 	}
 
-	if err := c.store.SaveScoreBatch(batch); err != nil {
+	start := time.Now()
+	err := c.store.SaveScoreBatch(batch)
+	metrics.ConsumerBatchSize.Observe(float64(len(batch)))
+	metrics.ConsumerSaveDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		// A partially rejected batch has still been saved; log the rejected
+		// scores instead of treating the whole batch as failed.
+		var batchErr *store.BatchError
+		if errors.As(err, &batchErr) {
+			for _, rejected := range batchErr.Rejected {
+				ctx := logging.WithRequestID(context.Background(), requests[refOf(rejected.Score)])
+				logging.ErrorContext(ctx, "Rejected score from batch", "game", rejected.Score.GameID, "user", rejected.Score.UserID, "reason", rejected.Reason)
+			}
+			return nil
+		}
+
 		logging.Error("Error saving batch", "error", err)
 		return fmt.Errorf("failed to save batch: %v", err)
 	}
@@ -187,6 +282,84 @@ func (c *KafkaConsumer) saveBatch(batch []models.Score) error {
 	return nil
 }
 
+// handleControl applies a control message and commits it. Messages that
+// cannot be parsed, or whose type is unknown, are logged and skipped.
+func (c *KafkaConsumer) handleControl(ctx context.Context, kind string, message kafka.Message) error {
+	var err error
+	switch kind {
+	case eraseUserType:
+		err = c.eraseUser(ctx, message)
+	case resetGameType:
+		err = c.resetGame(ctx, message)
+	default:
+		logging.ErrorContext(ctx, "Skipping message of unknown type", "type", kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.reader.CommitMessages(ctx, message); err != nil {
+		return fmt.Errorf("error committing message: %v", err)
+	}
+	return nil
+}
+
+func (c *KafkaConsumer) eraseUser(ctx context.Context, message kafka.Message) error {
+	var erasure eraseUserMessage
+	if err := json.Unmarshal(message.Value, &erasure); err != nil {
+		logging.ErrorContext(ctx, "Error unmarshaling user erasure", "error", err)
+		return nil
+	}
+
+	games, err := c.store.EraseUser(erasure.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to erase user %d: %v", erasure.UserID, err)
+	}
+	logging.InfoContext(ctx, "Erased user", "user", erasure.UserID, "games", len(games))
+	return nil
+}
+
+// applyIncrement applies an increment published by another instance. One
+// that cannot be applied is logged and skipped.
+func (c *KafkaConsumer) applyIncrement(ctx context.Context, message kafka.Message) {
+	if header(message, originHeader) == c.serviceID {
+		return
+	}
+
+	var score models.Score
+	if err := json.Unmarshal(message.Value, &score); err != nil {
+		logging.ErrorContext(ctx, "Error unmarshaling score increment", "error", err)
+		return
+	}
+	if err := c.store.ApplyIncrement(score); err != nil {
+		logging.ErrorContext(ctx, "Skipping score increment", "game", score.GameID, "user", score.UserID, "error", err)
+	}
+}
+
+func (c *KafkaConsumer) resetGame(ctx context.Context, message kafka.Message) error {
+	var reset resetGameMessage
+	if err := json.Unmarshal(message.Value, &reset); err != nil {
+		logging.ErrorContext(ctx, "Error unmarshaling game reset", "error", err)
+		return nil
+	}
+
+	players, _, err := c.store.ResetGame(reset.GameID, false)
+	if err != nil {
+		return fmt.Errorf("failed to reset game %d: %v", reset.GameID, err)
+	}
+	logging.InfoContext(ctx, "Reset game from control message", "game", reset.GameID, "players", players)
+	return nil
+}
+
+// Lag returns how many messages the consumer is behind the end of the topic,
+// as of its last fetch.
+func (c *KafkaConsumer) Lag() int64 {
+	if c.reader == nil {
+		return 0
+	}
+	return c.reader.Stats().Lag
+}
+
 func (c *KafkaConsumer) Close() error {
 	if c.reader != nil {
 		return c.reader.Close()
@@ -0,0 +1,345 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventLog records the order in which the fakes are called.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) all() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []kafka.Message
+	log       *eventLog
+}
+
+func (f *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	f.mu.Lock()
+	if len(f.messages) > 0 {
+		message := f.messages[0]
+		f.messages = f.messages[1:]
+		f.mu.Unlock()
+		return message, nil
+	}
+	f.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (f *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, msg := range msgs {
+		f.committed = append(f.committed, msg)
+		f.log.add(fmt.Sprintf("commit:%d", msg.Offset))
+	}
+	return nil
+}
+
+func (f *fakeReader) Close() error {
+	return nil
+}
+
+func (f *fakeReader) Stats() kafka.ReaderStats {
+	return kafka.ReaderStats{}
+}
+
+type fakeSaver struct {
+	mu      sync.Mutex
+	batches [][]int64
+	log     *eventLog
+}
+
+func (f *fakeSaver) SaveScoreBatch(scores []models.Score) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	users := make([]int64, len(scores))
+	for i, score := range scores {
+		users[i] = score.UserID
+	}
+	f.batches = append(f.batches, users)
+	f.log.add(fmt.Sprintf("save:%d", len(scores)))
+	return nil
+}
+
+func (f *fakeSaver) EraseUser(userID int64) ([]int64, error) {
+	f.log.add(fmt.Sprintf("erase:%d", userID))
+	return nil, nil
+}
+
+func (f *fakeSaver) ResetGame(gameID int64, purgeDB bool) (uint64, int64, error) {
+	f.log.add(fmt.Sprintf("reset:%d:%t", gameID, purgeDB))
+	return 0, 0, nil
+}
+
+func (f *fakeSaver) ApplyIncrement(score models.Score) error {
+	f.log.add(fmt.Sprintf("increment:%d:%d", score.UserID, score.Score))
+	return nil
+}
+
+func controlMessage(offset int64, kind string, message any) kafka.Message {
+	value, _ := json.Marshal(message)
+	return kafka.Message{
+		Offset:  offset,
+		Value:   value,
+		Headers: []kafka.Header{{Key: messageTypeHeader, Value: []byte(kind)}},
+	}
+}
+
+func eraseMessage(offset, userID int64) kafka.Message {
+	return controlMessage(offset, eraseUserType, eraseUserMessage{UserID: userID})
+}
+
+func scoreMessages(offset int64, userIDs ...int64) []kafka.Message {
+	messages := make([]kafka.Message, len(userIDs))
+	for i, userID := range userIDs {
+		value, _ := json.Marshal(models.Score{GameID: 1, UserID: userID, Score: 100, Timestamp: time.Now().UTC()})
+		messages[i] = kafka.Message{Offset: offset + int64(i), Value: value}
+	}
+	return messages
+}
+
+func newTestConsumer(reader MessageReader, saver ScoreBatchSaver, batchSize int, timeout time.Duration) *KafkaConsumer {
+	return &KafkaConsumer{
+		reader:    reader,
+		store:     saver,
+		batchSize: batchSize,
+		timeout:   timeout,
+		topic:     "test-scores",
+	}
+}
+
+func TestKafkaConsumer_ProcessBatch(t *testing.T) {
+	invalid := kafka.Message{Offset: 2, Value: []byte("{not json")}
+
+	tests := []struct {
+		name          string
+		messages      []kafka.Message
+		batchSize     int
+		timeout       time.Duration
+		cancelAfter   time.Duration
+		wantSaved     [][]int64
+		wantCommitted int
+		wantErr       error
+	}{
+		{
+			name:          "batch fills to size",
+			messages:      scoreMessages(0, 1, 2, 3, 4, 5),
+			batchSize:     3,
+			timeout:       5 * time.Second,
+			wantSaved:     [][]int64{{1, 2, 3}},
+			wantCommitted: 3,
+		},
+		{
+			name:          "timeout flushes a partial batch",
+			messages:      scoreMessages(0, 1, 2),
+			batchSize:     10,
+			timeout:       300 * time.Millisecond,
+			wantSaved:     [][]int64{{1, 2}},
+			wantCommitted: 2,
+		},
+		{
+			name:          "timeout with nothing fetched saves nothing",
+			batchSize:     10,
+			timeout:       200 * time.Millisecond,
+			wantSaved:     nil,
+			wantCommitted: 0,
+		},
+		{
+			name:          "unparseable message is committed and skipped",
+			messages:      append(append(scoreMessages(0, 1, 2), invalid), scoreMessages(3, 4)...),
+			batchSize:     3,
+			timeout:       5 * time.Second,
+			wantSaved:     [][]int64{{1, 2, 4}},
+			wantCommitted: 4,
+		},
+		{
+			name:          "cancellation mid-batch saves what was collected",
+			messages:      scoreMessages(0, 1, 2),
+			batchSize:     10,
+			timeout:       5 * time.Second,
+			cancelAfter:   300 * time.Millisecond,
+			wantSaved:     [][]int64{{1, 2}},
+			wantCommitted: 2,
+		},
+		{
+			name:          "cancellation with an empty batch returns the context error",
+			batchSize:     10,
+			timeout:       5 * time.Second,
+			cancelAfter:   200 * time.Millisecond,
+			wantSaved:     nil,
+			wantCommitted: 0,
+			wantErr:       context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &eventLog{}
+			reader := &fakeReader{messages: tt.messages, log: log}
+			saver := &fakeSaver{log: log}
+			consumer := newTestConsumer(reader, saver, tt.batchSize, tt.timeout)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAfter > 0 {
+				time.AfterFunc(tt.cancelAfter, cancel)
+			}
+
+			err := consumer.processBatch(ctx)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantSaved, saver.batches)
+			assert.Equal(t, tt.wantCommitted, len(reader.committed))
+		})
+	}
+}
+
+func TestKafkaConsumer_CommitOrdering(t *testing.T) {
+	log := &eventLog{}
+	reader := &fakeReader{messages: scoreMessages(0, 1, 2, 3), log: log}
+	saver := &fakeSaver{log: log}
+	consumer := newTestConsumer(reader, saver, 3, 5*time.Second)
+
+	assert.NoError(t, consumer.processBatch(context.Background()))
+
+	// Offsets are committed as messages are collected, before the batch is
+	// saved, and the message outside the batch is left uncommitted.
+	assert.Equal(t, []string{"commit:0", "commit:1", "commit:2", "save:3"}, log.all())
+}
+
+func TestKafkaConsumer_BatchMetrics(t *testing.T) {
+	reader := &fakeReader{messages: scoreMessages(0, 1, 2, 3), log: &eventLog{}}
+	consumer := newTestConsumer(reader, &fakeSaver{log: &eventLog{}}, 3, 5*time.Second)
+
+	batches, scores := metrics.ConsumerBatchSize.Count(), metrics.ConsumerBatchSize.Sum()
+	saves := metrics.ConsumerSaveDuration.Count()
+
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, batches+1, metrics.ConsumerBatchSize.Count())
+	assert.Equal(t, scores+3, metrics.ConsumerBatchSize.Sum())
+	assert.Equal(t, saves+1, metrics.ConsumerSaveDuration.Count())
+}
+
+func TestKafkaConsumer_EraseUser(t *testing.T) {
+	log := &eventLog{}
+	messages := append(scoreMessages(0, 1, 2), eraseMessage(2, 1))
+	messages = append(messages, scoreMessages(3, 3)...)
+	reader := &fakeReader{messages: messages, log: log}
+	saver := &fakeSaver{log: log}
+	consumer := newTestConsumer(reader, saver, 10, 5*time.Second)
+
+	// The scores fetched before the tombstone are saved before the user is
+	// erased, and the batch ends at the tombstone.
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, []string{"commit:0", "commit:1", "save:2", "erase:1", "commit:2"}, log.all())
+}
+
+func TestKafkaConsumer_ResetGame(t *testing.T) {
+	log := &eventLog{}
+	messages := append(scoreMessages(0, 1), controlMessage(1, resetGameType, resetGameMessage{GameID: 7}))
+	messages = append(messages, controlMessage(2, "from-the-future", struct{}{}))
+	reader := &fakeReader{messages: messages, log: log}
+	saver := &fakeSaver{log: log}
+	consumer := newTestConsumer(reader, saver, 10, 5*time.Second)
+
+	// Siblings reset their board without touching Postgres.
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, []string{"commit:0", "save:1", "reset:7:false", "commit:1"}, log.all())
+
+	// A control message this version does not know is skipped.
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, "commit:2", log.all()[4])
+}
+
+func TestKafkaConsumer_Increments(t *testing.T) {
+	log := &eventLog{}
+	increment := func(offset, userID int64, origin string) kafka.Message {
+		message := controlMessage(offset, incrementType, models.Score{GameID: 1, UserID: userID, Score: 5, Timestamp: time.Now().UTC()})
+		message.Headers = append(message.Headers, kafka.Header{Key: originHeader, Value: []byte(origin)})
+		return message
+	}
+	messages := append(scoreMessages(0, 1), increment(1, 2, "other"), increment(2, 3, "self"))
+	messages = append(messages, scoreMessages(3, 4)...)
+	reader := &fakeReader{messages: messages, log: log}
+	saver := &fakeSaver{log: log}
+	consumer := newTestConsumer(reader, saver, 2, 5*time.Second)
+	consumer.serviceID = "self"
+
+	// Increments are applied as they arrive without ending the batch, and
+	// this instance's own are skipped, having been applied already.
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, []string{"commit:0", "increment:2:5", "commit:1", "commit:2", "commit:3", "save:2"}, log.all())
+}
+
+func TestKafkaConsumer_ScoreTimestamps(t *testing.T) {
+	now := time.Now().UTC()
+	scoreAt := func(offset, userID int64, timestamp time.Time) kafka.Message {
+		value, _ := json.Marshal(models.Score{GameID: 1, UserID: userID, Score: 100, Timestamp: timestamp, ReceivedAt: now})
+		return kafka.Message{Offset: offset, Value: value}
+	}
+	messages := []kafka.Message{
+		scoreAt(0, 1, now),
+		scoreAt(1, 2, now.AddDate(1, 0, 0)),
+		scoreAt(2, 3, now.AddDate(0, 0, -60)),
+		scoreAt(3, 4, now.Add(-time.Hour)),
+	}
+	reader := &fakeReader{messages: messages, log: &eventLog{}}
+	saver := &fakeSaver{log: &eventLog{}}
+	consumer := newTestConsumer(reader, saver, 2, 5*time.Second)
+	consumer.scoreTimes = &scoretime.Policy{MaxSkew: 5 * time.Minute, MaxAge: 30 * 24 * time.Hour}
+
+	// Rejected scores are committed, so they are not fetched again, but not
+	// saved.
+	rejected := metrics.ScoresRejected.Value()
+	assert.NoError(t, consumer.processBatch(context.Background()))
+	assert.Equal(t, [][]int64{{1, 4}}, saver.batches)
+	assert.Equal(t, 4, len(reader.committed))
+	assert.Equal(t, rejected+2, metrics.ScoresRejected.Value())
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	message := kafka.Message{Headers: controlHeaders(ctx, eraseUserType, "instance-1")}
+	assert.Equal(t, eraseUserType, messageType(message))
+	assert.Equal(t, "req-1", logging.RequestID(messageContext(context.Background(), message)))
+
+	// Messages published outside a request carry no ID.
+	message = kafka.Message{Headers: controlHeaders(context.Background(), eraseUserType, "instance-1")}
+	assert.Len(t, message.Headers, 2)
+	assert.Empty(t, logging.RequestID(messageContext(context.Background(), message)))
+}
@@ -3,25 +3,36 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/config"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
 	"github.com/IWhitebird/go-leader-board/internal/models"
 	"github.com/segmentio/kafka-go"
 )
 
+var (
+	// ErrQueueFull is returned when more scores are waiting to be batched
+	// than the queue holds.
+	ErrQueueFull = errors.New("producer queue full - too many concurrent writes")
+	// ErrNotConnected is returned before the producer has connected to Kafka.
+	ErrNotConnected = errors.New("producer not connected")
+)
+
 type KafkaProducer struct {
 	writer        *kafka.Writer
 	connected     bool
-	scoreChan     chan models.Score
+	scoreChan     chan pendingScore
 	ctx           context.Context
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
 	batchSize     int
 	flushInterval time.Duration
+	serviceID     string
 	mu            sync.RWMutex
 }
 
@@ -41,16 +52,24 @@ func NewKafkaProducer(cfg *config.AppConfig) (*KafkaProducer, error) {
 		ReadTimeout:  10 * time.Second,
 		Compression:  kafka.Snappy,
 		MaxAttempts:  3,
+		// The writer is async, so failed batches are only reported here.
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				metrics.ProducerFlushFailures.Inc()
+				logging.Error("Kafka rejected a batch", "count", len(messages), "error", err)
+			}
+		},
 	}
 
 	producer := &KafkaProducer{
 		writer:        writer,
 		connected:     false,
-		scoreChan:     make(chan models.Score, 20000),
+		scoreChan:     make(chan pendingScore, 20000),
 		ctx:           ctx,
 		cancel:        cancel,
 		batchSize:     5000,
 		flushInterval: 1 * time.Second,
+		serviceID:     cfg.Kafka.ServiceID,
 	}
 
 	maxRetries := 5
@@ -92,7 +111,7 @@ func (p *KafkaProducer) startBatchProcessor() {
 	go func() {
 		defer p.wg.Done()
 
-		batch := make([]models.Score, 0, p.batchSize)
+		batch := make([]pendingScore, 0, p.batchSize)
 		ticker := time.NewTicker(p.flushInterval)
 		defer ticker.Stop()
 
@@ -122,13 +141,14 @@ func (p *KafkaProducer) startBatchProcessor() {
 	}()
 }
 
-func (p *KafkaProducer) flushBatch(scores []models.Score) {
+func (p *KafkaProducer) flushBatch(scores []pendingScore) {
 	if len(scores) == 0 {
 		return
 	}
 
 	messages := make([]kafka.Message, len(scores))
-	for i, score := range scores {
+	for i, pending := range scores {
+		score := pending.score
 		scoreJSON, err := json.Marshal(score)
 		if err != nil {
 			logging.Error("Error marshaling score", "error", err)
@@ -140,6 +160,9 @@ func (p *KafkaProducer) flushBatch(scores []models.Score) {
 			Value: scoreJSON,
 			Time:  time.Now(),
 		}
+		if pending.requestID != "" {
+			messages[i].Headers = []kafka.Header{{Key: requestIDHeader, Value: []byte(pending.requestID)}}
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(p.ctx, 15*time.Second)
@@ -150,6 +173,7 @@ func (p *KafkaProducer) flushBatch(scores []models.Score) {
 	duration := time.Since(start)
 
 	if err != nil {
+		metrics.ProducerFlushFailures.Inc()
 		logging.Error("Error sending batch to Kafka", "count", len(messages), "duration", duration, "error", err)
 	} else {
 		logging.Info("Successfully sent batch to Kafka", "count", len(messages), "duration", duration)
@@ -162,17 +186,62 @@ func (p *KafkaProducer) SendScore(ctx context.Context, score models.Score) error
 	p.mu.RUnlock()
 
 	if !connected {
-		return fmt.Errorf("producer not connected")
+		return ErrNotConnected
 	}
 
 	select {
-	case p.scoreChan <- score:
+	case p.scoreChan <- pendingScore{score: score, requestID: logging.RequestID(ctx)}:
 		return nil
 	default:
-		return fmt.Errorf("producer queue full - too many concurrent writes")
+		metrics.ProducerDropped.Inc()
+		return ErrQueueFull
 	}
 }
 
+// QueueDepth returns how many scores are waiting to be batched.
+func (p *KafkaProducer) QueueDepth() int {
+	return len(p.scoreChan)
+}
+
+// SendErasure publishes a tombstone asking every instance to erase the user.
+// Unlike scores it is written straight away rather than batched.
+func (p *KafkaProducer) SendErasure(ctx context.Context, userID int64) error {
+	return p.sendControl(ctx, eraseUserType, fmt.Sprintf("user-%d", userID), eraseUserMessage{UserID: userID})
+}
+
+// SendGameReset asks every instance to clear the game's board.
+func (p *KafkaProducer) SendGameReset(ctx context.Context, gameID int64) error {
+	return p.sendControl(ctx, resetGameType, fmt.Sprintf("game-%d", gameID), resetGameMessage{GameID: gameID})
+}
+
+// SendIncrement asks the other instances to apply an increment this one has
+// saved and applied.
+func (p *KafkaProducer) SendIncrement(ctx context.Context, score models.Score) error {
+	return p.sendControl(ctx, incrementType, fmt.Sprintf("game-%d", score.GameID), score)
+}
+
+func (p *KafkaProducer) sendControl(ctx context.Context, kind, key string, message any) error {
+	p.mu.RLock()
+	connected := p.connected
+	p.mu.RUnlock()
+
+	if !connected {
+		return fmt.Errorf("producer not connected")
+	}
+
+	value, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: controlHeaders(ctx, kind, p.serviceID),
+		Time:    time.Now(),
+	})
+}
+
 func (p *KafkaProducer) Close() error {
 	logging.Info("Shutting down Kafka producer")
 
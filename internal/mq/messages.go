@@ -0,0 +1,88 @@
+package mq
+
+import (
+	"context"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// Messages on the scores topic are scores unless their type header says
+// otherwise, so scores written before message types existed still parse.
+const (
+	messageTypeHeader = "type"
+	requestIDHeader   = "request-id" // the API request the message was published for
+	originHeader      = "origin"     // the service ID of the instance that published a control message
+	eraseUserType     = "erase-user"
+	resetGameType     = "reset-game"
+	incrementType     = "increment-score"
+)
+
+// eraseUserMessage is the tombstone asking every instance to erase a user.
+type eraseUserMessage struct {
+	UserID int64 `json:"user_id"`
+}
+
+// resetGameMessage asks every instance to clear a game's board. Postgres is
+// purged by the instance that received the request, never by the consumers.
+type resetGameMessage struct {
+	GameID int64 `json:"game_id"`
+}
+
+// An increment-score message carries a score that adds to a player's total in
+// a cumulative game. The instance that published it has already saved it to
+// Postgres and applied it, so only the others apply it, to memory only.
+
+func messageType(message kafka.Message) string {
+	return header(message, messageTypeHeader)
+}
+
+func header(message kafka.Message, key string) string {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// controlHeaders returns the headers of a control message of the given type
+// published by the instance with the given service ID, with the request ID
+// carried by ctx when it has one.
+func controlHeaders(ctx context.Context, kind, origin string) []kafka.Header {
+	headers := []kafka.Header{{Key: messageTypeHeader, Value: []byte(kind)}, {Key: originHeader, Value: []byte(origin)}}
+	if id := logging.RequestID(ctx); id != "" {
+		headers = append(headers, kafka.Header{Key: requestIDHeader, Value: []byte(id)})
+	}
+	return headers
+}
+
+// messageContext returns ctx carrying the ID of the request the message was
+// published for, so the consumer's log lines about it can be matched with
+// the API's.
+func messageContext(ctx context.Context, message kafka.Message) context.Context {
+	if id := header(message, requestIDHeader); id != "" {
+		return logging.WithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// scoreRef identifies a score within a batch, whatever the store sets on it
+// while saving.
+type scoreRef struct {
+	gameID, userID int64
+	score          uint64
+	timestamp      int64
+}
+
+func refOf(score models.Score) scoreRef {
+	return scoreRef{gameID: score.GameID, userID: score.UserID, score: score.Score, timestamp: score.Timestamp.UnixNano()}
+}
+
+// pendingScore is a score waiting to be batched, with the ID of the request
+// that submitted it.
+type pendingScore struct {
+	score     models.Score
+	requestID string
+}
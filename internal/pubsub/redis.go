@@ -0,0 +1,246 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Stats counts what the publisher has done since it started.
+type Stats struct {
+	Published  uint64 `json:"published"`
+	Failures   uint64 `json:"failures"`
+	Reconnects uint64 `json:"reconnects"`
+}
+
+// TopNPublisher publishes changes to each game's top N on a Redis channel per
+// game. Changes are debounced: a game that changes many times within one
+// interval produces a single diff against what was last published.
+type TopNPublisher struct {
+	store    *store.Store
+	addr     string
+	prefix   string
+	n        int
+	interval time.Duration
+
+	mu        sync.Mutex
+	dirty     map[int64]struct{}
+	published map[int64][]models.LeaderboardEntry
+	stats     Stats
+
+	conn        redis.Conn
+	backoff     time.Duration
+	nextAttempt time.Time
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewTopNPublisher(store *store.Store, addr, prefix string, n int, interval time.Duration) *TopNPublisher {
+	p := &TopNPublisher{
+		store:     store,
+		addr:      addr,
+		prefix:    prefix,
+		n:         n,
+		interval:  interval,
+		dirty:     make(map[int64]struct{}),
+		published: make(map[int64][]models.LeaderboardEntry),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	store.OnBoardChange(p.markDirty)
+	return p
+}
+
+func (p *TopNPublisher) markDirty(gameID int64) {
+	p.mu.Lock()
+	p.dirty[gameID] = struct{}{}
+	p.mu.Unlock()
+}
+
+// Start publishes pending diffs every interval until Close is called.
+func (p *TopNPublisher) Start() {
+	p.mu.Lock()
+	p.started = true
+	p.mu.Unlock()
+
+	ticker := time.NewTicker(p.interval)
+	go func() {
+		defer close(p.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Flush()
+			case <-p.stop:
+				p.Flush()
+				return
+			}
+		}
+	}()
+}
+
+// Flush publishes a diff for every game that changed since the last flush.
+// Games whose diff could not be published stay pending for the next flush.
+func (p *TopNPublisher) Flush() {
+	p.mu.Lock()
+	games := p.dirty
+	p.dirty = make(map[int64]struct{})
+	p.mu.Unlock()
+
+	for gameID := range games {
+		current := p.store.GetTopLeaders(gameID, p.n, 0, models.AllTime)
+
+		p.mu.Lock()
+		diff := diffTopN(gameID, p.published[gameID], current)
+		p.mu.Unlock()
+		if diff.Empty() {
+			continue
+		}
+
+		if err := p.publish(diff); err != nil {
+			logging.Error("Failed to publish top N diff", "game", gameID, "error", err)
+			p.markDirty(gameID)
+			continue
+		}
+
+		p.mu.Lock()
+		p.published[gameID] = current
+		p.mu.Unlock()
+	}
+}
+
+func (p *TopNPublisher) publish(diff models.TopNDiff) error {
+	payload, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.connection()
+	if err != nil {
+		p.recordFailure()
+		return err
+	}
+
+	if _, err := conn.Do("PUBLISH", fmt.Sprintf("%s%d", p.prefix, diff.GameID), payload); err != nil {
+		p.dropConnection()
+		p.recordFailure()
+		return err
+	}
+
+	p.mu.Lock()
+	p.stats.Published++
+	p.backoff = 0
+	p.mu.Unlock()
+	return nil
+}
+
+// connection returns the current connection, dialing a new one if the
+// backoff after the last failure has passed.
+func (p *TopNPublisher) connection() (redis.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		return p.conn, nil
+	}
+	if time.Now().Before(p.nextAttempt) {
+		return nil, fmt.Errorf("waiting %s before reconnecting to redis", time.Until(p.nextAttempt).Round(time.Millisecond))
+	}
+
+	conn, err := redis.Dial("tcp", p.addr,
+		redis.DialConnectTimeout(5*time.Second),
+		redis.DialReadTimeout(5*time.Second),
+		redis.DialWriteTimeout(5*time.Second),
+	)
+	if err != nil {
+		p.backoff = min(max(p.backoff*2, minBackoff), maxBackoff)
+		p.nextAttempt = time.Now().Add(p.backoff)
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	p.conn = conn
+	p.stats.Reconnects++
+	return conn, nil
+}
+
+func (p *TopNPublisher) dropConnection() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func (p *TopNPublisher) recordFailure() {
+	p.mu.Lock()
+	p.stats.Failures++
+	p.mu.Unlock()
+}
+
+func (p *TopNPublisher) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close publishes what is pending and closes the connection.
+func (p *TopNPublisher) Close() {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+
+	close(p.stop)
+	if started {
+		<-p.done
+	}
+	p.dropConnection()
+}
+
+// diffTopN compares two top N lists of the same game.
+func diffTopN(gameID int64, before, after []models.LeaderboardEntry) models.TopNDiff {
+	diff := models.TopNDiff{GameID: gameID}
+
+	previous := make(map[int64]models.LeaderboardEntry, len(before))
+	for _, entry := range before {
+		previous[entry.UserID] = entry
+	}
+
+	for _, entry := range after {
+		old, existed := previous[entry.UserID]
+		delete(previous, entry.UserID)
+
+		switch {
+		case !existed:
+			diff.Entered = append(diff.Entered, entry)
+		case old.Rank != entry.Rank || old.Score != entry.Score:
+			diff.Moved = append(diff.Moved, models.TopNMove{
+				UserID:       entry.UserID,
+				Score:        entry.Score,
+				Rank:         entry.Rank,
+				PreviousRank: old.Rank,
+			})
+		}
+	}
+
+	for _, entry := range before {
+		if _, left := previous[entry.UserID]; left {
+			diff.Left = append(diff.Left, entry)
+		}
+	}
+
+	return diff
+}
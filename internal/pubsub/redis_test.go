@@ -0,0 +1,195 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis speaks just enough RESP to record PUBLISH commands.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	conns     []net.Conn
+	published map[string][]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	r := &fakeRedis{listener: listener, published: make(map[string][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			r.conns = append(r.conns, conn)
+			r.mu.Unlock()
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close(); r.dropConnections() })
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "PUBLISH" && len(args) == 3 {
+			r.mu.Lock()
+			r.published[args[1]] = append(r.published[args[1]], args[2])
+			r.mu.Unlock()
+		}
+		fmt.Fprint(conn, ":1\r\n")
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := reader.Read(buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) dropConnections() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = nil
+}
+
+func (r *fakeRedis) diffs(t *testing.T, channel string) []models.TopNDiff {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	diffs := make([]models.TopNDiff, len(r.published[channel]))
+	for i, payload := range r.published[channel] {
+		assert.NoError(t, json.Unmarshal([]byte(payload), &diffs[i]))
+	}
+	return diffs
+}
+
+func TestTopNPublisher_PublishesDiffs(t *testing.T) {
+	redis := newFakeRedis(t)
+	leaderboard := store.NewStore(nil)
+	publisher := NewTopNPublisher(leaderboard, redis.listener.Addr().String(), "top:", 3, time.Hour)
+	defer publisher.Close()
+
+	now := time.Now().UTC()
+	add := func(userID int64, score uint64) {
+		assert.NoError(t, leaderboard.AddScore(models.Score{GameID: 1, UserID: userID, Score: score, Timestamp: now}))
+	}
+
+	// Several inserts between flushes are published as one diff.
+	add(1, 100)
+	add(2, 200)
+	add(3, 300)
+	publisher.Flush()
+
+	// A new leader pushes everyone down and player 1 out of the top 3.
+	add(4, 400)
+	publisher.Flush()
+
+	// A change below the top 3 publishes nothing.
+	add(5, 50)
+	publisher.Flush()
+
+	// Player 2 improves and swaps places with player 3.
+	add(2, 350)
+	publisher.Flush()
+
+	diffs := redis.diffs(t, "top:1")
+	assert.Equal(t, 3, len(diffs))
+
+	assert.Equal(t, []models.LeaderboardEntry{
+		{UserID: 3, Score: 300, Rank: 1},
+		{UserID: 2, Score: 200, Rank: 2},
+		{UserID: 1, Score: 100, Rank: 3},
+	}, diffs[0].Entered)
+
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 4, Score: 400, Rank: 1}}, diffs[1].Entered)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 3}}, diffs[1].Left)
+	assert.Equal(t, []models.TopNMove{
+		{UserID: 3, Score: 300, Rank: 2, PreviousRank: 1},
+		{UserID: 2, Score: 200, Rank: 3, PreviousRank: 2},
+	}, diffs[1].Moved)
+
+	assert.Empty(t, diffs[2].Entered)
+	assert.Empty(t, diffs[2].Left)
+	assert.Equal(t, []models.TopNMove{
+		{UserID: 2, Score: 350, Rank: 2, PreviousRank: 3},
+		{UserID: 3, Score: 300, Rank: 3, PreviousRank: 2},
+	}, diffs[2].Moved)
+
+	stats := publisher.Stats()
+	assert.Equal(t, uint64(3), stats.Published)
+	assert.Equal(t, uint64(0), stats.Failures)
+}
+
+func TestTopNPublisher_RetriesAfterConnectionLoss(t *testing.T) {
+	redis := newFakeRedis(t)
+	leaderboard := store.NewStore(nil)
+	publisher := NewTopNPublisher(leaderboard, redis.listener.Addr().String(), "top:", 3, time.Hour)
+	defer publisher.Close()
+
+	now := time.Now().UTC()
+	assert.NoError(t, leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now}))
+	publisher.Flush()
+
+	// The connection drops; the next diff fails and stays pending.
+	redis.dropConnections()
+	assert.NoError(t, leaderboard.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now}))
+	publisher.Flush()
+	assert.Equal(t, uint64(1), publisher.Stats().Failures)
+
+	// After the backoff it reconnects and publishes the diff it missed.
+	time.Sleep(2 * minBackoff)
+	publisher.Flush()
+
+	diffs := redis.diffs(t, "top:1")
+	assert.Equal(t, 2, len(diffs))
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 2, Score: 200, Rank: 1}}, diffs[1].Entered)
+	assert.Equal(t, uint64(2), publisher.Stats().Reconnects)
+}
@@ -0,0 +1,103 @@
+// Package ratelimit limits how often each client may act, with a token bucket
+// per client key.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter holds a token bucket for each key. A bucket starts full with burst
+// tokens, refills at rate tokens per second, and each allowed action takes one
+// token.
+//
+// Buckets that have been idle long enough to refill are the same as new ones,
+// so they are evicted. When the limiter still holds maxKeys buckets, a new key
+// evicts an arbitrary one, which at worst gives that client a fresh burst.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	maxKeys int
+	idle    time.Duration // Time an empty bucket takes to refill
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter allowing rate actions per second per key, in bursts
+// of up to burst, and tracking at most maxKeys keys.
+func New(rate float64, burst, maxKeys int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		idle:    time.Duration(float64(burst) / rate * float64(time.Second)),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idle {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxKeys {
+			l.sweep(now)
+		}
+		if len(l.buckets) >= l.maxKeys {
+			for evicted := range l.buckets {
+				delete(l.buckets, evicted)
+				break
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep evicts the buckets that have refilled. Callers hold mu.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Len returns the number of keys being tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
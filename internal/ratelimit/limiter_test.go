@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(rate float64, burst, maxKeys int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	l := New(rate, burst, maxKeys)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	l, clock := newTestLimiter(2, 3, 10)
+
+	for range 3 {
+		allowed, _ := l.Allow("a")
+		assert.True(t, allowed)
+	}
+	allowed, wait := l.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have buckets of their own
+	allowed, _ = l.Allow("b")
+	assert.True(t, allowed)
+
+	clock.advance(500 * time.Millisecond)
+	allowed, _ = l.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("a")
+	assert.False(t, allowed)
+
+	// The bucket never holds more than burst
+	clock.advance(time.Hour)
+	for range 3 {
+		allowed, _ = l.Allow("a")
+		assert.True(t, allowed)
+	}
+	allowed, _ = l.Allow("a")
+	assert.False(t, allowed)
+}
+
+func TestLimiter_EvictsIdleKeys(t *testing.T) {
+	l, clock := newTestLimiter(10, 10, 100)
+
+	for i := range 50 {
+		l.Allow(strconv.Itoa(i))
+	}
+	assert.Equal(t, 50, l.Len())
+
+	// After a second every bucket has refilled and is dropped by the next call
+	clock.advance(time.Second)
+	l.Allow("fresh")
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestLimiter_BoundedKeys(t *testing.T) {
+	l, _ := newTestLimiter(1, 1, 10)
+
+	for i := range 1000 {
+		allowed, _ := l.Allow(strconv.Itoa(i))
+		assert.True(t, allowed)
+		assert.LessOrEqual(t, l.Len(), 10)
+	}
+}
+
+func TestLimiter_Concurrent(t *testing.T) {
+	l := New(0.001, 20, 100)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if ok, _ := l.Allow("shared"); ok {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(20), allowed.Load())
+}
@@ -0,0 +1,168 @@
+package receipt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// JWK is an Ed25519 public key in JSON Web Key form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	KeyID     string `json:"kid"`
+	X         string `json:"x"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ,omitempty"`
+}
+
+type key struct {
+	id      string
+	private ed25519.PrivateKey
+}
+
+var (
+	ErrMalformed  = errors.New("malformed receipt")
+	ErrUnknownKey = errors.New("receipt signed with an unknown key")
+	ErrSignature  = errors.New("receipt signature is invalid")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Signer issues receipts as compact JWS tokens signed with Ed25519. The first
+// key signs; the others are only used to verify receipts issued before a key
+// rotation.
+type Signer struct {
+	keys []key
+	now  func() time.Time
+}
+
+// NewSigner parses a comma-separated list of kid:seed pairs, where seed is a
+// base64 encoded 32 byte Ed25519 seed. The first pair is the active key.
+func NewSigner(spec string) (*Signer, error) {
+	s := &Signer{now: func() time.Time { return time.Now().UTC() }}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encodedSeed, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid receipt key %q, expected kid:seed", pair)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encodedSeed)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid seed for receipt key %q", id)
+		}
+
+		s.keys = append(s.keys, key{id: id, private: ed25519.NewKeyFromSeed(seed)})
+	}
+
+	if len(s.keys) == 0 {
+		return nil, errors.New("no receipt keys configured")
+	}
+	return s, nil
+}
+
+// Sign issues a receipt for the claims, stamping the current server time.
+func (s *Signer) Sign(claims models.ReceiptClaims) (string, error) {
+	active := s.keys[0]
+	claims.IssuedAt = s.now().Unix()
+
+	headerJSON, err := json.Marshal(header{Algorithm: "EdDSA", KeyID: active.id, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(headerJSON) + "." + encoding.EncodeToString(claimsJSON)
+	signature := ed25519.Sign(active.private, []byte(signingInput))
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the receipt's signature against any configured key and
+// returns its claims.
+func (s *Signer) Verify(token string) (models.ReceiptClaims, error) {
+	var claims models.ReceiptClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrMalformed
+	}
+
+	headerJSON, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil || h.Algorithm != "EdDSA" {
+		return claims, ErrMalformed
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+
+	var public ed25519.PublicKey
+	for _, k := range s.keys {
+		if k.id == h.KeyID {
+			public = k.private.Public().(ed25519.PublicKey)
+			break
+		}
+	}
+	if public == nil {
+		return claims, ErrUnknownKey
+	}
+
+	if !ed25519.Verify(public, []byte(parts[0]+"."+parts[1]), signature) {
+		return claims, ErrSignature
+	}
+
+	claimsJSON, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return claims, ErrMalformed
+	}
+	return claims, nil
+}
+
+// JWKS returns the public half of every configured key.
+func (s *Signer) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, len(s.keys))}
+	for i, k := range s.keys {
+		jwks.Keys[i] = JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			KeyID:     k.id,
+			X:         encoding.EncodeToString(k.private.Public().(ed25519.PublicKey)),
+			Use:       "sig",
+			Algorithm: "EdDSA",
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,80 @@
+package receipt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSeed(b byte) string {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(seed)
+}
+
+func TestSigner_SignAndVerify(t *testing.T) {
+	signer, err := NewSigner("k2:" + testSeed(2) + ",k1:" + testSeed(1))
+	assert.NoError(t, err)
+
+	claims := models.ReceiptClaims{GameID: 1, UserID: 7, Score: 900, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Rank: 3}
+	token, err := signer.Sign(claims)
+	assert.NoError(t, err)
+
+	verified, err := signer.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, claims.Score, verified.Score)
+	assert.Equal(t, claims.Rank, verified.Rank)
+	assert.True(t, claims.Timestamp.Equal(verified.Timestamp))
+	assert.NotZero(t, verified.IssuedAt)
+
+	jwks := signer.JWKS()
+	assert.Equal(t, 2, len(jwks.Keys))
+	assert.Equal(t, "k2", jwks.Keys[0].KeyID)
+}
+
+func TestSigner_RejectsTamperedReceipts(t *testing.T) {
+	signer, err := NewSigner("k1:" + testSeed(1))
+	assert.NoError(t, err)
+
+	token, err := signer.Sign(models.ReceiptClaims{GameID: 1, UserID: 7, Score: 900})
+	assert.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	forged, _ := (&Signer{keys: signer.keys, now: signer.now}).Sign(models.ReceiptClaims{GameID: 1, UserID: 7, Score: 99999})
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+
+	_, err = signer.Verify(tampered)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = signer.Verify("not-a-receipt")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestSigner_KeyRotation(t *testing.T) {
+	old, err := NewSigner("k1:" + testSeed(1))
+	assert.NoError(t, err)
+	token, err := old.Sign(models.ReceiptClaims{GameID: 1, UserID: 7, Score: 900})
+	assert.NoError(t, err)
+
+	// After rotation the old key still verifies receipts it issued.
+	rotated, err := NewSigner("k2:" + testSeed(2) + ",k1:" + testSeed(1))
+	assert.NoError(t, err)
+	_, err = rotated.Verify(token)
+	assert.NoError(t, err)
+
+	// Once it is retired they are no longer accepted.
+	retired, err := NewSigner("k2:" + testSeed(2))
+	assert.NoError(t, err)
+	_, err = retired.Verify(token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewSigner("k1:short")
+	assert.Error(t, err)
+}
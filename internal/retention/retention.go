@@ -0,0 +1,143 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+)
+
+// Repository is the subset of the Postgres repository the retention job needs.
+type Repository interface {
+	GetAllGames() ([]int64, error)
+	GetRetentionOverrides() (map[int64]int, error)
+	CountScoresBefore(gameID int64, cutoff time.Time) (int64, error)
+	DeleteScoresBefore(gameID int64, cutoff time.Time) (int64, error)
+	SetGameRetention(gameID int64, days *int) error
+}
+
+// Policy is the effective retention for one game. Days of 0 keeps the game's
+// scores forever.
+type Policy struct {
+	GameID int64  `json:"game_id"`
+	Days   int    `json:"retention_days"`
+	Source string `json:"source"` // "game" for an override, "default" otherwise
+}
+
+// Result is the outcome of applying a policy. In a dry run Rows is the number
+// of rows that would have been deleted.
+type Result struct {
+	Policy
+	Cutoff *time.Time `json:"cutoff,omitempty"`
+	Rows   int64      `json:"rows"`
+	DryRun bool       `json:"dry_run"`
+}
+
+// Job deletes raw score rows older than each game's retention period.
+type Job struct {
+	repo        Repository
+	defaultDays int
+	now         func() time.Time
+}
+
+func NewJob(repo Repository, defaultDays int) *Job {
+	return &Job{
+		repo:        repo,
+		defaultDays: defaultDays,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetOverride sets a game's retention in days, or clears it when days is nil.
+func (j *Job) SetOverride(gameID int64, days *int) error {
+	return j.repo.SetGameRetention(gameID, days)
+}
+
+// Policies returns the effective retention of every game, ordered by game ID.
+func (j *Job) Policies() ([]Policy, error) {
+	games, err := j.repo.GetAllGames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list games: %w", err)
+	}
+
+	overrides, err := j.repo.GetRetentionOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention overrides: %w", err)
+	}
+
+	// Games with an override but no scores yet are still listed.
+	seen := make(map[int64]bool, len(games))
+	for _, gameID := range games {
+		seen[gameID] = true
+	}
+	for gameID := range overrides {
+		if !seen[gameID] {
+			games = append(games, gameID)
+		}
+	}
+	sort.Slice(games, func(a, b int) bool { return games[a] < games[b] })
+
+	policies := make([]Policy, len(games))
+	for i, gameID := range games {
+		policies[i] = Policy{GameID: gameID, Days: j.defaultDays, Source: "default"}
+		if days, ok := overrides[gameID]; ok {
+			policies[i].Days = days
+			policies[i].Source = "game"
+		}
+	}
+
+	return policies, nil
+}
+
+// Run applies every game's policy. With dryRun set nothing is deleted and the
+// results report how many rows would have been.
+func (j *Job) Run(dryRun bool) ([]Result, error) {
+	policies, err := j.Policies()
+	if err != nil {
+		return nil, err
+	}
+
+	now := j.now()
+	results := make([]Result, 0, len(policies))
+	for _, policy := range policies {
+		result := Result{Policy: policy, DryRun: dryRun}
+		if policy.Days <= 0 {
+			results = append(results, result)
+			continue
+		}
+
+		cutoff := now.Add(-time.Duration(policy.Days) * 24 * time.Hour)
+		result.Cutoff = &cutoff
+
+		if dryRun {
+			result.Rows, err = j.repo.CountScoresBefore(policy.GameID, cutoff)
+		} else {
+			result.Rows, err = j.repo.DeleteScoresBefore(policy.GameID, cutoff)
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to apply retention for game %d: %w", policy.GameID, err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (j *Job) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			results, err := j.Run(false)
+			if err != nil {
+				logging.Error("Retention run failed", "error", err)
+			}
+			for _, result := range results {
+				if result.Rows > 0 {
+					logging.Info("Retention removed scores", "game", result.GameID, "days", result.Days, "rows", result.Rows)
+				}
+			}
+		}
+	}()
+}
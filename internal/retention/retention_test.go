@@ -0,0 +1,113 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepo struct {
+	scores    map[int64][]time.Time
+	overrides map[int64]int
+}
+
+func (f *fakeRepo) GetAllGames() ([]int64, error) {
+	games := make([]int64, 0, len(f.scores))
+	for gameID := range f.scores {
+		games = append(games, gameID)
+	}
+	return games, nil
+}
+
+func (f *fakeRepo) GetRetentionOverrides() (map[int64]int, error) {
+	return f.overrides, nil
+}
+
+func (f *fakeRepo) CountScoresBefore(gameID int64, cutoff time.Time) (int64, error) {
+	var count int64
+	for _, ts := range f.scores[gameID] {
+		if ts.Before(cutoff) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeRepo) DeleteScoresBefore(gameID int64, cutoff time.Time) (int64, error) {
+	var kept []time.Time
+	var deleted int64
+	for _, ts := range f.scores[gameID] {
+		if ts.Before(cutoff) {
+			deleted++
+			continue
+		}
+		kept = append(kept, ts)
+	}
+	f.scores[gameID] = kept
+	return deleted, nil
+}
+
+func (f *fakeRepo) SetGameRetention(gameID int64, days *int) error {
+	if days == nil {
+		delete(f.overrides, gameID)
+		return nil
+	}
+	f.overrides[gameID] = *days
+	return nil
+}
+
+func TestJob_PerGameRetention(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	repo := &fakeRepo{
+		scores: map[int64][]time.Time{
+			1: {days(1), days(40), days(400)},   // short retention override
+			2: {days(1), days(40), days(400)},   // long retention override
+			3: {days(1), days(100), days(1000)}, // global default
+		},
+		overrides: map[int64]int{},
+	}
+
+	job := NewJob(repo, 365)
+	job.now = func() time.Time { return now }
+
+	short, long := 30, 730
+	assert.NoError(t, job.SetOverride(1, &short))
+	assert.NoError(t, job.SetOverride(2, &long))
+
+	policies, err := job.Policies()
+	assert.NoError(t, err)
+	assert.Equal(t, []Policy{
+		{GameID: 1, Days: 30, Source: "game"},
+		{GameID: 2, Days: 730, Source: "game"},
+		{GameID: 3, Days: 365, Source: "default"},
+	}, policies)
+
+	// A dry run reports per-game counts without deleting anything.
+	results, err := job.Run(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 0, 1}, []int64{results[0].Rows, results[1].Rows, results[2].Rows})
+	assert.Equal(t, 3, len(repo.scores[1]))
+
+	results, err = job.Run(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 0, 1}, []int64{results[0].Rows, results[1].Rows, results[2].Rows})
+
+	assert.Equal(t, []time.Time{days(1)}, repo.scores[1])
+	assert.Equal(t, []time.Time{days(1), days(40), days(400)}, repo.scores[2])
+	assert.Equal(t, []time.Time{days(1), days(100)}, repo.scores[3])
+
+	// Clearing the override falls back to the default; 0 keeps everything.
+	assert.NoError(t, job.SetOverride(2, nil))
+	forever := 0
+	assert.NoError(t, job.SetOverride(3, &forever))
+
+	results, err = job.Run(false)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", results[1].Source)
+	assert.Equal(t, int64(1), results[1].Rows)
+	assert.Nil(t, results[2].Cutoff)
+	assert.Equal(t, int64(0), results[2].Rows)
+}
@@ -0,0 +1,71 @@
+// Package scoretime bounds the timestamps scores may carry. A timestamp in
+// the future would keep a score in the short windows forever, and a very old
+// one is most likely a client clock or replay bug.
+package scoretime
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/config"
+)
+
+// Policy says how far a score's timestamp may stray from the time it was
+// received. A nil policy accepts every timestamp.
+type Policy struct {
+	MaxSkew  time.Duration // How far ahead of the receipt time a timestamp may be
+	MaxAge   time.Duration // How far behind it may be, unbounded when 0
+	ClampOld bool          // Move timestamps older than MaxAge up to it instead of rejecting them
+}
+
+// FromConfig returns the policy configured in cfg.
+func FromConfig(cfg config.ScoreTimeConfig) *Policy {
+	return &Policy{
+		MaxSkew:  time.Duration(cfg.MaxSkew) * time.Second,
+		MaxAge:   time.Duration(cfg.MaxAge) * time.Second,
+		ClampOld: cfg.ClampOld,
+	}
+}
+
+// Error is returned for a timestamp the policy rejects.
+type Error struct {
+	Timestamp time.Time
+	Future    bool // Too far in the future, otherwise too old
+	Limit     time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Future {
+		return fmt.Sprintf("timestamp %s is more than %s in the future", e.Timestamp.Format(time.RFC3339), e.Limit)
+	}
+	return fmt.Sprintf("timestamp %s is more than %s old", e.Timestamp.Format(time.RFC3339), e.Limit)
+}
+
+// Reason describes what was wrong with the timestamp, for field errors.
+func (e *Error) Reason() string {
+	if e.Future {
+		return fmt.Sprintf("must be at most %s in the future", e.Limit)
+	}
+	return fmt.Sprintf("must be at most %s old", e.Limit)
+}
+
+// Check returns the timestamp to store for a score stamped timestamp and
+// received at receivedAt, or an *Error when the policy rejects it.
+func (p *Policy) Check(timestamp, receivedAt time.Time) (time.Time, error) {
+	if p == nil {
+		return timestamp, nil
+	}
+	if timestamp.After(receivedAt.Add(p.MaxSkew)) {
+		return timestamp, &Error{Timestamp: timestamp, Future: true, Limit: p.MaxSkew}
+	}
+	if p.MaxAge > 0 {
+		oldest := receivedAt.Add(-p.MaxAge)
+		if timestamp.Before(oldest) {
+			if p.ClampOld {
+				return oldest, nil
+			}
+			return timestamp, &Error{Timestamp: timestamp, Limit: p.MaxAge}
+		}
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,48 @@
+package scoretime
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	reject := &Policy{MaxSkew: 5 * time.Minute, MaxAge: 30 * 24 * time.Hour}
+	clamp := &Policy{MaxSkew: 5 * time.Minute, MaxAge: 30 * 24 * time.Hour, ClampOld: true}
+
+	tests := []struct {
+		name       string
+		policy     *Policy
+		timestamp  time.Time
+		want       time.Time
+		wantFuture bool
+		wantErr    bool
+	}{
+		{"now", reject, received, received, false, false},
+		{"within skew", reject, received.Add(5 * time.Minute), received.Add(5 * time.Minute), false, false},
+		{"future", reject, received.Add(5*time.Minute + time.Second), time.Time{}, true, true},
+		{"next year", clamp, received.AddDate(1, 0, 0), time.Time{}, true, true},
+		{"oldest allowed", reject, received.Add(-30 * 24 * time.Hour), received.Add(-30 * 24 * time.Hour), false, false},
+		{"too old", reject, received.Add(-31 * 24 * time.Hour), time.Time{}, false, true},
+		{"too old clamped", clamp, received.Add(-31 * 24 * time.Hour), received.Add(-30 * 24 * time.Hour), false, false},
+		{"no max age", &Policy{MaxSkew: time.Minute}, received.AddDate(-5, 0, 0), received.AddDate(-5, 0, 0), false, false},
+		{"nil policy", nil, received.AddDate(1, 0, 0), received.AddDate(1, 0, 0), false, false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.policy.Check(tt.timestamp, received)
+		if !tt.wantErr {
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.want, got, tt.name)
+			continue
+		}
+		var timeErr *Error
+		if assert.True(t, errors.As(err, &timeErr), tt.name) {
+			assert.Equal(t, tt.wantFuture, timeErr.Future, tt.name)
+			assert.NotEmpty(t, timeErr.Reason(), tt.name)
+		}
+	}
+}
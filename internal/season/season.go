@@ -0,0 +1,190 @@
+// Package season rolls games over from one season to the next. When a season
+// ends it is frozen, which drops its board from memory, and a season of the
+// same length is started after it.
+package season
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// ErrOverlap is returned for a season that overlaps another of its game.
+var ErrOverlap = errors.New("season overlaps another season of the game")
+
+// Repository is the subset of the Postgres repository seasons need.
+type Repository interface {
+	GetSeasons(gameID int64) ([]models.Season, error)
+	GetOpenSeasons() ([]models.Season, error)
+	CreateSeason(season models.Season) (models.Season, bool, error)
+	FreezeSeason(seasonID int64, at time.Time) (bool, error)
+}
+
+// Boards keeps the boards of the open seasons, normally the store.
+type Boards interface {
+	SetOpenSeasons(seasons []models.Season)
+}
+
+// Rollover is a season frozen by a run and the one started after it, which is
+// nil when a later season already existed or was started by an earlier run.
+type Rollover struct {
+	Frozen  models.Season  `json:"frozen"`
+	Started *models.Season `json:"started,omitempty"`
+}
+
+// Job freezes ended seasons and starts their successors. It can run on every
+// instance: Postgres lets only one of them freeze a season or start the next.
+type Job struct {
+	repo      Repository
+	boards    Boards
+	lookahead time.Duration
+	now       func() time.Time
+}
+
+// NewJob creates a job that starts each next season once the current one
+// ends within lookahead, so it is open before its first score arrives. It
+// should be at least the interval between runs.
+func NewJob(repo Repository, boards Boards, lookahead time.Duration) *Job {
+	return &Job{
+		repo:      repo,
+		boards:    boards,
+		lookahead: lookahead,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Seasons returns a game's seasons, oldest first.
+func (j *Job) Seasons(gameID int64) ([]models.Season, error) {
+	return j.repo.GetSeasons(gameID)
+}
+
+// Create adds a season to a game and opens its board.
+func (j *Job) Create(gameID int64, startsAt, endsAt time.Time) (models.Season, error) {
+	if !endsAt.After(startsAt) {
+		return models.Season{}, fmt.Errorf("season must end after it starts")
+	}
+
+	season, created, err := j.repo.CreateSeason(models.Season{GameID: gameID, StartsAt: startsAt.UTC(), EndsAt: endsAt.UTC()})
+	if err != nil {
+		return models.Season{}, fmt.Errorf("failed to create season: %w", err)
+	}
+	if !created {
+		return models.Season{}, ErrOverlap
+	}
+
+	return season, j.Refresh()
+}
+
+// Refresh hands the open seasons to the boards, picking up seasons created
+// through other instances.
+func (j *Job) Refresh() error {
+	seasons, err := j.repo.GetOpenSeasons()
+	if err != nil {
+		return fmt.Errorf("failed to load open seasons: %w", err)
+	}
+	j.boards.SetOpenSeasons(seasons)
+	return nil
+}
+
+// Run freezes the open seasons that have ended, starts the seasons that
+// follow each game's last one, and refreshes the boards.
+func (j *Job) Run() ([]Rollover, error) {
+	open, err := j.repo.GetOpenSeasons()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open seasons: %w", err)
+	}
+
+	now := j.now()
+	last := make(map[int64]models.Season)
+	for _, season := range open {
+		if current, ok := last[season.GameID]; !ok || season.EndsAt.After(current.EndsAt) {
+			last[season.GameID] = season
+		}
+	}
+
+	// Start next seasons first, so scores keep landing in a season while
+	// the ended one is frozen.
+	started := make(map[int64]models.Season)
+	for gameID, season := range last {
+		if season.EndsAt.After(now.Add(j.lookahead)) {
+			continue
+		}
+		next, created, err := j.repo.CreateSeason(following(season, now))
+		if err != nil {
+			return nil, fmt.Errorf("failed to start the next season of game %d: %w", gameID, err)
+		}
+		if created {
+			started[gameID] = next
+		}
+	}
+
+	var rollovers []Rollover
+	for _, season := range open {
+		if season.EndsAt.After(now) {
+			continue
+		}
+		frozen, err := j.repo.FreezeSeason(season.SeasonID, now)
+		if err != nil {
+			return rollovers, fmt.Errorf("failed to freeze season %d: %w", season.SeasonID, err)
+		}
+		if !frozen {
+			continue
+		}
+		season.FrozenAt = &now
+		rollover := Rollover{Frozen: season}
+		if next, ok := started[season.GameID]; ok && last[season.GameID].SeasonID == season.SeasonID {
+			rollover.Started = &next
+		}
+		rollovers = append(rollovers, rollover)
+	}
+
+	return rollovers, j.Refresh()
+}
+
+// following returns the season after the given one, as long as it. Seasons
+// spanning whole calendar months are followed by as many months, whatever
+// their length in days. Seasons that would already have ended by now, for
+// example after an outage, are skipped.
+func following(season models.Season, now time.Time) models.Season {
+	next := func(t time.Time) time.Time { return t.Add(season.EndsAt.Sub(season.StartsAt)) }
+	if months := calendarMonths(season.StartsAt, season.EndsAt); months > 0 {
+		next = func(t time.Time) time.Time { return t.AddDate(0, months, 0) }
+	}
+
+	start := season.EndsAt
+	for !next(start).After(now) {
+		start = next(start)
+	}
+	return models.Season{GameID: season.GameID, StartsAt: start, EndsAt: next(start)}
+}
+
+// calendarMonths returns how many months end is after start when it is
+// exactly whole months later, otherwise 0.
+func calendarMonths(start, end time.Time) int {
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	if months > 0 && start.AddDate(0, months, 0).Equal(end) {
+		return months
+	}
+	return 0
+}
+
+func (j *Job) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			rollovers, err := j.Run()
+			if err != nil {
+				logging.Error("Season rollover failed", "error", err)
+			}
+			for _, rollover := range rollovers {
+				logging.Info("Season ended", "game", rollover.Frozen.GameID, "season", rollover.Frozen.SeasonID)
+				if rollover.Started != nil {
+					logging.Info("Season started", "game", rollover.Started.GameID, "season", rollover.Started.SeasonID, "ends", rollover.Started.EndsAt)
+				}
+			}
+		}
+	}()
+}
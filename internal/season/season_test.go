@@ -0,0 +1,151 @@
+package season
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepo struct {
+	seasons []models.Season
+}
+
+func (f *fakeRepo) GetSeasons(gameID int64) ([]models.Season, error) {
+	var seasons []models.Season
+	for _, season := range f.seasons {
+		if season.GameID == gameID {
+			seasons = append(seasons, season)
+		}
+	}
+	return seasons, nil
+}
+
+func (f *fakeRepo) GetOpenSeasons() ([]models.Season, error) {
+	var open []models.Season
+	for _, season := range f.seasons {
+		if season.FrozenAt == nil {
+			open = append(open, season)
+		}
+	}
+	return open, nil
+}
+
+func (f *fakeRepo) CreateSeason(season models.Season) (models.Season, bool, error) {
+	for _, existing := range f.seasons {
+		if existing.GameID == season.GameID && existing.StartsAt.Before(season.EndsAt) && existing.EndsAt.After(season.StartsAt) {
+			return season, false, nil
+		}
+	}
+	season.SeasonID = int64(len(f.seasons) + 1)
+	f.seasons = append(f.seasons, season)
+	return season, true, nil
+}
+
+func (f *fakeRepo) FreezeSeason(seasonID int64, at time.Time) (bool, error) {
+	for i := range f.seasons {
+		if f.seasons[i].SeasonID == seasonID && f.seasons[i].FrozenAt == nil {
+			f.seasons[i].FrozenAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeBoards struct {
+	open []models.Season
+}
+
+func (f *fakeBoards) SetOpenSeasons(seasons []models.Season) {
+	f.open = seasons
+}
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestJob_Create(t *testing.T) {
+	repo := &fakeRepo{}
+	boards := &fakeBoards{}
+	job := NewJob(repo, boards, time.Minute)
+
+	season, err := job.Create(1, date(time.January, 1), date(time.February, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), season.SeasonID)
+	assert.Len(t, boards.open, 1)
+
+	_, err = job.Create(1, date(time.January, 15), date(time.February, 15))
+	assert.ErrorIs(t, err, ErrOverlap)
+	_, err = job.Create(2, date(time.January, 15), date(time.February, 15))
+	assert.NoError(t, err)
+	_, err = job.Create(1, date(time.March, 1), date(time.March, 1))
+	assert.Error(t, err)
+}
+
+func TestJob_Run(t *testing.T) {
+	repo := &fakeRepo{}
+	boards := &fakeBoards{}
+	job := NewJob(repo, boards, time.Hour)
+	job.Create(1, date(time.January, 1), date(time.February, 1))
+	job.Create(2, date(time.January, 1), date(time.January, 8))
+
+	// Nothing to do mid-season.
+	job.now = func() time.Time { return date(time.January, 5) }
+	rollovers, err := job.Run()
+	assert.NoError(t, err)
+	assert.Empty(t, rollovers)
+	assert.Len(t, repo.seasons, 2)
+
+	// Within the lookahead of the end the next season is already open.
+	job.now = func() time.Time { return date(time.January, 8).Add(-time.Minute) }
+	rollovers, err = job.Run()
+	assert.NoError(t, err)
+	assert.Empty(t, rollovers)
+	assert.Len(t, repo.seasons, 3)
+	assert.Equal(t, date(time.January, 8), repo.seasons[2].StartsAt)
+	assert.Equal(t, date(time.January, 15), repo.seasons[2].EndsAt)
+
+	// Once it ends the season is frozen and dropped from the boards.
+	job.now = func() time.Time { return date(time.January, 8).Add(time.Minute) }
+	rollovers, err = job.Run()
+	assert.NoError(t, err)
+	assert.Len(t, rollovers, 1)
+	assert.Equal(t, int64(2), rollovers[0].Frozen.SeasonID)
+	assert.Nil(t, rollovers[0].Started)
+	assert.Len(t, boards.open, 2)
+
+	// Monthly seasons roll over by calendar month, and a rerun changes
+	// nothing.
+	job.now = func() time.Time { return date(time.February, 1).Add(time.Minute) }
+	rollovers, err = job.Run()
+	assert.NoError(t, err)
+	assert.Len(t, rollovers, 2)
+	started := rollovers[0].Started
+	if rollovers[0].Frozen.GameID != 1 {
+		started = rollovers[1].Started
+	}
+	assert.Equal(t, date(time.February, 1), started.StartsAt)
+	assert.Equal(t, date(time.March, 1), started.EndsAt)
+
+	rollovers, err = job.Run()
+	assert.NoError(t, err)
+	assert.Empty(t, rollovers)
+}
+
+func TestFollowing(t *testing.T) {
+	monthly := models.Season{GameID: 1, StartsAt: date(time.January, 1), EndsAt: date(time.February, 1)}
+	next := following(monthly, date(time.January, 31))
+	assert.Equal(t, date(time.February, 1), next.StartsAt)
+	assert.Equal(t, date(time.March, 1), next.EndsAt)
+
+	// After an outage the seasons that already ended are skipped.
+	next = following(monthly, date(time.April, 10))
+	assert.Equal(t, date(time.April, 1), next.StartsAt)
+	assert.Equal(t, date(time.May, 1), next.EndsAt)
+
+	weekly := models.Season{GameID: 1, StartsAt: date(time.January, 1), EndsAt: date(time.January, 8)}
+	next = following(weekly, date(time.January, 20))
+	assert.Equal(t, date(time.January, 15), next.StartsAt)
+	assert.Equal(t, date(time.January, 22), next.EndsAt)
+}
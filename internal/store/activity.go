@@ -0,0 +1,150 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// UserActivity is what the activity tracker remembers about one player in one
+// game.
+type UserActivity struct {
+	Recent []time.Time // submission times, oldest first
+	Best   uint64      // best score submitted so far
+}
+
+// CountSince returns how many of the remembered submissions happened at or
+// after since.
+func (a UserActivity) CountSince(since time.Time) int {
+	count := 0
+	for _, at := range a.Recent {
+		if !at.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+type activityKey struct {
+	gameID int64
+	userID int64
+}
+
+type activityEntry struct {
+	key   activityKey
+	times []time.Time // ring buffer of submission times
+	next  int
+	count int
+	best  uint64
+}
+
+// ActivityTracker keeps the last few submission times and the best score of
+// recently active players, so per-user checks do not need to hit Postgres.
+// Memory is bounded by evicting the least recently active player once the
+// tracker holds capacity players.
+type ActivityTracker struct {
+	mu        sync.Mutex
+	capacity  int
+	depth     int
+	entries   map[activityKey]*list.Element
+	lru       *list.List // front is the most recently active
+	evictions uint64
+}
+
+func NewActivityTracker(capacity, depth int) *ActivityTracker {
+	return &ActivityTracker{
+		capacity: capacity,
+		depth:    depth,
+		entries:  make(map[activityKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Record notes a submission of score by the player at the given time.
+func (t *ActivityTracker) Record(score models.Score, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := activityKey{gameID: score.GameID, userID: score.UserID}
+	element, exists := t.entries[key]
+	if exists {
+		t.lru.MoveToFront(element)
+	} else {
+		if t.lru.Len() >= t.capacity {
+			t.evictOldest()
+		}
+		element = t.lru.PushFront(&activityEntry{key: key, times: make([]time.Time, t.depth)})
+		t.entries[key] = element
+	}
+
+	entry := element.Value.(*activityEntry)
+	entry.times[entry.next] = at
+	entry.next = (entry.next + 1) % t.depth
+	if entry.count < t.depth {
+		entry.count++
+	}
+	if score.Score > entry.best {
+		entry.best = score.Score
+	}
+}
+
+func (t *ActivityTracker) evictOldest() {
+	oldest := t.lru.Back()
+	if oldest == nil {
+		return
+	}
+	t.lru.Remove(oldest)
+	delete(t.entries, oldest.Value.(*activityEntry).key)
+	t.evictions++
+}
+
+// Lookup returns the player's recent activity, or false if the player has not
+// submitted recently enough to still be tracked.
+func (t *ActivityTracker) Lookup(gameID, userID int64) (UserActivity, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	element, exists := t.entries[activityKey{gameID: gameID, userID: userID}]
+	if !exists {
+		return UserActivity{}, false
+	}
+
+	entry := element.Value.(*activityEntry)
+	activity := UserActivity{
+		Recent: make([]time.Time, 0, entry.count),
+		Best:   entry.best,
+	}
+	start := (entry.next - entry.count + t.depth) % t.depth
+	for i := range entry.count {
+		activity.Recent = append(activity.Recent, entry.times[(start+i)%t.depth])
+	}
+	return activity, true
+}
+
+// Forget drops everything remembered about the player, in every game.
+func (t *ActivityTracker) Forget(userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, element := range t.entries {
+		if key.userID == userID {
+			t.lru.Remove(element)
+			delete(t.entries, key)
+		}
+	}
+}
+
+// Stats reports how full the tracker is.
+func (t *ActivityTracker) Stats() models.ActivityStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return models.ActivityStats{
+		Players:   t.lru.Len(),
+		Capacity:  t.capacity,
+		Depth:     t.depth,
+		Evictions: t.evictions,
+	}
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"time"
+
+	cache "github.com/IWhitebird/go-leader-board/internal/cache"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+type MutationOp int
+
+const (
+	// MutationPut keeps the better of the player's current and new score,
+	// like AddScore.
+	MutationPut MutationOp = iota
+	// MutationSet replaces the player's score, even with a worse one.
+	MutationSet
+	// MutationDelete removes the player from every window.
+	MutationDelete
+)
+
+// Mutation is one change to a game's board, applied together with others by
+// Apply or ApplyByCopy.
+type Mutation struct {
+	Op        MutationOp
+	UserID    int64
+	Score     uint64
+	Timestamp time.Time
+}
+
+// applyInPlaceLimit is the largest batch Store.ApplyMutations applies while
+// holding the window locks. Larger batches are applied to copies and swapped
+// in, so readers are not blocked for the whole batch.
+const applyInPlaceLimit = 1024
+
+func (gl *GameLeaderboard) applyMutation(lb *LeaderBoard, window models.TimeWindow, m Mutation) bool {
+	score := models.Score{UserID: m.UserID, Score: m.Score, Timestamp: m.Timestamp}
+
+	switch m.Op {
+	case MutationPut:
+		return gl.isScoreValid(window, m.Timestamp) && lb.put(m.UserID, score)
+	case MutationSet:
+		removed := lb.remove(m.UserID)
+		if !gl.isScoreValid(window, m.Timestamp) {
+			return removed
+		}
+		return lb.put(m.UserID, score) || removed
+	case MutationDelete:
+		return lb.remove(m.UserID)
+	}
+	return false
+}
+
+func (gl *GameLeaderboard) advanceWatermarkFor(mutations []Mutation) {
+	for _, m := range mutations {
+		if m.Op != MutationDelete {
+			gl.advanceWatermark(m.Timestamp)
+		}
+	}
+}
+
+// lockAll takes every window's lock, and a cumulative board's hours before
+// them, always in the same order so two batches cannot deadlock, and returns a
+// function releasing them.
+func (gl *GameLeaderboard) lockAll() func() {
+	if gl.totals != nil {
+		for _, t := range gl.totals.shards {
+			t.mu.Lock()
+		}
+	}
+	for _, lb := range gl.leaderboards {
+		lb.lock()
+	}
+	return func() {
+		for _, lb := range gl.leaderboards {
+			lb.unlock()
+		}
+		if gl.totals != nil {
+			for _, t := range gl.totals.shards {
+				t.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Apply applies the mutations to every window while holding all the window
+// locks, so readers see either none of them or all of them. It reports whether
+// any window changed.
+func (gl *GameLeaderboard) Apply(mutations []Mutation) bool {
+	gl.advanceWatermarkFor(mutations)
+
+	unlock := gl.lockAll()
+	defer unlock()
+
+	gl.forgetTotals(mutations)
+	changed := false
+	for i, window := range models.AllTimeWindows() {
+		for _, m := range mutations {
+			if gl.applyMutation(gl.leaderboards[i], window, m) {
+				changed = true
+			}
+		}
+	}
+	if gl.applyToCalendar(mutations) {
+		changed = true
+	}
+	if changed {
+		gl.version.Add(1)
+	}
+	return changed
+}
+
+// ApplyByCopy applies the mutations to copies of the windows without holding
+// any lock, then swaps the copies in together. If the board changed while the
+// copies were being built, it falls back to Apply.
+func (gl *GameLeaderboard) ApplyByCopy(mutations []Mutation) {
+	version := gl.Version()
+
+	var copies [models.LeaderboardIndexCount]*LeaderBoard
+	for i, window := range models.AllTimeWindows() {
+		var entries [][]cache.Entry[int64, models.Score]
+		var sketches []*QuantileSketch
+		gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+			entries, sketches = lb.contents()
+		})
+
+		copied := copyLeaderBoard(entries, sketches)
+		for _, m := range mutations {
+			gl.applyMutation(copied, window, m)
+		}
+		copies[i] = copied
+	}
+
+	unlock := gl.lockAll()
+	if gl.Version() != version {
+		unlock()
+		gl.Apply(mutations)
+		return
+	}
+
+	gl.advanceWatermarkFor(mutations)
+	gl.forgetTotals(mutations)
+	for i, lb := range gl.leaderboards {
+		for j, shard := range lb.shards {
+			shard.scoresList = copies[i].shards[j].scoresList
+			shard.sketch = copies[i].shards[j].sketch
+			shard.levels = copies[i].shards[j].levels
+		}
+	}
+	gl.applyToCalendar(mutations)
+	gl.version.Add(1)
+	unlock()
+}
+
+// ApplyMutations applies the mutations to the game's board atomically: readers
+// see either none of them or all of them. Small batches are applied under the
+// window locks, larger ones by copy and swap.
+func (ls *Store) ApplyMutations(gameID int64, mutations []Mutation) {
+	if len(mutations) == 0 {
+		return
+	}
+
+	leaderboard := ls.GetOrCreateLeaderboard(gameID)
+	if leaderboard == nil {
+		return
+	}
+	if len(mutations) > applyInPlaceLimit {
+		leaderboard.ApplyByCopy(mutations)
+	} else {
+		leaderboard.Apply(mutations)
+	}
+	ls.notifyBoardChange(gameID)
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// RejectedScore is a score from a batch that was not recorded, with the reason.
+type RejectedScore struct {
+	Score  models.Score
+	Reason error
+}
+
+// BatchError is returned by SaveScoreBatch when part of a batch was rejected.
+// Every score not listed in Rejected was persisted and applied.
+type BatchError struct {
+	Rejected []RejectedScore
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d scores rejected from batch, first: %v", len(e.Rejected), e.Rejected[0].Reason)
+}
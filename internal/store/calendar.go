@@ -0,0 +1,165 @@
+package store
+
+import (
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// The calendar windows do not roll: each holds the current day's or week's
+// scores on a board of its own, and starts over on a fresh board when the
+// period ends. The board is swapped in whole, so a read racing the change
+// sees either the old period's board or the new one, never one half cleared.
+//
+// Writers swap in the new period themselves when they get there first, so a
+// score is never added to a period that has ended. Store.StartCalendarResets
+// does it at the boundary for every game, so boards nobody writes to start over
+// on time too.
+
+type calendarPeriod struct {
+	board      *LeaderBoard
+	start, end time.Time
+}
+
+func newCalendarPeriod(window models.TimeWindow, now time.Time, shards int) *calendarPeriod {
+	start, end := window.Period(now)
+	return &calendarPeriod{board: newLeaderBoard(shards), start: start, end: end}
+}
+
+func (gl *GameLeaderboard) initCalendar(shards int) {
+	now := clock()
+	for i, window := range models.CalendarWindows() {
+		gl.calendar[i].Store(newCalendarPeriod(window, now, shards))
+	}
+}
+
+// currentPeriod returns the calendar window's period containing now, swapping
+// in a fresh one when the stored period does not.
+func (gl *GameLeaderboard) currentPeriod(window models.TimeWindow, now time.Time) *calendarPeriod {
+	slot := &gl.calendar[window.CalendarIndex()]
+	for {
+		period := slot.Load()
+		if !now.Before(period.start) && now.Before(period.end) {
+			return period
+		}
+		next := newCalendarPeriod(window, now, len(period.board.shards))
+		if slot.CompareAndSwap(period, next) {
+			gl.version.Add(1)
+			return next
+		}
+	}
+}
+
+// addToCalendar adds a score to each calendar window whose current period it
+// falls in. With accumulate it adds to the player's total rather than keeping
+// their best.
+func (gl *GameLeaderboard) addToCalendar(score models.Score, accumulate bool) {
+	now := clock()
+	for _, window := range models.CalendarWindows() {
+		period := gl.currentPeriod(window, now)
+		if score.Timestamp.Before(period.start) {
+			continue
+		}
+
+		shard := period.board.shardFor(score.UserID)
+		shard.mu.Lock()
+		var changed bool
+		if accumulate {
+			changed = shard.accumulate(score.UserID, score.Score, score.Timestamp)
+		} else {
+			changed = shard.put(score.UserID, score)
+		}
+		shard.mu.Unlock()
+		if changed {
+			gl.version.Add(1)
+		}
+	}
+}
+
+// applyToCalendar applies mutations to the calendar windows, each under its
+// board's lock, and reports whether any changed.
+func (gl *GameLeaderboard) applyToCalendar(mutations []Mutation) bool {
+	changed := false
+	for _, window := range models.CalendarWindows() {
+		gl.withLeaderboard(window, LockTypeWrite, func(lb *LeaderBoard) {
+			for _, m := range mutations {
+				if gl.applyMutation(lb, window, m) {
+					changed = true
+				}
+			}
+		})
+	}
+	return changed
+}
+
+// resetCalendar starts every calendar window's current period over empty.
+func (gl *GameLeaderboard) resetCalendar() {
+	now := clock()
+	for i, window := range models.CalendarWindows() {
+		gl.calendar[i].Store(newCalendarPeriod(window, now, gl.Shards()))
+	}
+	gl.version.Add(1)
+}
+
+// seedCalendar fills the calendar windows after a restore from the rolling
+// window covering each period, keeping the entries set since it started. A
+// player whose best score in that window predates the period is left out even
+// if they scored lower since, until their next score. Cumulative boards are
+// never restored, so this only deals in best scores.
+func (gl *GameLeaderboard) seedCalendar() {
+	now := clock()
+	for _, window := range models.CalendarWindows() {
+		period := gl.currentPeriod(window, now)
+		length := models.WindowOfHours(int(period.end.Sub(period.start).Hours()))
+
+		var scores []models.Score
+		gl.withLeaderboard(coveringWindow(length), LockTypeDirtyRead, func(lb *LeaderBoard) {
+			scores = lb.scores()
+		})
+		for _, score := range scores {
+			if !score.Timestamp.Before(period.start) {
+				gl.addToCalendar(score, false)
+			}
+		}
+	}
+}
+
+// StartCalendarResets starts the calendar windows of every game over at the
+// end of each day and week, in models.CalendarLocation.
+func (ls *Store) StartCalendarResets() {
+	go func() {
+		for {
+			now := clock()
+			next := now.Add(24 * time.Hour)
+			for _, window := range models.CalendarWindows() {
+				if _, end := window.Period(now); end.Before(next) {
+					next = end
+				}
+			}
+			time.Sleep(next.Sub(now))
+
+			rolled := 0
+			for gameID, leaderboard := range ls.allBoards() {
+				for _, window := range models.CalendarWindows() {
+					leaderboard.currentPeriod(window, clock())
+				}
+				ls.notifyBoardChange(gameID)
+				rolled++
+			}
+			logging.Info("Calendar windows started over", "games", rolled)
+		}
+	}()
+}
+
+// allBoards returns every resident game's board, hidden ones included.
+func (ls *Store) allBoards() map[int64]*GameLeaderboard {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	boards := make(map[int64]*GameLeaderboard, len(ls.leaderboards))
+	for gameID, leaderboard := range ls.leaderboards {
+		boards[gameID] = leaderboard
+	}
+	return boards
+}
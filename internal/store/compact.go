@@ -0,0 +1,157 @@
+package store
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// estimatedEntryBytes is the approximate size of one skiplist node holding a
+// score, see the memory analysis in the README.
+const estimatedEntryBytes = 139
+
+// Report counts the games and entries resident in the store, along with the
+// Go runtime heap statistics.
+func (ls *Store) Report() models.StoreReport {
+	report := models.StoreReport{
+		Entries: make(map[string]uint64, models.LeaderboardIndexCount),
+	}
+
+	for _, leaderboard := range ls.residentGames() {
+		report.Games++
+		for _, window := range models.AllTimeWindows() {
+			entries := leaderboard.entryCount(window)
+			report.Entries[window.Display] += entries
+			report.EstimatedBytes += entries * estimatedEntryBytes
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	report.Heap = models.HeapStats{
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapIdle:     mem.HeapIdle,
+		HeapReleased: mem.HeapReleased,
+		HeapObjects:  mem.HeapObjects,
+		NumGC:        mem.NumGC,
+	}
+
+	if ls.activity != nil {
+		stats := ls.activity.Stats()
+		report.Activity = &stats
+	}
+
+	return report
+}
+
+// GameReports counts each resident game's entries per window, largest game
+// first.
+func (ls *Store) GameReports() []models.GameStoreReport {
+	games := ls.residentGames()
+	reports := make([]models.GameStoreReport, 0, len(games))
+	for gameID, leaderboard := range games {
+		report := models.GameStoreReport{
+			GameID:  gameID,
+			Entries: make(map[string]uint64, models.LeaderboardIndexCount),
+		}
+		for _, window := range models.AllTimeWindows() {
+			entries := leaderboard.entryCount(window)
+			report.Entries[window.Display] = entries
+			report.EstimatedBytes += entries * estimatedEntryBytes
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].EstimatedBytes != reports[j].EstimatedBytes {
+			return reports[i].EstimatedBytes > reports[j].EstimatedBytes
+		}
+		return reports[i].GameID < reports[j].GameID
+	})
+	return reports
+}
+
+// RecordMetrics sets the store gauges: resident games and entries per
+// window. It is meant to run before each metrics scrape.
+func (ls *Store) RecordMetrics() {
+	entries := make(map[string]uint64, models.LeaderboardIndexCount)
+	games := ls.residentGames()
+	for _, leaderboard := range games {
+		for _, window := range models.AllTimeWindows() {
+			entries[window.Display] += leaderboard.entryCount(window)
+		}
+	}
+
+	metrics.GamesLoaded.Set(float64(len(games)))
+	for _, window := range models.AllTimeWindows() {
+		metrics.BoardEntries.Set(float64(entries[window.Display]), window.Display)
+	}
+}
+
+// Compact removes expired window entries, drops games whose boards are all
+// empty and, when releaseMemory is set, forces a GC that returns freed memory
+// to the OS. The report shows the store before and after the pass.
+func (ls *Store) Compact(releaseMemory bool) models.CompactionReport {
+	start := time.Now()
+	before := ls.Report()
+
+	ls.CleanOldEntries()
+	pruned := ls.pruneEmptyGames()
+
+	if releaseMemory {
+		debug.FreeOSMemory()
+	}
+
+	after := ls.Report()
+
+	var removed uint64
+	for window, entries := range before.Entries {
+		if entries > after.Entries[window] {
+			removed += entries - after.Entries[window]
+		}
+	}
+
+	return models.CompactionReport{
+		Before:         before,
+		After:          after,
+		RemovedEntries: removed,
+		PrunedGames:    pruned,
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+}
+
+func (ls *Store) pruneEmptyGames() int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	pruned := 0
+	for gameID, leaderboard := range ls.leaderboards {
+		// Exclusions are only held here, so keep games that have them.
+		if leaderboard.IsEmpty() && len(leaderboard.excludedSet()) == 0 {
+			delete(ls.leaderboards, gameID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func (ls *Store) StartPeriodicCompaction(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			report := ls.Compact(true)
+			logging.Info("Store compaction finished",
+				"removed_entries", report.RemovedEntries,
+				"pruned_games", report.PrunedGames,
+				"heap_inuse_before", report.Before.Heap.HeapInuse,
+				"heap_inuse_after", report.After.Heap.HeapInuse,
+				"duration_ms", report.DurationMs)
+		}
+	}()
+}
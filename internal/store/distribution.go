@@ -0,0 +1,233 @@
+package store
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// distributionPoints is the number of order statistics kept per window. The
+// percentile of any score is then known to within 50/(distributionPoints-1)
+// percentage points, however large the board.
+const distributionPoints = 1024
+
+// ScoreDistribution is a compact sketch of a board's scores: evenly spaced
+// order statistics in ascending order. Boards with at most distributionPoints
+// players keep every score and are exact.
+type ScoreDistribution struct {
+	Total  uint64
+	Points []uint64
+}
+
+// newScoreDistribution sketches scores given in rank order, best first.
+func newScoreDistribution(scores []models.Score) ScoreDistribution {
+	n := len(scores)
+	if n <= distributionPoints {
+		points := make([]uint64, n)
+		for i, score := range scores {
+			points[n-1-i] = score.Score
+		}
+		return ScoreDistribution{Total: uint64(n), Points: points}
+	}
+
+	points := make([]uint64, distributionPoints)
+	for i := range points {
+		points[i] = scores[n-1-i*(n-1)/(distributionPoints-1)].Score
+	}
+	return ScoreDistribution{Total: uint64(n), Points: points}
+}
+
+// Percentile returns the share of players whose score is at or below score,
+// the same measure GetRankAndPercentile reports for a player on a live board.
+func (d ScoreDistribution) Percentile(score uint64) float64 {
+	if d.Total == 0 {
+		return 0
+	}
+
+	atOrBelow := sort.Search(len(d.Points), func(i int) bool { return d.Points[i] > score })
+	if atOrBelow == 0 || uint64(len(d.Points)) == d.Total || atOrBelow == len(d.Points) {
+		return 100.0 * float64(atOrBelow) / float64(len(d.Points))
+	}
+
+	// The players at or below score lie between the last point at or below it
+	// and the first point above it; take the middle of that interval.
+	n := int(d.Total)
+	lower := (atOrBelow-1)*(n-1)/(distributionPoints-1) + 1
+	upper := atOrBelow * (n - 1) / (distributionPoints - 1)
+	return 100.0 * (float64(lower+upper) / 2) / float64(n)
+}
+
+// ScoreHistory is the score distribution of every window of a game at the
+// time a snapshot was taken. It is kept after the snapshot itself has been
+// replaced, so percentiles can be computed against past boards.
+type ScoreHistory struct {
+	GameID  int64
+	TakenAt time.Time
+	Windows [models.LeaderboardIndexCount]ScoreDistribution
+}
+
+func newScoreHistory(snap *GameSnapshot) *ScoreHistory {
+	history := &ScoreHistory{GameID: snap.GameID, TakenAt: snap.TakenAt}
+	for i := range snap.Windows {
+		history.Windows[i] = newScoreDistribution(snap.Windows[i])
+	}
+	return history
+}
+
+// NoHistoryError is returned when no score history covers the requested time.
+// Nearest holds the closest times that do have one.
+type NoHistoryError struct {
+	GameID  int64
+	AsOf    time.Time
+	Nearest []time.Time
+}
+
+func (e *NoHistoryError) Error() string {
+	return fmt.Sprintf("no score history for game %d as of %s", e.GameID, e.AsOf.Format(time.RFC3339))
+}
+
+// maxCachedHistories bounds the decoded histories kept in memory.
+const maxCachedHistories = 64
+
+func (s *SnapshotStore) historyPath(gameID int64, takenAt time.Time) string {
+	return filepath.Join(s.dir, fmt.Sprintf("game-%d-%d.dist", gameID, takenAt.UnixNano()))
+}
+
+func (s *SnapshotStore) saveHistory(snap *GameSnapshot) error {
+	tmp, err := os.CreateTemp(s.dir, fmt.Sprintf("game-%d-*.tmp", snap.GameID))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(newScoreHistory(snap)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.historyPath(snap.GameID, snap.TakenAt)); err != nil {
+		return err
+	}
+	return s.pruneHistory(snap.GameID, snap.TakenAt)
+}
+
+// historyTimes lists the times of a game's stored histories, oldest first.
+func (s *SnapshotStore) historyTimes(gameID int64) ([]time.Time, error) {
+	prefix := fmt.Sprintf("game-%d-", gameID)
+	paths, err := filepath.Glob(filepath.Join(s.dir, prefix+"*.dist"))
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, 0, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".dist")
+		nanos, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, time.Unix(0, nanos).UTC())
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+	return times, nil
+}
+
+func (s *SnapshotStore) pruneHistory(gameID int64, now time.Time) error {
+	if s.historyRetention <= 0 {
+		return nil
+	}
+
+	times, err := s.historyTimes(gameID)
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-s.historyRetention)
+	for _, takenAt := range times {
+		if !takenAt.Before(cutoff) {
+			break
+		}
+		if err := os.Remove(s.historyPath(gameID, takenAt)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadHistory returns the latest score history of the game taken at or before
+// asOf. If there is none the error is a *NoHistoryError.
+func (s *SnapshotStore) LoadHistory(gameID int64, asOf time.Time) (*ScoreHistory, error) {
+	times, err := s.historyTimes(gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(asOf) })
+	if i == 0 {
+		return nil, &NoHistoryError{GameID: gameID, AsOf: asOf, Nearest: times[:min(3, len(times))]}
+	}
+
+	path := s.historyPath(gameID, times[i-1])
+
+	s.historyMu.Lock()
+	history, cached := s.histories[path]
+	s.historyMu.Unlock()
+	if cached {
+		return history, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	history = &ScoreHistory{}
+	if err := gob.NewDecoder(f).Decode(history); err != nil {
+		return nil, fmt.Errorf("failed to decode score history for game %d: %w", gameID, err)
+	}
+
+	s.historyMu.Lock()
+	if len(s.histories) >= maxCachedHistories {
+		clear(s.histories)
+	}
+	s.histories[path] = history
+	s.historyMu.Unlock()
+
+	return history, nil
+}
+
+// HistoricalPercentile returns the percentile the score would have had on the
+// game's board as of the given time, using the latest snapshot taken at or
+// before it.
+func (ls *Store) HistoricalPercentile(gameID int64, score uint64, asOf time.Time, window models.TimeWindow) (models.HistoricalPercentileResponse, error) {
+	if ls.snapshots == nil {
+		return models.HistoricalPercentileResponse{}, &NoHistoryError{GameID: gameID, AsOf: asOf}
+	}
+
+	history, err := ls.snapshots.LoadHistory(gameID, asOf)
+	if err != nil {
+		return models.HistoricalPercentileResponse{}, err
+	}
+
+	distribution := history.Windows[window.GetLeaderboardIndex()]
+	return models.HistoricalPercentileResponse{
+		GameID:       gameID,
+		Score:        score,
+		Percentile:   distribution.Percentile(score),
+		TotalPlayers: distribution.Total,
+		AsOf:         asOf,
+		SnapshotAt:   history.TakenAt,
+		Window:       window.Display,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EraseUser removes every trace of the player: their scores and exclusions in
+// Postgres, their entries in every window of every resident game and open
+// season, and their recent activity. It returns the games they were removed
+// from, in ascending order, and erasing a player who is already gone returns
+// none.
+func (ls *Store) EraseUser(userID int64) ([]int64, error) {
+	affected := make(map[int64]struct{})
+
+	if ls.db != nil {
+		games, err := ls.db.DeleteUser(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete user from PostgreSQL: %w", err)
+		}
+		for _, gameID := range games {
+			affected[gameID] = struct{}{}
+		}
+	}
+
+	for gameID, leaderboard := range ls.residentGames() {
+		removed := leaderboard.Apply([]Mutation{{Op: MutationDelete, UserID: userID}})
+		if _, excluded := leaderboard.excludedSet()[userID]; excluded {
+			leaderboard.SetExcluded(userID, false)
+			removed = true
+		}
+		if removed {
+			affected[gameID] = struct{}{}
+			ls.notifyBoardChange(gameID)
+		}
+	}
+
+	for _, board := range ls.allSeasonBoards() {
+		board.Apply([]Mutation{{Op: MutationDelete, UserID: userID}})
+		board.SetExcluded(userID, false)
+	}
+
+	if ls.activity != nil {
+		ls.activity.Forget(userID)
+	}
+
+	games := make([]int64, 0, len(affected))
+	for gameID := range affected {
+		games = append(games, gameID)
+	}
+	slices.Sort(games)
+	return games, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Excluded accounts keep their scores and can still look up their own rank,
+// but are left out of everyone else's view of the board: top lists, other
+// players' ranks and percentiles, and player totals.
+//
+// The set is copy-on-write, so reads take a single atomic load and every
+// entry visited during a traversal costs one map lookup.
+
+func (gl *GameLeaderboard) excludedSet() map[int64]struct{} {
+	if set := gl.excluded.Load(); set != nil {
+		return *set
+	}
+	return nil
+}
+
+// SetExcluded adds or removes an account from the game's excluded set.
+func (gl *GameLeaderboard) SetExcluded(userID int64, excluded bool) {
+	gl.excludedMu.Lock()
+	defer gl.excludedMu.Unlock()
+
+	current := gl.excludedSet()
+	if _, exists := current[userID]; exists == excluded {
+		return
+	}
+
+	next := make(map[int64]struct{}, len(current)+1)
+	for id := range current {
+		next[id] = struct{}{}
+	}
+	if excluded {
+		next[userID] = struct{}{}
+	} else {
+		delete(next, userID)
+	}
+
+	gl.excluded.Store(&next)
+	gl.version.Add(1)
+}
+
+// ExcludedAccounts returns the game's excluded accounts in ascending order.
+func (gl *GameLeaderboard) ExcludedAccounts() []int64 {
+	set := gl.excludedSet()
+	userIDs := make([]int64, 0, len(set))
+	for userID := range set {
+		userIDs = append(userIDs, userID)
+	}
+	slices.Sort(userIDs)
+	return userIDs
+}
+
+// excludedRange returns up to k non-excluded entries after skipping offset of
+// them, ranked among the non-excluded entries only.
+func excludedRange(lb *LeaderBoard, excluded map[int64]struct{}, offset, k int) []models.LeaderboardEntry {
+	result := make([]models.LeaderboardEntry, 0)
+	if k <= 0 {
+		return result
+	}
+
+	rank := 0
+	lb.ascend(func(userID int64, score models.Score) bool {
+		if _, skip := excluded[userID]; skip {
+			return true
+		}
+		rank++
+		if rank <= offset {
+			return true
+		}
+		result = append(result, models.LeaderboardEntry{
+			UserID: userID,
+			Score:  score.Score,
+			Rank:   uint64(rank),
+		})
+		return len(result) < k
+	})
+
+	return result
+}
+
+// excludedAhead returns how many excluded accounts are on the board, and how
+// many of them rank above the given rank.
+func excludedAhead(lb *LeaderBoard, excluded map[int64]struct{}, rank int) (ahead, present int) {
+	for userID := range excluded {
+		r, ok := lb.rank(userID)
+		if !ok {
+			continue
+		}
+		present++
+		if r < rank {
+			ahead++
+		}
+	}
+	return ahead, present
+}
+
+func (ls *Store) SetExcluded(gameID, userID int64, excluded bool) error {
+	leaderboard := ls.GetOrCreateLeaderboard(gameID)
+	if leaderboard == nil {
+		return fmt.Errorf("game %d: %w", gameID, ErrGameNotFound)
+	}
+
+	if ls.db != nil {
+		var err error
+		if excluded {
+			err = ls.db.AddExcludedAccount(gameID, userID)
+		} else {
+			err = ls.db.RemoveExcludedAccount(gameID, userID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save excluded account to PostgreSQL: %w", err)
+		}
+	}
+
+	leaderboard.SetExcluded(userID, excluded)
+	for _, board := range ls.seasonBoards(gameID) {
+		board.SetExcluded(userID, excluded)
+	}
+	ls.notifyBoardChange(gameID)
+	return nil
+}
+
+func (ls *Store) ExcludedAccounts(gameID int64) []int64 {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return []int64{}
+	}
+	return leaderboard.ExcludedAccounts()
+}
+
+func (ls *Store) loadExcludedAccounts() error {
+	excluded, err := ls.db.GetExcludedAccounts()
+	if err != nil {
+		return fmt.Errorf("failed to load excluded accounts: %w", err)
+	}
+
+	for gameID, userIDs := range excluded {
+		leaderboard := ls.GetOrCreateLeaderboard(gameID)
+		if leaderboard == nil {
+			continue
+		}
+		for _, userID := range userIDs {
+			leaderboard.SetExcluded(userID, true)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Registered games live in Postgres, in the games table that also holds
+// retention overrides. Like profiles, the store keeps the games it has read
+// in memory, including the fact that a game is not registered, and reads them
+// again once they are older than gameTTL, so games registered through other
+// instances are picked up within that time. Without Postgres the map is the
+// only copy.
+
+const gameTTL = time.Minute
+
+type cachedGame struct {
+	game     *models.Game // nil when the game is not registered
+	loadedAt time.Time
+}
+
+// ErrGameNotFound is returned for scores of unregistered games while
+// registration is required.
+var ErrGameNotFound = errors.New("game is not registered")
+
+// ErrScoreOutOfRange is returned for scores outside their game's range.
+var ErrScoreOutOfRange = errors.New("score is outside the game's range")
+
+// ErrScoringChanged is returned when registering a game whose board already
+// holds scores kept under another scoring mode.
+var ErrScoringChanged = errors.New("game already has scores under another scoring mode")
+
+// RequireRegisteredGames makes the store turn away scores for games that are
+// not registered, rather than starting a board for any game ID it is sent.
+func (ls *Store) RequireRegisteredGames(required bool) {
+	ls.gamesMu.Lock()
+	defer ls.gamesMu.Unlock()
+	ls.requireRegistered = required
+}
+
+// RegisterGame registers a game with its settings, replacing them when it is
+// already registered. created is false in that case. The scoring mode can only
+// change while the game's board is empty, and the board is started over
+// under the new mode.
+func (ls *Store) RegisterGame(game models.Game) (models.Game, bool, error) {
+	if game.Scoring == "" {
+		game.Scoring = models.ScoringBest
+	}
+	if board := ls.GetLeaderboard(game.GameID); board != nil && board.Scoring() != game.Scoring && !board.IsEmpty() {
+		return models.Game{}, false, fmt.Errorf("game %d: %w", game.GameID, ErrScoringChanged)
+	}
+
+	game.RegisteredAt = clock()
+	created := true
+	if ls.db != nil {
+		var err error
+		game, created, err = ls.db.RegisterGame(game)
+		if err != nil {
+			return models.Game{}, false, fmt.Errorf("failed to save game to PostgreSQL: %w", err)
+		}
+	}
+
+	ls.mu.Lock()
+	if board, ok := ls.leaderboards[game.GameID]; ok && board.Scoring() != game.Scoring && board.IsEmpty() {
+		ls.leaderboards[game.GameID] = ls.newGameBoard(game.GameID, game.Scoring)
+	}
+	ls.mu.Unlock()
+
+	ls.gamesMu.Lock()
+	defer ls.gamesMu.Unlock()
+	if existing := ls.games[game.GameID].game; existing != nil && ls.db == nil {
+		game.RegisteredAt = existing.RegisteredAt
+		created = false
+	}
+	ls.games[game.GameID] = cachedGame{game: &game, loadedAt: clock()}
+	return game, created, nil
+}
+
+// RegisteredGames returns the registered games known to this instance,
+// ordered by game ID.
+func (ls *Store) RegisteredGames() []models.Game {
+	ls.gamesMu.RLock()
+	defer ls.gamesMu.RUnlock()
+
+	games := make([]models.Game, 0, len(ls.games))
+	for _, cached := range ls.games {
+		if cached.game != nil {
+			games = append(games, *cached.game)
+		}
+	}
+	slices.SortFunc(games, func(a, b models.Game) int { return cmp.Compare(a.GameID, b.GameID) })
+	return games
+}
+
+// Game returns a registered game. Games missing from the cache or out of date
+// are read from Postgres; if that fails, what the cache holds is used.
+func (ls *Store) Game(gameID int64) (models.Game, bool) {
+	now := clock()
+	ls.gamesMu.RLock()
+	cached, ok := ls.games[gameID]
+	ls.gamesMu.RUnlock()
+	if ls.db == nil || (ok && now.Sub(cached.loadedAt) <= gameTTL) {
+		return registered(cached)
+	}
+
+	stored, err := ls.db.GetRegisteredGame(gameID)
+	if err != nil {
+		logging.Error("Failed to look up game", "game", gameID, "error", err)
+		return registered(cached)
+	}
+
+	ls.gamesMu.Lock()
+	defer ls.gamesMu.Unlock()
+	if current := ls.games[gameID]; current.loadedAt.After(now) {
+		// Registered while the query ran; keep the newer settings.
+		return registered(current)
+	}
+	ls.games[gameID] = cachedGame{game: stored, loadedAt: now}
+	return registered(ls.games[gameID])
+}
+
+func registered(cached cachedGame) (models.Game, bool) {
+	if cached.game == nil {
+		return models.Game{}, false
+	}
+	return *cached.game, true
+}
+
+// CheckGame returns ErrGameNotFound when registration is required and the
+// game is not registered, and ErrScoreOutOfRange when the score is outside
+// the range of its registered game.
+func (ls *Store) CheckGame(score models.Score) error {
+	ls.gamesMu.RLock()
+	required := ls.requireRegistered
+	ls.gamesMu.RUnlock()
+
+	game, ok := ls.Game(score.GameID)
+	if !ok {
+		if required {
+			return fmt.Errorf("game %d: %w", score.GameID, ErrGameNotFound)
+		}
+		return nil
+	}
+	if !game.Accepts(score.Score) {
+		return fmt.Errorf("score %d for game %d: %w", score.Score, score.GameID, ErrScoreOutOfRange)
+	}
+	return nil
+}
+
+// boardScoring returns the scoring of a board about to be started for the
+// game, and whether one may be started at all.
+func (ls *Store) boardScoring(gameID int64) (models.ScoringMode, bool) {
+	ls.gamesMu.RLock()
+	required := ls.requireRegistered
+	ls.gamesMu.RUnlock()
+
+	game, ok := ls.Game(gameID)
+	if !ok {
+		return models.ScoringBest, !required
+	}
+	return game.Scoring, true
+}
+
+func (ls *Store) loadGames() error {
+	games, err := ls.db.GetRegisteredGames()
+	if err != nil {
+		return fmt.Errorf("failed to load registered games: %w", err)
+	}
+
+	now := clock()
+	ls.gamesMu.Lock()
+	defer ls.gamesMu.Unlock()
+	for _, game := range games {
+		ls.games[game.GameID] = cachedGame{game: &game, loadedAt: now}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// ErrNotCumulative is returned for increments to a game that keeps each
+// player's best score.
+var ErrNotCumulative = errors.New("game keeps best scores, not totals")
+
+// IncrementScore saves score as a submission adding score.Score to the
+// player's total in a cumulative game, applies it, and returns the player's
+// standing on the all-time board straight after.
+func (ls *Store) IncrementScore(score models.Score) (PlayerRank, error) {
+	if err := score.Validate(); err != nil {
+		metrics.ScoresRejected.Inc()
+		return PlayerRank{}, err
+	}
+	if err := ls.CheckGame(score); err != nil {
+		metrics.ScoresRejected.Inc()
+		return PlayerRank{}, err
+	}
+	leaderboard, err := ls.cumulativeBoard(score.GameID)
+	if err != nil {
+		metrics.ScoresRejected.Inc()
+		return PlayerRank{}, err
+	}
+	ls.tagSeason(&score)
+
+	if ls.db != nil {
+		if err := ls.db.SaveScore(score); err != nil {
+			metrics.ScoresRejected.Inc()
+			return PlayerRank{}, fmt.Errorf("failed to save score to PostgreSQL: %w", err)
+		}
+	}
+
+	rank := ls.applyIncrement(leaderboard, score)
+	metrics.ScoresApplied.Inc()
+	return rank, nil
+}
+
+// ApplyIncrement applies an increment that another instance has already
+// saved to Postgres.
+func (ls *Store) ApplyIncrement(score models.Score) error {
+	leaderboard, err := ls.cumulativeBoard(score.GameID)
+	if err != nil {
+		return err
+	}
+	ls.tagSeason(&score)
+	ls.applyIncrement(leaderboard, score)
+	metrics.ScoresApplied.Inc()
+	return nil
+}
+
+func (ls *Store) cumulativeBoard(gameID int64) (*GameLeaderboard, error) {
+	leaderboard := ls.GetOrCreateLeaderboard(gameID)
+	if leaderboard == nil {
+		return nil, fmt.Errorf("game %d: %w", gameID, ErrGameNotFound)
+	}
+	if leaderboard.Scoring() != models.ScoringCumulative {
+		return nil, fmt.Errorf("game %d: %w", gameID, ErrNotCumulative)
+	}
+	return leaderboard, nil
+}
+
+func (ls *Store) applyIncrement(leaderboard *GameLeaderboard, score models.Score) PlayerRank {
+	depth := ls.topWatchDepth()
+	before := ls.topLists(score.GameID, depth)
+
+	ls.recordActivity(score)
+	rank, _ := leaderboard.Increment(score.UserID, score.Score, score.Timestamp)
+	ls.addSeasonScores(score.GameID, []models.Score{score})
+	ls.notifyBoardChange(score.GameID)
+	ls.notifyTopChange(score.GameID, depth, before)
+	return rank
+}
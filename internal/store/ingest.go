@@ -0,0 +1,95 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+type ingestJob struct {
+	gameID int64
+	scores []models.Score
+	done   *sync.WaitGroup
+}
+
+// ingestPipeline applies score batches on a fixed set of worker goroutines.
+// Every game is pinned to one worker by a consistent hash, so a game's scores
+// are always applied serially and in order while different games proceed in
+// parallel.
+type ingestPipeline struct {
+	store   *Store
+	workers []chan ingestJob
+	wg      sync.WaitGroup
+}
+
+func newIngestPipeline(store *Store, workers int) *ingestPipeline {
+	p := &ingestPipeline{
+		store:   store,
+		workers: make([]chan ingestJob, workers),
+	}
+
+	for i := range p.workers {
+		jobs := make(chan ingestJob, 64)
+		p.workers[i] = jobs
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range jobs {
+				if leaderboard := p.store.GetOrCreateLeaderboard(job.gameID); leaderboard != nil {
+					leaderboard.AddScoreBatch(job.scores)
+				}
+				job.done.Done()
+			}
+		}()
+	}
+
+	return p
+}
+
+// apply hands each game's scores to its worker and waits until every game
+// has been applied.
+func (p *ingestPipeline) apply(byGame map[int64][]models.Score) {
+	var done sync.WaitGroup
+	done.Add(len(byGame))
+	for gameID, gameScores := range byGame {
+		p.workers[p.shardFor(gameID)] <- ingestJob{
+			gameID: gameID,
+			scores: gameScores,
+			done:   &done,
+		}
+	}
+	done.Wait()
+}
+
+func (p *ingestPipeline) shardFor(gameID int64) int {
+	return jumpHash(uint64(gameID), len(p.workers))
+}
+
+// close stops the workers once every queued job has been applied.
+func (p *ingestPipeline) close() {
+	for _, jobs := range p.workers {
+		close(jobs)
+	}
+	p.wg.Wait()
+}
+
+func splitByGame(scores []models.Score) map[int64][]models.Score {
+	byGame := make(map[int64][]models.Score)
+	for _, score := range scores {
+		byGame[score.GameID] = append(byGame[score.GameID], score)
+	}
+	return byGame
+}
+
+// jumpHash is Lamping and Veach's jump consistent hash. Changing the number of
+// workers only moves about 1/n of the games to a different worker.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -2,33 +2,57 @@ package store
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
-	cache "github.com/IWhitebird/go-leader-board/internal/cache"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
 	models "github.com/IWhitebird/go-leader-board/internal/models"
 )
 
+// clock is the store's notion of the current time. Tests replace it to age
+// entries out of their windows.
+var clock = func() time.Time { return time.Now().UTC() }
+
+// LeaderBoard is one window of a game's board, split into one or more shards.
 type LeaderBoard struct {
-	mu         sync.RWMutex
-	scoresList *cache.SkipList[int64, models.Score]
+	shards []*boardShard
 }
 
 type GameLeaderboard struct {
 	leaderboards [models.LeaderboardIndexCount]*LeaderBoard
+	watermark    atomic.Int64  // newest score timestamp seen, in unix nanos
+	version      atomic.Uint64 // bumped whenever any window changes
+	excludedMu   sync.Mutex
+	excluded     atomic.Pointer[map[int64]struct{}]
+	totals       *runningTotals                                // recent submissions per hour; nil unless cumulative
+	history      func(since time.Time) ([]models.Score, error) // stored scores; nil unless cumulative with Postgres
+	customMu     sync.Mutex
+	custom       map[int]customBoard // custom window boards by hours
+	calendar     [models.CalendarWindowCount]atomic.Pointer[calendarPeriod]
 }
 
 func NewGameLeaderboard() *GameLeaderboard {
+	return NewShardedGameLeaderboard(1)
+}
+
+// NewShardedGameLeaderboard creates a board whose windows are each split into
+// the given number of shards. The count is fixed for the board's lifetime.
+func NewShardedGameLeaderboard(shards int) *GameLeaderboard {
 	gl := &GameLeaderboard{}
 	for i := range models.LeaderboardIndexCount {
-		gl.leaderboards[i] = &LeaderBoard{
-			scoresList: cache.NewSkipList[int64](models.ScoreCompare),
-		}
+		gl.leaderboards[i] = newLeaderBoard(shards)
 	}
+	gl.initCalendar(shards)
 	return gl
 }
 
 func (gl *GameLeaderboard) getLeaderboard(window models.TimeWindow) *LeaderBoard {
+	if window.IsCalendar() {
+		return gl.currentPeriod(window, clock()).board
+	}
+	if !window.IsStandard() {
+		return gl.customLeaderboard(window)
+	}
 	index := window.GetLeaderboardIndex()
 	if index >= 0 && index < models.LeaderboardIndexCount {
 		return gl.leaderboards[index]
@@ -38,13 +62,19 @@ func (gl *GameLeaderboard) getLeaderboard(window models.TimeWindow) *LeaderBoard
 }
 
 func (gl *GameLeaderboard) getCutoffTime(window models.TimeWindow) time.Time {
+	if window.IsCalendar() {
+		return gl.currentPeriod(window, clock()).start
+	}
 	if window.Hours > 0 {
-		return time.Now().UTC().Add(-time.Duration(window.Hours) * time.Hour)
+		return clock().Add(-time.Duration(window.Hours) * time.Hour)
 	}
 	return time.Time{}
 }
 
 func (gl *GameLeaderboard) isScoreValid(window models.TimeWindow, timestamp time.Time) bool {
+	if window.IsCalendar() {
+		return !timestamp.Before(gl.getCutoffTime(window))
+	}
 	if window.Hours == 0 {
 		return true
 	}
@@ -69,16 +99,44 @@ func (gl *GameLeaderboard) withLeaderboard(window models.TimeWindow, lockType Lo
 	switch lockType {
 	case LockTypeRead:
 	case LockTypeWrite:
-		lb.mu.Lock()
-		defer lb.mu.Unlock()
+		lb.lock()
+		defer lb.unlock()
 	case LockTypeDirtyRead:
-		lb.mu.Lock()
-		defer lb.mu.Unlock()
+		lb.lock()
+		defer lb.unlock()
 	}
 	fn(lb)
 }
 
+// Watermark returns the newest score timestamp this leaderboard has ingested.
+func (gl *GameLeaderboard) Watermark() time.Time {
+	nanos := gl.watermark.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+func (gl *GameLeaderboard) advanceWatermark(timestamp time.Time) {
+	if timestamp.IsZero() {
+		return
+	}
+	nanos := timestamp.UnixNano()
+	for {
+		current := gl.watermark.Load()
+		if nanos <= current || gl.watermark.CompareAndSwap(current, nanos) {
+			return
+		}
+	}
+}
+
 func (gl *GameLeaderboard) AddScore(userID int64, score uint64, timestamp time.Time) {
+	gl.advanceWatermark(timestamp)
+	if gl.totals != nil {
+		gl.addToTotal(userID, score, timestamp, nil)
+		return
+	}
+
 	newScore := models.Score{
 		UserID:    userID,
 		Score:     score,
@@ -90,23 +148,52 @@ func (gl *GameLeaderboard) AddScore(userID int64, score uint64, timestamp time.T
 			continue
 		}
 
-		gl.withLeaderboard(window, LockTypeWrite, func(lb *LeaderBoard) {
-			lb.scoresList.InsertOrUpdate(userID, newScore)
+		gl.withShard(window, userID, func(shard *boardShard) {
+			if shard.put(userID, newScore) {
+				gl.version.Add(1)
+			}
 		})
 	}
+	gl.addToCalendar(newScore, false)
+}
+
+// Version changes every time the leaderboard's contents change, which lets
+// callers key derived data such as cached responses on it.
+func (gl *GameLeaderboard) Version() uint64 {
+	return gl.version.Load()
 }
 
 func (gl *GameLeaderboard) AddScoreBatch(scores []models.Score) {
+	if gl.Shards() > 1 {
+		gl.addScoresByShard(scores)
+		return
+	}
 	for _, score := range scores {
 		gl.AddScore(score.UserID, score.Score, score.Timestamp)
 	}
 }
 
-func (gl *GameLeaderboard) GetTopK(k int, window models.TimeWindow) []models.LeaderboardEntry {
+// GetTopK returns up to k entries, skipping the first offset ranks.
+func (gl *GameLeaderboard) GetTopK(k, offset int, window models.TimeWindow) []models.LeaderboardEntry {
+	return gl.GetRankedTopK(k, offset, window, models.RankOrdinal)
+}
+
+// GetRankedTopK is GetTopK with tied players ranked under the given mode.
+// Paging always follows the ordinal order.
+func (gl *GameLeaderboard) GetRankedTopK(k, offset int, window models.TimeWindow, mode models.RankMode) []models.LeaderboardEntry {
 	var result []models.LeaderboardEntry
 
+	excluded := gl.excludedSet()
+
 	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
-		entries := lb.scoresList.GetTopK(k)
+		defer func() { newTieRanker(lb, excluded, mode).rankEntries(result) }()
+
+		if len(excluded) > 0 {
+			result = excludedRange(lb, excluded, offset, k)
+			return
+		}
+
+		entries := lb.rangeOf(offset, k)
 		result = make([]models.LeaderboardEntry, len(entries))
 
 		for i, entry := range entries {
@@ -121,59 +208,269 @@ func (gl *GameLeaderboard) GetTopK(k int, window models.TimeWindow) []models.Lea
 	return result
 }
 
-func (gl *GameLeaderboard) GetRankAndPercentile(userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, bool) {
-	var rank uint64
-	var percentile float64
-	var userScore uint64
-	var total uint64
+// GetNeighbors returns the player's entry with up to before players ranked
+// above and after players ranked below, or false if the player is not on the
+// board. Like GetRankAndPercentile, an excluded player sees the full board.
+func (gl *GameLeaderboard) GetNeighbors(userID int64, before, after int, window models.TimeWindow) ([]models.LeaderboardEntry, bool) {
+	var result []models.LeaderboardEntry
 	var found bool
 
+	excluded := gl.excludedSet()
+	if _, self := excluded[userID]; self {
+		excluded = nil
+	}
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		result, found = neighborsOf(lb, excluded, userID, before, after)
+		newTieRanker(lb, excluded, models.RankOrdinal).rankEntries(result)
+	})
+
+	return result, found
+}
+
+// neighborsOf lists the player's entry with up to before entries above and
+// after entries below, with ordinal ranks among the non-excluded players.
+func neighborsOf(lb *LeaderBoard, excluded map[int64]struct{}, userID int64, before, after int) ([]models.LeaderboardEntry, bool) {
+	if len(excluded) > 0 {
+		r, ok := lb.rank(userID)
+		if !ok {
+			return nil, false
+		}
+		ahead, _ := excludedAhead(lb, excluded, r)
+		rank := r - ahead
+		start := max(rank-before, 1)
+		return excludedRange(lb, excluded, start-1, rank-start+1+after), true
+	}
+
+	entries, ok := lb.neighbors(userID, before, after)
+	if !ok {
+		return nil, false
+	}
+	result := make([]models.LeaderboardEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = models.LeaderboardEntry{
+			UserID: entry.Key,
+			Score:  entry.Value.Score,
+			Rank:   uint64(entry.Rank),
+		}
+	}
+	return result, true
+}
+
+// GetRankAndPercentile ranks the player among the non-excluded players. An
+// excluded player gets their rank on the full board instead.
+func (gl *GameLeaderboard) GetRankAndPercentile(userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, bool) {
+	rank := gl.GetPlayerRank(userID, window, models.RankOrdinal)
+	return rank.Rank, rank.Percentile, rank.Score, rank.Total, rank.Found
+}
+
+// GetPlayerRank is GetRankAndPercentile with tied players ranked under the
+// given mode.
+func (gl *GameLeaderboard) GetPlayerRank(userID int64, window models.TimeWindow, mode models.RankMode) PlayerRank {
+	var rank PlayerRank
+
+	excluded := gl.excludedSet()
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		rank = rankOf(lb, excluded, userID, mode)
+	})
+
+	return rank
+}
+
+// GetPlayerRankWithNeighbors is GetPlayerRank together with up to n players
+// ranked directly above and below the player, all read under one lock so
+// they agree with each other. above and below are in rank order.
+func (gl *GameLeaderboard) GetPlayerRankWithNeighbors(userID int64, n int, window models.TimeWindow, mode models.RankMode) (rank PlayerRank, above, below []models.LeaderboardEntry) {
+	excluded := gl.excludedSet()
+
 	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
-		r, rankFound := lb.scoresList.GetRank(userID)
-		if !rankFound {
+		rank = rankOf(lb, excluded, userID, mode)
+		if !rank.Found || n <= 0 {
 			return
 		}
 
-		scoreKey, scoreFound := lb.scoresList.Search(userID)
-		if !scoreFound {
+		neighborhood := excluded
+		if _, self := excluded[userID]; self {
+			neighborhood = nil
+		}
+		entries, _ := neighborsOf(lb, neighborhood, userID, n, n)
+		newTieRanker(lb, neighborhood, mode).rankEntries(entries)
+		for i, entry := range entries {
+			if entry.UserID == userID {
+				above, below = entries[:i], entries[i+1:]
+				break
+			}
+		}
+	})
+
+	return rank, above, below
+}
+
+// PlayerRank is one player's standing on a window's board.
+type PlayerRank struct {
+	UserID     int64
+	Rank       uint64
+	TiedWith   uint64
+	Percentile float64
+	Score      uint64
+	Total      uint64
+	Found      bool
+}
+
+// GetRanks looks up several players under a single lock acquisition, so the
+// ranks are consistent with each other. Results are in the order of userIDs.
+func (gl *GameLeaderboard) GetRanks(userIDs []int64, window models.TimeWindow) []PlayerRank {
+	ranks := make([]PlayerRank, len(userIDs))
+
+	excluded := gl.excludedSet()
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		for i, userID := range userIDs {
+			ranks[i] = rankOf(lb, excluded, userID, models.RankOrdinal)
+		}
+	})
+
+	return ranks
+}
+
+// rankOf ranks the player under the mode. Their percentile is the share of
+// players they are level with or ahead of; with ordinal ranks the players
+// tied ahead of them count as ahead.
+func rankOf(lb *LeaderBoard, excluded map[int64]struct{}, userID int64, mode models.RankMode) PlayerRank {
+	rank := PlayerRank{UserID: userID}
+
+	if _, self := excluded[userID]; self {
+		excluded = nil
+	}
+
+	r, rankFound := lb.rank(userID)
+	if !rankFound {
+		return rank
+	}
+
+	scoreKey, scoreFound := lb.search(userID)
+	if !scoreFound {
+		return rank
+	}
+
+	ahead, present := excludedAhead(lb, excluded, r)
+	rank.Rank = uint64(r - ahead)
+	rank.Score = scoreKey.Score
+	rank.Total = uint64(lb.length() - present)
+	rank.Percentile = 100.0 * float64(rank.Total-rank.Rank+1) / float64(rank.Total)
+	rank.Found = true
+
+	ties := newTieRanker(lb, excluded, mode)
+	rank.TiedWith = ties.tiedWith(rank.Score)
+	if mode != models.RankOrdinal {
+		above := uint64(ties.above(rank.Score))
+		rank.Rank = ties.rank(rank.Rank, rank.Score)
+		rank.Percentile = 100.0 * float64(rank.Total-above) / float64(rank.Total)
+	}
+	return rank
+}
+
+// RankForScore returns the rank a new score would take: one below every
+// player with a strictly higher score.
+func (gl *GameLeaderboard) RankForScore(score uint64, window models.TimeWindow) uint64 {
+	var above int
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		above = lb.countWhile(func(s models.Score) bool { return s.Score > score })
+	})
+
+	return uint64(above) + 1
+}
+
+// GetScoreThreshold returns the score held by the player at the given rank and
+// how many players share that score. found is false when fewer than rank
+// players are on the board, in which case only total is set.
+func (gl *GameLeaderboard) GetScoreThreshold(rank int, window models.TimeWindow) (uint64, uint64, uint64, bool) {
+	var threshold uint64
+	var ties uint64
+	var total uint64
+	var found bool
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		total = uint64(lb.length())
+
+		entry, ok := lb.byRank(rank)
+		if !ok {
 			return
 		}
 
-		rank = uint64(r)
-		userScore = scoreKey.Score
-		total = uint64(lb.scoresList.GetLength())
-		percentile = 100.0 * float64(total-rank+1) / float64(total)
+		threshold = entry.Value.Score
+		above := lb.countWhile(func(s models.Score) bool { return s.Score > threshold })
+		atOrAbove := lb.countWhile(func(s models.Score) bool { return s.Score >= threshold })
+		ties = uint64(atOrAbove - above)
 		found = true
 	})
 
-	return rank, percentile, userScore, total, found
+	return threshold, ties, total, found
 }
 
+// TotalPlayers counts the non-excluded players on the window's board.
 func (gl *GameLeaderboard) TotalPlayers(window models.TimeWindow) uint64 {
 	var total uint64
 
+	excluded := gl.excludedSet()
+
 	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
-		total = uint64(lb.scoresList.GetLength())
+		_, present := excludedAhead(lb, excluded, 0)
+		total = uint64(lb.length() - present)
 	})
 
 	return total
 }
 
+// entryCount counts every entry on the window's board, excluded or not.
+func (gl *GameLeaderboard) entryCount(window models.TimeWindow) uint64 {
+	var count uint64
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		count = uint64(lb.length())
+	})
+
+	return count
+}
+
+// IsEmpty reports whether every window of the leaderboard is empty.
+func (gl *GameLeaderboard) IsEmpty() bool {
+	for _, window := range models.AllTimeWindows() {
+		if gl.entryCount(window) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (gl *GameLeaderboard) CleanOldEntries() {
+	if gl.totals != nil {
+		gl.expireTotals()
+		return
+	}
 	for _, window := range models.AllTimeWindows() {
 		cutoff := gl.getCutoffTime(window)
 		gl.withLeaderboard(window, LockTypeWrite, func(lb *LeaderBoard) {
-			toRemove := make([]int64, 0)
+			removed := false
+			for _, shard := range lb.shards {
+				toRemove := make([]int64, 0)
 
-			entries := lb.scoresList.GetAll()
-			for _, entry := range entries {
-				if entry.Value.Timestamp.Before(cutoff) {
-					toRemove = append(toRemove, entry.Key)
+				entries := shard.scoresList.GetAll()
+				for _, entry := range entries {
+					if entry.Value.Timestamp.Before(cutoff) {
+						toRemove = append(toRemove, entry.Key)
+					}
 				}
-			}
 
-			for _, userID := range toRemove {
-				lb.scoresList.Delete(userID)
+				for _, userID := range toRemove {
+					shard.remove(userID)
+				}
+				removed = removed || len(toRemove) > 0
+			}
+			if removed {
+				gl.version.Add(1)
 			}
 		})
 	}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Profiles live in Postgres. The store keeps the ones it has read in a small
+// map, including the fact that a player has none, and reads them again once
+// they are older than profileTTL, so changes made through other instances
+// show up within that time. Without Postgres the map is the only copy.
+
+const (
+	profileTTL       = time.Minute
+	profileCacheSize = 10000
+)
+
+type cachedProfile struct {
+	profile  *models.Profile // nil when the player has no profile
+	loadedAt time.Time
+}
+
+// SetProfile creates or replaces a player's profile. A nil field clears it.
+func (ls *Store) SetProfile(userID int64, displayName, avatarURL *string) (models.Profile, error) {
+	profile := models.Profile{
+		UserID:      userID,
+		DisplayName: displayName,
+		AvatarURL:   avatarURL,
+		UpdatedAt:   clock(),
+	}
+	if ls.db != nil {
+		if err := ls.db.SaveProfile(profile); err != nil {
+			return models.Profile{}, fmt.Errorf("failed to save profile to PostgreSQL: %w", err)
+		}
+	}
+
+	ls.profilesMu.Lock()
+	defer ls.profilesMu.Unlock()
+	ls.cacheProfile(userID, &profile, profile.UpdatedAt)
+	return profile, nil
+}
+
+// Profiles returns the profiles of the given players that have one. Profiles
+// missing from the cache or out of date are read from Postgres in one query;
+// if that fails, out of date ones are used as they are.
+func (ls *Store) Profiles(userIDs []int64) map[int64]models.Profile {
+	now := clock()
+	profiles := make(map[int64]models.Profile, len(userIDs))
+	var stale []int64
+
+	ls.profilesMu.RLock()
+	for _, userID := range userIDs {
+		cached, ok := ls.profiles[userID]
+		if cached.profile != nil {
+			profiles[userID] = *cached.profile
+		}
+		if ls.db != nil && (!ok || now.Sub(cached.loadedAt) > profileTTL) {
+			stale = append(stale, userID)
+		}
+	}
+	ls.profilesMu.RUnlock()
+
+	if len(stale) == 0 {
+		return profiles
+	}
+
+	loaded, err := ls.db.GetProfiles(stale)
+	if err != nil {
+		logging.Error("Failed to load profiles", "users", len(stale), "error", err)
+		return profiles
+	}
+
+	ls.profilesMu.Lock()
+	defer ls.profilesMu.Unlock()
+	for _, userID := range stale {
+		if cached := ls.profiles[userID]; cached.loadedAt.After(now) {
+			// Saved while the query ran; keep the newer profile.
+			if cached.profile != nil {
+				profiles[userID] = *cached.profile
+			}
+			continue
+		}
+		profile, ok := loaded[userID]
+		if !ok {
+			delete(profiles, userID)
+			ls.cacheProfile(userID, nil, now)
+			continue
+		}
+		profiles[userID] = profile
+		ls.cacheProfile(userID, &profile, now)
+	}
+	return profiles
+}
+
+// cacheProfile records what is known about a player's profile, making room
+// first if the cache is full and the profiles are also in Postgres.
+// profilesMu must be held.
+func (ls *Store) cacheProfile(userID int64, profile *models.Profile, loadedAt time.Time) {
+	if _, ok := ls.profiles[userID]; !ok && ls.db != nil && len(ls.profiles) >= profileCacheSize {
+		// Any entry will do; an evicted profile is simply read again.
+		for evicted := range ls.profiles {
+			delete(ls.profiles, evicted)
+			if len(ls.profiles) < profileCacheSize {
+				break
+			}
+		}
+	}
+	ls.profiles[userID] = cachedProfile{profile: profile, loadedAt: loadedAt}
+}
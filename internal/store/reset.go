@@ -0,0 +1,74 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Reset empties every window of the board at once. The version keeps counting
+// up rather than starting over, so responses cached for the old board can
+// never be served for the new one. Excluded accounts and the watermark are
+// kept. It returns how many players the all-time window held.
+func (gl *GameLeaderboard) Reset() uint64 {
+	unlock := gl.lockAll()
+	defer unlock()
+
+	players := uint64(gl.leaderboards[0].length())
+	if gl.totals != nil {
+		for _, t := range gl.totals.shards {
+			clear(t.hours)
+		}
+	}
+	for _, lb := range gl.leaderboards {
+		for _, shard := range lb.shards {
+			shard.scoresList.Clear()
+			shard.sketch = NewQuantileSketch()
+			shard.levels = newScoreLevels()
+		}
+	}
+	gl.resetCalendar()
+	return players
+}
+
+// ResetGame clears the game's board for a clean slate, for example between
+// tournament rounds. With purgeDB its Postgres scores are deleted as well and
+// the number of rows deleted is returned.
+//
+// Without purgeDB the scores stay in Postgres. When snapshots are enabled the
+// reset board is saved straight away, so a restart only reloads scores newer
+// than the reset; without snapshots, or for a cumulative game, which is not
+// warmed from snapshots, a restart brings the old scores back.
+func (ls *Store) ResetGame(gameID int64, purgeDB bool) (uint64, int64, error) {
+	var deleted int64
+	if purgeDB && ls.db != nil {
+		var err error
+		deleted, err = ls.db.DeleteGameScores(gameID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete scores from PostgreSQL: %w", err)
+		}
+		// Season boards are kept through a reset, unless their scores are
+		// gone too.
+		for _, board := range ls.seasonBoards(gameID) {
+			board.Reset()
+		}
+	}
+
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return 0, deleted, nil
+	}
+
+	players := leaderboard.Reset()
+	ls.notifyBoardChange(gameID)
+
+	if ls.snapshots != nil && leaderboard.Scoring() != models.ScoringCumulative {
+		if err := ls.snapshots.Save(leaderboard.Snapshot(gameID)); err != nil {
+			logging.Error("Failed to save snapshot of reset game", "game", gameID, "error", err)
+		}
+	}
+
+	logging.Info("Reset game", "game", gameID, "players", players, "rows", deleted)
+	return players, deleted, nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Each open season of a game has a board of its own next to the game's board.
+// Scores are tagged with the season they were received in when they are
+// saved, and applied to both. Frozen seasons are dropped from memory and only
+// read from Postgres.
+
+type seasonBoard struct {
+	season models.Season
+	board  *GameLeaderboard
+}
+
+// SetOpenSeasons replaces the seasons the store keeps boards for. Boards of
+// seasons already open are kept; new ones are loaded from Postgres.
+func (ls *Store) SetOpenSeasons(seasons []models.Season) {
+	var added []*seasonBoard
+
+	// Looking the games up can read Postgres, so is done before locking.
+	scoring := make(map[int64]models.ScoringMode, len(seasons))
+	for _, season := range seasons {
+		scoring[season.GameID], _ = ls.boardScoring(season.GameID)
+	}
+
+	ls.seasonsMu.Lock()
+	next := make(map[int64]*seasonBoard, len(seasons))
+	for _, season := range seasons {
+		if current, ok := ls.seasons[season.SeasonID]; ok {
+			next[season.SeasonID] = &seasonBoard{season: season, board: current.board}
+			continue
+		}
+		board := newBoard(1, scoring[season.GameID])
+		for _, userID := range ls.ExcludedAccounts(season.GameID) {
+			board.SetExcluded(userID, true)
+		}
+		next[season.SeasonID] = &seasonBoard{season: season, board: board}
+		added = append(added, next[season.SeasonID])
+	}
+	ls.seasons = next
+	ls.seasonsMu.Unlock()
+
+	if ls.db == nil {
+		return
+	}
+	// The boards are already receiving new scores; loading the stored ones
+	// afterwards at worst applies a score twice, which changes nothing on a
+	// best score board but counts it twice on a cumulative one.
+	for _, season := range added {
+		scores, err := ls.db.GetScoresForSeason(season.season.SeasonID)
+		if err != nil {
+			logging.Error("Failed to load season scores", "game", season.season.GameID, "season", season.season.SeasonID, "error", err)
+			continue
+		}
+		season.board.AddScoreBatch(scores)
+	}
+}
+
+// ActiveSeason returns the game's open season that scores received now count
+// towards.
+func (ls *Store) ActiveSeason(gameID int64) (models.Season, bool) {
+	season := ls.seasonAt(gameID, clock())
+	if season == nil {
+		return models.Season{}, false
+	}
+	return season.season, true
+}
+
+// SeasonLeaderboard returns the board of an open season of the game, or nil
+// when the season is frozen, unknown or belongs to another game.
+func (ls *Store) SeasonLeaderboard(gameID, seasonID int64) *GameLeaderboard {
+	ls.seasonsMu.RLock()
+	defer ls.seasonsMu.RUnlock()
+
+	season, ok := ls.seasons[seasonID]
+	if !ok || season.season.GameID != gameID {
+		return nil
+	}
+	return season.board
+}
+
+func (ls *Store) seasonAt(gameID int64, at time.Time) *seasonBoard {
+	ls.seasonsMu.RLock()
+	defer ls.seasonsMu.RUnlock()
+
+	for _, season := range ls.seasons {
+		if season.season.GameID == gameID && season.season.Contains(at) {
+			return season
+		}
+	}
+	return nil
+}
+
+// tagSeason sets the season the score was received in, replacing whatever it
+// carried.
+func (ls *Store) tagSeason(score *models.Score) {
+	received := score.ReceivedAt
+	if received.IsZero() {
+		received = clock()
+	}
+
+	score.SeasonID = 0
+	if season := ls.seasonAt(score.GameID, received); season != nil {
+		score.SeasonID = season.season.SeasonID
+	}
+}
+
+// addSeasonScores applies a game's scores to the boards of the seasons they
+// are tagged with.
+func (ls *Store) addSeasonScores(gameID int64, scores []models.Score) {
+	ls.seasonsMu.RLock()
+	defer ls.seasonsMu.RUnlock()
+
+	for _, score := range scores {
+		if season, ok := ls.seasons[score.SeasonID]; ok && season.season.GameID == gameID {
+			season.board.AddScore(score.UserID, score.Score, score.Timestamp)
+		}
+	}
+}
+
+// seasonBoards returns the boards of the game's open seasons.
+func (ls *Store) seasonBoards(gameID int64) []*GameLeaderboard {
+	ls.seasonsMu.RLock()
+	defer ls.seasonsMu.RUnlock()
+
+	var boards []*GameLeaderboard
+	for _, season := range ls.seasons {
+		if season.season.GameID == gameID {
+			boards = append(boards, season.board)
+		}
+	}
+	return boards
+}
+
+// allSeasonBoards returns the boards of every open season.
+func (ls *Store) allSeasonBoards() []*GameLeaderboard {
+	ls.seasonsMu.RLock()
+	defer ls.seasonsMu.RUnlock()
+
+	boards := make([]*GameLeaderboard, 0, len(ls.seasons))
+	for _, season := range ls.seasons {
+		boards = append(boards, season.board)
+	}
+	return boards
+}
@@ -0,0 +1,328 @@
+package store
+
+import (
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+
+	cache "github.com/IWhitebird/go-leader-board/internal/cache"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// A window's board is split into shards by a hash of the user ID, each with
+// its own skiplist, sketch and lock. Most games have a single shard. A game
+// with tens of millions of players can be given more, so that submissions for
+// different players are applied in parallel and no single skiplist holds the
+// whole board.
+//
+// Reads lock every shard and combine them: ranks are the player's rank in
+// their own shard plus the entries ahead of them in the others, and top lists
+// merge the shards in rank order, listing players tied across shards in shard
+// order.
+
+type boardShard struct {
+	mu         sync.Mutex
+	scoresList *cache.SkipList[int64, models.Score]
+	sketch     *QuantileSketch
+	levels     *scoreLevels
+}
+
+func newBoardShard() *boardShard {
+	return &boardShard{
+		scoresList: cache.NewSkipList[int64](models.ScoreCompare),
+		sketch:     NewQuantileSketch(),
+		levels:     newScoreLevels(),
+	}
+}
+
+func newLeaderBoard(shards int) *LeaderBoard {
+	lb := &LeaderBoard{shards: make([]*boardShard, max(shards, 1))}
+	for i := range lb.shards {
+		lb.shards[i] = newBoardShard()
+	}
+	return lb
+}
+
+// shardIndex maps a player to one of n shards. The multiplication spreads
+// sequential user IDs evenly.
+func shardIndex(userID int64, n int) int {
+	if n == 1 {
+		return 0
+	}
+	return int((uint64(userID) * 0x9E3779B97F4A7C15 >> 32) % uint64(n))
+}
+
+func (lb *LeaderBoard) shardFor(userID int64) *boardShard {
+	return lb.shards[shardIndex(userID, len(lb.shards))]
+}
+
+// lock takes every shard's lock, always in index order.
+func (lb *LeaderBoard) lock() {
+	for _, shard := range lb.shards {
+		shard.mu.Lock()
+	}
+}
+
+func (lb *LeaderBoard) unlock() {
+	for _, shard := range lb.shards {
+		shard.mu.Unlock()
+	}
+}
+
+// The methods below read or change the whole board. The caller holds every
+// shard's lock, or for put and remove at least the player's shard's lock.
+
+func (lb *LeaderBoard) put(userID int64, score models.Score) bool {
+	return lb.shardFor(userID).put(userID, score)
+}
+
+func (lb *LeaderBoard) remove(userID int64) bool {
+	return lb.shardFor(userID).remove(userID)
+}
+
+func (lb *LeaderBoard) search(userID int64) (models.Score, bool) {
+	return lb.shardFor(userID).scoresList.Search(userID)
+}
+
+func (lb *LeaderBoard) length() int {
+	total := 0
+	for _, shard := range lb.shards {
+		total += shard.scoresList.GetLength()
+	}
+	return total
+}
+
+// rank returns the player's 1-based rank on the whole board. As with a single
+// skiplist, players whose entries compare equal share the best of their ranks.
+func (lb *LeaderBoard) rank(userID int64) (int, bool) {
+	own := shardIndex(userID, len(lb.shards))
+	list := lb.shards[own].scoresList
+
+	rank, ok := list.GetRank(userID)
+	if !ok {
+		return 0, false
+	}
+	score, _ := list.Search(userID)
+
+	for i, shard := range lb.shards {
+		if i != own {
+			rank += shard.scoresList.CountGreater(score)
+		}
+	}
+	return rank, true
+}
+
+// countWhile returns how many entries satisfy pred, which must hold for a
+// prefix of the board as for SkipList.CountWhile.
+func (lb *LeaderBoard) countWhile(pred func(models.Score) bool) int {
+	count := 0
+	for _, shard := range lb.shards {
+		count += shard.scoresList.CountWhile(pred)
+	}
+	return count
+}
+
+// ascend calls fn for every entry in rank order until fn returns false. With
+// several shards it merges them, costing O(shards) per entry visited.
+func (lb *LeaderBoard) ascend(fn func(userID int64, score models.Score) bool) {
+	if len(lb.shards) == 1 {
+		lb.shards[0].scoresList.Ascend(fn)
+		return
+	}
+
+	type cursor struct {
+		next   func() (int64, models.Score, bool)
+		userID int64
+		score  models.Score
+		ok     bool
+	}
+
+	cursors := make([]cursor, len(lb.shards))
+	for i, shard := range lb.shards {
+		next, stop := iter.Pull2(iter.Seq2[int64, models.Score](shard.scoresList.Ascend))
+		defer stop()
+		cursors[i].next = next
+		cursors[i].userID, cursors[i].score, cursors[i].ok = next()
+	}
+
+	for {
+		best := -1
+		for i := range cursors {
+			if cursors[i].ok && (best < 0 || models.ScoreCompare(cursors[i].score, cursors[best].score) < 0) {
+				best = i
+			}
+		}
+		if best < 0 || !fn(cursors[best].userID, cursors[best].score) {
+			return
+		}
+		cursors[best].userID, cursors[best].score, cursors[best].ok = cursors[best].next()
+	}
+}
+
+// rangeOf returns up to k entries after skipping the first offset ranks.
+func (lb *LeaderBoard) rangeOf(offset, k int) []cache.Entry[int64, models.Score] {
+	if len(lb.shards) == 1 {
+		return lb.shards[0].scoresList.GetRange(offset, k)
+	}
+
+	result := make([]cache.Entry[int64, models.Score], 0)
+	if offset < 0 || k <= 0 {
+		return result
+	}
+
+	rank := 0
+	lb.ascend(func(userID int64, score models.Score) bool {
+		rank++
+		if rank <= offset {
+			return true
+		}
+		result = append(result, cache.Entry[int64, models.Score]{Key: userID, Value: score, Rank: rank})
+		return len(result) < k
+	})
+	return result
+}
+
+func (lb *LeaderBoard) byRank(rank int) (cache.Entry[int64, models.Score], bool) {
+	if len(lb.shards) == 1 {
+		return lb.shards[0].scoresList.GetByRank(rank)
+	}
+
+	entries := lb.rangeOf(rank-1, 1)
+	if len(entries) == 0 {
+		return cache.Entry[int64, models.Score]{}, false
+	}
+	return entries[0], true
+}
+
+// neighbors returns the player's entry with up to before entries ranked above
+// and after entries ranked below.
+func (lb *LeaderBoard) neighbors(userID int64, before, after int) ([]cache.Entry[int64, models.Score], bool) {
+	if len(lb.shards) == 1 {
+		return lb.shards[0].scoresList.GetNeighbors(userID, before, after)
+	}
+
+	rank, ok := lb.rank(userID)
+	if !ok {
+		return nil, false
+	}
+	start := max(rank-before, 1)
+	return lb.rangeOf(start-1, rank-start+1+after), true
+}
+
+// scores returns every entry's score in rank order.
+func (lb *LeaderBoard) scores() []models.Score {
+	scores := make([]models.Score, 0, lb.length())
+	lb.ascend(func(_ int64, score models.Score) bool {
+		scores = append(scores, score)
+		return true
+	})
+	return scores
+}
+
+// mergedSketch returns a copy of the sketch covering every shard.
+func (lb *LeaderBoard) mergedSketch() *QuantileSketch {
+	sketch := lb.shards[0].sketch.Clone()
+	for _, shard := range lb.shards[1:] {
+		sketch.Merge(shard.sketch)
+	}
+	return sketch
+}
+
+// contents returns every shard's entries and a copy of its sketch, from which
+// copyLeaderBoard rebuilds the board without holding its locks.
+func (lb *LeaderBoard) contents() ([][]cache.Entry[int64, models.Score], []*QuantileSketch) {
+	entries := make([][]cache.Entry[int64, models.Score], len(lb.shards))
+	sketches := make([]*QuantileSketch, len(lb.shards))
+	for i, shard := range lb.shards {
+		entries[i] = shard.scoresList.GetAll()
+		sketches[i] = shard.sketch.Clone()
+	}
+	return entries, sketches
+}
+
+func copyLeaderBoard(entries [][]cache.Entry[int64, models.Score], sketches []*QuantileSketch) *LeaderBoard {
+	copied := &LeaderBoard{shards: make([]*boardShard, len(entries))}
+	for i := range entries {
+		copied.shards[i] = &boardShard{
+			scoresList: cache.NewSkipList[int64](models.ScoreCompare),
+			sketch:     sketches[i],
+			levels:     newScoreLevels(),
+		}
+		for _, entry := range entries[i] {
+			copied.shards[i].scoresList.InsertOrUpdate(entry.Key, entry.Value)
+			copied.shards[i].levels.add(entry.Value.Score)
+		}
+	}
+	return copied
+}
+
+// Shards returns how many shards each of the game's windows is split into.
+func (gl *GameLeaderboard) Shards() int {
+	return len(gl.leaderboards[0].shards)
+}
+
+// withShard runs fn on the player's shard of the window, holding only that
+// shard's lock.
+func (gl *GameLeaderboard) withShard(window models.TimeWindow, userID int64, fn func(*boardShard)) {
+	shard := gl.getLeaderboard(window).shardFor(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	fn(shard)
+}
+
+// addScoresByShard applies a batch with one goroutine per shard. Each player
+// lives on one shard, so their scores are still applied in order.
+func (gl *GameLeaderboard) addScoresByShard(scores []models.Score) {
+	byShard := make([][]models.Score, gl.Shards())
+	for _, score := range scores {
+		i := shardIndex(score.UserID, len(byShard))
+		byShard[i] = append(byShard[i], score)
+	}
+
+	var wg sync.WaitGroup
+	for _, shardScores := range byShard {
+		if len(shardScores) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, score := range shardScores {
+				gl.AddScore(score.UserID, score.Score, score.Timestamp)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ParseGameShards parses a comma separated list of gameID:shards pairs, as
+// accepted by Store.SetGameShards.
+func ParseGameShards(spec string) (map[int64]int, error) {
+	shards := make(map[int64]int)
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		game, count, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid game shards %q, expected gameID:shards", pair)
+		}
+		gameID, err := strconv.ParseInt(game, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid game ID in game shards %q", pair)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid shard count in game shards %q", pair)
+		}
+
+		shards[gameID] = n
+	}
+
+	return shards, nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// SketchRelativeError bounds the error of every quantile a QuantileSketch
+// returns: the estimate is within 1% of the exact score at that quantile.
+const SketchRelativeError = 0.01
+
+var (
+	sketchGamma    = (1 + SketchRelativeError) / (1 - SketchRelativeError)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// QuantileSketch is a DDSketch of a board's scores. Scores are counted in
+// logarithmically sized buckets, so its size grows with the range of scores
+// rather than the number of players, and unlike most quantile sketches scores
+// can be removed again when a player improves or ages out of a window.
+type QuantileSketch struct {
+	Bins  map[int]uint64 // bucket index to count; bucket i holds (gamma^(i-1), gamma^i]
+	Zeros uint64         // scores of 0, which have no logarithm
+	Count uint64
+}
+
+func NewQuantileSketch() *QuantileSketch {
+	return &QuantileSketch{Bins: make(map[int]uint64)}
+}
+
+func sketchIndex(score uint64) int {
+	return int(math.Ceil(math.Log(float64(score)) / sketchLogGamma))
+}
+
+// sketchValue is the score the bucket stands for, the point within it whose
+// relative distance to either edge is the same.
+func sketchValue(index int) uint64 {
+	return uint64(math.Round(2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)))
+}
+
+func (s *QuantileSketch) Add(score uint64) {
+	s.Count++
+	if score == 0 {
+		s.Zeros++
+		return
+	}
+	s.Bins[sketchIndex(score)]++
+}
+
+// Remove takes back a score previously added. Scores that were never added
+// are ignored.
+func (s *QuantileSketch) Remove(score uint64) {
+	if score == 0 {
+		if s.Zeros > 0 {
+			s.Zeros--
+			s.Count--
+		}
+		return
+	}
+
+	index := sketchIndex(score)
+	switch s.Bins[index] {
+	case 0:
+		return
+	case 1:
+		delete(s.Bins, index)
+	default:
+		s.Bins[index]--
+	}
+	s.Count--
+}
+
+// Merge adds every score counted by other to the sketch.
+func (s *QuantileSketch) Merge(other *QuantileSketch) {
+	for index, count := range other.Bins {
+		s.Bins[index] += count
+	}
+	s.Zeros += other.Zeros
+	s.Count += other.Count
+}
+
+func (s *QuantileSketch) Clone() *QuantileSketch {
+	clone := NewQuantileSketch()
+	clone.Merge(s)
+	return clone
+}
+
+// Quantiles returns the approximate score at each quantile, where 0 is the
+// lowest score on the board and 1 the highest. The sketch must not be empty.
+func (s *QuantileSketch) Quantiles(qs []float64) []uint64 {
+	indexes := make([]int, 0, len(s.Bins))
+	for index := range s.Bins {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	scores := make([]uint64, len(qs))
+	for i, q := range qs {
+		scores[i] = s.quantile(indexes, q)
+	}
+	return scores
+}
+
+func (s *QuantileSketch) quantile(indexes []int, q float64) uint64 {
+	rank := uint64(q * float64(s.Count-1))
+	if rank < s.Zeros {
+		return 0
+	}
+
+	seen := s.Zeros
+	for _, index := range indexes {
+		seen += s.Bins[index]
+		if seen > rank {
+			return sketchValue(index)
+		}
+	}
+	return sketchValue(indexes[len(indexes)-1])
+}
+
+// ScoreQuantiles returns the approximate scores at the given quantiles of a
+// window's board and the number of scores the sketch covers. Excluded
+// accounts are counted. found is false when the board is empty.
+func (gl *GameLeaderboard) ScoreQuantiles(qs []float64, window models.TimeWindow) ([]uint64, uint64, bool) {
+	sketch := gl.Sketch(window)
+	if sketch.Count == 0 {
+		return nil, 0, false
+	}
+	return sketch.Quantiles(qs), sketch.Count, true
+}
+
+// Sketch returns a copy of the window's quantile sketch.
+func (gl *GameLeaderboard) Sketch(window models.TimeWindow) *QuantileSketch {
+	var sketch *QuantileSketch
+
+	gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		sketch = lb.mergedSketch()
+	})
+
+	return sketch
+}
+
+// put inserts or improves the player's entry and keeps the sketch and score
+// levels in step. The caller holds the shard's lock.
+func (lb *boardShard) put(userID int64, score models.Score) bool {
+	previous, existed := lb.scoresList.Search(userID)
+	if !lb.scoresList.InsertOrUpdate(userID, score) {
+		return false
+	}
+	if existed {
+		lb.sketch.Remove(previous.Score)
+		lb.levels.remove(previous.Score)
+	}
+	lb.sketch.Add(score.Score)
+	lb.levels.add(score.Score)
+	return true
+}
+
+// update replaces the player's entry with fn(current, exists), even when it
+// is worse, and keeps the sketch and score levels in step. The caller holds
+// the shard's lock.
+func (lb *boardShard) update(userID int64, fn func(current models.Score, exists bool) models.Score) bool {
+	var previous models.Score
+	var existed bool
+	next := lb.scoresList.Upsert(userID, func(current models.Score, exists bool) models.Score {
+		previous, existed = current, exists
+		return fn(current, exists)
+	})
+	if existed {
+		if next == previous {
+			return false
+		}
+		lb.sketch.Remove(previous.Score)
+		lb.levels.remove(previous.Score)
+	}
+	lb.sketch.Add(next.Score)
+	lb.levels.add(next.Score)
+	return true
+}
+
+// accumulate adds score to the player's total, saturating rather than
+// wrapping. The entry keeps the latest timestamp, so of two players with the
+// same total the one who reached it first ranks higher. The caller holds the
+// shard's lock.
+func (lb *boardShard) accumulate(userID int64, score uint64, timestamp time.Time) bool {
+	return lb.update(userID, func(current models.Score, exists bool) models.Score {
+		if !exists {
+			return models.Score{UserID: userID, Score: score, Timestamp: timestamp}
+		}
+		current.Score = saturatingAdd(current.Score, score)
+		if timestamp.After(current.Timestamp) {
+			current.Timestamp = timestamp
+		}
+		return current
+	})
+}
+
+// remove deletes the player's entry and takes its score out of the sketch and
+// score levels. The caller holds the shard's lock.
+func (lb *boardShard) remove(userID int64) bool {
+	previous, existed := lb.scoresList.Search(userID)
+	if !existed || !lb.scoresList.Delete(userID) {
+		return false
+	}
+	lb.sketch.Remove(previous.Score)
+	lb.levels.remove(previous.Score)
+	return true
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// GameSnapshot is the persisted form of a GameLeaderboard. Watermark is the
+// newest score timestamp the leaderboard had seen when the snapshot was taken,
+// so warm-up only has to replay scores at or after it from Postgres.
+// Snapshots written before sketches were added have nil Sketches.
+type GameSnapshot struct {
+	GameID    int64
+	Watermark time.Time
+	TakenAt   time.Time
+	Windows   [models.LeaderboardIndexCount][]models.Score
+	Sketches  [models.LeaderboardIndexCount]*QuantileSketch
+}
+
+// SnapshotStore keeps one snapshot file per game in a local directory, plus
+// the score history of every snapshot taken.
+type SnapshotStore struct {
+	dir              string
+	historyRetention time.Duration
+	historyMu        sync.Mutex
+	histories        map[string]*ScoreHistory
+}
+
+func NewSnapshotStore(dir string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &SnapshotStore{
+		dir:       dir,
+		histories: make(map[string]*ScoreHistory),
+	}, nil
+}
+
+// SetHistoryRetention removes score histories older than retention as new
+// snapshots are saved. Zero keeps them forever.
+func (s *SnapshotStore) SetHistoryRetention(retention time.Duration) {
+	s.historyRetention = retention
+}
+
+func (s *SnapshotStore) path(gameID int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("game-%d.snap", gameID))
+}
+
+// Save writes the snapshot to a temporary file and renames it into place so a
+// crash mid-write never leaves a truncated snapshot behind.
+func (s *SnapshotStore) Save(snap *GameSnapshot) error {
+	tmp, err := os.CreateTemp(s.dir, fmt.Sprintf("game-%d-*.tmp", snap.GameID))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(snap.GameID)); err != nil {
+		return err
+	}
+	return s.saveHistory(snap)
+}
+
+// Load returns the latest snapshot for a game, or nil if none exists.
+func (s *SnapshotStore) Load(gameID int64) (*GameSnapshot, error) {
+	f, err := os.Open(s.path(gameID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snap GameSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot for game %d: %w", gameID, err)
+	}
+	return &snap, nil
+}
+
+// Snapshot captures every window's entries together with the watermark.
+func (gl *GameLeaderboard) Snapshot(gameID int64) *GameSnapshot {
+	snap := &GameSnapshot{
+		GameID:    gameID,
+		Watermark: gl.Watermark(),
+		TakenAt:   clock(),
+	}
+
+	for i, window := range models.AllTimeWindows() {
+		gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+			snap.Windows[i] = lb.scores()
+			snap.Sketches[i] = lb.mergedSketch()
+		})
+	}
+
+	return snap
+}
+
+// Restore loads a snapshot's entries into the leaderboard. Entries that have
+// aged out of their window since the snapshot was taken are skipped, and live
+// scores already present are kept if they are better.
+func (gl *GameLeaderboard) Restore(snap *GameSnapshot) {
+	for i, window := range models.AllTimeWindows() {
+		gl.withLeaderboard(window, LockTypeWrite, func(lb *LeaderBoard) {
+			// The saved sketch still describes the board when the snapshot is
+			// restored whole onto an empty unsharded one; otherwise it is
+			// rebuilt.
+			if snap.Sketches[i] != nil && len(lb.shards) == 1 && lb.length() == 0 && gl.allValid(window, snap.Windows[i]) {
+				shard := lb.shards[0]
+				for _, score := range snap.Windows[i] {
+					shard.scoresList.InsertOrUpdate(score.UserID, score)
+					shard.levels.add(score.Score)
+				}
+				shard.sketch = snap.Sketches[i].Clone()
+				if len(snap.Windows[i]) > 0 {
+					gl.version.Add(1)
+				}
+				return
+			}
+
+			for _, score := range snap.Windows[i] {
+				if !gl.isScoreValid(window, score.Timestamp) {
+					continue
+				}
+				if lb.put(score.UserID, score) {
+					gl.version.Add(1)
+				}
+			}
+		})
+	}
+	gl.seedCalendar()
+	gl.advanceWatermark(snap.Watermark)
+}
+
+func (gl *GameLeaderboard) allValid(window models.TimeWindow, scores []models.Score) bool {
+	for _, score := range scores {
+		if !gl.isScoreValid(window, score.Timestamp) {
+			return false
+		}
+	}
+	return true
+}
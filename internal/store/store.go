@@ -1,25 +1,52 @@
 package store
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/config"
 	"github.com/IWhitebird/go-leader-board/internal/db"
 	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
 	"github.com/IWhitebird/go-leader-board/internal/models"
 )
 
 type Store struct {
-	mu           sync.RWMutex
-	db           *db.PostgresRepository
-	leaderboards map[int64]*GameLeaderboard
+	mu                sync.RWMutex
+	db                *db.PostgresRepository
+	snapshots         *SnapshotStore
+	ingestMu          sync.RWMutex
+	ingest            *ingestPipeline
+	activity          *ActivityTracker
+	listenersMu       sync.RWMutex
+	listeners         []func(gameID int64)
+	topWatchers       []topWatcher
+	feedsMu           sync.RWMutex
+	feeds             map[int64][]*topFeed // live top list subscriptions by game
+	profilesMu        sync.RWMutex
+	profiles          map[int64]cachedProfile
+	seasonsMu         sync.RWMutex
+	seasons           map[int64]*seasonBoard // open seasons by season ID
+	gamesMu           sync.RWMutex
+	games             map[int64]cachedGame // registered games by game ID
+	requireRegistered bool
+	leaderboards      map[int64]*GameLeaderboard
+	hidden            map[int64]struct{}
+	shards            map[int64]int
 }
 
 func NewStore(db *db.PostgresRepository) *Store {
 	store := &Store{
 		leaderboards: make(map[int64]*GameLeaderboard),
+		hidden:       make(map[int64]struct{}),
+		shards:       make(map[int64]int),
+		profiles:     make(map[int64]cachedProfile),
+		seasons:      make(map[int64]*seasonBoard),
+		games:        make(map[int64]cachedGame),
 		db:           db,
 	}
 	// For now let's not run the cleanup.
@@ -27,13 +54,141 @@ func NewStore(db *db.PostgresRepository) *Store {
 	return store
 }
 
+// StartIngestWorkers makes SaveScoreBatch apply each game's scores on one of
+// n dedicated workers instead of the caller's goroutine.
+func (ls *Store) StartIngestWorkers(n int) {
+	ls.ingestMu.Lock()
+	defer ls.ingestMu.Unlock()
+
+	if n <= 1 || ls.ingest != nil {
+		return
+	}
+	ls.ingest = newIngestPipeline(ls, n)
+}
+
+// stopIngestWorkers drains the workers; later batches are applied inline.
+func (ls *Store) stopIngestWorkers() {
+	ls.ingestMu.Lock()
+	defer ls.ingestMu.Unlock()
+
+	if ls.ingest != nil {
+		ls.ingest.close()
+		ls.ingest = nil
+	}
+}
+
+// SetSnapshotStore enables snapshot-based warm-up and snapshotting on Close.
+func (ls *Store) SetSnapshotStore(snapshots *SnapshotStore) {
+	ls.snapshots = snapshots
+}
+
+// OnBoardChange registers fn to be called after scores have been applied to a
+// game. fn runs on the writer's goroutine and must not block.
+func (ls *Store) OnBoardChange(fn func(gameID int64)) {
+	ls.listenersMu.Lock()
+	defer ls.listenersMu.Unlock()
+	ls.listeners = append(ls.listeners, fn)
+}
+
+func (ls *Store) notifyBoardChange(gameID int64) {
+	ls.wakeFeeds(gameID)
+
+	ls.listenersMu.RLock()
+	defer ls.listenersMu.RUnlock()
+	for _, fn := range ls.listeners {
+		fn(gameID)
+	}
+}
+
+// EnableActivityTracking keeps the recent submissions of up to capacity
+// players, depth submissions each. It must be called before scores arrive.
+func (ls *Store) EnableActivityTracking(capacity, depth int) {
+	if capacity <= 0 || depth <= 0 {
+		return
+	}
+	ls.activity = NewActivityTracker(capacity, depth)
+}
+
+// Activity returns the player's recent submissions, or false if activity
+// tracking is off or the player is not tracked.
+func (ls *Store) Activity(gameID, userID int64) (UserActivity, bool) {
+	if ls.activity == nil {
+		return UserActivity{}, false
+	}
+	return ls.activity.Lookup(gameID, userID)
+}
+
+func (ls *Store) recordActivity(scores ...models.Score) {
+	if ls.activity == nil {
+		return
+	}
+	now := clock()
+	for _, score := range scores {
+		ls.activity.Record(score, now)
+	}
+}
+
+// HideGame keeps a game out of listings such as Games and GetUserRanks. The
+// game itself works as usual; this is for internal games like the canary.
+func (ls *Store) HideGame(gameID int64) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.hidden[gameID] = struct{}{}
+}
+
+// IsHidden reports whether the game is kept out of listings.
+func (ls *Store) IsHidden(gameID int64) bool {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	_, hidden := ls.hidden[gameID]
+	return hidden
+}
+
+// listedGames returns the resident games that are not hidden.
+func (ls *Store) listedGames() map[int64]*GameLeaderboard {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	games := make(map[int64]*GameLeaderboard, len(ls.leaderboards))
+	for gameID, leaderboard := range ls.leaderboards {
+		if _, hidden := ls.hidden[gameID]; !hidden {
+			games[gameID] = leaderboard
+		}
+	}
+	return games
+}
+
+// SetGameShards splits the given games' boards into shards when they are
+// created. Boards that already exist keep their shard count until the store is
+// rebuilt, so it must be called before the store is loaded.
+func (ls *Store) SetGameShards(shards map[int64]int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for gameID, count := range shards {
+		ls.shards[gameID] = count
+	}
+}
+
+// GetOrCreateLeaderboard returns the game's board, starting one if it has
+// none. While registration is required it returns nil for unregistered games
+// instead.
 func (ls *Store) GetOrCreateLeaderboard(gameID int64) *GameLeaderboard {
+	if leaderboard := ls.GetLeaderboard(gameID); leaderboard != nil {
+		return leaderboard
+	}
+	// Looking the game up can read Postgres, so is done before locking.
+	scoring, ok := ls.boardScoring(gameID)
+	if !ok {
+		return nil
+	}
+
 	ls.mu.Lock()
 	defer ls.mu.Unlock()
 
 	leaderboard, exists := ls.leaderboards[gameID]
 	if !exists {
-		leaderboard = NewGameLeaderboard()
+		leaderboard = ls.newGameBoard(gameID, scoring)
 		ls.leaderboards[gameID] = leaderboard
 	}
 
@@ -41,6 +196,9 @@ func (ls *Store) GetOrCreateLeaderboard(gameID int64) *GameLeaderboard {
 }
 
 func (ls *Store) GetLeaderboard(gameID int64) *GameLeaderboard {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
 	leaderboard, exists := ls.leaderboards[gameID]
 	if !exists {
 		return nil
@@ -49,47 +207,184 @@ func (ls *Store) GetLeaderboard(gameID int64) *GameLeaderboard {
 }
 
 func (ls *Store) AddScore(score models.Score) error {
+	if err := score.Validate(); err != nil {
+		metrics.ScoresRejected.Inc()
+		return err
+	}
+	if err := ls.CheckGame(score); err != nil {
+		metrics.ScoresRejected.Inc()
+		return err
+	}
+	ls.tagSeason(&score)
+
 	if ls.db != nil {
 		err := ls.db.SaveScore(score)
 		if err != nil {
+			metrics.ScoresRejected.Inc()
 			return fmt.Errorf("failed to save score to PostgreSQL: %w", err)
 		}
 	}
 
+	ls.recordActivity(score)
 	ls.addScoreToCache(score)
+	metrics.ScoresApplied.Inc()
 	return nil
 }
 
+// SubmitResult is a player's all-time standing right after a submission, and
+// whether the submission raised their score.
+type SubmitResult struct {
+	PlayerRank
+	Improved bool
+}
+
+// ApplySubmission applies a score on its way through Kafka to the in-memory
+// boards ahead of the consumer, so the submitter can be told their new rank,
+// and returns the player's all-time standing after it. Nothing is saved; the
+// consumer does that when the score arrives. Applying a best score a second
+// time changes nothing, but a cumulative game's total would count it twice, so
+// there the score is left to the consumer and the standing is projected from
+// the player's current total instead.
+func (ls *Store) ApplySubmission(score models.Score) (SubmitResult, error) {
+	if err := score.Validate(); err != nil {
+		return SubmitResult{}, err
+	}
+	if err := ls.CheckGame(score); err != nil {
+		return SubmitResult{}, err
+	}
+	leaderboard := ls.GetOrCreateLeaderboard(score.GameID)
+	if leaderboard == nil {
+		return SubmitResult{}, fmt.Errorf("game %d: %w", score.GameID, ErrGameNotFound)
+	}
+
+	before := leaderboard.GetPlayerRank(score.UserID, models.AllTime, models.RankOrdinal)
+	if leaderboard.Scoring() == models.ScoringCumulative {
+		after := PlayerRank{UserID: score.UserID, Score: saturatingAdd(before.Score, score.Score), Total: before.Total, Found: true}
+		if !before.Found {
+			after.Total = leaderboard.TotalPlayers(models.AllTime) + 1
+		}
+		after.Rank = min(leaderboard.RankForScore(after.Score, models.AllTime), after.Total)
+		after.Percentile = 100.0 * float64(after.Total-after.Rank+1) / float64(after.Total)
+		return SubmitResult{PlayerRank: after, Improved: score.Score > 0}, nil
+	}
+
+	ls.tagSeason(&score)
+	ls.addScoreToCache(score)
+	after := leaderboard.GetPlayerRank(score.UserID, models.AllTime, models.RankOrdinal)
+	return SubmitResult{PlayerRank: after, Improved: !before.Found || score.Score > before.Score}, nil
+}
+
+// SaveScoreBatch persists and applies every valid score in the batch. Scores
+// that fail validation, or whose game could not be persisted, are left out and
+// reported through a *BatchError instead of failing the whole batch.
 func (ls *Store) SaveScoreBatch(scores []models.Score) error {
 	if len(scores) == 0 {
 		return nil
 	}
 
+	var rejected []RejectedScore
+	valid := make([]models.Score, 0, len(scores))
+	for _, score := range scores {
+		if err := score.Validate(); err != nil {
+			rejected = append(rejected, RejectedScore{Score: score, Reason: err})
+			continue
+		}
+		if err := ls.CheckGame(score); err != nil {
+			rejected = append(rejected, RejectedScore{Score: score, Reason: err})
+			continue
+		}
+		ls.tagSeason(&score)
+		valid = append(valid, score)
+	}
+
+	byGame := splitByGame(valid)
+
 	if ls.db != nil {
-		err := ls.db.SaveScoreBatch(scores)
-		if err != nil {
-			return fmt.Errorf("failed to save scores to PostgreSQL: %w", err)
+		// One transaction per game, so a failure in one game does not roll
+		// back the scores of the others.
+		for gameID, gameScores := range byGame {
+			if err := ls.db.SaveScoreBatch(gameScores); err != nil {
+				err = fmt.Errorf("failed to save scores to PostgreSQL: %w", err)
+				for _, score := range gameScores {
+					rejected = append(rejected, RejectedScore{Score: score, Reason: err})
+				}
+				delete(byGame, gameID)
+			}
 		}
 	}
 
-	for _, score := range scores {
-		ls.addScoreToCache(score)
+	applied := 0
+	for _, gameScores := range byGame {
+		ls.recordActivity(gameScores...)
+		applied += len(gameScores)
 	}
+	ls.applyBatch(byGame)
+
+	metrics.ScoresApplied.Add(float64(applied))
+	metrics.ScoresRejected.Add(float64(len(rejected)))
 
+	if len(rejected) > 0 {
+		return &BatchError{Rejected: rejected}
+	}
 	return nil
 }
 
+func (ls *Store) applyBatch(byGame map[int64][]models.Score) {
+	ls.ingestMu.RLock()
+	defer ls.ingestMu.RUnlock()
+
+	depth := ls.topWatchDepth()
+	before := make(map[int64][][]models.LeaderboardEntry, len(byGame))
+	if depth > 0 {
+		for gameID := range byGame {
+			before[gameID] = ls.topLists(gameID, depth)
+		}
+	}
+
+	if ls.ingest != nil {
+		ls.ingest.apply(byGame)
+	} else {
+		for gameID, gameScores := range byGame {
+			if leaderboard := ls.GetOrCreateLeaderboard(gameID); leaderboard != nil {
+				leaderboard.AddScoreBatch(gameScores)
+			}
+		}
+	}
+
+	for gameID, gameScores := range byGame {
+		ls.addSeasonScores(gameID, gameScores)
+		ls.notifyBoardChange(gameID)
+		ls.notifyTopChange(gameID, depth, before[gameID])
+	}
+}
+
 func (ls *Store) addScoreToCache(score models.Score) {
-	leaderboard := ls.GetOrCreateLeaderboard(score.GameID)
-	leaderboard.AddScore(score.UserID, score.Score, score.Timestamp)
+	depth := ls.topWatchDepth()
+	before := ls.topLists(score.GameID, depth)
+
+	if leaderboard := ls.GetOrCreateLeaderboard(score.GameID); leaderboard != nil {
+		leaderboard.AddScore(score.UserID, score.Score, score.Timestamp)
+	}
+	ls.addSeasonScores(score.GameID, []models.Score{score})
+	ls.notifyBoardChange(score.GameID)
+	ls.notifyTopChange(score.GameID, depth, before)
 }
 
-func (ls *Store) GetTopLeaders(gameID int64, limit int, window models.TimeWindow) []models.LeaderboardEntry {
+func (ls *Store) GetTopLeaders(gameID int64, limit, offset int, window models.TimeWindow) []models.LeaderboardEntry {
 	leaderboard := ls.GetLeaderboard(gameID)
 	if leaderboard == nil {
 		return []models.LeaderboardEntry{}
 	}
-	return leaderboard.GetTopK(limit, window)
+	return leaderboard.GetTopK(limit, offset, window)
+}
+
+// GetRankedTopLeaders is GetTopLeaders with tied players ranked under mode.
+func (ls *Store) GetRankedTopLeaders(gameID int64, limit, offset int, window models.TimeWindow, mode models.RankMode) []models.LeaderboardEntry {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return []models.LeaderboardEntry{}
+	}
+	return leaderboard.GetRankedTopK(limit, offset, window, mode)
 }
 
 func (ls *Store) GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, bool) {
@@ -100,6 +395,130 @@ func (ls *Store) GetPlayerRank(gameID, userID int64, window models.TimeWindow) (
 	return leaderboard.GetRankAndPercentile(userID, window)
 }
 
+// GetRankedPlayer is GetPlayerRank with tied players ranked under mode.
+func (ls *Store) GetRankedPlayer(gameID, userID int64, window models.TimeWindow, mode models.RankMode) PlayerRank {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return PlayerRank{UserID: userID}
+	}
+	return leaderboard.GetPlayerRank(userID, window, mode)
+}
+
+// GetRankedPlayerWithNeighbors is GetRankedPlayer together with up to n
+// players ranked directly above and below the player.
+func (ls *Store) GetRankedPlayerWithNeighbors(gameID, userID int64, n int, window models.TimeWindow, mode models.RankMode) (PlayerRank, []models.LeaderboardEntry, []models.LeaderboardEntry) {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return PlayerRank{UserID: userID}, nil, nil
+	}
+	return leaderboard.GetPlayerRankWithNeighbors(userID, n, window, mode)
+}
+
+// GetPlayerRanks looks up several players against the same state of the board.
+func (ls *Store) GetPlayerRanks(gameID int64, userIDs []int64, window models.TimeWindow) []PlayerRank {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		ranks := make([]PlayerRank, len(userIDs))
+		for i, userID := range userIDs {
+			ranks[i] = PlayerRank{UserID: userID}
+		}
+		return ranks
+	}
+	return leaderboard.GetRanks(userIDs, window)
+}
+
+// GetUserRanks returns the player's rank in every resident game where they
+// have a score in the window, ordered by game ID. Games not loaded into the
+// store, and hidden games, are not consulted.
+func (ls *Store) GetUserRanks(userID int64, window models.TimeWindow) []models.UserGameRank {
+	games := ls.listedGames()
+
+	ranks := make([]models.UserGameRank, 0)
+	for gameID, leaderboard := range games {
+		rank, percentile, score, total, exists := leaderboard.GetRankAndPercentile(userID, window)
+		if !exists {
+			continue
+		}
+		ranks = append(ranks, models.UserGameRank{
+			GameID:       gameID,
+			Rank:         rank,
+			Score:        score,
+			Percentile:   percentile,
+			TotalPlayers: total,
+		})
+	}
+	slices.SortFunc(ranks, func(a, b models.UserGameRank) int { return cmp.Compare(a.GameID, b.GameID) })
+
+	return ranks
+}
+
+func (ls *Store) GetPlayerNeighbors(gameID, userID int64, count int, window models.TimeWindow) ([]models.LeaderboardEntry, bool) {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return nil, false
+	}
+	return leaderboard.GetNeighbors(userID, count, count, window)
+}
+
+func (ls *Store) RankForScore(gameID int64, score uint64) uint64 {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return 1
+	}
+	return leaderboard.RankForScore(score, models.AllTime)
+}
+
+// ReceiptStatus reports whether a receipted score is still the player's entry
+// on the all-time board.
+func (ls *Store) ReceiptStatus(claims models.ReceiptClaims) string {
+	_, _, current, _, found := ls.GetPlayerRank(claims.GameID, claims.UserID, models.AllTime)
+	switch {
+	case found && current == claims.Score:
+		return models.ReceiptStanding
+	case found && current > claims.Score:
+		return models.ReceiptSuperseded
+	default:
+		return models.ReceiptRemoved
+	}
+}
+
+func (ls *Store) GetScoreThreshold(gameID int64, rank int, window models.TimeWindow) (uint64, uint64, uint64, bool) {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return 0, 0, 0, false
+	}
+	return leaderboard.GetScoreThreshold(rank, window)
+}
+
+// ScoreQuantiles returns the approximate scores at the given quantiles of the
+// game's board from its quantile sketch, and the number of scores the sketch
+// covers. found is false when the board is empty.
+func (ls *Store) ScoreQuantiles(gameID int64, qs []float64, window models.TimeWindow) ([]uint64, uint64, bool) {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return nil, 0, false
+	}
+	return leaderboard.ScoreQuantiles(qs, window)
+}
+
+// Games lists every game loaded into the store, except hidden ones, with its
+// all-time player count, ordered by game ID.
+func (ls *Store) Games() []models.GameInfo {
+	games := ls.listedGames()
+
+	infos := make([]models.GameInfo, 0, len(games))
+	for gameID, leaderboard := range games {
+		infos = append(infos, models.GameInfo{
+			GameID:       gameID,
+			TotalPlayers: leaderboard.TotalPlayers(models.AllTime),
+			Loaded:       true,
+		})
+	}
+	slices.SortFunc(infos, func(a, b models.GameInfo) int { return cmp.Compare(a.GameID, b.GameID) })
+
+	return infos
+}
+
 func (ls *Store) TotalPlayers(gameID int64) uint64 {
 	leaderboard := ls.GetLeaderboard(gameID)
 	if leaderboard == nil {
@@ -108,12 +527,40 @@ func (ls *Store) TotalPlayers(gameID int64) uint64 {
 	return leaderboard.TotalPlayers(models.AllTime)
 }
 
+// WindowPlayers returns the number of players on the game's board for the
+// window.
+func (ls *Store) WindowPlayers(gameID int64, window models.TimeWindow) uint64 {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return 0
+	}
+	return leaderboard.TotalPlayers(window)
+}
+
+// BoardVersion returns the game's leaderboard version, or 0 if the game is not
+// loaded.
+func (ls *Store) BoardVersion(gameID int64) uint64 {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil {
+		return 0
+	}
+	return leaderboard.Version()
+}
+
 func (ls *Store) InitializeFromDatabase(cfg *config.AppConfig) error {
+	if err := ls.loadGames(); err != nil {
+		return err
+	}
+
 	games, err := ls.db.GetAllGames()
 	if err != nil {
 		return fmt.Errorf("failed to load scores from database: %w", err)
 	}
 
+	if err := ls.loadExcludedAccounts(); err != nil {
+		return err
+	}
+
 	logging.Info("Initializing store with", len(games), "games")
 	for _, gameID := range games {
 		go ls.CacheGameLeaderboard(gameID)
@@ -122,26 +569,108 @@ func (ls *Store) InitializeFromDatabase(cfg *config.AppConfig) error {
 	return nil
 }
 
+// CacheGameLeaderboard warms a game from its latest snapshot plus the Postgres
+// delta after the snapshot's watermark, or from a full row scan when no
+// snapshot is available. Cumulative games are always scanned in full, since
+// replaying the delta would count the submissions at the watermark twice.
 func (ls *Store) CacheGameLeaderboard(gameID int64) error {
-	scores, err := ls.db.GetAllScoresForGame(gameID)
-	if err != nil {
-		return fmt.Errorf("failed to load scores for game %d: %w", gameID, err)
+	var snap *GameSnapshot
+	if scoring, _ := ls.boardScoring(gameID); scoring != models.ScoringCumulative {
+		var err error
+		snap, err = ls.loadSnapshot(gameID)
+		if err != nil {
+			logging.Error("Failed to load snapshot, falling back to full load", "game", gameID, "error", err)
+		}
+	}
+
+	if snap == nil {
+		scores, err := ls.db.GetAllScoresForGame(gameID)
+		if err != nil {
+			return fmt.Errorf("failed to load scores for game %d: %w", gameID, err)
+		}
+
+		if leaderboard := ls.GetOrCreateLeaderboard(gameID); leaderboard != nil {
+			leaderboard.AddScoreBatch(scores)
+		}
+		return nil
 	}
 
 	leaderboard := ls.GetOrCreateLeaderboard(gameID)
-	leaderboard.AddScoreBatch(scores)
+	if leaderboard == nil {
+		return nil
+	}
+	leaderboard.Restore(snap)
+
+	delta, err := ls.db.GetScoresForGameSince(gameID, snap.Watermark)
+	if err != nil {
+		return fmt.Errorf("failed to load score delta for game %d: %w", gameID, err)
+	}
+	leaderboard.AddScoreBatch(delta)
+
+	logging.Info("Warmed game from snapshot", "game", gameID, "watermark", snap.Watermark, "delta", len(delta))
 	return nil
 }
 
-func (ls *Store) CleanOldEntries() {
-	// ls.mu.RLock()
-	// defer ls.mu.RUnlock()
+func (ls *Store) loadSnapshot(gameID int64) (*GameSnapshot, error) {
+	if ls.snapshots == nil {
+		return nil, nil
+	}
+	return ls.snapshots.Load(gameID)
+}
+
+// SaveSnapshots writes a snapshot of every resident game, except cumulative
+// games, which are not warmed from snapshots.
+func (ls *Store) SaveSnapshots() error {
+	if ls.snapshots == nil {
+		return nil
+	}
 
-	for _, leaderboard := range ls.leaderboards {
+	var errs []error
+	for gameID, leaderboard := range ls.residentGames() {
+		if leaderboard.Scoring() == models.ScoringCumulative {
+			continue
+		}
+		if err := ls.snapshots.Save(leaderboard.Snapshot(gameID)); err != nil {
+			errs = append(errs, fmt.Errorf("game %d: %w", gameID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to save snapshots: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (ls *Store) StartPeriodicSnapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := ls.SaveSnapshots(); err != nil {
+				logging.Error("Periodic snapshot failed", "error", err)
+			}
+		}
+	}()
+}
+
+func (ls *Store) CleanOldEntries() {
+	for _, leaderboard := range ls.residentGames() {
 		leaderboard.CleanOldEntries()
 	}
 }
 
+// residentGames snapshots the leaderboards map so callers can walk the games
+// without holding the store lock.
+func (ls *Store) residentGames() map[int64]*GameLeaderboard {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	games := make(map[int64]*GameLeaderboard, len(ls.leaderboards))
+	for gameID, leaderboard := range ls.leaderboards {
+		games[gameID] = leaderboard
+	}
+	return games
+}
+
 func (ls *Store) StartPeriodicCleanup() {
 	ticker := time.NewTicker(5 * time.Minute)
 	go func() {
@@ -152,5 +681,9 @@ func (ls *Store) StartPeriodicCleanup() {
 }
 
 func (ls *Store) Close() {
-	return
+	ls.stopIngestWorkers()
+
+	if err := ls.SaveSnapshots(); err != nil {
+		logging.Error("Failed to snapshot store on close", "error", err)
+	}
 }
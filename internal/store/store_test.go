@@ -1,6 +1,14 @@
 package store
 
 import (
+	"cmp"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,14 +26,14 @@ func TestGameLeaderboard_GetTopK(t *testing.T) {
 	gl.AddScore(3, 200, now)
 	gl.AddScore(4, 50, now)
 
-	topKAll := gl.GetTopK(2, models.AllTime)
+	topKAll := gl.GetTopK(2, 0, models.AllTime)
 	assert.Equal(t, 2, len(topKAll))
 	assert.Equal(t, int64(2), topKAll[0].UserID)
 	assert.Equal(t, uint64(300), topKAll[0].Score)
 	assert.Equal(t, int64(3), topKAll[1].UserID)
 	assert.Equal(t, uint64(200), topKAll[1].Score)
 
-	topK24h := gl.GetTopK(2, models.Last24Hours)
+	topK24h := gl.GetTopK(2, 0, models.Last24Hours)
 	assert.Equal(t, 2, len(topK24h))
 	assert.Equal(t, int64(2), topK24h[0].UserID)
 	assert.Equal(t, uint64(300), topK24h[0].Score)
@@ -77,13 +85,13 @@ func TestLeaderboardStore(t *testing.T) {
 	store.AddScore(score3)
 
 	// Test top leaders for game 1
-	leaders1 := store.GetTopLeaders(1, 10, models.AllTime)
+	leaders1 := store.GetTopLeaders(1, 10, 0, models.AllTime)
 	assert.Equal(t, 2, len(leaders1))
 	assert.Equal(t, int64(2), leaders1[0].UserID)
 	assert.Equal(t, uint64(200), leaders1[0].Score)
 
 	// Test top leaders for game 2
-	leaders2 := store.GetTopLeaders(2, 10, models.AllTime)
+	leaders2 := store.GetTopLeaders(2, 10, 0, models.AllTime)
 	assert.Equal(t, 1, len(leaders2))
 	assert.Equal(t, int64(1), leaders2[0].UserID)
 	assert.Equal(t, uint64(300), leaders2[0].Score)
@@ -101,3 +109,1324 @@ func TestLeaderboardStore(t *testing.T) {
 	assert.Equal(t, uint64(1), store.TotalPlayers(2))
 	assert.Equal(t, uint64(0), store.TotalPlayers(99)) // Non-existent game
 }
+
+func TestGameLeaderboard_SnapshotPlusDeltaMatchesRebuild(t *testing.T) {
+	now := time.Now().UTC()
+	scores := []models.Score{
+		{UserID: 1, Score: 500, Timestamp: now.Add(-100 * time.Hour)},
+		{UserID: 2, Score: 300, Timestamp: now.Add(-50 * time.Hour)},
+		{UserID: 3, Score: 250, Timestamp: now.Add(-10 * time.Hour)},
+		{UserID: 1, Score: 200, Timestamp: now.Add(-5 * time.Hour)},
+		{UserID: 4, Score: 400, Timestamp: now.Add(-3 * time.Hour)},
+		{UserID: 2, Score: 350, Timestamp: now.Add(-2 * time.Hour)},
+		{UserID: 5, Score: 100, Timestamp: now.Add(-1 * time.Hour)},
+		{UserID: 3, Score: 600, Timestamp: now},
+	}
+
+	rebuilt := NewGameLeaderboard()
+	rebuilt.AddScoreBatch(scores)
+
+	// Snapshot the board after the first half of the history.
+	partial := NewGameLeaderboard()
+	partial.AddScoreBatch(scores[:4])
+
+	snapshots, err := NewSnapshotStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, snapshots.Save(partial.Snapshot(1)))
+
+	snap, err := snapshots.Load(1)
+	assert.NoError(t, err)
+	assert.Equal(t, scores[3].Timestamp.UnixNano(), snap.Watermark.UnixNano())
+
+	var delta []models.Score
+	for _, score := range scores {
+		if !score.Timestamp.Before(snap.Watermark) {
+			delta = append(delta, score)
+		}
+	}
+
+	restored := NewGameLeaderboard()
+	restored.Restore(snap)
+	restored.AddScoreBatch(delta)
+
+	for _, window := range models.AllTimeWindows() {
+		assert.Equal(t, rebuilt.GetTopK(100, 0, window), restored.GetTopK(100, 0, window), window.Display)
+		assert.Equal(t, rebuilt.Sketch(window), restored.Sketch(window), window.Display)
+	}
+	assert.Equal(t, rebuilt.Watermark(), restored.Watermark())
+
+	missing, err := snapshots.Load(2)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func mixedGameBatch(games, perGame int, now time.Time) []models.Score {
+	scores := make([]models.Score, 0, games*perGame)
+	for i := range perGame {
+		for gameID := range games {
+			scores = append(scores, models.Score{
+				GameID:    int64(gameID + 1),
+				UserID:    int64(i%500 + 1),
+				Score:     uint64((i * 7919) % 100000),
+				Timestamp: now.Add(-time.Duration(i) * time.Minute),
+			})
+		}
+	}
+	return scores
+}
+
+func TestStore_SaveScoreBatchWithIngestWorkers(t *testing.T) {
+	scores := mixedGameBatch(8, 200, time.Now().UTC())
+
+	inline := NewStore(nil)
+	assert.NoError(t, inline.SaveScoreBatch(scores))
+
+	sharded := NewStore(nil)
+	sharded.StartIngestWorkers(4)
+	assert.NoError(t, sharded.SaveScoreBatch(scores))
+	sharded.Close()
+
+	for gameID := int64(1); gameID <= 8; gameID++ {
+		for _, window := range models.AllTimeWindows() {
+			assert.Equal(t, inline.GetTopLeaders(gameID, 50, 0, window), sharded.GetTopLeaders(gameID, 50, 0, window))
+		}
+	}
+
+	// Batches after Close are still applied, just inline.
+	assert.NoError(t, sharded.SaveScoreBatch([]models.Score{{GameID: 99, UserID: 1, Score: 1, Timestamp: time.Now().UTC()}}))
+	assert.Equal(t, uint64(1), sharded.TotalPlayers(99))
+}
+
+func TestStore_SaveScoreBatchIsolatesRejectedScores(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+
+	batch := []models.Score{
+		{GameID: 1, UserID: 1, Score: 100, Timestamp: now},
+		{GameID: 0, UserID: 2, Score: 900, Timestamp: now},
+		{GameID: 2, UserID: 1, Score: 300, Timestamp: now},
+		{GameID: 1, UserID: -5, Score: 800, Timestamp: now},
+		{GameID: 1, UserID: 3, Score: 200, Timestamp: now},
+		{GameID: 3, UserID: 1, Score: 50},
+	}
+
+	err := store.SaveScoreBatch(batch)
+
+	var batchErr *BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 3, len(batchErr.Rejected))
+	assert.Equal(t, batch[1], batchErr.Rejected[0].Score)
+	assert.Equal(t, batch[3], batchErr.Rejected[1].Score)
+	assert.Equal(t, batch[5], batchErr.Rejected[2].Score)
+	for _, rejected := range batchErr.Rejected {
+		assert.Error(t, rejected.Reason)
+	}
+
+	// The valid scores landed despite the rejected ones.
+	leaders := store.GetTopLeaders(1, 10, 0, models.AllTime)
+	assert.Equal(t, 2, len(leaders))
+	assert.Equal(t, int64(3), leaders[0].UserID)
+	assert.Equal(t, int64(1), leaders[1].UserID)
+	assert.Equal(t, uint64(1), store.TotalPlayers(2))
+	assert.Equal(t, uint64(0), store.TotalPlayers(3))
+
+	assert.NoError(t, store.SaveScoreBatch(batch[:1]))
+}
+
+func TestStore_RegisteredGames(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	low, high := uint64(10), uint64(1000)
+
+	// Unregistered games are accepted until registration is required.
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 5, Timestamp: now}))
+	store.RequireRegisteredGames(true)
+	assert.ErrorIs(t, store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 50, Timestamp: now}), ErrGameNotFound)
+	assert.Nil(t, store.GetOrCreateLeaderboard(2))
+	assert.NotNil(t, store.GetOrCreateLeaderboard(1)) // existing boards stay
+	assert.ErrorIs(t, store.SetExcluded(2, 1, true), ErrGameNotFound)
+
+	game, created, err := store.RegisterGame(models.Game{GameID: 2, Name: "Racer", SortOrder: models.SortDescending, MinScore: &low, MaxScore: &high})
+	assert.NoError(t, err)
+	assert.True(t, created)
+	_, created, err = store.RegisterGame(game)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	err = store.SaveScoreBatch([]models.Score{
+		{GameID: 2, UserID: 1, Score: 50, Timestamp: now},
+		{GameID: 2, UserID: 2, Score: 5, Timestamp: now},
+		{GameID: 2, UserID: 3, Score: 5000, Timestamp: now},
+		{GameID: 3, UserID: 1, Score: 50, Timestamp: now},
+	})
+	var batchErr *BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Rejected, 3)
+	assert.ErrorIs(t, batchErr.Rejected[0].Reason, ErrScoreOutOfRange)
+	assert.ErrorIs(t, batchErr.Rejected[2].Reason, ErrGameNotFound)
+	assert.Equal(t, uint64(1), store.TotalPlayers(2))
+	assert.Nil(t, store.GetLeaderboard(3))
+
+	games := store.RegisteredGames()
+	assert.Len(t, games, 1)
+	assert.Equal(t, "Racer", games[0].Name)
+}
+
+func TestStore_CumulativeScoring(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	clock = func() time.Time { return start }
+
+	store := NewStore(nil)
+	_, _, err := store.RegisterGame(models.Game{GameID: 1, Name: "Quest", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+
+	// Every submission adds to the total, lower ones included.
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: start.Add(-30 * time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 40, Timestamp: start.Add(-time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 120, Timestamp: start.Add(-time.Hour)})
+
+	top := store.GetTopLeaders(1, 10, 0, models.AllTime)
+	assert.Equal(t, []int64{1, 2}, []int64{top[0].UserID, top[1].UserID})
+	assert.Equal(t, uint64(140), top[0].Score)
+	top = store.GetTopLeaders(1, 10, 0, models.Last24Hours)
+	assert.Equal(t, []int64{2, 1}, []int64{top[0].UserID, top[1].UserID})
+	assert.Equal(t, uint64(40), top[1].Score)
+
+	// Totals stop at the largest uint64 rather than wrapping.
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: math.MaxUint64 - 10, Timestamp: start})
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 20, Timestamp: start})
+	_, _, score, _, _ := store.GetPlayerRank(1, 3, models.AllTime)
+	assert.Equal(t, uint64(math.MaxUint64), score)
+
+	// A day later the last hour's submissions have left the 24h window, and
+	// once the first one leaves the 3d window only the later one counts there.
+	clock = func() time.Time { return start.Add(24 * time.Hour) }
+	store.CleanOldEntries()
+	top = store.GetTopLeaders(1, 10, 0, models.Last24Hours)
+	assert.Len(t, top, 1)
+	assert.Equal(t, int64(3), top[0].UserID)
+	_, _, score, _, _ = store.GetPlayerRank(1, 1, models.Last3Days)
+	assert.Equal(t, uint64(140), score)
+
+	clock = func() time.Time { return start.Add(43 * time.Hour) }
+	store.CleanOldEntries()
+	_, _, score, _, _ = store.GetPlayerRank(1, 1, models.Last3Days)
+	assert.Equal(t, uint64(40), score)
+	_, _, score, _, _ = store.GetPlayerRank(1, 1, models.AllTime)
+	assert.Equal(t, uint64(140), score)
+	assert.NoError(t, store.GetLeaderboard(1).CheckWindows())
+
+	// Scoring only changes while the board is empty.
+	_, _, err = store.RegisterGame(models.Game{GameID: 1, Name: "Quest", SortOrder: models.SortDescending, Scoring: models.ScoringBest})
+	assert.ErrorIs(t, err, ErrScoringChanged)
+	store.GetOrCreateLeaderboard(2)
+	_, _, err = store.RegisterGame(models.Game{GameID: 2, Name: "Grind", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScoringCumulative, store.GetLeaderboard(2).Scoring())
+}
+
+func TestStore_CustomWindows(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	clock = func() time.Time { return start }
+	window := models.WindowOfHours(48)
+
+	store := NewStore(nil)
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: start.Add(-60 * time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 300, Timestamp: start.Add(-30 * time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 100, Timestamp: start.Add(-time.Hour)})
+
+	top := store.GetTopLeaders(1, 10, 0, window)
+	assert.Equal(t, []int64{2, 3}, []int64{top[0].UserID, top[1].UserID})
+	assert.Equal(t, uint64(2), store.WindowPlayers(1, window))
+
+	// The built board is reused for a while, then rebuilt.
+	store.AddScore(models.Score{GameID: 1, UserID: 4, Score: 200, Timestamp: start})
+	assert.Len(t, store.GetTopLeaders(1, 10, 0, window), 2)
+	clock = func() time.Time { return start.Add(customWindowTTL) }
+	assert.Len(t, store.GetTopLeaders(1, 10, 0, window), 3)
+
+	// A cumulative game sums the hours inside the window.
+	_, _, err := store.RegisterGame(models.Game{GameID: 2, Name: "Grind", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 100, Timestamp: start.Add(-60 * time.Hour)})
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 40, Timestamp: start.Add(-30 * time.Hour)})
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 2, Timestamp: start})
+	_, _, score, _, _ := store.GetPlayerRank(2, 1, window)
+	assert.Equal(t, uint64(42), score)
+	_, _, score, _, _ = store.GetPlayerRank(2, 1, models.WindowOfHours(30*24))
+	assert.Equal(t, uint64(142), score)
+}
+
+func TestStore_IncrementScore(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	_, err := store.IncrementScore(models.Score{GameID: 1, UserID: 1, Score: 5, Timestamp: now})
+	assert.ErrorIs(t, err, ErrNotCumulative)
+
+	_, _, err = store.RegisterGame(models.Game{GameID: 2, Name: "Grind", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 500, Timestamp: now})
+
+	// Concurrent increments for one player each see a total of their own.
+	var wg sync.WaitGroup
+	totals := make(chan uint64, 400)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				rank, err := store.IncrementScore(models.Score{GameID: 2, UserID: 2, Score: 2, Timestamp: now})
+				assert.NoError(t, err)
+				totals <- rank.Score
+			}
+		}()
+	}
+	wg.Wait()
+	close(totals)
+
+	seen := make(map[uint64]bool)
+	for total := range totals {
+		seen[total] = true
+	}
+	assert.Len(t, seen, 400)
+	assert.True(t, seen[800])
+
+	rank, err := store.IncrementScore(models.Score{GameID: 2, UserID: 1, Score: 1, Timestamp: now})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(501), rank.Score)
+	assert.Equal(t, uint64(2), rank.Rank)
+	assert.Equal(t, uint64(2), rank.Total)
+}
+
+func TestStore_ApplySubmission(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+
+	result, err := store.ApplySubmission(models.Score{GameID: 1, UserID: 2, Score: 150, Timestamp: now})
+	assert.NoError(t, err)
+	assert.True(t, result.Improved)
+	assert.Equal(t, uint64(1), result.Rank)
+	assert.Equal(t, uint64(2), store.TotalPlayers(1))
+
+	_, err = store.ApplySubmission(models.Score{GameID: 0, UserID: 2, Score: 150, Timestamp: now})
+	assert.Error(t, err)
+
+	// A cumulative total is projected, leaving the score to the consumer.
+	_, _, err = store.RegisterGame(models.Game{GameID: 2, Name: "Grind", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 2, UserID: 2, Score: 60, Timestamp: now})
+
+	result, err = store.ApplySubmission(models.Score{GameID: 2, UserID: 2, Score: 50, Timestamp: now})
+	assert.NoError(t, err)
+	assert.Equal(t, PlayerRank{UserID: 2, Rank: 1, Percentile: 100, Score: 110, Total: 2, Found: true}, result.PlayerRank)
+	_, _, score, _, _ := store.GetPlayerRank(2, 2, models.AllTime)
+	assert.Equal(t, uint64(60), score)
+
+	result, err = store.ApplySubmission(models.Score{GameID: 2, UserID: 3, Score: 10, Timestamp: now})
+	assert.NoError(t, err)
+	assert.Equal(t, PlayerRank{UserID: 3, Rank: 3, Percentile: 100.0 / 3, Score: 10, Total: 3, Found: true}, result.PlayerRank)
+}
+
+func TestJumpHash(t *testing.T) {
+	moved := 0
+	for gameID := uint64(0); gameID < 10000; gameID++ {
+		shard := jumpHash(gameID, 8)
+		assert.True(t, shard >= 0 && shard < 8)
+		assert.Equal(t, shard, jumpHash(gameID, 8))
+
+		if jumpHash(gameID, 9) != shard {
+			moved++
+		}
+	}
+	// Growing from 8 to 9 workers should move roughly 1/9 of the games.
+	assert.InDelta(t, 10000/9, moved, 300)
+}
+
+func BenchmarkStore_SaveScoreBatchMixedGames(b *testing.B) {
+	scores := mixedGameBatch(16, 5000, time.Now().UTC())
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				store := NewStore(nil)
+				store.StartIngestWorkers(workers)
+				store.SaveScoreBatch(scores)
+				store.stopIngestWorkers()
+			}
+		})
+	}
+}
+
+func TestStore_CompactRemovesExpiredEntries(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	start := time.Now().UTC()
+	clock = func() time.Time { return start }
+
+	store := NewStore(nil)
+	for userID := int64(1); userID <= 10; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID), Timestamp: start.Add(-time.Hour)})
+	}
+	store.GetOrCreateLeaderboard(2) // resident but never received a score
+
+	before := store.Report()
+	assert.Equal(t, 2, before.Games)
+	assert.Equal(t, uint64(10), before.Entries[models.Last24Hours.Display])
+
+	// Two days later the scores have left the 24h window but not the others.
+	clock = func() time.Time { return start.Add(48 * time.Hour) }
+	report := store.Compact(false)
+
+	assert.Equal(t, uint64(10), report.Before.Entries[models.Last24Hours.Display])
+	assert.Equal(t, uint64(0), report.After.Entries[models.Last24Hours.Display])
+	assert.Equal(t, uint64(10), report.After.Entries[models.Last3Days.Display])
+	assert.Equal(t, uint64(10), report.After.Entries[models.AllTime.Display])
+	assert.Equal(t, uint64(10), report.RemovedEntries)
+	assert.Equal(t, 1, report.PrunedGames)
+	assert.Equal(t, 1, report.After.Games)
+	assert.Less(t, report.After.EstimatedBytes, report.Before.EstimatedBytes)
+}
+
+func TestStore_GameReports(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 10, Timestamp: now})
+	for userID := int64(1); userID <= 3; userID++ {
+		store.AddScore(models.Score{GameID: 2, UserID: userID, Score: 10, Timestamp: now})
+	}
+
+	reports := store.GameReports()
+	assert.Len(t, reports, 2)
+	assert.Equal(t, int64(2), reports[0].GameID)
+	assert.Equal(t, uint64(3), reports[0].Entries[models.AllTime.Display])
+	assert.Equal(t, uint64(1), reports[1].Entries[models.Last24Hours.Display])
+	assert.Equal(t, store.Report().EstimatedBytes, reports[0].EstimatedBytes+reports[1].EstimatedBytes)
+}
+
+func TestActivityTracker_RecentSubmissionRate(t *testing.T) {
+	tracker := NewActivityTracker(10, 4)
+	start := time.Now().UTC()
+
+	// Six submissions ten seconds apart; only the last four are remembered.
+	for i := range 6 {
+		tracker.Record(models.Score{GameID: 1, UserID: 7, Score: uint64(100 + i*10)}, start.Add(time.Duration(i)*10*time.Second))
+	}
+	tracker.Record(models.Score{GameID: 1, UserID: 7, Score: 50}, start.Add(60*time.Second))
+
+	activity, ok := tracker.Lookup(1, 7)
+	assert.True(t, ok)
+	assert.Equal(t, 4, len(activity.Recent))
+	assert.Equal(t, start.Add(30*time.Second), activity.Recent[0])
+	assert.Equal(t, start.Add(60*time.Second), activity.Recent[3])
+	assert.Equal(t, uint64(150), activity.Best)
+
+	now := start.Add(60 * time.Second)
+	assert.Equal(t, 4, activity.CountSince(now.Add(-time.Minute)))
+	assert.Equal(t, 2, activity.CountSince(now.Add(-15*time.Second)))
+
+	// The same user in another game is tracked separately.
+	_, ok = tracker.Lookup(2, 7)
+	assert.False(t, ok)
+}
+
+func TestActivityTracker_EvictsLeastRecentlyActive(t *testing.T) {
+	tracker := NewActivityTracker(3, 2)
+	now := time.Now().UTC()
+
+	for userID := int64(1); userID <= 3; userID++ {
+		tracker.Record(models.Score{GameID: 1, UserID: userID, Score: 10}, now)
+	}
+	// User 1 submits again, so user 2 is now the least recently active.
+	tracker.Record(models.Score{GameID: 1, UserID: 1, Score: 20}, now)
+	tracker.Record(models.Score{GameID: 1, UserID: 4, Score: 10}, now)
+
+	_, ok := tracker.Lookup(1, 2)
+	assert.False(t, ok)
+	for _, userID := range []int64{1, 3, 4} {
+		_, ok := tracker.Lookup(1, userID)
+		assert.True(t, ok, userID)
+	}
+
+	stats := tracker.Stats()
+	assert.Equal(t, 3, stats.Players)
+	assert.Equal(t, uint64(1), stats.Evictions)
+}
+
+func TestStore_RecordsActivity(t *testing.T) {
+	store := NewStore(nil)
+	_, ok := store.Activity(1, 1)
+	assert.False(t, ok)
+	assert.Nil(t, store.Report().Activity)
+
+	store.EnableActivityTracking(100, 8)
+	now := time.Now().UTC()
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 300, Timestamp: now}))
+	assert.NoError(t, store.SaveScoreBatch([]models.Score{
+		{GameID: 1, UserID: 1, Score: 200, Timestamp: now},
+		{GameID: 2, UserID: 1, Score: 100, Timestamp: now},
+	}))
+
+	activity, ok := store.Activity(1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(activity.Recent))
+	assert.Equal(t, uint64(300), activity.Best)
+	assert.Equal(t, 2, store.Report().Activity.Players)
+}
+
+func TestGameLeaderboard_ExcludedAccounts(t *testing.T) {
+	gl := NewGameLeaderboard()
+	now := time.Now().UTC()
+
+	// Seed accounts 101 and 102 hold the top spots, 103 is mid-table.
+	gl.AddScore(101, 1000, now)
+	gl.AddScore(102, 900, now)
+	gl.AddScore(1, 800, now)
+	gl.AddScore(2, 700, now)
+	gl.AddScore(103, 600, now)
+	gl.AddScore(3, 500, now)
+
+	version := gl.Version()
+	for _, userID := range []int64{101, 102, 103, 999} {
+		gl.SetExcluded(userID, true)
+	}
+	assert.Greater(t, gl.Version(), version)
+	assert.Equal(t, []int64{101, 102, 103, 999}, gl.ExcludedAccounts())
+
+	top := gl.GetTopK(10, 0, models.AllTime)
+	assert.Equal(t, []models.LeaderboardEntry{
+		{UserID: 1, Score: 800, Rank: 1},
+		{UserID: 2, Score: 700, Rank: 2},
+		{UserID: 3, Score: 500, Rank: 3},
+	}, top)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 3, Score: 500, Rank: 3}}, gl.GetTopK(5, 2, models.AllTime))
+	assert.Equal(t, uint64(3), gl.TotalPlayers(models.AllTime))
+
+	rank, percentile, _, total, found := gl.GetRankAndPercentile(3, models.AllTime)
+	assert.True(t, found)
+	assert.Equal(t, uint64(3), rank)
+	assert.Equal(t, uint64(3), total)
+	assert.InDelta(t, 100.0/3, percentile, 0.1)
+
+	// An excluded account still sees its place on the full board.
+	rank, _, _, total, found = gl.GetRankAndPercentile(102, models.AllTime)
+	assert.True(t, found)
+	assert.Equal(t, uint64(2), rank)
+	assert.Equal(t, uint64(6), total)
+
+	gl.SetExcluded(101, false)
+	rank, _, _, _, _ = gl.GetRankAndPercentile(1, models.AllTime)
+	assert.Equal(t, uint64(2), rank)
+	assert.Equal(t, uint64(4), gl.TotalPlayers(models.AllTime))
+	assert.False(t, gl.IsEmpty())
+}
+
+func TestScoreDistribution_PercentileAccuracy(t *testing.T) {
+	// Skewed scores with plenty of ties, in rank order as a snapshot holds them.
+	var scores []models.Score
+	for i := range 50000 {
+		scores = append(scores, models.Score{UserID: int64(i + 1), Score: uint64((i * i) % 9973)})
+	}
+	slices.SortFunc(scores, func(a, b models.Score) int { return cmp.Compare(b.Score, a.Score) })
+
+	distribution := newScoreDistribution(scores)
+	assert.Equal(t, distributionPoints, len(distribution.Points))
+
+	exact := func(score uint64) float64 {
+		atOrBelow := 0
+		for _, s := range scores {
+			if s.Score <= score {
+				atOrBelow++
+			}
+		}
+		return 100.0 * float64(atOrBelow) / float64(len(scores))
+	}
+
+	bound := 50.0 / (distributionPoints - 1)
+	for _, score := range []uint64{0, 1, 17, 500, 2500, 4986, 7000, 9900, 9972, 20000} {
+		assert.InDelta(t, exact(score), distribution.Percentile(score), bound, "score %d", score)
+	}
+
+	small := newScoreDistribution(scores[:10])
+	assert.Equal(t, 10, len(small.Points))
+	assert.Equal(t, 100.0, small.Percentile(scores[0].Score))
+}
+
+func TestStore_HistoricalPercentile(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return start }
+
+	snapshots, err := NewSnapshotStore(t.TempDir())
+	assert.NoError(t, err)
+
+	store := NewStore(nil)
+	store.SetSnapshotStore(snapshots)
+	for userID := int64(1); userID <= 4; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 100), Timestamp: start})
+	}
+	assert.NoError(t, store.SaveSnapshots())
+
+	// A day later the board has moved on and a new snapshot is taken.
+	clock = func() time.Time { return start.Add(24 * time.Hour) }
+	for userID := int64(5); userID <= 8; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 100), Timestamp: start.Add(24 * time.Hour)})
+	}
+	assert.NoError(t, store.SaveSnapshots())
+
+	response, err := store.HistoricalPercentile(1, 300, start.Add(time.Hour), models.AllTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 75.0, response.Percentile)
+	assert.Equal(t, uint64(4), response.TotalPlayers)
+	assert.Equal(t, start, response.SnapshotAt)
+
+	response, err = store.HistoricalPercentile(1, 300, start.Add(48*time.Hour), models.AllTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 37.5, response.Percentile)
+
+	_, err = store.HistoricalPercentile(1, 300, start.Add(-time.Hour), models.AllTime)
+	var noHistory *NoHistoryError
+	assert.ErrorAs(t, err, &noHistory)
+	assert.Equal(t, []time.Time{start, start.Add(24 * time.Hour)}, noHistory.Nearest)
+}
+
+func TestQuantileSketch_Accuracy(t *testing.T) {
+	datasets := map[string]func(i int) uint64{
+		"uniform":      func(i int) uint64 { return uint64(i*7919) % 1000000 },
+		"skewed ties":  func(i int) uint64 { return uint64((i * i) % 9973) },
+		"heavy tailed": func(i int) uint64 { return uint64(math.Exp(float64(i%4000) / 200)) },
+	}
+
+	for name, score := range datasets {
+		t.Run(name, func(t *testing.T) {
+			sketch := NewQuantileSketch()
+			exact := make([]uint64, 50000)
+			for i := range exact {
+				exact[i] = score(i)
+				sketch.Add(exact[i])
+			}
+			slices.Sort(exact)
+
+			qs := []float64{0, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1}
+			for i, estimate := range sketch.Quantiles(qs) {
+				want := exact[int(qs[i]*float64(len(exact)-1))]
+				// The bucket's score is rounded to an integer, hence the extra 1.
+				assert.InDelta(t, want, estimate, SketchRelativeError*float64(want)+1, "q %v", qs[i])
+			}
+		})
+	}
+}
+
+func TestQuantileSketch_RemoveAndMerge(t *testing.T) {
+	low, high := NewQuantileSketch(), NewQuantileSketch()
+	for i := range 1000 {
+		low.Add(uint64(i))
+		high.Add(uint64(i + 1000))
+	}
+
+	merged := low.Clone()
+	merged.Merge(high)
+	assert.Equal(t, uint64(2000), merged.Count)
+	assert.InDelta(t, 1000, merged.Quantiles([]float64{0.5})[0], 1000*SketchRelativeError+1)
+
+	for i := range 1000 {
+		merged.Remove(uint64(i))
+	}
+	merged.Remove(5000) // never added
+	assert.Equal(t, high, merged)
+}
+
+func TestGameLeaderboard_SketchFollowsBoard(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+
+	start := time.Now().UTC()
+	clock = func() time.Time { return start }
+
+	gl := NewGameLeaderboard()
+	for i := range 500 {
+		gl.AddScore(int64(i%200), uint64(i*37%1000), start.Add(-time.Duration(i)*time.Minute))
+	}
+
+	// Every window's sketch counts exactly the scores left on its board, after
+	// improvements and after entries age out.
+	check := func() {
+		for _, window := range models.AllTimeWindows() {
+			want := NewQuantileSketch()
+			for _, entry := range gl.GetTopK(1000, 0, window) {
+				want.Add(entry.Score)
+			}
+			assert.Equal(t, want, gl.Sketch(window), window.Display)
+		}
+	}
+	check()
+
+	clock = func() time.Time { return start.Add(20 * time.Hour) }
+	gl.CleanOldEntries()
+	check()
+
+	_, count, found := gl.ScoreQuantiles([]float64{0.5}, models.AllTime)
+	assert.True(t, found)
+	assert.Equal(t, uint64(200), count)
+
+	_, _, found = NewGameLeaderboard().ScoreQuantiles([]float64{0.5}, models.AllTime)
+	assert.False(t, found)
+}
+
+func TestGameLeaderboard_ApplyIsAtomicToReaders(t *testing.T) {
+	apply := map[string]func(gl *GameLeaderboard, mutations []Mutation){
+		"in place":      func(gl *GameLeaderboard, mutations []Mutation) { gl.Apply(mutations) },
+		"copy and swap": (*GameLeaderboard).ApplyByCopy,
+	}
+
+	for name, applyFn := range apply {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC()
+			gl := NewGameLeaderboard()
+			gl.AddScore(1, 100, now)
+			gl.AddScore(2, 50, now)
+
+			// Merging player 2 into player 1 and back again: a reader must see
+			// either both players or the merged one, never a half-applied merge.
+			merge := []Mutation{
+				{Op: MutationDelete, UserID: 2},
+				{Op: MutationSet, UserID: 1, Score: 150, Timestamp: now},
+			}
+			split := []Mutation{
+				{Op: MutationSet, UserID: 1, Score: 100, Timestamp: now},
+				{Op: MutationPut, UserID: 2, Score: 50, Timestamp: now},
+			}
+
+			before := []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 2, Score: 50, Rank: 2}}
+			after := []models.LeaderboardEntry{{UserID: 1, Score: 150, Rank: 1}}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for range 200 {
+					applyFn(gl, merge)
+					applyFn(gl, split)
+				}
+			}()
+
+			for reading := true; reading; {
+				select {
+				case <-done:
+					reading = false
+				default:
+				}
+				top := gl.GetTopK(10, 0, models.AllTime)
+				if !assert.True(t, slices.Equal(top, before) || slices.Equal(top, after), "intermediate state %v", top) {
+					return
+				}
+			}
+
+			assert.Equal(t, before, gl.GetTopK(10, 0, models.AllTime))
+		})
+	}
+}
+
+func TestGameLeaderboard_ApplySetAndWindows(t *testing.T) {
+	now := time.Now().UTC()
+	gl := NewGameLeaderboard()
+	gl.AddScore(1, 500, now)
+	gl.AddScore(2, 300, now)
+
+	// Set lowers a score, and a timestamp outside a window takes the player
+	// out of that window.
+	gl.ApplyByCopy([]Mutation{
+		{Op: MutationSet, UserID: 1, Score: 200, Timestamp: now},
+		{Op: MutationSet, UserID: 2, Score: 400, Timestamp: now.Add(-48 * time.Hour)},
+	})
+
+	assert.Equal(t, []models.LeaderboardEntry{
+		{UserID: 2, Score: 400, Rank: 1},
+		{UserID: 1, Score: 200, Rank: 2},
+	}, gl.GetTopK(10, 0, models.AllTime))
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 200, Rank: 1}}, gl.GetTopK(10, 0, models.Last24Hours))
+
+	for _, window := range models.AllTimeWindows() {
+		want := NewQuantileSketch()
+		for _, entry := range gl.GetTopK(10, 0, window) {
+			want.Add(entry.Score)
+		}
+		assert.Equal(t, want, gl.Sketch(window), window.Display)
+	}
+}
+
+func TestStore_EraseUser(t *testing.T) {
+	store := NewStore(nil)
+	store.EnableActivityTracking(10, 4)
+
+	now := time.Now().UTC()
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 7, Score: 100, Timestamp: now}))
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 8, Score: 200, Timestamp: now}))
+	assert.NoError(t, store.AddScore(models.Score{GameID: 2, UserID: 7, Score: 300, Timestamp: now.Add(-48 * time.Hour)}))
+	assert.NoError(t, store.AddScore(models.Score{GameID: 3, UserID: 8, Score: 300, Timestamp: now}))
+	store.GetOrCreateLeaderboard(3).SetExcluded(7, true)
+
+	games, err := store.EraseUser(7)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, games)
+
+	for _, gameID := range []int64{1, 2, 3} {
+		for _, window := range models.AllTimeWindows() {
+			_, _, _, _, found := store.GetPlayerRank(gameID, 7, window)
+			assert.False(t, found)
+		}
+	}
+	assert.Empty(t, store.GetLeaderboard(3).ExcludedAccounts())
+	_, tracked := store.Activity(1, 7)
+	assert.False(t, tracked)
+
+	// Other players are untouched.
+	rank, _, _, total, found := store.GetPlayerRank(1, 8, models.AllTime)
+	assert.True(t, found)
+	assert.Equal(t, uint64(1), rank)
+	assert.Equal(t, uint64(1), total)
+
+	// Erasing again finds nothing left.
+	games, err = store.EraseUser(7)
+	assert.NoError(t, err)
+	assert.Empty(t, games)
+}
+
+func TestStore_ResetGame(t *testing.T) {
+	store := NewStore(nil)
+	store.SetGameShards(map[int64]int{2: 4})
+	now := time.Now().UTC()
+
+	for _, gameID := range []int64{1, 2} {
+		for userID := int64(1); userID <= 20; userID++ {
+			store.AddScore(models.Score{GameID: gameID, UserID: userID, Score: uint64(userID), Timestamp: now})
+		}
+		store.GetOrCreateLeaderboard(gameID).SetExcluded(5, true)
+	}
+
+	version := store.BoardVersion(2)
+	players, deleted, err := store.ResetGame(2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), players)
+	assert.Equal(t, int64(0), deleted)
+
+	// Cache keys must never see an old version again.
+	assert.Greater(t, store.BoardVersion(2), version)
+	for _, window := range models.AllTimeWindows() {
+		assert.Equal(t, uint64(0), store.WindowPlayers(2, window))
+		_, _, found := store.ScoreQuantiles(2, []float64{0.5}, window)
+		assert.False(t, found)
+	}
+	assert.Equal(t, []int64{5}, store.ExcludedAccounts(2))
+	assert.Equal(t, uint64(19), store.TotalPlayers(1))
+
+	store.AddScore(models.Score{GameID: 2, UserID: 7, Score: 1, Timestamp: now})
+	assert.Equal(t, uint64(1), store.TotalPlayers(2))
+
+	// Resetting a game that was never loaded is a no-op.
+	players, _, err = store.ResetGame(3, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), players)
+	assert.Nil(t, store.GetLeaderboard(3))
+}
+
+// shardedPair fills an unsharded and a sharded board with the same scores.
+// Scores repeat but timestamps do not, so both boards order players the same.
+func shardedPair(players int) (*GameLeaderboard, *GameLeaderboard) {
+	single := NewGameLeaderboard()
+	sharded := NewShardedGameLeaderboard(7)
+
+	now := time.Now().UTC()
+	rng := rand.New(rand.NewSource(1))
+	scores := make([]models.Score, players)
+	for i := range scores {
+		scores[i] = models.Score{
+			UserID:    int64(i + 1),
+			Score:     uint64(rng.Intn(players / 4)),
+			Timestamp: now.Add(-time.Duration(i) * time.Minute),
+		}
+	}
+	single.AddScoreBatch(scores)
+	sharded.AddScoreBatch(scores)
+	return single, sharded
+}
+
+func assertSameBoards(t *testing.T, single, sharded *GameLeaderboard, players int) {
+	t.Helper()
+
+	for _, window := range models.AllTimeWindows() {
+		assert.Equal(t, single.TotalPlayers(window), sharded.TotalPlayers(window))
+		assert.Equal(t, single.GetTopK(players, 0, window), sharded.GetTopK(players, 0, window))
+		assert.Equal(t, single.GetTopK(10, 25, window), sharded.GetTopK(10, 25, window))
+		assert.Equal(t, single.Sketch(window), sharded.Sketch(window))
+
+		for userID := int64(1); userID <= int64(players); userID += 7 {
+			r1, p1, s1, t1, f1 := single.GetRankAndPercentile(userID, window)
+			r2, p2, s2, t2, f2 := sharded.GetRankAndPercentile(userID, window)
+			assert.Equal(t, []any{r1, p1, s1, t1, f1}, []any{r2, p2, s2, t2, f2})
+
+			n1, _ := single.GetNeighbors(userID, 3, 2, window)
+			n2, _ := sharded.GetNeighbors(userID, 3, 2, window)
+			assert.Equal(t, n1, n2)
+		}
+
+		for _, rank := range []int{1, 10, players / 2, players + 1} {
+			th1, ties1, total1, found1 := single.GetScoreThreshold(rank, window)
+			th2, ties2, total2, found2 := sharded.GetScoreThreshold(rank, window)
+			assert.Equal(t, []any{th1, ties1, total1, found1}, []any{th2, ties2, total2, found2})
+		}
+		assert.Equal(t, single.RankForScore(uint64(players/8), window), sharded.RankForScore(uint64(players/8), window))
+	}
+}
+
+func TestGameLeaderboard_ShardedMatchesSingleShard(t *testing.T) {
+	const players = 500
+	single, sharded := shardedPair(players)
+	assert.Equal(t, 7, sharded.Shards())
+	assertSameBoards(t, single, sharded, players)
+
+	for _, gl := range []*GameLeaderboard{single, sharded} {
+		gl.SetExcluded(3, true)
+		gl.SetExcluded(250, true)
+	}
+	assertSameBoards(t, single, sharded, players)
+
+	mutations := []Mutation{
+		{Op: MutationDelete, UserID: 10},
+		{Op: MutationSet, UserID: 11, Score: 1, Timestamp: time.Now().UTC()},
+		{Op: MutationPut, UserID: 1000, Score: 400, Timestamp: time.Now().UTC()},
+	}
+	single.Apply(mutations)
+	sharded.ApplyByCopy(mutations)
+	assertSameBoards(t, single, sharded, players)
+
+	// A snapshot of a sharded board restores onto any shard count.
+	restored := NewGameLeaderboard()
+	restored.Restore(sharded.Snapshot(1))
+	restored.SetExcluded(3, true)
+	restored.SetExcluded(250, true)
+	assertSameBoards(t, restored, sharded, players)
+}
+
+func TestGameLeaderboard_ShardedTies(t *testing.T) {
+	single := NewGameLeaderboard()
+	sharded := NewShardedGameLeaderboard(4)
+	now := time.Now().UTC()
+
+	// Players 11 to 40 tie exactly, in entries spread over every shard.
+	for _, gl := range []*GameLeaderboard{single, sharded} {
+		for userID := int64(1); userID <= 40; userID++ {
+			gl.AddScore(userID, uint64(max(100, 111-userID)), now)
+		}
+	}
+
+	top := sharded.GetTopK(40, 0, models.AllTime)
+	assert.Equal(t, 40, len(top))
+	for i, entry := range top {
+		assert.Equal(t, uint64(i+1), entry.Rank)
+
+		want, _, _, _, _ := single.GetRankAndPercentile(entry.UserID, models.AllTime)
+		rank, _, _, _, found := sharded.GetRankAndPercentile(entry.UserID, models.AllTime)
+		assert.True(t, found)
+		assert.Equal(t, want, rank)
+	}
+	rank, _, _, _, _ := sharded.GetRankAndPercentile(40, models.AllTime)
+	assert.Equal(t, uint64(11), rank)
+}
+
+func TestGameLeaderboard_RankModes(t *testing.T) {
+	now := time.Now().UTC()
+	ranks := func(entries []models.LeaderboardEntry) (ranks, tied []uint64) {
+		for _, entry := range entries {
+			ranks = append(ranks, entry.Rank)
+			tied = append(tied, entry.TiedWith)
+		}
+		return ranks, tied
+	}
+
+	// Everyone holds the same score.
+	for _, gl := range []*GameLeaderboard{NewGameLeaderboard(), NewShardedGameLeaderboard(3)} {
+		for userID := int64(1); userID <= 5; userID++ {
+			gl.AddScore(userID, 100, now.Add(time.Duration(userID)*time.Second))
+		}
+
+		got, tied := ranks(gl.GetTopK(5, 0, models.AllTime))
+		assert.Equal(t, []uint64{1, 2, 3, 4, 5}, got)
+		assert.Equal(t, []uint64{4, 4, 4, 4, 4}, tied)
+		for _, mode := range []models.RankMode{models.RankCompetition, models.RankDense} {
+			got, tied = ranks(gl.GetRankedTopK(5, 0, models.AllTime, mode))
+			assert.Equal(t, []uint64{1, 1, 1, 1, 1}, got, mode)
+			assert.Equal(t, []uint64{4, 4, 4, 4, 4}, tied, mode)
+
+			rank := gl.GetPlayerRank(5, models.AllTime, mode)
+			assert.Equal(t, uint64(1), rank.Rank, mode)
+			assert.Equal(t, uint64(4), rank.TiedWith, mode)
+			assert.InDelta(t, 100.0, rank.Percentile, 0.01, mode)
+		}
+		rank := gl.GetPlayerRank(5, models.AllTime, models.RankOrdinal)
+		assert.Equal(t, uint64(5), rank.Rank)
+		assert.InDelta(t, 20.0, rank.Percentile, 0.01)
+	}
+
+	// 300, 200, 200, 200, 100, with excluded accounts holding 250 alone and
+	// 200 alongside the others.
+	for _, gl := range []*GameLeaderboard{NewGameLeaderboard(), NewShardedGameLeaderboard(3)} {
+		gl.AddScore(1, 300, now)
+		for userID := int64(2); userID <= 4; userID++ {
+			gl.AddScore(userID, 200, now.Add(time.Duration(userID)*time.Second))
+		}
+		gl.AddScore(5, 100, now)
+		gl.AddScore(9, 200, now)
+		gl.AddScore(10, 250, now)
+		gl.SetExcluded(9, true)
+		gl.SetExcluded(10, true)
+
+		got, tied := ranks(gl.GetTopK(5, 0, models.AllTime))
+		assert.Equal(t, []uint64{1, 2, 3, 4, 5}, got)
+		assert.Equal(t, []uint64{0, 2, 2, 2, 0}, tied)
+		got, _ = ranks(gl.GetRankedTopK(5, 0, models.AllTime, models.RankCompetition))
+		assert.Equal(t, []uint64{1, 2, 2, 2, 5}, got)
+		got, _ = ranks(gl.GetRankedTopK(5, 0, models.AllTime, models.RankDense))
+		assert.Equal(t, []uint64{1, 2, 2, 2, 3}, got)
+
+		// A page starting mid-tie still ranks its first entry with the tie.
+		got, _ = ranks(gl.GetRankedTopK(2, 3, models.AllTime, models.RankCompetition))
+		assert.Equal(t, []uint64{2, 5}, got)
+
+		rank := gl.GetPlayerRank(5, models.AllTime, models.RankDense)
+		assert.Equal(t, uint64(3), rank.Rank)
+		assert.Equal(t, uint64(0), rank.TiedWith)
+		rank = gl.GetPlayerRank(4, models.AllTime, models.RankCompetition)
+		assert.Equal(t, uint64(2), rank.Rank)
+		assert.Equal(t, uint64(2), rank.TiedWith)
+		assert.InDelta(t, 80.0, rank.Percentile, 0.01)
+
+		// Improving a score moves it between ties.
+		gl.AddScore(5, 200, now.Add(time.Minute))
+		rank = gl.GetPlayerRank(5, models.AllTime, models.RankDense)
+		assert.Equal(t, uint64(2), rank.Rank)
+		assert.Equal(t, uint64(3), rank.TiedWith)
+		rank = gl.GetPlayerRank(1, models.AllTime, models.RankDense)
+		assert.Equal(t, uint64(1), rank.Rank)
+		assert.Equal(t, uint64(0), rank.TiedWith)
+	}
+}
+
+func TestGameLeaderboard_GetPlayerRankWithNeighbors(t *testing.T) {
+	gl := NewGameLeaderboard()
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 6; userID++ {
+		gl.AddScore(userID, uint64(700-100*userID), now)
+	}
+	gl.AddScore(99, 450, now)
+	gl.SetExcluded(99, true)
+
+	ids := func(entries []models.LeaderboardEntry) []int64 {
+		var ids []int64
+		for _, entry := range entries {
+			ids = append(ids, entry.UserID)
+		}
+		return ids
+	}
+
+	rank, above, below := gl.GetPlayerRankWithNeighbors(4, 2, models.AllTime, models.RankOrdinal)
+	assert.True(t, rank.Found)
+	assert.Equal(t, uint64(4), rank.Rank)
+	assert.Equal(t, []int64{2, 3}, ids(above))
+	assert.Equal(t, []int64{5, 6}, ids(below))
+	assert.Equal(t, uint64(3), above[1].Rank)
+	assert.Equal(t, uint64(5), below[0].Rank)
+
+	// Near the ends the lists are shorter.
+	_, above, below = gl.GetPlayerRankWithNeighbors(1, 2, models.AllTime, models.RankOrdinal)
+	assert.Empty(t, above)
+	assert.Equal(t, []int64{2, 3}, ids(below))
+
+	// Without neighbors only the rank is read.
+	rank, above, below = gl.GetPlayerRankWithNeighbors(6, 0, models.AllTime, models.RankOrdinal)
+	assert.Equal(t, uint64(6), rank.Rank)
+	assert.Nil(t, above)
+	assert.Nil(t, below)
+
+	rank, above, below = gl.GetPlayerRankWithNeighbors(42, 2, models.AllTime, models.RankOrdinal)
+	assert.False(t, rank.Found)
+	assert.Nil(t, above)
+	assert.Nil(t, below)
+}
+
+func TestStore_SetGameShards(t *testing.T) {
+	shards, err := ParseGameShards("42:16, 7:4")
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int{42: 16, 7: 4}, shards)
+
+	for _, spec := range []string{"42", "x:4", "42:0", "42:y"} {
+		_, err := ParseGameShards(spec)
+		assert.Error(t, err, spec)
+	}
+
+	store := NewStore(nil)
+	store.SetGameShards(shards)
+	assert.Equal(t, 16, store.GetOrCreateLeaderboard(42).Shards())
+	assert.Equal(t, 1, store.GetOrCreateLeaderboard(1).Shards())
+}
+
+func TestGameLeaderboard_ValidateAndCheckWindows(t *testing.T) {
+	now := time.Now().UTC()
+	build := func() *GameLeaderboard {
+		gl := NewShardedGameLeaderboard(4)
+		for i := int64(1); i <= 200; i++ {
+			gl.AddScore(i, uint64(i*37%500), now.Add(-time.Duration(i)*time.Hour))
+		}
+		return gl
+	}
+
+	gl := build()
+	assert.NoError(t, gl.Validate())
+	assert.NoError(t, gl.CheckWindows())
+
+	// A player dropped from a longer window while still in a shorter one.
+	gl = build()
+	gl.getLeaderboard(models.Last7Days).remove(5)
+	assert.ErrorContains(t, gl.CheckWindows(), "1 players in the 3d window")
+	assert.NoError(t, gl.Validate())
+
+	// A better score in a shorter window than in the longer ones.
+	gl = build()
+	gl.getLeaderboard(models.Last24Hours).put(3, models.Score{UserID: 3, Score: 10_000, Timestamp: now})
+	assert.ErrorContains(t, gl.CheckWindows(), "user 3")
+
+	// A player on the wrong shard.
+	gl = build()
+	all := gl.getLeaderboard(models.AllTime)
+	wrong := (shardIndex(7, len(all.shards)) + 1) % len(all.shards)
+	all.shards[wrong].put(7, models.Score{UserID: 7, Score: 1, Timestamp: now})
+	assert.ErrorContains(t, gl.Validate(), "user 7 is on shard")
+}
+
+func TestStore_SampleScores(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	for i := int64(1); i <= 100; i++ {
+		store.AddScore(models.Score{GameID: 1, UserID: i, Score: uint64(i), Timestamp: now})
+	}
+
+	sample := store.SampleScores(1, 10)
+	assert.Len(t, sample, 10)
+	assert.Equal(t, uint64(100), sample[0].Score)
+	assert.Equal(t, uint64(10), sample[9].Score)
+
+	assert.Len(t, store.SampleScores(1, 500), 100)
+	assert.Nil(t, store.SampleScores(2, 10))
+}
+
+func TestStore_Subscribe(t *testing.T) {
+	store := NewStore(nil)
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 50, Timestamp: now})
+
+	next := func(ch <-chan []models.LeaderboardEntry) []models.LeaderboardEntry {
+		select {
+		case top := <-ch:
+			return top
+		case <-time.After(time.Second):
+			t.Fatal("no list received")
+			return nil
+		}
+	}
+	quiet := func(ch <-chan []models.LeaderboardEntry) {
+		select {
+		case top := <-ch:
+			t.Fatalf("unexpected list %v", top)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	ch, cancel := store.Subscribe(1, 2, models.AllTime)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 2, Score: 50, Rank: 2}}, next(ch))
+
+	// Changes below the top 2 are not sent.
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 10, Timestamp: now})
+	quiet(ch)
+
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 70, Timestamp: now})
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 3, Score: 70, Rank: 2}}, next(ch))
+
+	// A second subscriber gets the current list without resending it to the
+	// first.
+	other, cancelOther := store.Subscribe(1, 2, models.AllTime)
+	assert.Equal(t, int64(3), next(other)[1].UserID)
+	quiet(ch)
+
+	// A reader that is not reading only gets the latest list.
+	for score := uint64(200); score < 210; score++ {
+		store.AddScore(models.Score{GameID: 1, UserID: 4, Score: score, Timestamp: now})
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, models.LeaderboardEntry{UserID: 4, Score: 209, Rank: 1}, next(ch)[0])
+	quiet(ch)
+	assert.Equal(t, uint64(209), next(other)[0].Score)
+
+	// Exclusions change the list too.
+	store.SetExcluded(1, 4, true)
+	assert.Equal(t, int64(1), next(ch)[0].UserID)
+
+	cancel()
+	_, open := <-ch
+	assert.False(t, open)
+	cancelOther()
+	cancelOther()
+
+	store.feedsMu.RLock()
+	assert.Empty(t, store.feeds)
+	store.feedsMu.RUnlock()
+}
+
+func TestStore_OnTopChange(t *testing.T) {
+	store := NewStore(nil)
+	var changes []TopChange
+	store.OnTopChange(2, func(change TopChange) { changes = append(changes, change) })
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	assert.Len(t, changes, models.LeaderboardIndexCount)
+	assert.Empty(t, changes[0].Before)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}}, changes[0].After)
+
+	// Old scores only change the all-time window, and changes below the top
+	// 2 are not reported.
+	changes = nil
+	store.SaveScoreBatch([]models.Score{
+		{GameID: 1, UserID: 2, Score: 150, Timestamp: now.AddDate(0, 0, -10)},
+		{GameID: 1, UserID: 3, Score: 50, Timestamp: now.AddDate(0, 0, -10)},
+	})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, models.AllTime, changes[0].Window)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}}, changes[0].Before)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 2, Score: 150, Rank: 1}, {UserID: 1, Score: 100, Rank: 2}}, changes[0].After)
+
+	changes = nil
+	store.AddScore(models.Score{GameID: 1, UserID: 4, Score: 10, Timestamp: now.AddDate(0, 0, -10)})
+	assert.Empty(t, changes)
+
+	// Hidden games are not watched.
+	store.HideGame(2)
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 100, Timestamp: now})
+	assert.Empty(t, changes)
+}
+
+var benchEntries = flag.Int("entries", 10_000_000, "players preloaded by BenchmarkGameLeaderboard_ConcurrentInsert")
+
+// BenchmarkGameLeaderboard_ConcurrentInsert inserts new players from every
+// CPU into a board already holding -entries players. Scores are old enough to
+// land on the all-time window only. Each board is loaded once and keeps
+// growing across runs.
+func BenchmarkGameLeaderboard_ConcurrentInsert(b *testing.B) {
+	old := time.Now().UTC().Add(-365 * 24 * time.Hour)
+
+	for _, shards := range []int{1, 16} {
+		var gl *GameLeaderboard
+		var next atomic.Int64
+
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			if gl == nil {
+				gl = NewShardedGameLeaderboard(shards)
+				rng := rand.New(rand.NewSource(1))
+				batch := make([]models.Score, 0, 100_000)
+				for next.Load() < int64(*benchEntries) {
+					batch = append(batch, models.Score{UserID: next.Add(1), Score: uint64(rng.Int63n(1 << 40)), Timestamp: old})
+					if len(batch) == cap(batch) {
+						gl.AddScoreBatch(batch)
+						batch = batch[:0]
+					}
+				}
+				gl.AddScoreBatch(batch)
+				b.ResetTimer()
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(next.Load()))
+				for pb.Next() {
+					gl.AddScore(next.Add(1), uint64(rng.Int63n(1<<40)), old)
+				}
+			})
+		})
+	}
+}
+
+func TestStore_Profiles(t *testing.T) {
+	store := NewStore(nil)
+	name := "Ace"
+
+	profile, err := store.SetProfile(1, &name, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), profile.UserID)
+
+	profiles := store.Profiles([]int64{1, 2})
+	assert.Len(t, profiles, 1)
+	assert.Equal(t, "Ace", *profiles[1].DisplayName)
+	assert.Nil(t, profiles[1].AvatarURL)
+
+	// Without Postgres the profiles never expire.
+	realClock := clock
+	defer func() { clock = realClock }()
+	clock = func() time.Time { return profile.UpdatedAt.Add(time.Hour) }
+	assert.Contains(t, store.Profiles([]int64{1}), int64(1))
+}
+
+func TestStore_Seasons(t *testing.T) {
+	realClock := clock
+	defer func() { clock = realClock }()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return start.Add(time.Hour) }
+
+	store := NewStore(nil)
+	store.SetExcluded(1, 9, true)
+	store.SetOpenSeasons([]models.Season{
+		{SeasonID: 1, GameID: 1, StartsAt: start, EndsAt: start.Add(24 * time.Hour)},
+		{SeasonID: 2, GameID: 1, StartsAt: start.Add(24 * time.Hour), EndsAt: start.Add(48 * time.Hour)},
+	})
+
+	active, ok := store.ActiveSeason(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), active.SeasonID)
+	_, ok = store.ActiveSeason(2)
+	assert.False(t, ok)
+
+	// Scores count towards the season they are received in, whatever their
+	// timestamp.
+	now := clock()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 9, Score: 500, Timestamp: now})
+	store.SaveScoreBatch([]models.Score{
+		{GameID: 1, UserID: 2, Score: 50, Timestamp: now},
+		{GameID: 1, UserID: 3, Score: 70, Timestamp: now, ReceivedAt: start.Add(30 * time.Hour)},
+		{GameID: 2, UserID: 4, Score: 10, Timestamp: now},
+	})
+
+	first := store.SeasonLeaderboard(1, 1)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 2, Score: 50, Rank: 2}}, first.GetTopK(10, 0, models.AllTime))
+	second := store.SeasonLeaderboard(1, 2)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 3, Score: 70, Rank: 1}}, second.GetTopK(10, 0, models.AllTime))
+	assert.Nil(t, store.SeasonLeaderboard(2, 1))
+	assert.Equal(t, uint64(3), store.TotalPlayers(1)) // the game board still has every score
+
+	// Open boards are kept, frozen ones dropped.
+	store.SetOpenSeasons([]models.Season{{SeasonID: 2, GameID: 1, StartsAt: start.Add(24 * time.Hour), EndsAt: start.Add(48 * time.Hour)}})
+	assert.Nil(t, store.SeasonLeaderboard(1, 1))
+	assert.Same(t, second, store.SeasonLeaderboard(1, 2))
+
+	_, err := store.EraseUser(3)
+	assert.NoError(t, err)
+	assert.Empty(t, second.GetTopK(10, 0, models.AllTime))
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"slices"
+	"sync"
+
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Subscribers to the same game, size and window share one feed. A board change
+// only wakes the feed, without blocking; the feed's goroutine then reads the
+// top list once and hands it to every subscriber whose list differs. Each
+// subscriber holds at most one pending list, and a newer one replaces it, so a
+// slow reader misses intermediate lists instead of holding up the others or
+// the writers.
+
+type feedKey struct {
+	gameID int64
+	n      int
+	window int // hours
+}
+
+type topFeed struct {
+	key  feedKey
+	wake chan struct{}
+	done chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[chan []models.LeaderboardEntry]struct{}
+	fresh       []chan []models.LeaderboardEntry // have not had a list yet
+	last        []models.LeaderboardEntry
+}
+
+// Subscribe returns a channel receiving the game's top n in the window: first
+// the current list, then the new one every time its players, their order or
+// their scores change. A reader that falls behind only gets the latest list.
+// Lists are shared between subscribers and must not be modified. cancel stops the subscription and closes the channel.
+func (ls *Store) Subscribe(gameID int64, n int, window models.TimeWindow) (<-chan []models.LeaderboardEntry, func()) {
+	key := feedKey{gameID: gameID, n: n, window: window.Hours}
+	ch := make(chan []models.LeaderboardEntry, 1)
+
+	ls.feedsMu.Lock()
+	if ls.feeds == nil {
+		ls.feeds = make(map[int64][]*topFeed)
+	}
+	feed := ls.feedFor(key)
+	if feed == nil {
+		feed = &topFeed{
+			key:         key,
+			wake:        make(chan struct{}, 1),
+			done:        make(chan struct{}),
+			subscribers: make(map[chan []models.LeaderboardEntry]struct{}),
+		}
+		ls.feeds[gameID] = append(ls.feeds[gameID], feed)
+		go ls.runFeed(feed, window)
+	}
+	feed.mu.Lock()
+	feed.subscribers[ch] = struct{}{}
+	feed.fresh = append(feed.fresh, ch)
+	feed.mu.Unlock()
+	ls.feedsMu.Unlock()
+
+	// The feed's goroutine sends the current list, like every later one.
+	feed.notify()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { ls.unsubscribe(feed, ch) })
+	}
+	return ch, cancel
+}
+
+// feedFor returns the feed for key, or nil. The caller holds feedsMu.
+func (ls *Store) feedFor(key feedKey) *topFeed {
+	for _, feed := range ls.feeds[key.gameID] {
+		if feed.key == key {
+			return feed
+		}
+	}
+	return nil
+}
+
+func (ls *Store) unsubscribe(feed *topFeed, ch chan []models.LeaderboardEntry) {
+	ls.feedsMu.Lock()
+	defer ls.feedsMu.Unlock()
+
+	feed.mu.Lock()
+	delete(feed.subscribers, ch)
+	feed.fresh = slices.DeleteFunc(feed.fresh, func(c chan []models.LeaderboardEntry) bool { return c == ch })
+	close(ch)
+	empty := len(feed.subscribers) == 0
+	feed.mu.Unlock()
+
+	if empty {
+		ls.feeds[feed.key.gameID] = slices.DeleteFunc(ls.feeds[feed.key.gameID], func(f *topFeed) bool { return f == feed })
+		if len(ls.feeds[feed.key.gameID]) == 0 {
+			delete(ls.feeds, feed.key.gameID)
+		}
+		close(feed.done)
+	}
+}
+
+// wakeFeeds tells every feed of the game that its board changed.
+func (ls *Store) wakeFeeds(gameID int64) {
+	ls.feedsMu.RLock()
+	defer ls.feedsMu.RUnlock()
+	for _, feed := range ls.feeds[gameID] {
+		feed.notify()
+	}
+}
+
+func (f *topFeed) notify() {
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ls *Store) runFeed(feed *topFeed, window models.TimeWindow) {
+	for {
+		select {
+		case <-feed.wake:
+		case <-feed.done:
+			return
+		}
+
+		top := ls.GetTopLeaders(feed.key.gameID, feed.key.n, 0, window)
+
+		feed.mu.Lock()
+		if !slices.Equal(feed.last, top) {
+			feed.last = top
+			for ch := range feed.subscribers {
+				replace(ch, top)
+			}
+		} else {
+			for _, ch := range feed.fresh {
+				replace(ch, top)
+			}
+		}
+		feed.fresh = nil
+		feed.mu.Unlock()
+	}
+}
+
+// replace puts top on ch, dropping the list still waiting there if the reader
+// has not taken it. Only the feed's goroutine sends, so it never blocks.
+func replace(ch chan []models.LeaderboardEntry, top []models.LeaderboardEntry) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- top
+}
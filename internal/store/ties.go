@@ -0,0 +1,156 @@
+package store
+
+import (
+	"cmp"
+
+	cache "github.com/IWhitebird/go-leader-board/internal/cache"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// The skiplists order tied players by who reached the score first, which is
+// the ordinal rank. Competition ranks count the players with a strictly
+// higher score, which the skiplist answers directly. Dense ranks count the
+// distinct higher scores, so each shard also keeps its distinct scores in a
+// skiplist of their own, in step with the players like the sketch.
+
+// scoreLevels is a shard's distinct scores, highest first, with how many of
+// its players hold each.
+type scoreLevels struct {
+	holders map[uint64]int
+	order   *cache.SkipList[uint64, uint64]
+}
+
+func newScoreLevels() *scoreLevels {
+	return &scoreLevels{
+		holders: make(map[uint64]int),
+		order:   cache.NewSkipList[uint64](func(a, b uint64) int { return cmp.Compare(b, a) }),
+	}
+}
+
+func (l *scoreLevels) add(score uint64) {
+	l.holders[score]++
+	if l.holders[score] == 1 {
+		l.order.InsertOrUpdate(score, score)
+	}
+}
+
+func (l *scoreLevels) remove(score uint64) {
+	l.holders[score]--
+	if l.holders[score] <= 0 {
+		delete(l.holders, score)
+		l.order.Delete(score)
+	}
+}
+
+// above counts the distinct scores strictly higher than score.
+func (l *scoreLevels) above(score uint64) int {
+	return l.order.CountWhile(func(s uint64) bool { return s > score })
+}
+
+// holders counts the players holding score across the shards.
+func (lb *LeaderBoard) holders(score uint64) int {
+	count := 0
+	for _, shard := range lb.shards {
+		count += shard.levels.holders[score]
+	}
+	return count
+}
+
+// distinctAbove counts the distinct scores strictly higher than score. Shards
+// can hold the same score, so with more than one their levels are merged,
+// which walks every distinct score above.
+func (lb *LeaderBoard) distinctAbove(score uint64) int {
+	if len(lb.shards) == 1 {
+		return lb.shards[0].levels.above(score)
+	}
+
+	seen := make(map[uint64]struct{})
+	for _, shard := range lb.shards {
+		shard.levels.order.Ascend(func(s, _ uint64) bool {
+			if s <= score {
+				return false
+			}
+			seen[s] = struct{}{}
+			return true
+		})
+	}
+	return len(seen)
+}
+
+// tieRanker ranks scores on one window's board under a rank mode, leaving out
+// the excluded players. The board must stay locked while it is used.
+type tieRanker struct {
+	lb       *LeaderBoard
+	mode     models.RankMode
+	excluded map[uint64]int // how many excluded players hold each score
+}
+
+func newTieRanker(lb *LeaderBoard, excluded map[int64]struct{}, mode models.RankMode) tieRanker {
+	r := tieRanker{lb: lb, mode: mode}
+	for userID := range excluded {
+		if score, ok := lb.search(userID); ok {
+			if r.excluded == nil {
+				r.excluded = make(map[uint64]int)
+			}
+			r.excluded[score.Score]++
+		}
+	}
+	return r
+}
+
+// tiedWith counts the other players holding the score.
+func (r tieRanker) tiedWith(score uint64) uint64 {
+	return uint64(max(r.lb.holders(score)-r.excluded[score]-1, 0))
+}
+
+// above counts the players with a strictly higher score.
+func (r tieRanker) above(score uint64) int {
+	count := r.lb.countWhile(func(s models.Score) bool { return s.Score > score })
+	for s, n := range r.excluded {
+		if s > score {
+			count -= n
+		}
+	}
+	return count
+}
+
+// distinctAbove counts the distinct scores strictly higher than score, not
+// counting scores only excluded players hold.
+func (r tieRanker) distinctAbove(score uint64) int {
+	count := r.lb.distinctAbove(score)
+	for s, n := range r.excluded {
+		if s > score && r.lb.holders(s) == n {
+			count--
+		}
+	}
+	return count
+}
+
+// rank returns the rank of a player with the given score under the mode.
+// ordinal is their rank with ties broken by time.
+func (r tieRanker) rank(ordinal, score uint64) uint64 {
+	switch r.mode {
+	case models.RankCompetition:
+		return uint64(r.above(score)) + 1
+	case models.RankDense:
+		return uint64(r.distinctAbove(score)) + 1
+	default:
+		return ordinal
+	}
+}
+
+// rankEntries sets the rank and tie count of entries listed in rank order.
+// Ties are looked up once per distinct score on the page.
+func (r tieRanker) rankEntries(entries []models.LeaderboardEntry) {
+	for i := range entries {
+		if i > 0 && entries[i].Score == entries[i-1].Score {
+			entries[i].TiedWith = entries[i-1].TiedWith
+			if r.mode != models.RankOrdinal {
+				entries[i].Rank = entries[i-1].Rank
+			}
+			continue
+		}
+		entries[i].TiedWith = r.tiedWith(entries[i].Score)
+		entries[i].Rank = r.rank(entries[i].Rank, entries[i].Score)
+	}
+}
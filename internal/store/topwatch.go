@@ -0,0 +1,90 @@
+package store
+
+import (
+	"slices"
+	"time"
+
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// TopChange is a game's top list in one window just before and just after a
+// write that changed it.
+type TopChange struct {
+	GameID int64
+	Window models.TimeWindow
+	Before []models.LeaderboardEntry
+	After  []models.LeaderboardEntry
+	At     time.Time
+}
+
+type topWatcher struct {
+	n  int
+	fn func(TopChange)
+}
+
+// OnTopChange registers fn to be called with the top n of every window that a
+// write to a game changed. The lists are read right before and right after
+// AddScore and SaveScoreBatch apply their scores, so concurrent writes to the
+// same game may be folded into one change. Hidden games are left out. fn runs
+// on the writer's goroutine and must not block.
+func (ls *Store) OnTopChange(n int, fn func(TopChange)) {
+	ls.listenersMu.Lock()
+	defer ls.listenersMu.Unlock()
+	ls.topWatchers = append(ls.topWatchers, topWatcher{n: n, fn: fn})
+}
+
+// topWatchDepth returns how many places the watchers need, 0 when there are
+// none.
+func (ls *Store) topWatchDepth() int {
+	ls.listenersMu.RLock()
+	defer ls.listenersMu.RUnlock()
+
+	depth := 0
+	for _, watcher := range ls.topWatchers {
+		depth = max(depth, watcher.n)
+	}
+	return depth
+}
+
+// topLists reads the game's top depth in every window, or nil when nobody is
+// watching.
+func (ls *Store) topLists(gameID int64, depth int) [][]models.LeaderboardEntry {
+	if depth == 0 || ls.IsHidden(gameID) {
+		return nil
+	}
+	lists := make([][]models.LeaderboardEntry, models.LeaderboardIndexCount)
+	for i, window := range models.AllTimeWindows() {
+		lists[i] = ls.GetTopLeaders(gameID, depth, 0, window)
+	}
+	return lists
+}
+
+// notifyTopChange hands the windows whose top list differs from before to the
+// watchers, each cut to the watcher's depth.
+func (ls *Store) notifyTopChange(gameID int64, depth int, before [][]models.LeaderboardEntry) {
+	if before == nil {
+		return
+	}
+	after := ls.topLists(gameID, depth)
+	at := clock()
+
+	ls.listenersMu.RLock()
+	defer ls.listenersMu.RUnlock()
+	for i, window := range models.AllTimeWindows() {
+		if slices.Equal(before[i], after[i]) {
+			continue
+		}
+		for _, watcher := range ls.topWatchers {
+			change := TopChange{
+				GameID: gameID,
+				Window: window,
+				Before: before[i][:min(watcher.n, len(before[i]))],
+				After:  after[i][:min(watcher.n, len(after[i]))],
+				At:     at,
+			}
+			if !slices.Equal(change.Before, change.After) {
+				watcher.fn(change)
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// A cumulative game's board holds each player's total rather than their best
+// score. The all-time window only needs the running total, but the shorter
+// windows must let submissions go once they age out, so the board also keeps
+// each player's recent submissions summed per hour, for as long as the
+// longest window covers them. A window lets go of an hour's submissions
+// together, once the whole hour has aged out of it.
+//
+// The hours are split into shards like the windows, so a player's hours and
+// entries sit on shards with the same index. A shard's hours are locked
+// before the windows' shards, which lockAll also does.
+
+type totalsShard struct {
+	mu    sync.Mutex
+	hours map[int64]map[int64]uint64 // user ID to unix hour to the sum of its submissions
+}
+
+type runningTotals struct {
+	shards []*totalsShard
+}
+
+func newRunningTotals(shards int) *runningTotals {
+	t := &runningTotals{shards: make([]*totalsShard, max(shards, 1))}
+	for i := range t.shards {
+		t.shards[i] = &totalsShard{hours: make(map[int64]map[int64]uint64)}
+	}
+	return t
+}
+
+// saturatingAdd adds b to a, stopping at the largest uint64 rather than
+// wrapping around.
+func saturatingAdd(a, b uint64) uint64 {
+	if sum := a + b; sum >= a {
+		return sum
+	}
+	return math.MaxUint64
+}
+
+// longestWindow is the window covering the most time short of all time.
+func longestWindow() models.TimeWindow {
+	var longest models.TimeWindow
+	for _, window := range models.AllTimeWindows() {
+		if window.Hours > longest.Hours {
+			longest = window
+		}
+	}
+	return longest
+}
+
+func hourOf(timestamp time.Time) int64 {
+	return timestamp.Unix() / 3600
+}
+
+// hourEnds reports whether the hour is over by the cutoff.
+func hourEnds(hour int64, cutoff time.Time) bool {
+	return !time.Unix((hour+1)*3600, 0).After(cutoff)
+}
+
+func (t *totalsShard) add(userID int64, score uint64, timestamp time.Time) {
+	hours, ok := t.hours[userID]
+	if !ok {
+		hours = make(map[int64]uint64)
+		t.hours[userID] = hours
+	}
+	hour := hourOf(timestamp)
+	hours[hour] = saturatingAdd(hours[hour], score)
+}
+
+// since sums the player's submissions in the hours still running at the
+// cutoff. ok is false when they have none.
+func (t *totalsShard) since(userID int64, cutoff time.Time) (total uint64, ok bool) {
+	for hour, sum := range t.hours[userID] {
+		if !hourEnds(hour, cutoff) {
+			total = saturatingAdd(total, sum)
+			ok = true
+		}
+	}
+	return total, ok
+}
+
+// expire drops the hours that are over by the cutoff.
+func (t *totalsShard) expire(cutoff time.Time) {
+	for userID, hours := range t.hours {
+		for hour := range hours {
+			if hourEnds(hour, cutoff) {
+				delete(hours, hour)
+			}
+		}
+		if len(hours) == 0 {
+			delete(t.hours, userID)
+		}
+	}
+}
+
+// NewCumulativeGameLeaderboard creates a board for a cumulative game, where
+// each submission adds to the player's total rather than only counting when
+// it beats their best.
+func NewCumulativeGameLeaderboard(shards int) *GameLeaderboard {
+	gl := NewShardedGameLeaderboard(shards)
+	gl.totals = newRunningTotals(shards)
+	return gl
+}
+
+// newBoard creates a board for a game with the given scoring.
+func newBoard(shards int, scoring models.ScoringMode) *GameLeaderboard {
+	if scoring == models.ScoringCumulative {
+		return NewCumulativeGameLeaderboard(shards)
+	}
+	return NewShardedGameLeaderboard(shards)
+}
+
+// Scoring returns how the board combines a player's submissions.
+func (gl *GameLeaderboard) Scoring() models.ScoringMode {
+	if gl.totals != nil {
+		return models.ScoringCumulative
+	}
+	return models.ScoringBest
+}
+
+// addToTotal adds a submission to the player's total in every window it falls
+// in, holding the player's hours locked throughout so the windows cannot be
+// recounted from them halfway. When read is set, the whole all-time window
+// stays locked from the addition until read has looked at it.
+func (gl *GameLeaderboard) addToTotal(userID int64, score uint64, timestamp time.Time, read func(*LeaderBoard)) {
+	t := gl.totals.shards[shardIndex(userID, len(gl.totals.shards))]
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if gl.isScoreValid(longestWindow(), timestamp) {
+		t.add(userID, score, timestamp)
+	}
+
+	for _, window := range models.AllTimeWindows() {
+		if !gl.isScoreValid(window, timestamp) {
+			continue
+		}
+
+		if window.Hours == 0 && read != nil {
+			gl.withLeaderboard(window, LockTypeWrite, func(lb *LeaderBoard) {
+				if lb.shardFor(userID).accumulate(userID, score, timestamp) {
+					gl.version.Add(1)
+				}
+				read(lb)
+			})
+			continue
+		}
+
+		gl.withShard(window, userID, func(shard *boardShard) {
+			if shard.accumulate(userID, score, timestamp) {
+				gl.version.Add(1)
+			}
+		})
+	}
+	gl.addToCalendar(models.Score{UserID: userID, Score: score, Timestamp: timestamp}, true)
+}
+
+// Increment adds delta to the player's total on a cumulative board and
+// returns their standing on the all-time window right after, read under the
+// same lock, so concurrent increments each see their own result. It returns
+// false, changing nothing, on a best score board.
+func (gl *GameLeaderboard) Increment(userID int64, delta uint64, timestamp time.Time) (PlayerRank, bool) {
+	if gl.totals == nil {
+		return PlayerRank{}, false
+	}
+	gl.advanceWatermark(timestamp)
+
+	excluded := gl.excludedSet()
+	var rank PlayerRank
+	gl.addToTotal(userID, delta, timestamp, func(lb *LeaderBoard) {
+		rank = rankOf(lb, excluded, userID, models.RankOrdinal)
+	})
+	return rank, true
+}
+
+// expireTotals drops the hours that have aged out of the longest window and
+// recounts each shorter window's totals from the hours still inside it,
+// removing players with none left.
+func (gl *GameLeaderboard) expireTotals() {
+	for i, t := range gl.totals.shards {
+		t.mu.Lock()
+		t.expire(gl.getCutoffTime(longestWindow()))
+
+		for _, window := range models.AllTimeWindows() {
+			if window.Hours == 0 {
+				continue
+			}
+			cutoff := gl.getCutoffTime(window)
+			shard := gl.getLeaderboard(window).shards[i]
+
+			shard.mu.Lock()
+			for _, entry := range shard.scoresList.GetAll() {
+				total, ok := t.since(entry.Key, cutoff)
+				var changed bool
+				if ok {
+					changed = shard.update(entry.Key, func(current models.Score, _ bool) models.Score {
+						current.Score = total
+						return current
+					})
+				} else {
+					changed = shard.remove(entry.Key)
+				}
+				if changed {
+					gl.version.Add(1)
+				}
+			}
+			shard.mu.Unlock()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// forgetTotals drops the hours of the players deleted by the mutations. The
+// caller holds every lock, as taken by lockAll.
+func (gl *GameLeaderboard) forgetTotals(mutations []Mutation) {
+	if gl.totals == nil {
+		return
+	}
+	for _, m := range mutations {
+		if m.Op == MutationDelete {
+			delete(gl.totals.shards[shardIndex(m.UserID, len(gl.totals.shards))].hours, m.UserID)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Validate checks the structure of every window's skiplists, and that every
+// player sits on the shard their user ID maps to. It reports the first problem
+// found.
+func (gl *GameLeaderboard) Validate() error {
+	for _, window := range models.AllTimeWindows() {
+		var err error
+		gl.withLeaderboard(window, LockTypeDirtyRead, func(lb *LeaderBoard) {
+			for i, shard := range lb.shards {
+				if err = shard.scoresList.Validate(); err != nil {
+					err = fmt.Errorf("%s window, shard %d: %w", window.Display, i, err)
+					return
+				}
+				shard.scoresList.Ascend(func(userID int64, _ models.Score) bool {
+					if own := shardIndex(userID, len(lb.shards)); own != i {
+						err = fmt.Errorf("%s window: user %d is on shard %d, expected %d", window.Display, userID, i, own)
+					}
+					return err == nil
+				})
+				if err != nil {
+					return
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckWindows checks that the windows nest: every player in a window is also
+// in each longer window, with a score at least as good. A score being added
+// while the check runs can show up as a violation, since AddScore updates the
+// windows one at a time.
+func (gl *GameLeaderboard) CheckWindows() error {
+	unlock := gl.lockAll()
+	defer unlock()
+
+	// Shortest window first, all time last.
+	windows := models.AllTimeWindows()
+	slices.SortFunc(windows[:], func(a, b models.TimeWindow) int {
+		if a.Hours == 0 || b.Hours == 0 {
+			return b.Hours - a.Hours
+		}
+		return a.Hours - b.Hours
+	})
+
+	for i := 0; i+1 < len(windows); i++ {
+		shorter, longer := gl.getLeaderboard(windows[i]), gl.getLeaderboard(windows[i+1])
+
+		violations := 0
+		var example int64
+		for _, score := range shorter.scores() {
+			best, ok := longer.search(score.UserID)
+			if !ok || models.ScoreCompare(best, score) > 0 {
+				if violations == 0 {
+					example = score.UserID
+				}
+				violations++
+			}
+		}
+
+		if violations > 0 {
+			return fmt.Errorf("%d players in the %s window are missing from %s or have a better score there, e.g. user %d",
+				violations, windows[i].Display, windows[i+1].Display, example)
+		}
+	}
+	return nil
+}
+
+// SampleScores returns up to n all-time entries spread evenly over the
+// game's board, from first to last place, or nil if the game is not loaded.
+// Excluded accounts are included.
+func (ls *Store) SampleScores(gameID int64, n int) []models.Score {
+	leaderboard := ls.GetLeaderboard(gameID)
+	if leaderboard == nil || n <= 0 {
+		return nil
+	}
+
+	var sample []models.Score
+	leaderboard.withLeaderboard(models.AllTime, LockTypeDirtyRead, func(lb *LeaderBoard) {
+		length := lb.length()
+		if length == 0 {
+			return
+		}
+		step := max(length/n, 1)
+		rank := 0
+		lb.ascend(func(_ int64, score models.Score) bool {
+			if rank%step == 0 {
+				sample = append(sample, score)
+			}
+			rank++
+			return len(sample) < n
+		})
+	})
+	return sample
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	models "github.com/IWhitebird/go-leader-board/internal/models"
+)
+
+// Only the standard windows have boards of their own. A custom window, such as
+// 48h or 30d, is read from a board built for it on demand. A best score game's
+// is copied from the shortest standard window covering it, keeping the entries
+// set inside the custom window; as on the standard windows, a player whose best
+// score ages out drops off rather than falling back to an older, lower one. A
+// cumulative game's sums each player's hours inside the window, which only
+// reach back as far as the longest standard window, so longer windows are
+// summed from Postgres instead. A built board is reused for customWindowTTL.
+
+const customWindowTTL = 10 * time.Second
+
+type customBoard struct {
+	board   *LeaderBoard
+	builtAt time.Time
+}
+
+// newGameBoard creates a board for the game, letting a cumulative game's board
+// sum long custom windows from Postgres. The caller holds ls.mu.
+func (ls *Store) newGameBoard(gameID int64, scoring models.ScoringMode) *GameLeaderboard {
+	board := newBoard(ls.shards[gameID], scoring)
+	if board.totals != nil && ls.db != nil {
+		board.history = func(since time.Time) ([]models.Score, error) {
+			return ls.db.GetScoresForGameSince(gameID, since)
+		}
+	}
+	return board
+}
+
+// coveringWindow is the shortest standard window at least as long as the
+// given one, all time when none is.
+func coveringWindow(window models.TimeWindow) models.TimeWindow {
+	covering := models.AllTime
+	for _, standard := range models.AllTimeWindows() {
+		if standard.Hours >= window.Hours && (covering.Hours == 0 || standard.Hours < covering.Hours) {
+			covering = standard
+		}
+	}
+	return covering
+}
+
+// customLeaderboard returns the board for a custom window, building it when
+// there is none younger than customWindowTTL.
+func (gl *GameLeaderboard) customLeaderboard(window models.TimeWindow) *LeaderBoard {
+	gl.customMu.Lock()
+	defer gl.customMu.Unlock()
+
+	now := clock()
+	if built, ok := gl.custom[window.Hours]; ok && now.Sub(built.builtAt) < customWindowTTL {
+		return built.board
+	}
+
+	if gl.custom == nil {
+		gl.custom = make(map[int]customBoard)
+	}
+	for hours, built := range gl.custom {
+		if now.Sub(built.builtAt) >= customWindowTTL {
+			delete(gl.custom, hours)
+		}
+	}
+
+	board := gl.buildCustomBoard(window)
+	gl.custom[window.Hours] = customBoard{board: board, builtAt: now}
+	return board
+}
+
+func (gl *GameLeaderboard) buildCustomBoard(window models.TimeWindow) *LeaderBoard {
+	board := newLeaderBoard(gl.Shards())
+	cutoff := gl.getCutoffTime(window)
+	if gl.totals != nil {
+		gl.sumCustomWindow(board, window, cutoff)
+		return board
+	}
+
+	source := gl.getLeaderboard(coveringWindow(window))
+	for i, shard := range source.shards {
+		shard.mu.Lock()
+		for _, entry := range shard.scoresList.GetAll() {
+			if entry.Value.Timestamp.After(cutoff) {
+				board.shards[i].put(entry.Key, entry.Value)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return board
+}
+
+// sumCustomWindow fills board with each player's total since the cutoff.
+func (gl *GameLeaderboard) sumCustomWindow(board *LeaderBoard, window models.TimeWindow, cutoff time.Time) {
+	if window.Hours > longestWindow().Hours && gl.history != nil {
+		scores, err := gl.history(cutoff)
+		if err == nil {
+			for _, score := range scores {
+				board.shardFor(score.UserID).accumulate(score.UserID, score.Score, score.Timestamp)
+			}
+			return
+		}
+		logging.Error("Failed to sum custom window from PostgreSQL, summing the hours in memory", "window", window.Display, "error", err)
+	}
+
+	for i, t := range gl.totals.shards {
+		t.mu.Lock()
+		for userID, hours := range t.hours {
+			for hour, sum := range hours {
+				if !hourEnds(hour, cutoff) {
+					board.shards[i].accumulate(userID, sum, time.Unix(hour*3600, 0).UTC())
+				}
+			}
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+type delivery struct {
+	target *Target
+	event  models.WebhookEvent
+}
+
+// Dispatcher turns top list changes into events and posts them to the
+// targets. Events are queued without blocking the writer that caused them;
+// when the queue is full they are dropped. One goroutine delivers them in
+// order, retrying failed posts with exponential backoff.
+type Dispatcher struct {
+	targets     []Target
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+
+	queue chan delivery
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	started bool
+}
+
+// New creates a dispatcher holding up to queueSize events and trying each
+// delivery up to maxAttempts times, each within timeout.
+func New(targets []Target, queueSize, maxAttempts int, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		targets:     targets,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: max(maxAttempts, 1),
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		now:         func() time.Time { return time.Now().UTC() },
+		queue:       make(chan delivery, max(queueSize, 1)),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Watch has the store report its top list changes to the dispatcher.
+func (d *Dispatcher) Watch(leaderboard *store.Store) {
+	depth := 0
+	for _, target := range d.targets {
+		depth = max(depth, target.TopN)
+	}
+	leaderboard.OnTopChange(depth, d.handle)
+}
+
+// handle queues the events of a change, on the writer's goroutine.
+func (d *Dispatcher) handle(change store.TopChange) {
+	for i := range d.targets {
+		target := &d.targets[i]
+		if !target.watches(change) {
+			continue
+		}
+		for _, event := range target.events(change) {
+			select {
+			case d.queue <- delivery{target: target, event: event}:
+			default:
+				metrics.WebhookDropped.Inc(event.Event)
+			}
+		}
+	}
+}
+
+// Start delivers queued events until Close is called.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	d.started = true
+	d.mu.Unlock()
+
+	go func() {
+		defer close(d.done)
+		for {
+			select {
+			case next := <-d.queue:
+				d.deliver(next)
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// deliver posts the event, retrying until it is accepted, maxAttempts have
+// failed, or the dispatcher is closed.
+func (d *Dispatcher) deliver(next delivery) {
+	backoff := d.minBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(next)
+		if err == nil {
+			metrics.WebhookDelivered.Inc(next.event.Event)
+			return
+		}
+		if attempt >= d.maxAttempts {
+			logging.Error("Giving up on webhook", "event", next.event.Event, "game", next.event.GameID, "attempts", attempt, "error", err)
+			metrics.WebhookFailed.Inc(next.event.Event)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-d.stop:
+			metrics.WebhookFailed.Inc(next.event.Event)
+			return
+		}
+		backoff = min(backoff*2, d.maxBackoff)
+	}
+}
+
+func (d *Dispatcher) post(next delivery) error {
+	next.event.SentAt = d.now()
+	body, err := next.target.payload(next.event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, next.target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close stops delivering. An event still being retried is given up, and
+// those still queued are dropped.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	started := d.started
+	d.mu.Unlock()
+
+	close(d.stop)
+	if started {
+		<-d.done
+	}
+}
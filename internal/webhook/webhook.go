@@ -0,0 +1,184 @@
+// Package webhook posts leaderboard changes, such as a new first place, to
+// HTTP endpoints like Slack or Discord incoming webhooks.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+)
+
+// Events a target can subscribe to.
+const (
+	// EventNewTopPlayer fires when a different player takes first place.
+	EventNewTopPlayer = "new_top_player"
+	// EventRankEnteredTopN fires for each player entering the target's top N.
+	EventRankEnteredTopN = "rank_entered_top_n"
+	// EventScoreRecord fires when the best score in the window goes up.
+	EventScoreRecord = "score_record"
+)
+
+var allEvents = []string{EventNewTopPlayer, EventRankEnteredTopN, EventScoreRecord}
+
+// Payload formats.
+const (
+	FormatJSON    = "json"    // models.WebhookEvent
+	FormatSlack   = "slack"   // {"text": ...}
+	FormatDiscord = "discord" // {"content": ...}
+)
+
+const defaultTopN = 10
+
+// Target is an endpoint and the events it receives.
+type Target struct {
+	URL    string            `json:"url"`
+	Events []string          `json:"events"` // All events when empty
+	TopN   int               `json:"top_n"`  // Size of the top list for rank_entered_top_n, default 10
+	Window models.TimeWindow `json:"-"`
+	Games  []int64           `json:"games"`  // All games when empty
+	Format string            `json:"format"` // json, slack or discord, default json
+}
+
+// LoadTargets reads a JSON array of targets. Each may name a "window" as the
+// API's window parameter does, all time by default.
+func LoadTargets(path string) ([]Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook targets: %w", err)
+	}
+	return ParseTargets(data)
+}
+
+// ParseTargets parses and checks a JSON array of targets.
+func ParseTargets(data []byte) ([]Target, error) {
+	var raw []struct {
+		Target
+		Window string `json:"window"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook targets: %w", err)
+	}
+
+	targets := make([]Target, len(raw))
+	for i, r := range raw {
+		target := r.Target
+		if target.URL == "" {
+			return nil, fmt.Errorf("webhook target %d has no url", i)
+		}
+		for _, event := range target.Events {
+			if !slices.Contains(allEvents, event) {
+				return nil, fmt.Errorf("webhook target %d has unknown event %q", i, event)
+			}
+		}
+		if target.TopN <= 0 {
+			target.TopN = defaultTopN
+		}
+		switch target.Format {
+		case "":
+			target.Format = FormatJSON
+		case FormatJSON, FormatSlack, FormatDiscord:
+		default:
+			return nil, fmt.Errorf("webhook target %d has unknown format %q", i, target.Format)
+		}
+		window, err := models.FromQueryParam(r.Window)
+		if err != nil {
+			return nil, fmt.Errorf("webhook target %d: %w", i, err)
+		}
+		if !window.IsStandard() {
+			// Top list changes are only watched on the standard windows.
+			return nil, fmt.Errorf("webhook target %d: window must be one of %s", i, models.SupportedWindows())
+		}
+		target.Window = window
+		targets[i] = target
+	}
+	return targets, nil
+}
+
+func (t *Target) wants(event string) bool {
+	return len(t.Events) == 0 || slices.Contains(t.Events, event)
+}
+
+func (t *Target) watches(change store.TopChange) bool {
+	return change.Window.Hours == t.Window.Hours && (len(t.Games) == 0 || slices.Contains(t.Games, change.GameID))
+}
+
+// events finds what the target receives for a change.
+func (t *Target) events(change store.TopChange) []models.WebhookEvent {
+	before := change.Before[:min(t.TopN, len(change.Before))]
+	after := change.After[:min(t.TopN, len(change.After))]
+	if len(after) == 0 {
+		return nil
+	}
+
+	// Ranks below the target's top N are still known down to the depth
+	// watched for every target.
+	oldRanks := make(map[int64]uint64, len(change.Before))
+	for _, entry := range change.Before {
+		oldRanks[entry.UserID] = entry.Rank
+	}
+	event := func(kind string, entry models.LeaderboardEntry) models.WebhookEvent {
+		return models.WebhookEvent{
+			Event:      kind,
+			GameID:     change.GameID,
+			Window:     change.Window.Display,
+			UserID:     entry.UserID,
+			Score:      entry.Score,
+			OldRank:    oldRanks[entry.UserID],
+			NewRank:    entry.Rank,
+			OccurredAt: change.At,
+		}
+	}
+
+	var events []models.WebhookEvent
+	first := after[0]
+	if t.wants(EventNewTopPlayer) && (len(before) == 0 || before[0].UserID != first.UserID) {
+		e := event(EventNewTopPlayer, first)
+		if len(before) > 0 {
+			e.PreviousUserID = before[0].UserID
+		}
+		events = append(events, e)
+	}
+	if t.wants(EventScoreRecord) && (len(before) == 0 || first.Score > before[0].Score) {
+		e := event(EventScoreRecord, first)
+		if len(before) > 0 {
+			e.PreviousScore = before[0].Score
+		}
+		events = append(events, e)
+	}
+	if t.wants(EventRankEnteredTopN) {
+		for _, entry := range after {
+			if rank, was := oldRanks[entry.UserID]; !was || rank > uint64(t.TopN) {
+				events = append(events, event(EventRankEnteredTopN, entry))
+			}
+		}
+	}
+	return events
+}
+
+// payload renders an event in the target's format.
+func (t *Target) payload(event models.WebhookEvent) ([]byte, error) {
+	switch t.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": describe(event)})
+	case FormatDiscord:
+		return json.Marshal(map[string]string{"content": describe(event)})
+	default:
+		return json.Marshal(event)
+	}
+}
+
+// describe says what happened in a sentence, for chat formats.
+func describe(e models.WebhookEvent) string {
+	switch e.Event {
+	case EventNewTopPlayer:
+		return fmt.Sprintf("Player %d took first place in game %d (%s) with %d", e.UserID, e.GameID, e.Window, e.Score)
+	case EventScoreRecord:
+		return fmt.Sprintf("Player %d set a new record of %d in game %d (%s)", e.UserID, e.Score, e.GameID, e.Window)
+	default:
+		return fmt.Sprintf("Player %d entered the top places in game %d (%s) at rank %d with %d", e.UserID, e.GameID, e.Window, e.NewRank, e.Score)
+	}
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets([]byte(`[
+		{"url": "http://a", "events": ["new_top_player"], "window": "24h", "games": [1]},
+		{"url": "http://b", "top_n": 3, "format": "slack"}
+	]`))
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Equal(t, models.Last24Hours, targets[0].Window)
+	assert.Equal(t, defaultTopN, targets[0].TopN)
+	assert.Equal(t, FormatJSON, targets[0].Format)
+	assert.Equal(t, models.AllTime, targets[1].Window)
+	assert.Equal(t, 3, targets[1].TopN)
+
+	for _, invalid := range []string{
+		`[{"events": ["new_top_player"]}]`,
+		`[{"url": "http://a", "events": ["first_blood"]}]`,
+		`[{"url": "http://a", "window": "1y"}]`,
+		`[{"url": "http://a", "format": "xml"}]`,
+		`{"url": "http://a"}`,
+	} {
+		_, err := ParseTargets([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTarget_Events(t *testing.T) {
+	target := Target{TopN: 2, Window: models.AllTime, Format: FormatJSON}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(userID int64, score, rank uint64) models.LeaderboardEntry {
+		return models.LeaderboardEntry{UserID: userID, Score: score, Rank: rank}
+	}
+	kinds := func(events []models.WebhookEvent) []string {
+		var kinds []string
+		for _, event := range events {
+			kinds = append(kinds, event.Event)
+		}
+		return kinds
+	}
+
+	// A new leader with a better score.
+	events := target.events(store.TopChange{
+		GameID: 1, Window: models.AllTime, At: at,
+		Before: []models.LeaderboardEntry{entry(1, 100, 1), entry(2, 90, 2), entry(3, 80, 3)},
+		After:  []models.LeaderboardEntry{entry(3, 150, 1), entry(1, 100, 2), entry(2, 90, 3)},
+	})
+	assert.Equal(t, []string{EventNewTopPlayer, EventScoreRecord, EventRankEnteredTopN}, kinds(events))
+	assert.Equal(t, models.WebhookEvent{
+		Event: EventNewTopPlayer, GameID: 1, Window: "all", UserID: 3, Score: 150,
+		OldRank: 3, NewRank: 1, PreviousUserID: 1, OccurredAt: at,
+	}, events[0])
+	assert.Equal(t, uint64(100), events[1].PreviousScore)
+
+	// The leader improving only sets a record.
+	events = target.events(store.TopChange{
+		GameID: 1, Window: models.AllTime,
+		Before: []models.LeaderboardEntry{entry(1, 100, 1), entry(2, 90, 2)},
+		After:  []models.LeaderboardEntry{entry(1, 120, 1), entry(2, 90, 2)},
+	})
+	assert.Equal(t, []string{EventScoreRecord}, kinds(events))
+
+	// Only the player moving into the top 2 has entered it.
+	events = target.events(store.TopChange{
+		GameID: 1, Window: models.AllTime,
+		Before: []models.LeaderboardEntry{entry(1, 100, 1), entry(2, 90, 2), entry(3, 80, 3)},
+		After:  []models.LeaderboardEntry{entry(1, 100, 1), entry(3, 95, 2), entry(2, 90, 3)},
+	})
+	assert.Equal(t, []string{EventRankEnteredTopN}, kinds(events))
+	assert.Equal(t, int64(3), events[0].UserID)
+	assert.Equal(t, uint64(3), events[0].OldRank)
+	assert.Equal(t, uint64(2), events[0].NewRank)
+
+	filtered := Target{TopN: 2, Events: []string{EventNewTopPlayer}}
+	assert.Empty(t, filtered.events(store.TopChange{
+		Before: []models.LeaderboardEntry{entry(1, 100, 1)},
+		After:  []models.LeaderboardEntry{entry(1, 120, 1), entry(2, 90, 2)},
+	}))
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	failures int // Requests to fail before accepting
+	bodies   []map[string]any
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var body map[string]any
+	json.NewDecoder(req.Body).Decode(&body)
+	r.bodies = append(r.bodies, body)
+}
+
+func (r *recorder) received() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]any(nil), r.bodies...)
+}
+
+func newTestDispatcher(targets []Target, queueSize, maxAttempts int) *Dispatcher {
+	d := New(targets, queueSize, maxAttempts, time.Second)
+	d.minBackoff = time.Millisecond
+	d.maxBackoff = 5 * time.Millisecond
+	return d
+}
+
+func TestDispatcher_DeliversWithRetries(t *testing.T) {
+	endpoint := &recorder{failures: 2}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	leaderboard := store.NewStore(nil)
+	d := newTestDispatcher([]Target{{URL: server.URL, Events: []string{EventNewTopPlayer}, TopN: 10, Window: models.AllTime}}, 10, 3)
+	d.Watch(leaderboard)
+	d.Start()
+	defer d.Close()
+
+	now := time.Now().UTC()
+	assert.NoError(t, leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now}))
+	assert.NoError(t, leaderboard.SaveScoreBatch([]models.Score{
+		{GameID: 1, UserID: 2, Score: 50, Timestamp: now},
+		{GameID: 1, UserID: 3, Score: 200, Timestamp: now},
+	}))
+
+	assert.Eventually(t, func() bool { return len(endpoint.received()) == 2 }, 2*time.Second, 5*time.Millisecond)
+	bodies := endpoint.received()
+	assert.Equal(t, float64(1), bodies[0]["user_id"])
+	assert.Equal(t, float64(3), bodies[1]["user_id"])
+	assert.NotContains(t, bodies[1], "old_rank")
+	assert.Equal(t, float64(1), bodies[1]["new_rank"])
+	assert.Equal(t, float64(1), bodies[1]["previous_user_id"])
+	assert.Equal(t, "all", bodies[1]["window"])
+	assert.NotEmpty(t, bodies[1]["sent_at"])
+}
+
+func TestDispatcher_NeverBlocksWriters(t *testing.T) {
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	leaderboard := store.NewStore(nil)
+	d := newTestDispatcher([]Target{{URL: server.URL, TopN: 10, Window: models.AllTime}}, 2, 1)
+	d.Watch(leaderboard)
+	d.Start()
+	defer d.Close()
+
+	// Every score is a new record; with the endpoint hanging, all but the
+	// queue's worth are dropped instead of holding up the writes.
+	dropped := metrics.WebhookDropped.Value(EventScoreRecord)
+	done := make(chan struct{})
+	go func() {
+		for i := range 50 {
+			leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: uint64(100 + i), Timestamp: time.Now().UTC()})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("writes blocked on webhook delivery")
+	}
+	assert.Greater(t, metrics.WebhookDropped.Value(EventScoreRecord), dropped)
+}
+
+func TestTarget_ChatPayloads(t *testing.T) {
+	event := models.WebhookEvent{Event: EventNewTopPlayer, GameID: 7, Window: "24h", UserID: 42, Score: 900, NewRank: 1}
+
+	slack, err := (&Target{Format: FormatSlack}).payload(event)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Player 42 took first place in game 7 (24h) with 900"}`, string(slack))
+
+	discord, err := (&Target{Format: FormatDiscord}).payload(event)
+	assert.NoError(t, err)
+	assert.Contains(t, string(discord), `"content"`)
+}
@@ -35,7 +35,7 @@ func setupTestServer(t *testing.T) (*gin.Engine, *store.Store) {
 
 	router := gin.New()
 
-	api.ConfigureRoutes(router, store, nil, nil, responseCache)
+	api.ConfigureRoutes(router, store, nil, nil, responseCache, nil, nil, nil, nil, nil, api.TopLimits{})
 
 	return router, store
 }
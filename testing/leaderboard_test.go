@@ -2,18 +2,34 @@ package test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/IWhitebird/go-leader-board/api"
+	"github.com/IWhitebird/go-leader-board/internal/auth"
+	"github.com/IWhitebird/go-leader-board/internal/doctor"
+	"github.com/IWhitebird/go-leader-board/internal/idempotency"
+	"github.com/IWhitebird/go-leader-board/internal/logging"
+	"github.com/IWhitebird/go-leader-board/internal/metrics"
 	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/ratelimit"
+	"github.com/IWhitebird/go-leader-board/internal/receipt"
+	"github.com/IWhitebird/go-leader-board/internal/scoretime"
 	"github.com/IWhitebird/go-leader-board/internal/store"
 	"github.com/gin-contrib/cache/persistence"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
 )
 
 func setupRouter() (*gin.Engine, *store.Store) {
@@ -22,7 +38,8 @@ func setupRouter() (*gin.Engine, *store.Store) {
 	store := store.NewStore(nil)
 	responseCache := persistence.NewInMemoryStore(time.Minute)
 
-	api.ConfigureRoutes(router, store, nil, nil, responseCache)
+	api.ConfigureRoutes(router, store, nil, nil, responseCache, nil, nil, nil, nil, nil, api.TopLimits{})
+	api.ConfigureAdminRoutes(router, store, nil, nil, nil, nil, nil)
 
 	return router, store
 }
@@ -81,6 +98,196 @@ func TestGetTopLeadersHandler(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestGetTopLeadersHandlerPagination(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 25; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 10), Timestamp: now})
+	}
+
+	tests := []struct {
+		query       string
+		wantStatus  int
+		wantUsers   []int64
+		wantRankLow uint64
+	}{
+		{"limit=3&offset=0", http.StatusOK, []int64{25, 24, 23}, 1},
+		{"limit=3&offset=10", http.StatusOK, []int64{15, 14, 13}, 11},
+		{"limit=10&offset=20", http.StatusOK, []int64{5, 4, 3, 2, 1}, 21},
+		{"limit=10&offset=25", http.StatusOK, []int64{}, 0},
+		{"limit=10&offset=-1", http.StatusBadRequest, nil, 0},
+		{"limit=10&offset=abc", http.StatusBadRequest, nil, 0},
+		{"limit=1000&offset=24", http.StatusOK, []int64{1}, 25},
+		{"limit=1001", http.StatusBadRequest, nil, 0},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/top/1?"+tt.query, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.wantStatus, w.Code, tt.query)
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var response models.TopLeadersResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, uint64(25), response.TotalPlayers)
+		assert.NotNil(t, response.Leaders, tt.query)
+
+		users := make([]int64, len(response.Leaders))
+		for i, leader := range response.Leaders {
+			users[i] = leader.UserID
+		}
+		assert.Equal(t, tt.wantUsers, users, tt.query)
+		if len(response.Leaders) > 0 {
+			assert.Equal(t, tt.wantRankLow, response.Leaders[0].Rank, tt.query)
+		}
+	}
+}
+
+func TestGetTopLeadersHandlerConfiguredLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	leaderboard := store.NewStore(nil)
+	api.ConfigureRoutes(router, leaderboard, nil, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{Default: 2, Max: 5})
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 10; userID++ {
+		leaderboard.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID), Timestamp: now})
+	}
+
+	top := func(query string) (int, models.TopLeadersResponse, models.ErrorResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.TopLeadersResponse
+		var errResponse models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		json.Unmarshal(w.Body.Bytes(), &errResponse)
+		return w.Code, response, errResponse
+	}
+
+	code, response, _ := top("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response.Leaders, 2)
+
+	code, response, _ = top("?limit=5")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response.Leaders, 5)
+
+	code, _, errResponse := top("?limit=6")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, api.CodeInvalidParameter, errResponse.Error.Code)
+	assert.Contains(t, errResponse.Error.Message, "at most 5")
+}
+
+func TestGetTopLeadersHandlerMeIsPerUser(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 150, Timestamp: now})
+
+	getTop := func(query string) models.TopLeadersResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/top/1?limit=2"+query, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.TopLeadersResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// Both viewers hit the same cached leaders but must get their own entry.
+	userA := getTop("&userId=1")
+	userB := getTop("&userId=3")
+	anonymous := getTop("")
+
+	assert.Equal(t, userA.Leaders, userB.Leaders)
+	assert.Equal(t, userA.Leaders, anonymous.Leaders)
+
+	assert.NotNil(t, userA.Me)
+	assert.Equal(t, int64(1), userA.Me.UserID)
+	assert.Equal(t, uint64(3), userA.Me.Rank)
+
+	assert.NotNil(t, userB.Me)
+	assert.Equal(t, int64(3), userB.Me.UserID)
+	assert.Equal(t, uint64(2), userB.Me.Rank)
+
+	assert.Nil(t, anonymous.Me)
+	assert.Nil(t, getTop("&userId=99").Me)
+
+	// A new score changes the board version, so the cached page is not reused.
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 300, Timestamp: now})
+	updated := getTop("&userId=1")
+	assert.Equal(t, int64(1), updated.Leaders[0].UserID)
+	assert.Equal(t, uint64(1), updated.Me.Rank)
+}
+
+func TestIncludeProfile(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now})
+
+	put := func(userID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/users/"+userID, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, put("2", `{"display_name": "Ace", "avatar_url": "https://cdn.example.com/ace.png"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("2", `{"display_name": ""}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("2", `{"avatar_url": "javascript:alert(1)"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put("x", `{}`).Code)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without include the cached page carries no profiles, and it must not
+	// pick them up from a later request that asks for them.
+	var plain models.TopLeadersResponse
+	assert.NoError(t, json.Unmarshal(get("/api/v1/leaderboard/top/1?userId=1").Body.Bytes(), &plain))
+	assert.Nil(t, plain.Leaders[0].Profile)
+
+	w := get("/api/v1/leaderboard/top/1?userId=1&include=profile")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"profile":{"display_name":null,"avatar_url":null}`)
+	var top models.TopLeadersResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &top))
+	assert.Equal(t, "Ace", *top.Leaders[0].Profile.DisplayName)
+	assert.Equal(t, "https://cdn.example.com/ace.png", *top.Leaders[0].Profile.AvatarURL)
+	assert.Nil(t, top.Leaders[1].Profile.DisplayName)
+	assert.Nil(t, top.Me.Profile.DisplayName)
+
+	assert.NoError(t, json.Unmarshal(get("/api/v1/leaderboard/top/1?userId=1").Body.Bytes(), &plain))
+	assert.Nil(t, plain.Leaders[0].Profile)
+
+	var rank models.PlayerRankResponse
+	assert.NoError(t, json.Unmarshal(get("/api/v1/leaderboard/rank/1/2?include=profile").Body.Bytes(), &rank))
+	assert.Equal(t, "Ace", *rank.Profile.DisplayName)
+
+	// Replacing the profile clears the fields left out.
+	assert.Equal(t, http.StatusOK, put("2", `{"display_name": "Ace2"}`).Code)
+	assert.NoError(t, json.Unmarshal(get("/api/v1/leaderboard/rank/1/2?include=profile").Body.Bytes(), &rank))
+	assert.Equal(t, "Ace2", *rank.Profile.DisplayName)
+	assert.Nil(t, rank.Profile.AvatarURL)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/leaderboard/top/1?include=friends").Code)
+}
+
 func TestGetPlayerRankHandler(t *testing.T) {
 	router, store := setupRouter()
 
@@ -125,6 +332,21 @@ func TestGetPlayerRankHandler(t *testing.T) {
 	req, _ = http.NewRequest("GET", "/api/leaderboard/rank/1/99", nil)
 	router.ServeHTTP(w, req)
 
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var notFound models.ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &notFound)
+	assert.NoError(t, err)
+	assert.Equal(t, api.CodePlayerNotFound, notFound.Error.Code)
+	assert.Equal(t, "Player not found", notFound.Error.Message)
+	assert.Equal(t, map[string]any{"game_id": 1.0, "user_id": 99.0, "window": "all"}, notFound.Error.Details)
+
+	// The miss is not cached: the player is found once they submit a score.
+	store.AddScore(models.Score{GameID: 1, UserID: 99, Score: 50, Timestamp: now})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/leaderboard/rank/1/99", nil)
+	router.ServeHTTP(w, req)
+
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Test invalid game ID
@@ -142,6 +364,108 @@ func TestGetPlayerRankHandler(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestRankModes(t *testing.T) {
+	router, store := setupRouter()
+
+	// Everyone holds the same score.
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 4; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: 100, Timestamp: now.Add(time.Duration(userID) * time.Second)})
+	}
+
+	top := func(query string) models.TopLeadersResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1?"+query, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.TopLeadersResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	// Without rankMode ties keep their order of arrival, and say who they
+	// are tied with.
+	response := top("")
+	for i, entry := range response.Leaders {
+		assert.Equal(t, uint64(i+1), entry.Rank)
+		assert.Equal(t, uint64(3), entry.TiedWith)
+	}
+
+	for _, mode := range []string{"competition", "dense"} {
+		response = top("rankMode=" + mode + "&userId=4")
+		assert.Len(t, response.Leaders, 4)
+		for _, entry := range response.Leaders {
+			assert.Equal(t, uint64(1), entry.Rank, mode)
+			assert.Equal(t, uint64(3), entry.TiedWith, mode)
+		}
+		assert.Equal(t, &models.LeaderboardEntry{UserID: 4, Score: 100, Rank: 1, TiedWith: 3}, response.Me)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/rank/1/4?rankMode="+mode, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var rank models.PlayerRankResponse
+		json.Unmarshal(w.Body.Bytes(), &rank)
+		assert.Equal(t, uint64(1), rank.Rank)
+		assert.Equal(t, uint64(3), rank.TiedWith)
+		assert.InDelta(t, 100.0, rank.Percentile, 0.1)
+	}
+
+	// Below the tie competition ranks skip, dense ranks do not.
+	store.AddScore(models.Score{GameID: 1, UserID: 5, Score: 50, Timestamp: now})
+	assert.Equal(t, uint64(5), top("rankMode=competition").Leaders[4].Rank)
+	assert.Equal(t, uint64(2), top("rankMode=dense").Leaders[4].Rank)
+	assert.Equal(t, uint64(5), top("").Leaders[4].Rank)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1?rankMode=olympic", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetPlayerRankHandlerNeighbors(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 5; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(600 - 100*userID), Timestamp: now})
+	}
+
+	rank := func(query string) (int, models.PlayerRankResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/rank/1/3?"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.PlayerRankResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// Without neighbors the payload is unchanged.
+	code, response := rank("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, response.Above)
+	assert.Nil(t, response.Below)
+
+	code, response = rank("neighbors=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(3), response.Rank)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 2, Score: 400, Rank: 2}}, response.Above)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 4, Score: 200, Rank: 4}}, response.Below)
+
+	code, response = rank("neighbors=25")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response.Above, 2)
+	assert.Len(t, response.Below, 2)
+
+	for _, query := range []string{"neighbors=26", "neighbors=-1", "neighbors=x"} {
+		code, _ = rank(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
 func TestSubmitScoreHandler(t *testing.T) {
 	router, _ := setupRouter()
 
@@ -189,3 +513,1602 @@ func TestSubmitScoreHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestSubmitScoreIncludeRank(t *testing.T) {
+	router, store := setupRouter()
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: time.Now().UTC()}))
+
+	submit := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/leaderboard/score"+query, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without the parameter the response stays empty.
+	w := submit("", `{"game_id": 1, "user_id": 2, "score": 100}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	var response models.SubmitScoreResponse
+	w = submit("?includeRank=true", `{"game_id": 1, "user_id": 2, "score": 300}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, &models.SubmissionRank{Rank: 2, Score: 300, Percentile: 50, TotalPlayers: 2, Improved: true}, response.Rank)
+
+	w = submit("?includeRank=true", `{"game_id": 1, "user_id": 2, "score": 700}`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, &models.SubmissionRank{Rank: 1, Score: 700, Percentile: 100, TotalPlayers: 2, Improved: true}, response.Rank)
+
+	// A lower score leaves the best in place.
+	w = submit("?includeRank=true", `{"game_id": 1, "user_id": 2, "score": 200}`)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, &models.SubmissionRank{Rank: 1, Score: 700, Percentile: 100, TotalPlayers: 2, Improved: false}, response.Rank)
+}
+
+func TestRegisteredGames(t *testing.T) {
+	router, store := setupRouter()
+	store.RequireRegisteredGames(true)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/leaderboard/score", `{"game_id": 7, "user_id": 1, "score": 100}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var errResponse models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResponse))
+	assert.Equal(t, api.CodeGameNotFound, errResponse.Error.Code)
+
+	for _, body := range []string{
+		`{"name": "Racer"}`,
+		`{"game_id": 7}`,
+		`{"game_id": 7, "name": "Racer", "sort_order": "asc"}`,
+		`{"game_id": 7, "name": "Racer", "min_score": 10, "max_score": 5}`,
+		`{"game_id": 7, "name": "Racer", "retention_days": -1}`,
+		`{"game_id": 7, "name": "Racer", "scoring": "max"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, request("POST", "/api/admin/games", body).Code, body)
+	}
+
+	w = request("POST", "/api/admin/games", `{"game_id": 7, "name": "Racer", "max_score": 1000, "retention_days": 30}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var game models.Game
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &game))
+	assert.Equal(t, models.SortDescending, game.SortOrder)
+	assert.Equal(t, models.ScoringBest, game.Scoring)
+	assert.Equal(t, 30, *game.RetentionDays)
+	assert.Equal(t, http.StatusOK, request("POST", "/api/admin/games", `{"game_id": 7, "name": "Racer 2", "max_score": 1000}`).Code)
+
+	assert.Equal(t, http.StatusOK, request("POST", "/api/leaderboard/score", `{"game_id": 7, "user_id": 1, "score": 100}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/api/leaderboard/score", `{"game_id": 7, "user_id": 1, "score": 5000}`).Code)
+
+	// Once the board has scores its scoring is settled.
+	assert.NoError(t, store.AddScore(models.Score{GameID: 7, UserID: 2, Score: 10, Timestamp: time.Now().UTC()}))
+	w = request("POST", "/api/admin/games", `{"game_id": 7, "name": "Racer 2", "scoring": "cumulative"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResponse))
+	assert.Equal(t, api.CodeScoringChanged, errResponse.Error.Code)
+
+	var games []models.Game
+	assert.NoError(t, json.Unmarshal(request("GET", "/api/admin/games", "").Body.Bytes(), &games))
+	assert.Len(t, games, 1)
+	assert.Equal(t, "Racer 2", games[0].Name)
+	assert.Nil(t, games[0].RetentionDays)
+}
+
+func TestIncrementScoreHandler(t *testing.T) {
+	router, store := setupRouter()
+	_, _, err := store.RegisterGame(models.Game{GameID: 1, Name: "Grind", SortOrder: models.SortDescending, Scoring: models.ScoringCumulative})
+	assert.NoError(t, err)
+	assert.NoError(t, store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: time.Now().UTC()}))
+
+	increment := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/leaderboard/score/increment", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := increment(`{"game_id": 1, "user_id": 2, "delta": 60}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.IncrementScoreResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint64(60), response.Score)
+	assert.Equal(t, uint64(2), response.Rank)
+	assert.Equal(t, uint64(2), response.TotalPlayers)
+
+	w = increment(`{"game_id": 1, "user_id": 2, "delta": 60}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint64(120), response.Score)
+	assert.Equal(t, uint64(1), response.Rank)
+
+	for _, body := range []string{
+		`{"game_id": 1, "user_id": 2, "delta": 0}`,
+		`{"game_id": 1, "user_id": -2, "delta": 5}`,
+		`{"game_id": 1, "user_id": 2, "delta": -5}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, increment(body).Code, body)
+	}
+
+	// Games keeping best scores cannot be incremented.
+	w = increment(`{"game_id": 2, "user_id": 2, "delta": 5}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var errResponse models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResponse))
+	assert.Equal(t, api.CodeNotCumulative, errResponse.Error.Code)
+}
+
+func TestSubmitScoreHandlerForm(t *testing.T) {
+	router, _ := setupRouter()
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{"game_id=1&user_id=2&score=100", http.StatusOK, nil},
+		{"game_id=1&user_id=2&score=100&timestamp=2024-05-01T10:00:00Z", http.StatusOK, nil},
+		{"game_id=-1&user_id=2&score=100", http.StatusBadRequest, []string{"game_id"}},
+		{"game_id=1&score=100", http.StatusBadRequest, []string{"user_id"}},
+		{"game_id=1&user_id=2&score=abc", http.StatusBadRequest, []string{"score"}},
+		{"game_id=1&user_id=2&score=100&timestamp=yesterday", http.StatusBadRequest, []string{"timestamp"}},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/leaderboard/score", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.wantStatus, w.Code, tt.body)
+		if tt.wantFields != nil {
+			assert.Equal(t, tt.wantFields, invalidFields(t, w), tt.body)
+		}
+	}
+}
+
+// invalidFields returns the fields an INVALID_SCORE response names.
+func invalidFields(t *testing.T, w *httptest.ResponseRecorder) []string {
+	var response struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Fields []models.FieldError `json:"fields"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, api.CodeInvalidScore, response.Error.Code)
+
+	var fields []string
+	for _, field := range response.Error.Details.Fields {
+		assert.NotEmpty(t, field.Reason)
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestSubmitScoreHandlerFieldErrors(t *testing.T) {
+	router, _ := setupRouter()
+
+	tests := []struct {
+		body       string
+		wantFields []string
+	}{
+		{`{"game_id": 0, "user_id": -3, "score": 100}`, []string{"game_id", "user_id"}},
+		{`{"game_id": 1, "user_id": 2}`, nil},
+		{`{"game_id": "1", "user_id": 2, "score": 100}`, []string{"game_id"}},
+		{`{"game_id": 1, "user_id": 2, "score": -5}`, []string{"score"}},
+		{`{"game_id": 1, "user_id": 2, "score": 1.5, "timestamp": "yesterday"}`, []string{"score", "timestamp"}},
+		{`{"game_id": 1, "user_id": 2, "score": 100, "timestamp": null}`, nil},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/leaderboard/score", bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		if tt.wantFields == nil {
+			assert.Equal(t, http.StatusOK, w.Code, tt.body)
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.body)
+		assert.Equal(t, tt.wantFields, invalidFields(t, w), tt.body)
+	}
+
+	// A body that is not JSON at all has no fields to name
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/leaderboard/score", bytes.NewBufferString("{invalid json}"))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, api.CodeInvalidBody, response.Error.Code)
+}
+
+func TestPanicsBecomeInternalErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.RequestIDMiddleware(), api.RecoveryMiddleware())
+	router.GET("/boom", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/boom", nil)
+	router.ServeHTTP(w, req)
+
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, api.CodeInternal, response.Error.Code)
+	assert.NotEmpty(t, response.Error.RequestID)
+	assert.Equal(t, w.Header().Get(api.RequestIDHeader), response.Error.RequestID)
+
+	// A request ID sent by the client is kept
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/boom", nil)
+	req.Header.Set(api.RequestIDHeader, "client-42")
+	router.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "client-42", response.Error.RequestID)
+}
+
+func TestRequestIDReachesContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.RequestIDMiddleware())
+	router.GET("/id", func(c *gin.Context) { c.String(http.StatusOK, logging.RequestID(c.Request.Context())) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/id", nil)
+	router.ServeHTTP(w, req)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, w.Body.String())
+	assert.Equal(t, w.Header().Get(api.RequestIDHeader), w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/id", nil)
+	req.Header.Set(api.RequestIDHeader, "client-42")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "client-42", w.Body.String())
+}
+
+func TestSubmitScoreTimestampBounds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	receipts, err := receipt.NewSigner("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	assert.NoError(t, err)
+
+	newRouter := func(clampOld bool) *gin.Engine {
+		router := gin.New()
+		policy := &scoretime.Policy{MaxSkew: 5 * time.Minute, MaxAge: 30 * 24 * time.Hour, ClampOld: clampOld}
+		api.ConfigureRoutes(router, store.NewStore(nil), nil, nil, persistence.NewInMemoryStore(time.Minute), receipts, nil, nil, nil, policy, api.TopLimits{})
+		return router
+	}
+	submit := func(router *gin.Engine, timestamp time.Time) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"game_id": 1, "user_id": 2, "score": 100, "timestamp": %q}`, timestamp.Format(time.RFC3339))
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/leaderboard/score?receipt=true", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	now := time.Now().UTC()
+	rejecting := newRouter(false)
+	assert.Equal(t, http.StatusOK, submit(rejecting, now.Add(-time.Hour)).Code)
+	assert.Equal(t, http.StatusOK, submit(rejecting, now.Add(time.Minute)).Code)
+
+	w := submit(rejecting, now.AddDate(1, 0, 0))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"timestamp"}, invalidFields(t, w))
+
+	w = submit(rejecting, now.AddDate(0, 0, -60))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"timestamp"}, invalidFields(t, w))
+
+	// Clamped scores are accepted at the oldest allowed time.
+	clamping := newRouter(true)
+	assert.Equal(t, http.StatusBadRequest, submit(clamping, now.AddDate(1, 0, 0)).Code)
+	w = submit(clamping, now.AddDate(0, 0, -60))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var submitted models.SubmitScoreResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submitted))
+	claims, err := receipts.Verify(submitted.Receipt)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, now.Add(-30*24*time.Hour), claims.Timestamp, time.Minute)
+}
+
+func TestSubmitScoreQueryHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	// GET submission is off unless its routes are configured.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/leaderboard/score/submit?game_id=1&user_id=2&score=100", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	api.ConfigureQuerySubmitRoutes(router, store, nil, nil, nil, nil, nil, nil)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"game_id=1&user_id=2&score=100", http.StatusOK},
+		{"game_id=1&user_id=0&score=100", http.StatusBadRequest},
+		{"game_id=x&user_id=2&score=100", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/score/submit?"+tt.query, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.wantStatus, w.Code, tt.query)
+	}
+}
+
+func TestGetGamesHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := store.NewStore(nil)
+	api.ConfigureRoutes(router, store, &mockPgRepo{games: []int64{1, 2, 4, 9}}, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now})
+	store.AddScore(models.Score{GameID: 3, UserID: 1, Score: 100, Timestamp: now})
+
+	// Hidden games, like the canary's, are never listed.
+	store.HideGame(9)
+	store.AddScore(models.Score{GameID: 9, UserID: 1, Score: 100, Timestamp: now})
+
+	getGames := func(query string) (int, models.GamesResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/games"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.GamesResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// Games only in Postgres are listed as not loaded.
+	code, response := getGames("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 4, response.Total)
+	assert.Equal(t, []models.GameInfo{
+		{GameID: 1, TotalPlayers: 2, Loaded: true},
+		{GameID: 2},
+		{GameID: 3, TotalPlayers: 1, Loaded: true},
+		{GameID: 4},
+	}, response.Games)
+
+	_, response = getGames("?limit=2&offset=1")
+	assert.Equal(t, 1, response.Offset)
+	assert.Equal(t, []int64{2, 3}, []int64{response.Games[0].GameID, response.Games[1].GameID})
+
+	_, response = getGames("?offset=10")
+	assert.Empty(t, response.Games)
+	assert.Equal(t, 4, response.Total)
+
+	code, _ = getGames("?limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Without Postgres only the loaded games are known.
+	memoryOnly, _ := setupRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/games", nil)
+	memoryOnly.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"games":[]`)
+}
+
+func TestSubmittedBeforeFreezesStandings(t *testing.T) {
+	end := time.Now().UTC().Truncate(time.Second)
+	repo := &mockPgRepo{scores: []models.Score{
+		{GameID: 1, UserID: 1, Score: 300, Timestamp: end.Add(-time.Hour), ReceivedAt: end.Add(-time.Hour)},
+		{GameID: 1, UserID: 2, Score: 200, Timestamp: end.Add(-time.Hour), ReceivedAt: end.Add(-time.Hour)},
+	}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.ConfigureRoutes(router, store.NewStore(nil), repo, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	frozen := "submitted_before=" + url.QueryEscape(end.Format(time.RFC3339))
+	get := func(path string, response any) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		json.Unmarshal(w.Body.Bytes(), response)
+		return w.Code
+	}
+
+	var top models.TopLeadersResponse
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1?userId=2&"+frozen, &top))
+	want := top
+
+	// Back-dated scores that arrive after the instant do not move the frozen
+	// standings, nor does a new player.
+	repo.scores = append(repo.scores,
+		models.Score{GameID: 1, UserID: 2, Score: 900, Timestamp: end.Add(-30 * time.Minute), ReceivedAt: end.Add(time.Minute)},
+		models.Score{GameID: 1, UserID: 3, Score: 500, Timestamp: end.Add(-30 * time.Minute), ReceivedAt: end.Add(time.Minute)},
+	)
+
+	top = models.TopLeadersResponse{}
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1?userId=2&"+frozen, &top))
+	assert.Equal(t, want, top)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 300, Rank: 1}, {UserID: 2, Score: 200, Rank: 2}}, top.Leaders)
+	assert.Equal(t, uint64(2), top.TotalPlayers)
+	assert.Equal(t, &models.LeaderboardEntry{UserID: 2, Score: 200, Rank: 2}, top.Me)
+	assert.True(t, end.Equal(*top.SubmittedBefore))
+
+	var rank models.PlayerRankResponse
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/2?"+frozen, &rank))
+	assert.Equal(t, uint64(2), rank.Rank)
+	assert.Equal(t, uint64(200), rank.Score)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/leaderboard/rank/1/3?"+frozen, &rank))
+
+	// A later instant sees the late scores.
+	later := "submitted_before=" + url.QueryEscape(end.Add(time.Hour).Format(time.RFC3339))
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/2?"+later, &rank))
+	assert.Equal(t, uint64(1), rank.Rank)
+
+	var history models.ScoreHistoryResponse
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/history/1/2", &history))
+	assert.Len(t, history.Scores, 2)
+	for _, score := range history.Scores {
+		assert.False(t, score.ReceivedAt.IsZero())
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/leaderboard/top/1?submitted_before=yesterday", &top))
+
+	// Without Postgres there are no receipt times to freeze on.
+	memoryOnly, _ := setupRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1?"+frozen, nil)
+	memoryOnly.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestSeasonBoards(t *testing.T) {
+	now := time.Now().UTC()
+	current := models.Season{SeasonID: 2, GameID: 1, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	frozenAt := current.StartsAt
+	past := models.Season{SeasonID: 1, GameID: 1, StartsAt: now.Add(-3 * time.Hour), EndsAt: current.StartsAt, FrozenAt: &frozenAt}
+	repo := &mockPgRepo{
+		seasons: []models.Season{past, current},
+		scores: []models.Score{
+			{GameID: 1, UserID: 1, Score: 900, Timestamp: past.StartsAt, SeasonID: 1},
+			{GameID: 1, UserID: 2, Score: 400, Timestamp: past.StartsAt, SeasonID: 1},
+		},
+	}
+
+	leaderboard := store.NewStore(nil)
+	leaderboard.SetOpenSeasons([]models.Season{current})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 900, Timestamp: past.StartsAt, ReceivedAt: past.StartsAt})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 2, Score: 100, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 3, Score: 200, Timestamp: now})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.ConfigureRoutes(router, leaderboard, repo, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	get := func(path string, response any) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		json.Unmarshal(w.Body.Bytes(), response)
+		return w.Code
+	}
+
+	// The current season only has the scores received in it, although the
+	// game's board has every score.
+	var top models.TopLeadersResponse
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1?season=current&userId=2", &top))
+	assert.Equal(t, int64(2), top.SeasonID)
+	assert.Equal(t, uint64(2), top.TotalPlayers)
+	assert.Equal(t, int64(3), top.Leaders[0].UserID)
+	assert.Equal(t, uint64(2), top.Me.Rank)
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1?season=2", &top))
+	assert.Equal(t, int64(3), top.Leaders[0].UserID)
+
+	// Past seasons are read from Postgres.
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1?season=1", &top))
+	assert.Equal(t, int64(1), top.SeasonID)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 900, Rank: 1}, {UserID: 2, Score: 400, Rank: 2}}, top.Leaders)
+
+	var rank models.PlayerRankResponse
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/2?season=1", &rank))
+	assert.Equal(t, uint64(400), rank.Score)
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/2?season=current", &rank))
+	assert.Equal(t, uint64(100), rank.Score)
+	assert.Equal(t, int64(2), rank.SeasonID)
+
+	var failure models.ErrorResponse
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/leaderboard/rank/1/1?season=current", &failure))
+	assert.Equal(t, api.CodePlayerNotFound, failure.Error.Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/leaderboard/top/2?season=current", &failure))
+	assert.Equal(t, api.CodeSeasonNotFound, failure.Error.Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/leaderboard/top/2?season=1", &failure))
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/leaderboard/top/1?season=1&window=24h", &failure))
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/leaderboard/top/1?season=last", &failure))
+
+	var seasons []models.Season
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/seasons/1", &seasons))
+	assert.Len(t, seasons, 2)
+}
+
+func TestGetScoreHistoryHandler(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	repo := &mockPgRepo{}
+	for i := range 5 {
+		repo.scores = append(repo.scores, models.Score{GameID: 1, UserID: 1, Score: uint64(100 - i), Timestamp: now.Add(-time.Duration(i) * time.Minute)})
+	}
+	repo.scores = append(repo.scores, models.Score{GameID: 1, UserID: 2, Score: 500, Timestamp: now})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.ConfigureRoutes(router, store.NewStore(nil), repo, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	getHistory := func(path string) (int, models.ScoreHistoryResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.ScoreHistoryResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// Page through the player's history two submissions at a time.
+	var scores []uint64
+	path := "/api/v1/leaderboard/history/1/1?limit=2"
+	for pages := 0; ; pages++ {
+		code, response := getHistory(path)
+		assert.Equal(t, http.StatusOK, code)
+		for _, score := range response.Scores {
+			scores = append(scores, score.Score)
+		}
+		if response.NextBefore == nil {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		path = "/api/v1/leaderboard/history/1/1?limit=2&before=" + url.QueryEscape(response.NextBefore.Format(time.RFC3339Nano))
+	}
+	assert.Equal(t, []uint64{100, 99, 98, 97, 96}, scores)
+
+	// A player who never submitted is not found.
+	code, _ := getHistory("/api/v1/leaderboard/history/1/3")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = getHistory("/api/v1/leaderboard/history/1/1?before=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = getHistory("/api/v1/leaderboard/history/1/1?limit=1000")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// The endpoint is only routed with Postgres configured.
+	memoryOnly, _ := setupRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/history/1/1", nil)
+	memoryOnly.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetUserRanksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 3, UserID: 1, Score: 100, Timestamp: now.Add(-48 * time.Hour)})
+	store.AddScore(models.Score{GameID: 3, UserID: 2, Score: 300, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 400, Timestamp: now})
+	store.AddScore(models.Score{GameID: 2, UserID: 2, Score: 50, Timestamp: now})
+
+	getRanks := func(path string) (int, models.UserRanksResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.UserRanksResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// Game 2 has no score from the player and is left out.
+	code, response := getRanks("/api/v1/leaderboard/user/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), response.UserID)
+	assert.Equal(t, []models.UserGameRank{
+		{GameID: 1, Rank: 1, Score: 500, Percentile: 100, TotalPlayers: 2},
+		{GameID: 3, Rank: 2, Score: 100, Percentile: 50, TotalPlayers: 2},
+	}, response.Games)
+
+	_, response = getRanks("/api/v1/leaderboard/user/1?window=24h")
+	assert.Equal(t, "24h", response.Window)
+	assert.Equal(t, 1, len(response.Games))
+	assert.Equal(t, int64(1), response.Games[0].GameID)
+
+	_, response = getRanks("/api/v1/leaderboard/user/42")
+	assert.NotNil(t, response.Games)
+	assert.Empty(t, response.Games)
+
+	code, _ = getRanks("/api/v1/leaderboard/user/abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestResetGameHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 50, Timestamp: now})
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 100, Timestamp: now})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Warm the response cache for the old board.
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/top/1").Code)
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/1").Code)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/v1/admin/leaderboard/1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ResetGameResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ResetGameResponse{GameID: 1, PlayersRemoved: 2}, response)
+
+	var top models.TopLeadersResponse
+	assert.NoError(t, json.Unmarshal(get("/api/v1/leaderboard/top/1").Body.Bytes(), &top))
+	assert.Empty(t, top.Leaders)
+	assert.Equal(t, uint64(0), top.TotalPlayers)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/leaderboard/rank/1/1").Code)
+
+	// Other games are untouched, and the reset board takes new scores.
+	assert.Equal(t, uint64(1), store.TotalPlayers(2))
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 10, Timestamp: now})
+	assert.Equal(t, http.StatusOK, get("/api/v1/leaderboard/rank/1/3").Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/v1/admin/leaderboard/abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLiveTopLeadersHandler(t *testing.T) {
+	router, store := setupRouter()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 50, Timestamp: now})
+
+	ws, err := websocket.Dial("ws"+server.URL[len("http"):]+"/api/v1/leaderboard/live/1?limit=2", "", server.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	receive := func() models.TopLeadersResponse {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var frame models.TopLeadersResponse
+		assert.NoError(t, websocket.JSON.Receive(ws, &frame))
+		return frame
+	}
+
+	frame := receive()
+	assert.Equal(t, int64(1), frame.GameID)
+	assert.Equal(t, "all", frame.Window)
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 2, Score: 50, Rank: 2}}, frame.Leaders)
+
+	// A player entering the top 2 is pushed without polling.
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 75, Timestamp: now})
+	frame = receive()
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 1, Score: 100, Rank: 1}, {UserID: 3, Score: 75, Rank: 2}}, frame.Leaders)
+	assert.Equal(t, uint64(3), frame.TotalPlayers)
+
+	for _, path := range []string{"/api/v1/leaderboard/live/abc", "/api/v1/leaderboard/live/1?limit=1000", "/api/v1/leaderboard/live/1?window=1y"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	leaderboard := store.NewStore(nil)
+	api.ConfigureMetrics(router, metrics.Default)
+	api.ConfigureRoutes(router, leaderboard, nil, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, nil, nil, nil, api.TopLimits{})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const route = "/api/v1/leaderboard/top/:gameId"
+	ok := metrics.HTTPRequests.Value("GET", route, "200")
+	bad := metrics.HTTPRequests.Value("GET", route, "400")
+	timed := metrics.HTTPRequestDuration.Count("GET", route)
+	unmatched := metrics.HTTPRequests.Value("GET", "unmatched", "404")
+	applied := metrics.ScoresApplied.Value()
+	rejected := metrics.ScoresRejected.Value()
+
+	now := time.Now().UTC()
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 2, Score: 50, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: -1, Score: 50, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 2, UserID: 1, Score: 50, Timestamp: now})
+
+	get("/api/v1/leaderboard/top/1")
+	get("/api/v1/leaderboard/top/2")
+	get("/api/v1/leaderboard/top/abc")
+	get("/nowhere")
+
+	// Requests are counted by route template, not by path.
+	assert.Equal(t, ok+2, metrics.HTTPRequests.Value("GET", route, "200"))
+	assert.Equal(t, bad+1, metrics.HTTPRequests.Value("GET", route, "400"))
+	assert.Equal(t, timed+3, metrics.HTTPRequestDuration.Count("GET", route))
+	assert.Equal(t, unmatched+1, metrics.HTTPRequests.Value("GET", "unmatched", "404"))
+	assert.Equal(t, applied+3, metrics.ScoresApplied.Value())
+	assert.Equal(t, rejected+1, metrics.ScoresRejected.Value())
+
+	// Store gauges are read when scraped.
+	metrics.Default.OnScrape(leaderboard.RecordMetrics)
+	w := get("/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "leaderboard_store_games_loaded 2\n")
+	assert.Contains(t, w.Body.String(), `leaderboard_store_entries{window="all"} 3`+"\n")
+	assert.Contains(t, w.Body.String(), `leaderboard_http_requests_total{method="GET",route="/api/v1/leaderboard/top/:gameId",status="200"}`)
+	assert.Contains(t, w.Body.String(), "# TYPE leaderboard_postgres_query_duration_seconds histogram")
+}
+
+func TestRunDoctorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	leaderboard := store.NewStore(nil)
+	responseCache := persistence.NewInMemoryStore(time.Minute)
+
+	check := doctor.New(leaderboard)
+	check.AddCheck(api.CacheCheck(leaderboard, responseCache))
+	api.ConfigureRoutes(router, leaderboard, nil, nil, responseCache, nil, nil, nil, nil, nil, api.TopLimits{})
+	api.ConfigureAdminRoutes(router, leaderboard, nil, nil, nil, check, nil)
+
+	now := time.Now().UTC()
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 2, Score: 50, Timestamp: now})
+
+	run := func(path string) (int, doctor.Report) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		router.ServeHTTP(w, req)
+
+		var report doctor.Report
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+	result := func(report doctor.Report, name string) doctor.Result {
+		for _, result := range report.Checks {
+			if result.Name == name {
+				return result
+			}
+		}
+		return doctor.Result{}
+	}
+
+	// Warm the cached first page.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1", nil)
+	router.ServeHTTP(w, req)
+
+	code, report := run("/api/v1/admin/doctor/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Healthy)
+	assert.Equal(t, int64(1), report.GameID)
+	assert.Equal(t, doctor.StatusPass, result(report, "response_cache").Status)
+	assert.Equal(t, "1 cached top lists match the board", result(report, "response_cache").Detail)
+	assert.Equal(t, doctor.StatusSkip, result(report, "postgres").Status)
+
+	// A cached page that no longer matches the board at the same version, as
+	// after a write that did not bump it.
+	key := fmt.Sprintf("top:1:all:ordinal:10:0:%d", leaderboard.BoardVersion(1))
+	responseCache.Set(key, models.TopLeadersResponse{GameID: 1, Leaders: []models.LeaderboardEntry{{UserID: 2, Score: 50, Rank: 1}}}, time.Minute)
+
+	code, report = run("/api/v1/admin/doctor/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, report.Healthy)
+	assert.Equal(t, doctor.StatusFail, result(report, "response_cache").Status)
+	assert.NotEmpty(t, result(report, "response_cache").Remediation)
+
+	code, _ = run("/api/v1/admin/doctor/abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestEraseUserHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 2, UserID: 1, Score: 100, Timestamp: now})
+	store.AddScore(models.Score{GameID: 2, UserID: 2, Score: 50, Timestamp: now})
+
+	erase := func(path string) (int, models.EraseUserResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", path, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.EraseUserResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := erase("/api/v1/leaderboard/user/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, response.GamesAffected)
+	assert.Equal(t, []int64{1, 2}, response.GameIDs)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/2", nil)
+	router.ServeHTTP(w, req)
+	var top models.TopLeadersResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &top))
+	assert.Equal(t, []models.LeaderboardEntry{{UserID: 2, Score: 50, Rank: 1}}, top.Leaders)
+
+	// Erasure is idempotent.
+	code, response = erase("/api/v1/leaderboard/user/1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, response.GamesAffected)
+
+	code, _ = erase("/api/v1/leaderboard/user/abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestGetMultiTopLeadersHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 5; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 100), Timestamp: now})
+		store.AddScore(models.Score{GameID: 2, UserID: userID, Score: uint64(userID * 10), Timestamp: now.Add(-48 * time.Hour)})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/leaderboard/top?gameIds=1,2,99&limit=3&window=24h", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[int64]models.TopLeadersResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 3)
+	assert.Len(t, response[1].Leaders, 3)
+	assert.Equal(t, int64(5), response[1].Leaders[0].UserID)
+	assert.Equal(t, uint64(5), response[1].TotalPlayers)
+	assert.Equal(t, "24h", response[1].Window)
+	assert.Empty(t, response[2].Leaders) // only older scores
+	assert.NotNil(t, response[99].Leaders)
+	assert.Empty(t, response[99].Leaders)
+
+	tooMany := make([]string, 51)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for _, query := range []string{"", "gameIds=", "gameIds=1,x", "gameIds=" + strings.Join(tooMany, ","), "gameIds=1&limit=1001"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/top?"+query, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetPlayerRanksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 5; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 100), Timestamp: now})
+	}
+	store.AddScore(models.Score{GameID: 1, UserID: 6, Score: 1000, Timestamp: now.Add(-48 * time.Hour)})
+
+	check := func(req *http.Request, wantRanks []uint64, wantFound []bool) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response []models.PlayerRankLookup
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, len(wantRanks), len(response))
+		for i := range response {
+			assert.Equal(t, wantRanks[i], response[i].Rank)
+			assert.Equal(t, wantFound[i], response[i].Found)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/api/leaderboard/ranks/1?userIds=5,42,1,6", nil)
+	check(req, []uint64{2, 0, 6, 1}, []bool{true, false, true, true})
+
+	req, _ = http.NewRequest("GET", "/api/leaderboard/ranks/1?userIds=5,1,6&window=24h", nil)
+	check(req, []uint64{1, 5, 0}, []bool{true, true, false})
+
+	req, _ = http.NewRequest("POST", "/api/leaderboard/ranks/1", bytes.NewBufferString(`{"user_ids":[3,4],"window":"7d"}`))
+	req.Header.Set("Content-Type", "application/json")
+	check(req, []uint64{4, 3}, []bool{true, true})
+
+	for _, path := range []string{"/api/leaderboard/ranks/1", "/api/leaderboard/ranks/1?userIds=1,x", "/api/leaderboard/ranks/1?userIds=1&window=1y"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
+
+func TestGetAroundPlayerHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for userID := int64(1); userID <= 10; userID++ {
+		store.AddScore(models.Score{GameID: 1, UserID: userID, Score: uint64(userID * 100), Timestamp: now})
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantUsers  []int64
+	}{
+		{"/api/leaderboard/around/1/5?count=2", http.StatusOK, []int64{7, 6, 5, 4, 3}},
+		{"/api/leaderboard/around/1/10?count=2", http.StatusOK, []int64{10, 9, 8}},
+		{"/api/leaderboard/around/1/1?count=2", http.StatusOK, []int64{3, 2, 1}},
+		{"/api/leaderboard/around/1/1?count=0", http.StatusOK, []int64{1}},
+		{"/api/leaderboard/around/1/42", http.StatusNotFound, nil},
+		{"/api/leaderboard/around/2/1", http.StatusNotFound, nil},
+		{"/api/leaderboard/around/1/5?count=-1", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.wantStatus, w.Code, tt.path)
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+
+		var response models.AroundPlayerResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		users := make([]int64, len(response.Entries))
+		for i, entry := range response.Entries {
+			users[i] = entry.UserID
+		}
+		assert.Equal(t, tt.wantUsers, users, tt.path)
+		assert.Equal(t, uint64(10), response.TotalPlayers)
+	}
+}
+
+func TestSubmissionReceipts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := store.NewStore(nil)
+	receipts, err := receipt.NewSigner("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	assert.NoError(t, err)
+	api.ConfigureRoutes(router, store, nil, nil, persistence.NewInMemoryStore(time.Minute), receipts, nil, nil, nil, nil, api.TopLimits{})
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 900, Timestamp: now})
+
+	score := models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: now}
+	scoreJSON, _ := json.Marshal(score)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/leaderboard/score?receipt=true", bytes.NewBuffer(scoreJSON))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var submitted models.SubmitScoreResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &submitted))
+	assert.NotEmpty(t, submitted.Receipt)
+
+	verify := func(token string) models.ReceiptVerificationResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/verify?receipt="+url.QueryEscape(token), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.ReceiptVerificationResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// The consumer has not applied the score yet.
+	response := verify(submitted.Receipt)
+	assert.True(t, response.Valid)
+	assert.Equal(t, models.ReceiptRemoved, response.Status)
+	assert.Equal(t, uint64(2), response.Claims.Rank)
+
+	store.AddScore(score)
+	assert.Equal(t, models.ReceiptStanding, verify(submitted.Receipt).Status)
+
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 700, Timestamp: now})
+	assert.Equal(t, models.ReceiptSuperseded, verify(submitted.Receipt).Status)
+
+	tampered := submitted.Receipt[:len(submitted.Receipt)-4] + "AAAA"
+	response = verify(tampered)
+	assert.False(t, response.Valid)
+	assert.NotEmpty(t, response.Error)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"kid":"k1"`)
+}
+
+func TestGetScoreThresholdHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 400, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 400, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 4, Score: 400, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 5, Score: 100, Timestamp: now})
+
+	getThreshold := func(query string) (int, models.ScoreThresholdResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/threshold/1"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.ScoreThresholdResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// The threshold falls in the middle of a three-way tie.
+	code, response := getThreshold("?rank=3")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(400), response.Threshold)
+	assert.Equal(t, uint64(3), response.Ties)
+	assert.Equal(t, uint64(5), response.Players)
+
+	code, response = getThreshold("?rank=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(500), response.Threshold)
+	assert.Equal(t, uint64(1), response.Ties)
+
+	// Fewer players than the requested rank: any score qualifies.
+	code, response = getThreshold("?rank=100")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(0), response.Threshold)
+	assert.Equal(t, uint64(5), response.Players)
+
+	code, _ = getThreshold("?rank=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = getThreshold("?rank=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// A new score invalidates the cached threshold.
+	store.AddScore(models.Score{GameID: 1, UserID: 6, Score: 450, Timestamp: now})
+	_, response = getThreshold("?rank=3")
+	assert.Equal(t, uint64(400), response.Threshold)
+	_, response = getThreshold("?rank=2")
+	assert.Equal(t, uint64(450), response.Threshold)
+	assert.Equal(t, uint64(1), response.Ties)
+}
+
+func TestGetScoreSketchHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	for i := range 100 {
+		store.AddScore(models.Score{GameID: 1, UserID: int64(i + 1), Score: uint64((i + 1) * 10), Timestamp: now})
+	}
+
+	getSketch := func(query string) (int, models.SketchResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/sketch/1"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.SketchResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := getSketch("?q=0,0.5,1&window=all")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(100), response.Count)
+	assert.Equal(t, "all", response.Window)
+	assert.Equal(t, 3, len(response.Quantiles))
+	for i, want := range []float64{10, 500, 1000} {
+		assert.InDelta(t, want, response.Quantiles[i].Score, want*response.RelativeError+1)
+	}
+
+	// The default quantiles are the median, p90 and p99.
+	_, response = getSketch("")
+	assert.Equal(t, []float64{0.5, 0.9, 0.99}, []float64{response.Quantiles[0].Q, response.Quantiles[1].Q, response.Quantiles[2].Q})
+
+	// An empty board has no quantiles.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/leaderboard/sketch/2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"quantiles":[]`)
+
+	code, _ = getSketch("?q=1.5")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = getSketch("?q=0.5,abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestWindowParamIsNormalized(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantWindow string
+	}{
+		{"", http.StatusOK, "all"},
+		{"&window=all", http.StatusOK, "all"},
+		{"&window=alltime", http.StatusOK, "all"},
+		{"&window=ALL", http.StatusOK, "all"},
+		{"&window=24h", http.StatusOK, "24h"},
+		{"&window=7d", http.StatusOK, "7d"},
+		{"&window=1d", http.StatusOK, "24h"},
+		{"&window=168h", http.StatusOK, "7d"},
+		{"&window=48h", http.StatusOK, "2d"},
+		{"&window=12H", http.StatusOK, "12h"},
+		{"&window=30d", http.StatusOK, "30d"},
+		{"&window=1y", http.StatusBadRequest, ""},
+		{"&window=0h", http.StatusBadRequest, ""},
+		{"&window=-5d", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		for _, path := range []string{"/api/leaderboard/top/1?limit=5", "/api/leaderboard/rank/1/1?", "/api/leaderboard/threshold/1?rank=1"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, path+tt.query)
+
+			if tt.wantStatus == http.StatusOK {
+				var response map[string]any
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantWindow, response["window"], path+tt.query)
+			} else {
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, api.CodeInvalidWindow, response.Error.Code, path+tt.query)
+				assert.Contains(t, response.Error.Message, "24h", path+tt.query)
+			}
+		}
+	}
+}
+
+func TestCustomWindows(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 500, Timestamp: now.Add(-60 * time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 300, Timestamp: now.Add(-30 * time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 3, Score: 100, Timestamp: now.Add(-time.Hour)})
+	store.AddScore(models.Score{GameID: 1, UserID: 4, Score: 900, Timestamp: now.Add(-20 * 24 * time.Hour)})
+
+	top := func(window string) []int64 {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/leaderboard/top/1?window="+window, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, window)
+
+		var response models.TopLeadersResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var users []int64
+		for _, entry := range response.Leaders {
+			users = append(users, entry.UserID)
+		}
+		return users
+	}
+
+	assert.Equal(t, []int64{3}, top("12h"))
+	assert.Equal(t, []int64{2, 3}, top("48h"))
+	assert.Equal(t, []int64{1, 2, 3}, top("7d"))
+	assert.Equal(t, []int64{4, 1, 2, 3}, top("30d"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/leaderboard/rank/1/2?window=48h", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rank models.PlayerRankResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rank))
+	assert.Equal(t, uint64(1), rank.Rank)
+	assert.Equal(t, uint64(2), rank.TotalPlayers)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/leaderboard/top/1?window=400d", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Snapshots only hold the standard windows.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/leaderboard/percentile/1?score=100&as_of="+now.Format(time.RFC3339)+"&window=48h", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestVersionedAndLegacyPathsMatch(t *testing.T) {
+	router, store := setupRouter()
+
+	now := time.Now().UTC()
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 300, Timestamp: now})
+	store.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now})
+
+	paths := []string{
+		"/leaderboard/top/1?limit=5",
+		"/leaderboard/rank/1/2?window=24h",
+		"/leaderboard/rank/1/99",
+		"/leaderboard/around/1/1?count=1",
+		"/leaderboard/threshold/1?rank=1",
+		"/leaderboard/ranks/1?userIds=1,2",
+		"/leaderboard/top/abc",
+	}
+
+	for _, path := range paths {
+		current := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", api.CurrentPrefix+path, nil)
+		router.ServeHTTP(current, req)
+
+		legacy := httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api"+path, nil)
+		router.ServeHTTP(legacy, req)
+
+		assert.Equal(t, current.Code, legacy.Code, path)
+		assert.Equal(t, current.Body.String(), legacy.Body.String(), path)
+
+		assert.Empty(t, current.Header().Get("Deprecation"), path)
+		assert.Equal(t, "true", legacy.Header().Get("Deprecation"), path)
+		assert.Equal(t, "<"+api.CurrentPrefix+path+">; rel=\"successor-version\"", legacy.Header().Get("Link"), path)
+	}
+
+	// Submissions are accepted under both prefixes.
+	for _, prefix := range []string{api.CurrentPrefix, "/api"} {
+		body, _ := json.Marshal(models.Score{GameID: 2, UserID: 1, Score: 10, Timestamp: now})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", prefix+"/leaderboard/score", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, prefix)
+	}
+}
+
+func TestSubmitScoreRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := store.NewStore(nil)
+	limiter := ratelimit.New(0.001, 5, 100)
+	api.ConfigureRoutes(router, store, nil, nil, persistence.NewInMemoryStore(time.Minute), nil, limiter, nil, nil, nil, api.TopLimits{})
+
+	submit := func(body, contentType, remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/leaderboard/score", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Concurrent submissions for each player get exactly the burst through,
+	// whichever address they come from.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int64]map[int]int{1: {}, 2: {}}
+	for i := range 40 {
+		userID := int64(i%2 + 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"game_id": 1, "user_id": %d, "score": %d}`, userID, 100+i)
+			w := submit(body, "application/json", fmt.Sprintf("10.0.0.%d:1234", i))
+			if w.Code == http.StatusTooManyRequests {
+				assert.NotEmpty(t, w.Header().Get("Retry-After"))
+			}
+			mu.Lock()
+			codes[userID][w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for userID, byCode := range codes {
+		assert.Equal(t, 5, byCode[http.StatusOK], "user %d", userID)
+		assert.Equal(t, 15, byCode[http.StatusTooManyRequests], "user %d", userID)
+	}
+
+	// Form submissions share the player's bucket, and the handler still
+	// reads the body the limiter looked at.
+	w := submit("game_id=1&user_id=3&score=10", binding.MIMEPOSTForm, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = submit("game_id=1&user_id=1&score=10", binding.MIMEPOSTForm, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+
+	// Without a user ID submissions are limited by client IP.
+	for range 5 {
+		w = submit(`{"score": 1}`, "application/json", "10.0.0.9:1234")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+	w = submit(`{"score": 1}`, "application/json", "10.0.0.9:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	w = submit(`{"score": 1}`, "application/json", "10.0.0.10:1234")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeys("ingest:s3cret")
+	assert.NoError(t, err)
+
+	setup := func(lockReads bool) *gin.Engine {
+		keys.SetReadsLocked(lockReads)
+		router := gin.New()
+		store := store.NewStore(nil)
+		api.ConfigureRoutes(router, store, nil, nil, persistence.NewInMemoryStore(time.Minute), nil, nil, keys, nil, nil, api.TopLimits{})
+		api.ConfigureAdminRoutes(router, store, nil, nil, nil, nil, keys)
+		return router
+	}
+
+	request := func(router *gin.Engine, method, path, key string) *httptest.ResponseRecorder {
+		body := bytes.NewBufferString("")
+		if method == "POST" {
+			body = bytes.NewBufferString(`{"game_id": 1, "user_id": 1, "score": 100}`)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(api.APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := setup(false)
+	tests := []struct {
+		method, path, key string
+		wantStatus        int
+		wantCode          string
+	}{
+		{"POST", "/api/v1/leaderboard/score", "", http.StatusUnauthorized, api.CodeMissingAPIKey},
+		{"POST", "/api/v1/leaderboard/score", "wrong", http.StatusUnauthorized, api.CodeInvalidAPIKey},
+		{"POST", "/api/v1/leaderboard/score", "s3cret", http.StatusOK, ""},
+		{"POST", "/api/leaderboard/score", "s3cret", http.StatusOK, ""},
+		{"DELETE", "/api/v1/leaderboard/user/1", "", http.StatusUnauthorized, api.CodeMissingAPIKey},
+		{"GET", "/api/v1/admin/games/1/excluded", "", http.StatusUnauthorized, api.CodeMissingAPIKey},
+		{"GET", "/api/v1/admin/games/1/excluded", "s3cret", http.StatusOK, ""},
+		{"GET", "/api/v1/leaderboard/top/1", "", http.StatusOK, ""},
+		{"GET", "/api/v1/health", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := request(router, tt.method, tt.path, tt.key)
+		assert.Equal(t, tt.wantStatus, w.Code, "%s %s", tt.method, tt.path)
+		if tt.wantCode != "" {
+			var response models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantCode, response.Error.Code)
+			assert.NotEmpty(t, response.Error.Message)
+		}
+	}
+
+	// Locked reads need a key too, except the health check
+	router = setup(true)
+	assert.Equal(t, http.StatusUnauthorized, request(router, "GET", "/api/v1/leaderboard/top/1", "").Code)
+	assert.Equal(t, http.StatusOK, request(router, "GET", "/api/v1/leaderboard/top/1", "s3cret").Code)
+	assert.Equal(t, http.StatusOK, request(router, "POST", "/api/v1/leaderboard/score", "s3cret").Code)
+	assert.Equal(t, http.StatusOK, request(router, "GET", "/api/v1/health", "").Code)
+}
+
+func TestDebugRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeys("ops:s3cret")
+	assert.NoError(t, err)
+
+	store := store.NewStore(nil)
+	store.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: time.Now().UTC()})
+	router := gin.New()
+	api.ConfigureDebugRoutes(router, store, keys)
+
+	request := func(path, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(api.APIKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("/debug/store", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/debug/pprof/heap", "").Code)
+
+	w := request("/debug/store", "s3cret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report models.DebugStoreReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 1, report.Totals.Games)
+	assert.Len(t, report.Games, 1)
+	assert.Equal(t, uint64(1), report.Games[0].Entries[models.AllTime.Display])
+
+	assert.Equal(t, http.StatusOK, request("/debug/pprof/heap", "s3cret").Code)
+	assert.Equal(t, http.StatusOK, request("/debug/pprof/", "s3cret").Code)
+}
+
+func TestAPIKeyIDIsLogged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeys("ingest:s3cret")
+	assert.NoError(t, err)
+
+	var logged bytes.Buffer
+	var seen string
+	router := gin.New()
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{Formatter: api.AccessLogFormatter, Output: &logged}))
+	router.POST("/write", api.APIKeyMiddleware(keys), func(c *gin.Context) {
+		seen = api.APIKeyID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/write", nil)
+	req.Header.Set(api.APIKeyHeader, "s3cret")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "ingest", seen)
+	assert.Contains(t, logged.String(), "| key=ingest")
+}
+
+func TestSubmitScoreIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := store.NewStore(nil)
+	receipts, err := receipt.NewSigner("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	assert.NoError(t, err)
+	api.ConfigureRoutes(router, store, nil, nil, persistence.NewInMemoryStore(time.Minute), receipts, nil, nil, idempotency.NewStore(time.Hour), nil, api.TopLimits{})
+
+	submit := func(userID int64, score uint64, key string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"game_id": 1, "user_id": %d, "score": %d, "timestamp": "2025-01-01T00:00:00Z"}`, userID, score)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/leaderboard/score?receipt=true", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(api.IdempotencyKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Concurrent retries are handled once and all get the same receipt
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 16)
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = submit(1, 100, "retry-1")
+		}()
+	}
+	wg.Wait()
+
+	handled := 0
+	for _, w := range responses {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, responses[0].Body.String(), w.Body.String())
+		if w.Header().Get(api.IdempotentReplayedHeader) == "" {
+			handled++
+		}
+	}
+	assert.Equal(t, 1, handled)
+	assert.Contains(t, responses[0].Body.String(), "receipt")
+
+	// The same key from another player is a different submission
+	w := submit(2, 100, "retry-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(api.IdempotentReplayedHeader))
+
+	// Reusing a key for another score is refused
+	w = submit(1, 200, "retry-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Without a key nothing is replayed
+	w = submit(1, 100, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(api.IdempotentReplayedHeader))
+}
+
+// Cached top and rank responses are keyed by the board version, so every kind
+// of write must be visible on the very next read, well within the cache TTL.
+func TestCachedResponsesFollowWrites(t *testing.T) {
+	router, leaderboard := setupRouter()
+	now := time.Now().UTC()
+
+	top := func() models.TopLeadersResponse {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/leaderboard/top/1?limit=3", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.TopLeadersResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	rank := func(userID int64) (int, models.PlayerRankResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/leaderboard/rank/1/%d", userID), nil)
+		router.ServeHTTP(w, req)
+		var response models.PlayerRankResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	leaders := func() []int64 {
+		var ids []int64
+		for _, entry := range top().Leaders {
+			ids = append(ids, entry.UserID)
+		}
+		return ids
+	}
+
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 100, Timestamp: now})
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 2, Score: 200, Timestamp: now})
+	assert.Equal(t, []int64{2, 1}, leaders())
+	_, response := rank(1)
+	assert.Equal(t, uint64(2), response.Rank)
+
+	// A single submission
+	leaderboard.AddScore(models.Score{GameID: 1, UserID: 1, Score: 300, Timestamp: now})
+	assert.Equal(t, []int64{1, 2}, leaders())
+	_, response = rank(1)
+	assert.Equal(t, uint64(1), response.Rank)
+	assert.Equal(t, uint64(300), response.Score)
+
+	// A batch, as saved by the Kafka consumer
+	assert.NoError(t, leaderboard.SaveScoreBatch([]models.Score{{GameID: 1, UserID: 3, Score: 400, Timestamp: now}}))
+	assert.Equal(t, []int64{3, 1, 2}, leaders())
+	_, response = rank(1)
+	assert.Equal(t, uint64(2), response.Rank)
+
+	// Excluding and erasing players
+	assert.NoError(t, leaderboard.SetExcluded(1, 3, true))
+	assert.Equal(t, []int64{1, 2}, leaders())
+	_, err := leaderboard.EraseUser(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, leaders())
+	code, _ := rank(2)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Resetting the game
+	_, _, err = leaderboard.ResetGame(1, false)
+	assert.NoError(t, err)
+	assert.Empty(t, leaders())
+	code, _ = rank(1)
+	assert.Equal(t, http.StatusNotFound, code)
+}
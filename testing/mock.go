@@ -1,18 +1,135 @@
 package test
 
-import "github.com/IWhitebird/go-leader-board/internal/models"
+import (
+	"time"
+
+	"github.com/IWhitebird/go-leader-board/internal/models"
+	"github.com/IWhitebird/go-leader-board/internal/store"
+)
 
 // Mock PostgreSQL repository for testing
-type mockPgRepo struct{}
+type mockPgRepo struct {
+	games   []int64
+	scores  []models.Score // every submission, newest first
+	seasons []models.Season
+}
 
 func (m *mockPgRepo) SaveScore(score models.Score) error {
 	return nil
 }
 
-func (m *mockPgRepo) GetTopLeaders(gameID int64, limit int, window models.TimeWindow) ([]models.LeaderboardEntry, error) {
+func (m *mockPgRepo) GetTopLeaders(gameID int64, limit, offset int, window models.TimeWindow) ([]models.LeaderboardEntry, error) {
 	return nil, nil
 }
 
 func (m *mockPgRepo) GetPlayerRank(gameID, userID int64, window models.TimeWindow) (uint64, float64, uint64, uint64, error) {
 	return 0, 0, 0, 0, nil
 }
+
+func (m *mockPgRepo) SaveScoreBatch(scores []models.Score) error {
+	return nil
+}
+
+func (m *mockPgRepo) GetAllScores() ([]models.Score, error) {
+	return nil, nil
+}
+
+func (m *mockPgRepo) GetAllScoresForGame(gameID int64) ([]models.Score, error) {
+	return nil, nil
+}
+
+func (m *mockPgRepo) GetScoresForGameSince(gameID int64, since time.Time) ([]models.Score, error) {
+	return nil, nil
+}
+
+func (m *mockPgRepo) GetAllGames() ([]int64, error) {
+	return m.games, nil
+}
+
+func (m *mockPgRepo) GetScoresForUser(gameID, userID int64, limit int, before time.Time) ([]models.Score, error) {
+	scores := []models.Score{}
+	for _, score := range m.scores {
+		if score.GameID != gameID || score.UserID != userID {
+			continue
+		}
+		if !before.IsZero() && !score.Timestamp.Before(before) {
+			continue
+		}
+		if len(scores) == limit {
+			break
+		}
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+// submittedBefore builds the game's board from the scores received before the
+// instant, as the frozen Postgres queries do.
+func (m *mockPgRepo) submittedBefore(gameID int64, before time.Time) *store.GameLeaderboard {
+	board := store.NewGameLeaderboard()
+	for _, score := range m.scores {
+		received := score.ReceivedAt
+		if received.IsZero() {
+			received = score.Timestamp
+		}
+		if score.GameID == gameID && received.Before(before) {
+			board.AddScore(score.UserID, score.Score, score.Timestamp)
+		}
+	}
+	return board
+}
+
+func (m *mockPgRepo) GetTopLeadersSubmittedBefore(gameID int64, limit, offset int, window models.TimeWindow, before time.Time, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error) {
+	board := m.submittedBefore(gameID, before)
+	return board.GetRankedTopK(limit, offset, window, mode), board.TotalPlayers(window), nil
+}
+
+func (m *mockPgRepo) GetPlayerRankSubmittedBefore(gameID, userID int64, window models.TimeWindow, before time.Time, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	return standing(m.submittedBefore(gameID, before).GetPlayerRank(userID, window, mode))
+}
+
+// standing returns a board's player rank the way the Postgres rank queries do.
+func standing(rank store.PlayerRank) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	entry := models.LeaderboardEntry{UserID: rank.UserID, Score: rank.Score, Rank: rank.Rank, TiedWith: rank.TiedWith}
+	return entry, rank.Percentile, rank.Total, rank.Found, nil
+}
+
+func (m *mockPgRepo) GetSeasons(gameID int64) ([]models.Season, error) {
+	seasons := []models.Season{}
+	for _, season := range m.seasons {
+		if season.GameID == gameID {
+			seasons = append(seasons, season)
+		}
+	}
+	return seasons, nil
+}
+
+func (m *mockPgRepo) GetSeason(seasonID int64) (*models.Season, error) {
+	for _, season := range m.seasons {
+		if season.SeasonID == seasonID {
+			return &season, nil
+		}
+	}
+	return nil, nil
+}
+
+// season builds a season's board from the scores tagged with it, as the
+// Postgres season queries do.
+func (m *mockPgRepo) season(seasonID int64) *store.GameLeaderboard {
+	board := store.NewGameLeaderboard()
+	for _, score := range m.scores {
+		if score.SeasonID == seasonID {
+			board.AddScore(score.UserID, score.Score, score.Timestamp)
+		}
+	}
+	return board
+}
+
+func (m *mockPgRepo) GetSeasonTopLeaders(gameID, seasonID int64, limit, offset int, mode models.RankMode) ([]models.LeaderboardEntry, uint64, error) {
+	board := m.season(seasonID)
+	return board.GetRankedTopK(limit, offset, models.AllTime, mode), board.TotalPlayers(models.AllTime), nil
+}
+
+func (m *mockPgRepo) GetSeasonPlayerRank(gameID, seasonID, userID int64, mode models.RankMode) (models.LeaderboardEntry, float64, uint64, bool, error) {
+	return standing(m.season(seasonID).GetPlayerRank(userID, models.AllTime, mode))
+}